@@ -0,0 +1,97 @@
+package magnumrouter
+
+import (
+	"errors"
+	"fmt"
+)
+
+// Sends a control command, waiting for the server to acknowledge it when ack waiting is enabled
+// Quartz acknowledgements carry no identifier, so they are correlated to commands in the order sent
+// If an acknowledgement times out its waiter is dropped, so later acknowledgements match later commands
+func (m *MagnumRouter) sendControl(cmd func() error) error {
+	if m.opts.ackWait <= 0 {
+		return m.send(cmd)
+	}
+	m.writeMu.Lock()
+	if err := m.checkLinked(); err != nil {
+		m.writeMu.Unlock()
+		return err
+	}
+	ack := m.expectAck()
+	err := cmd()
+	m.writeMu.Unlock()
+	if err != nil {
+		m.dropAck(ack)
+		return err
+	}
+	return m.waitAck(ack)
+}
+
+// Queues a waiter for the next acknowledgement, must be called with writeMu held before sending
+func (m *MagnumRouter) expectAck() chan error {
+	ack := make(chan error, 1)
+	m.ackMu.Lock()
+	defer m.ackMu.Unlock()
+	m.ackQueue = append(m.ackQueue, ack)
+	return ack
+}
+
+// Waits for a queued acknowledgement until the ack wait timeout
+func (m *MagnumRouter) waitAck(ack chan error) error {
+	timeout := make(chan struct{})
+	timer := m.opts.clock.AfterFunc(m.opts.ackWait, func() {
+		close(timeout)
+	})
+	defer timer.Stop()
+	select {
+	case err := <-ack:
+		return err
+	case <-timeout:
+		m.dropAck(ack)
+		return fmt.Errorf("%w after %s", ErrAckTimeout, m.opts.ackWait)
+	}
+}
+
+func (m *MagnumRouter) dropAck(ack chan error) {
+	m.ackMu.Lock()
+	defer m.ackMu.Unlock()
+	for i, queued := range m.ackQueue {
+		if queued == ack {
+			m.ackQueue = append(m.ackQueue[:i], m.ackQueue[i+1:]...)
+			return
+		}
+	}
+}
+
+// Resolves the oldest waiting command with an acknowledgement (nil) or rejection
+// Queries are not queued, so an error answering a query sent before the command resolves it too, see WithAckWait()
+func (m *MagnumRouter) resolveAck(err error) {
+	m.ackMu.Lock()
+	defer m.ackMu.Unlock()
+	if len(m.ackQueue) == 0 {
+		return
+	}
+	m.ackQueue[0] <- err
+	m.ackQueue = m.ackQueue[1:]
+}
+
+// Re-queries the lock status and routes of a destination after the server rejected a command for it
+// A rejection most often means a lock the cache did not know about, so this brings the cache back in line
+// Only used with WithRefreshOnReject(), failures are logged as the rejection is what is returned
+func (m *MagnumRouter) refreshRejected(err error, destination uint, levels []uint) {
+	if !m.opts.refreshOnReject || !errors.Is(err, ErrCommandRejected) {
+		return
+	}
+	if err := m.send(func() error { return m.conn.GetDestinationLock(destination) }); err != nil {
+		m.opts.logger.Warn("magnum refresh after rejection failed", "destination", destination, "err", err)
+	}
+	for _, lvl := range levels {
+		quartzLevel, ok := idToQuartzLevel(lvl)
+		if !ok {
+			continue
+		}
+		if err := m.send(func() error { return m.conn.GetRoute(quartzLevel, destination) }); err != nil {
+			m.opts.logger.Warn("magnum refresh after rejection failed", "destination", destination, "level", lvl, "err", err)
+		}
+	}
+}
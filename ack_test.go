@@ -0,0 +1,88 @@
+package magnumrouter
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/cassaram/quartz"
+)
+
+func TestAckWaitReceived(t *testing.T) {
+	m, _ := newFakeRouter(t, 4, 4, 1, WithAckWait(time.Second))
+	if err := m.SetRoute([]uint{0}, 2, 3); err != nil {
+		t.Errorf("SetRoute() = %v, want acknowledged", err)
+	}
+	if err := m.SetLock(2, true); err != nil {
+		t.Errorf("SetLock() = %v, want acknowledged", err)
+	}
+}
+
+func TestAckWaitTimeout(t *testing.T) {
+	clock := newFakeClock()
+	m, conn := newScriptRouter(t, 4, 4, 1, WithAckWait(time.Second), WithClock(clock))
+	errs := make(chan error, 1)
+	go func() { errs <- m.SetRoute([]uint{0}, 2, 3) }()
+	awaitSent(t, conn, "route")
+	eventually(t, func() bool { return clock.pending() > 0 })
+	clock.Advance(time.Second)
+	if err := receiveErr(t, errs); !errors.Is(err, ErrAckTimeout) {
+		t.Fatalf("SetRoute() = %v, want ErrAckTimeout", err)
+	}
+
+	// The timed out waiter was dropped, so the next acknowledgement belongs to the next command
+	go func() { errs <- m.SetLock(2, true) }()
+	awaitSent(t, conn, "lock 2")
+	conn.inject(&quartz.ResponseAcknowledge{RawData: ".A\r"})
+	if err := receiveErr(t, errs); err != nil {
+		t.Errorf("SetLock() = %v, want acknowledged", err)
+	}
+}
+
+func TestAckWaitRejected(t *testing.T) {
+	m, conn := newScriptRouter(t, 4, 4, 1, WithAckWait(time.Second))
+	errs := make(chan error, 1)
+	go func() { errs <- m.SetRoute([]uint{0}, 2, 3) }()
+	awaitSent(t, conn, "route")
+	conn.inject(&quartz.ResponseError{RawData: ".E\r"})
+	if err := receiveErr(t, errs); !errors.Is(err, ErrCommandRejected) {
+		t.Errorf("SetRoute() = %v, want ErrCommandRejected", err)
+	}
+}
+
+func TestRejectedRouteRefreshesDestination(t *testing.T) {
+	m, conn := newScriptRouter(t, 4, 4, 1, WithAckWait(time.Second), WithRefreshOnReject(true))
+	conn.inject(update(2, 1))
+	eventually(t, func() bool { return m.GetRoute(0, 2) == 1 })
+
+	errs := make(chan error, 1)
+	go func() { errs <- m.SetRouteConfirmed(context.Background(), []uint{0}, 2, 3) }()
+	awaitSent(t, conn, "route")
+	conn.inject(&quartz.ResponseError{RawData: ".E\r"})
+	if err := receiveErr(t, errs); !errors.Is(err, ErrCommandRejected) {
+		t.Fatalf("SetRouteConfirmed() = %v, want ErrCommandRejected", err)
+	}
+	if got := m.GetRoute(0, 2); got != 1 {
+		t.Errorf("route after rejection = %d, want 1 as before", got)
+	}
+	awaitSent(t, conn, "get lock 2")
+	awaitSent(t, conn, "get route V 2")
+}
+
+func TestRejectedRouteNotRefreshedByDefault(t *testing.T) {
+	m, conn := newScriptRouter(t, 4, 4, 1, WithAckWait(time.Second))
+	errs := make(chan error, 1)
+	go func() { errs <- m.SetRoute([]uint{0}, 2, 3) }()
+	awaitSent(t, conn, "route")
+	conn.inject(&quartz.ResponseError{RawData: ".E\r"})
+	if err := receiveErr(t, errs); !errors.Is(err, ErrCommandRejected) {
+		t.Fatalf("SetRoute() = %v, want ErrCommandRejected", err)
+	}
+	for _, call := range conn.recorded() {
+		if strings.HasPrefix(call, "get") {
+			t.Errorf("sent %q after the rejection, want no refresh", call)
+		}
+	}
+}
@@ -0,0 +1,175 @@
+package magnumrouter
+
+import (
+	"context"
+	"strconv"
+	"sync/atomic"
+	"time"
+)
+
+// A record of a single route or lock attempt, passed to the WithAuditLog() function
+type AuditEntry struct {
+	Time time.Time
+	// Name of the operation, e.g. "SetRoute"
+	Op          string
+	Destination uint
+	// Source routed, unset for lock changes
+	Source uint
+	Levels []uint
+	// Source of each level read from the cache at the time of the attempt, unset for lock changes
+	// or when validation failed before the cache was read
+	PrevSources map[uint]uint
+	// Lock status set, unset for routes
+	Locked bool
+	// Nil if the command was sent, and acknowledged when ack waiting is enabled
+	Err error
+	// Who made the change, from ContextWithActor() or SetActor()
+	Actor string
+	// Identifies the operation, from ContextWithCorrelationID() or generated, shared by every entry of one operation
+	CorrelationID string
+}
+
+type actorKey struct{}
+
+type correlationKey struct{}
+
+// Counter for generated correlation IDs, unique within the process
+var correlationCounter atomic.Uint64
+
+// Returns a context carrying a correlation ID, recorded in audit entries, log lines and OpError
+// for operations given the context, so a change can be traced from the originating request
+// Operations without one generate their own
+func ContextWithCorrelationID(ctx context.Context, id string) context.Context {
+	return context.WithValue(ctx, correlationKey{}, id)
+}
+
+// Returns the correlation ID carried by a context, or an empty string if it has none
+func CorrelationID(ctx context.Context) string {
+	id, _ := ctx.Value(correlationKey{}).(string)
+	return id
+}
+
+// Returns the context with a generated correlation ID if it does not already carry one
+func (m *MagnumRouter) correlate(ctx context.Context) context.Context {
+	if CorrelationID(ctx) != "" {
+		return ctx
+	}
+	return ContextWithCorrelationID(ctx, "magnum-"+strconv.FormatUint(correlationCounter.Add(1), 10))
+}
+
+// Returns a context identifying who is making changes, recorded as the actor in audit entries
+// Takes precedence over the router wide actor from SetActor() for operations given the context
+func ContextWithActor(ctx context.Context, actor string) context.Context {
+	return context.WithValue(ctx, actorKey{}, actor)
+}
+
+// Sets the actor recorded in audit entries for operations without an actor in their context
+func (m *MagnumRouter) SetActor(actor string) {
+	m.auditMu.Lock()
+	defer m.auditMu.Unlock()
+	m.actor = actor
+}
+
+// Passes an entry to the audit log, filling the time and actor
+func (m *MagnumRouter) audit(ctx context.Context, entry AuditEntry) {
+	if m.opts.auditLog == nil {
+		return
+	}
+	entry.Time = m.opts.clock.Now()
+	entry.CorrelationID = CorrelationID(ctx)
+	if actor, ok := ctx.Value(actorKey{}).(string); ok {
+		entry.Actor = actor
+	} else {
+		m.auditMu.Lock()
+		entry.Actor = m.actor
+		m.auditMu.Unlock()
+	}
+	entry.Levels = append([]uint{}, entry.Levels...)
+	m.opts.auditLog(entry)
+}
+
+// Validates, sends and audits a route, returning the cached sources of its levels beforehand
+// check, if set, is given the previous sources before sending and can veto the route by returning an error
+func (m *MagnumRouter) setRoute(ctx context.Context, op string, levels []uint, destination uint, source uint, check func(prev map[uint]uint) error) (map[uint]uint, error) {
+	ctx = m.correlate(ctx)
+	entry := AuditEntry{Op: op, Destination: destination, Source: source, Levels: levels}
+	prev, err := func() (map[uint]uint, error) {
+		quartzLevels, err := m.prepareRoute(levels, destination, source)
+		if err != nil {
+			return nil, err
+		}
+		prev := m.cachedSources(levels, destination)
+		entry.PrevSources = prev
+		if check != nil {
+			if err := check(prev); err != nil {
+				return nil, err
+			}
+		}
+		err = m.sendControl(func() error {
+			return m.conn.SetCrosspoint(quartzLevels, destination, source)
+		})
+		if err != nil {
+			return nil, err
+		}
+		return prev, nil
+	}()
+	entry.Err = err
+	m.logCommand(ctx, op, destination, err)
+	m.audit(ctx, entry)
+	m.refreshRejected(err, destination, levels)
+	return prev, err
+}
+
+// Returns the cached source of each level of a validated destination
+func (m *MagnumRouter) cachedSources(levels []uint, destination uint) map[uint]uint {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	prev := make(map[uint]uint, len(levels))
+	for _, lvl := range levels {
+		prev[lvl] = m.routes.get(destination, lvl)
+	}
+	return prev
+}
+
+// Validates, sends and audits a lock change
+func (m *MagnumRouter) setLock(ctx context.Context, op string, destination uint, lock bool) error {
+	ctx = m.correlate(ctx)
+	err := func() error {
+		if err := m.checkControl(); err != nil {
+			return err
+		}
+		if err := m.checkDestination(destination); err != nil {
+			return err
+		}
+		return m.sendControl(func() error {
+			if lock {
+				return m.conn.LockDestination(destination)
+			} else {
+				return m.conn.UnlockDestination(destination)
+			}
+		})
+	}()
+	if err == nil {
+		m.mu.Lock()
+		if lock {
+			m.ownLocks[destination] = true
+		} else {
+			delete(m.ownLocks, destination)
+		}
+		m.mu.Unlock()
+	}
+	m.logCommand(ctx, op, destination, err)
+	m.audit(ctx, AuditEntry{Op: op, Destination: destination, Locked: lock, Err: err})
+	m.refreshRejected(err, destination, nil)
+	return err
+}
+
+// Logs the outcome of a control command with its correlation ID
+// Acknowledgements are matched to commands by order, so a rejection logged here is the device's response to this command
+func (m *MagnumRouter) logCommand(ctx context.Context, op string, destination uint, err error) {
+	if err != nil {
+		m.opts.logger.Warn("magnum command failed", "op", op, "destination", destination, "correlation_id", CorrelationID(ctx), "err", err)
+		return
+	}
+	m.opts.logger.Debug("magnum command sent", "op", op, "destination", destination, "correlation_id", CorrelationID(ctx))
+}
@@ -0,0 +1,152 @@
+package magnumrouter
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/cassaram/quartz"
+)
+
+type auditRecorder struct {
+	mu      sync.Mutex
+	entries []AuditEntry
+}
+
+func (r *auditRecorder) log(entry AuditEntry) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.entries = append(r.entries, entry)
+}
+
+func (r *auditRecorder) recorded() []AuditEntry {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return append([]AuditEntry{}, r.entries...)
+}
+
+func TestAuditEntryPerOperation(t *testing.T) {
+	clock := newFakeClock()
+	audit := &auditRecorder{}
+	m, _ := newScriptRouter(t, 4, 2, 2, WithClock(clock), WithAuditLog(audit.log))
+	m.processMessage(update(1, 2, quartz.QUARTZ_LVL_V))
+	m.SetActor("desk 1")
+
+	if err := m.SetRoute([]uint{0, 1}, 1, 3); err != nil {
+		t.Fatalf("SetRoute(): %v", err)
+	}
+	if err := m.SetRoute([]uint{0}, 1, 9); !errors.Is(err, ErrSourceOutOfRange) {
+		t.Fatalf("SetRoute() of source 9 = %v, want ErrSourceOutOfRange", err)
+	}
+	if err := m.SetLock(2, true); err != nil {
+		t.Fatalf("SetLock(): %v", err)
+	}
+	ctx := ContextWithActor(context.Background(), "automation")
+	if err := m.SetRoutes(ctx, []RouteOp{{Levels: []uint{1}, Destination: 2, Source: 4}}); err != nil {
+		t.Fatalf("SetRoutes(): %v", err)
+	}
+
+	entries := audit.recorded()
+	if len(entries) != 4 {
+		t.Fatalf("recorded %d audit entries, want 4: %+v", len(entries), entries)
+	}
+	for i, entry := range entries {
+		if !entry.Time.Equal(clock.Now()) {
+			t.Errorf("entry %d at %v, want %v", i, entry.Time, clock.Now())
+		}
+		if entry.CorrelationID == "" {
+			t.Errorf("entry %d has no correlation ID", i)
+		}
+		entries[i].Time, entries[i].CorrelationID = clock.Now(), ""
+	}
+	if !errors.Is(entries[1].Err, ErrSourceOutOfRange) {
+		t.Errorf("failed route entry error = %v, want ErrSourceOutOfRange", entries[1].Err)
+	}
+	entries[1].Err = nil
+	want := []AuditEntry{
+		{Time: clock.Now(), Op: "SetRoute", Destination: 1, Source: 3, Levels: []uint{0, 1}, PrevSources: map[uint]uint{0: 2, 1: SourceUnknown}, Actor: "desk 1"},
+		{Time: clock.Now(), Op: "SetRoute", Destination: 1, Source: 9, Levels: []uint{0}, Actor: "desk 1"},
+		{Time: clock.Now(), Op: "SetLock", Destination: 2, Levels: []uint{}, Locked: true, Actor: "desk 1"},
+		{Time: clock.Now(), Op: "SetRoutes", Destination: 2, Source: 4, Levels: []uint{1}, PrevSources: map[uint]uint{1: SourceUnknown}, Actor: "automation"},
+	}
+	if !reflect.DeepEqual(entries, want) {
+		t.Errorf("audit entries =\n%+v\nwant\n%+v", entries, want)
+	}
+}
+
+func TestAuditEntryOfUnsentRoute(t *testing.T) {
+	audit := &auditRecorder{}
+	m := NewMagnumRouterWithConn(newScriptConn(), 4, 2, 1, WithAuditLog(audit.log))
+	if err := m.SetRoute([]uint{0}, 1, 2); !errors.Is(err, ErrNotConnected) {
+		t.Fatalf("SetRoute() before connecting = %v, want ErrNotConnected", err)
+	}
+	entries := audit.recorded()
+	if len(entries) != 1 || !errors.Is(entries[0].Err, ErrNotConnected) {
+		t.Errorf("audit entries = %+v, want one with ErrNotConnected", entries)
+	}
+}
+
+func TestCorrelationIDFromContext(t *testing.T) {
+	audit := &auditRecorder{}
+	m, _ := newScriptRouter(t, 4, 4, 1, WithAuditLog(audit.log))
+	ctx := ContextWithCorrelationID(context.Background(), "req-42")
+	ops := []RouteOp{{Levels: []uint{0}, Destination: 1, Source: 2}, {Levels: []uint{0}, Destination: 2, Source: 3}}
+	if err := m.SetRoutes(ctx, ops); err != nil {
+		t.Fatalf("SetRoutes() = %v", err)
+	}
+	entries := audit.recorded()
+	if len(entries) != 2 {
+		t.Fatalf("%d entries, want 2", len(entries))
+	}
+	for i, entry := range entries {
+		if entry.CorrelationID != "req-42" {
+			t.Errorf("entry %d correlation ID %q, want req-42", i, entry.CorrelationID)
+		}
+	}
+}
+
+func TestCorrelationIDGenerated(t *testing.T) {
+	audit := &auditRecorder{}
+	m, _ := newScriptRouter(t, 4, 4, 1, WithAuditLog(audit.log))
+	for _, dest := range []uint{1, 2} {
+		if err := m.SetLock(dest, true); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := m.ReleaseMyLocks(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	entries := audit.recorded()
+	if len(entries) != 4 {
+		t.Fatalf("%d entries, want 4", len(entries))
+	}
+	// Each lock is its own operation, the two releases are one
+	ids := []string{entries[0].CorrelationID, entries[1].CorrelationID, entries[2].CorrelationID}
+	if ids[0] == "" || ids[0] == ids[1] || ids[1] == ids[2] || ids[0] == ids[2] {
+		t.Errorf("correlation IDs %q, want distinct generated IDs per operation", ids)
+	}
+	if entries[3].CorrelationID != entries[2].CorrelationID {
+		t.Errorf("release correlation IDs %q and %q, want one shared ID", entries[2].CorrelationID, entries[3].CorrelationID)
+	}
+}
+
+func TestCorrelationIDOnOpError(t *testing.T) {
+	audit := &auditRecorder{}
+	m, _ := newScriptRouter(t, 4, 4, 1, WithAuditLog(audit.log))
+	ctx, cancel := context.WithTimeout(ContextWithCorrelationID(context.Background(), "req-7"), 10*time.Millisecond)
+	defer cancel()
+	err := m.SetRouteConfirmed(ctx, []uint{0}, 1, 2)
+	var opErr *OpError
+	if !errors.As(err, &opErr) {
+		t.Fatalf("SetRouteConfirmed() = %v, want an OpError", err)
+	}
+	if opErr.CorrelationID != "req-7" {
+		t.Errorf("OpError correlation ID %q, want req-7", opErr.CorrelationID)
+	}
+	if entries := audit.recorded(); len(entries) != 1 || entries[0].CorrelationID != "req-7" {
+		t.Errorf("audit entries %+v, want one with correlation ID req-7", entries)
+	}
+}
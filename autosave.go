@@ -0,0 +1,39 @@
+package magnumrouter
+
+import (
+	"context"
+	"errors"
+	"time"
+)
+
+// Periodically captures the cached state with ExportState() and passes it to fn, e.g. to back it up to disk
+// Intervals where nothing changed since the last saved snapshot are skipped
+// A snapshot fn fails to save is logged, and offered again at the next interval
+// Runs in the background until the context is done
+func (m *MagnumRouter) StartAutosave(ctx context.Context, interval time.Duration, fn func(RouterSnapshot) error) error {
+	if interval <= 0 {
+		return errors.New("autosave interval must be positive")
+	}
+	go func() {
+		saved := false
+		var savedGeneration uint64
+		for sleep(ctx, m.opts.clock, interval) == nil {
+			m.mu.RLock()
+			generation := m.generation
+			if saved && generation == savedGeneration {
+				m.mu.RUnlock()
+				continue
+			}
+			snapshot := m.snapshotLocked()
+			m.mu.RUnlock()
+
+			if err := fn(snapshot); err != nil {
+				m.opts.logger.Warn("magnum autosave failed", "err", err)
+				continue
+			}
+			saved = true
+			savedGeneration = generation
+		}
+	}()
+	return nil
+}
@@ -0,0 +1,88 @@
+package magnumrouter
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+// Fires the pending autosave timer and waits for the autosave to sleep again
+func tickAutosave(t *testing.T, clock *fakeClock, interval time.Duration) {
+	t.Helper()
+	eventually(t, func() bool { return clock.pending() == 1 })
+	clock.Advance(interval)
+	eventually(t, func() bool { return clock.pending() == 1 })
+}
+
+func TestAutosaveSkipsUnchanged(t *testing.T) {
+	clock := newFakeClock()
+	m := NewMagnumRouterWithConn(NewFakeConn(4, 4), 4, 4, 1, WithClock(clock))
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	saves := make(chan RouterSnapshot, 8)
+	if err := m.StartAutosave(ctx, time.Minute, func(s RouterSnapshot) error {
+		saves <- s
+		return nil
+	}); err != nil {
+		t.Fatalf("StartAutosave(): %v", err)
+	}
+
+	tickAutosave(t, clock, time.Minute)
+	if len(saves) != 1 {
+		t.Fatalf("%d saves after the first interval, want 1", len(saves))
+	}
+	<-saves
+	tickAutosave(t, clock, time.Minute)
+	if len(saves) != 0 {
+		t.Fatalf("%d saves after an unchanged interval, want 0", len(saves))
+	}
+
+	m.processMessage(update(2, 3))
+	tickAutosave(t, clock, time.Minute)
+	if len(saves) != 1 {
+		t.Fatalf("%d saves after a route change, want 1", len(saves))
+	}
+	if got := (<-saves).Routes[2][0]; got != 3 {
+		t.Errorf("saved route of destination 2 = %d, want 3", got)
+	}
+
+	cancel()
+	eventually(t, func() bool { return clock.pending() == 0 })
+	m.processMessage(update(2, 4))
+	clock.Advance(time.Minute)
+	if len(saves) != 0 {
+		t.Errorf("%d saves after the context was cancelled, want 0", len(saves))
+	}
+}
+
+func TestAutosaveRetriesFailedSave(t *testing.T) {
+	clock := newFakeClock()
+	m := NewMagnumRouterWithConn(NewFakeConn(4, 4), 4, 4, 1, WithClock(clock))
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	attempts := 0
+	if err := m.StartAutosave(ctx, time.Minute, func(RouterSnapshot) error {
+		attempts++
+		if attempts == 1 {
+			return errors.New("disk full")
+		}
+		return nil
+	}); err != nil {
+		t.Fatalf("StartAutosave(): %v", err)
+	}
+	for i := 0; i < 3; i++ {
+		tickAutosave(t, clock, time.Minute)
+	}
+	// The first save failed, so the unchanged state is offered again once, then skipped
+	if attempts != 2 {
+		t.Errorf("fn called %d times, want 2", attempts)
+	}
+}
+
+func TestAutosaveRejectsInterval(t *testing.T) {
+	m := NewMagnumRouterWithConn(NewFakeConn(4, 4), 4, 4, 1)
+	if err := m.StartAutosave(context.Background(), 0, func(RouterSnapshot) error { return nil }); err == nil {
+		t.Error("StartAutosave() with a zero interval succeeded, want an error")
+	}
+}
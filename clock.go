@@ -0,0 +1,25 @@
+package magnumrouter
+
+import "time"
+
+// Clock abstracts time so timing behaviour can be driven by tests
+// Defaults to the system clock
+type Clock interface {
+	Now() time.Time
+	AfterFunc(d time.Duration, f func()) Timer
+}
+
+// Timer is a cancellable pending call created by Clock.AfterFunc
+type Timer interface {
+	Stop() bool
+}
+
+type systemClock struct{}
+
+func (systemClock) Now() time.Time {
+	return time.Now()
+}
+
+func (systemClock) AfterFunc(d time.Duration, f func()) Timer {
+	return time.AfterFunc(d, f)
+}
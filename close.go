@@ -0,0 +1,76 @@
+package magnumrouter
+
+import (
+	"errors"
+	"io"
+)
+
+var _ io.Closer = (*MagnumRouter)(nil)
+
+// Shuts the router down for good, disconnecting, stopping background work and closing every subscription channel
+// Background work covers the response handler, sync retries, salvo schedules and follows
+// The router is unusable afterwards, connecting and control operations return ErrClosed
+// Safe to call more than once, later calls return nil
+func (m *MagnumRouter) Close() error {
+	m.stateMu.Lock()
+	if m.closed {
+		m.stateMu.Unlock()
+		return nil
+	}
+	m.closed = true
+	m.stateMu.Unlock()
+
+	err := m.Disconnect()
+	if errors.Is(err, ErrNotConnected) {
+		err = nil
+	}
+	m.stopSyncRetry()
+	m.salvos.mu.Lock()
+	for name, sched := range m.salvos.schedules {
+		sched.timer.Stop()
+		delete(m.salvos.schedules, name)
+	}
+	m.salvos.mu.Unlock()
+
+	m.followMu.Lock()
+	m.follows = nil
+	if m.followStop != nil {
+		m.followStop()
+		m.followStop = nil
+	}
+	m.followMu.Unlock()
+
+	m.subMu.Lock()
+	m.subsClosed = true
+	for id, ch := range m.subscribers {
+		delete(m.subscribers, id)
+		close(ch)
+	}
+	for id, sub := range m.stateSubscribers {
+		delete(m.stateSubscribers, id)
+		close(sub.ch)
+	}
+	for id, sub := range m.throttled {
+		delete(m.throttled, id)
+		sub.stop()
+	}
+	m.subMu.Unlock()
+
+	m.handlerMu.Lock()
+	exited := m.handlerExited
+	m.handlerMu.Unlock()
+	if exited != nil {
+		<-exited
+	}
+	return err
+}
+
+// Returns ErrClosed once Close() has been called
+func (m *MagnumRouter) checkOpen() error {
+	m.stateMu.Lock()
+	defer m.stateMu.Unlock()
+	if m.closed {
+		return ErrClosed
+	}
+	return nil
+}
@@ -0,0 +1,51 @@
+package magnumrouter
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestCloseTwice(t *testing.T) {
+	m, _ := newScriptRouter(t, 4, 4, 1)
+	events, _ := m.Subscribe()
+	states, _ := m.SubscribeState()
+	if err := m.Close(); err != nil {
+		t.Fatalf("Close() = %v", err)
+	}
+	if err := m.Close(); err != nil {
+		t.Errorf("second Close() = %v, want nil", err)
+	}
+	for range events {
+	}
+	deadline := time.After(time.Second)
+	for open := true; open; {
+		select {
+		case _, open = <-states:
+		case <-deadline:
+			t.Fatal("state channel not closed by Close()")
+		}
+	}
+	if got := m.State(); got != StateDisconnected {
+		t.Errorf("State() = %v after Close(), want disconnected", got)
+	}
+}
+
+func TestUseAfterClose(t *testing.T) {
+	m, _ := newScriptRouter(t, 4, 4, 1)
+	m.Close()
+	ops := map[string]func() error{
+		"Connect":  m.Connect,
+		"SetRoute": func() error { return m.SetRoute([]uint{0}, 1, 2) },
+		"SetLock":  func() error { return m.SetLock(1, true) },
+	}
+	for name, op := range ops {
+		if err := op(); !errors.Is(err, ErrClosed) {
+			t.Errorf("%s() = %v after Close(), want ErrClosed", name, err)
+		}
+	}
+	events, _ := m.Subscribe()
+	if _, open := <-events; open {
+		t.Error("Subscribe() after Close() returned an open channel")
+	}
+}
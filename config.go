@@ -0,0 +1,109 @@
+package magnumrouter
+
+import (
+	"errors"
+	"fmt"
+	"time"
+)
+
+// Router configuration suitable for loading from JSON
+// Optional fields left at their zero value keep the option defaults
+type Config struct {
+	Address          string `json:"address"`
+	Port             uint16 `json:"port"`
+	SourceCount      uint   `json:"source_count"`
+	DestinationCount uint   `json:"destination_count"`
+	LevelCount       uint   `json:"level_count"`
+	// Names for levels by level ID, see WithLevelNames()
+	LevelNames []string `json:"level_names,omitempty"`
+	// Either "strict" or "best-effort", see WithSyncErrorPolicy()
+	SyncErrorPolicy string `json:"sync_error_policy,omitempty"`
+	// See WithSyncConcurrency()
+	SyncConcurrency int `json:"sync_concurrency,omitempty"`
+	// Duration string such as "500ms", see WithStateDebounce()
+	StateDebounce string `json:"state_debounce,omitempty"`
+	// See WithRouteHistory()
+	RouteHistoryDepth int `json:"route_history_depth,omitempty"`
+	// See WithSparseRouteTable()
+	SparseRouteTable bool `json:"sparse_route_table,omitempty"`
+	// See WithValidateEndpoints()
+	ValidateEndpoints bool `json:"validate_endpoints,omitempty"`
+	// See WithLevelNameQuery()
+	LevelNameQuery bool `json:"level_name_query,omitempty"`
+}
+
+// Returns a new magnum router instance built from a config
+// The config is validated first, and all problems found are returned together
+// Additional options are applied after those from the config
+func NewMagnumRouterFromConfig(cfg Config, opts ...Option) (*MagnumRouter, error) {
+	cfgOpts, err := cfg.options()
+	if err != nil {
+		return nil, err
+	}
+	return NewMagnumRouterWithOptions(cfg.Address, cfg.Port, cfg.SourceCount, cfg.DestinationCount, cfg.LevelCount, append(cfgOpts, opts...)...)
+}
+
+// Validates the config and converts it to options
+func (cfg Config) options() ([]Option, error) {
+	errs := []error{}
+	opts := []Option{}
+	if cfg.Address == "" {
+		errs = append(errs, errors.New("address is required"))
+	}
+	if cfg.Port == 0 {
+		errs = append(errs, errors.New("port is required"))
+	}
+	if cfg.SourceCount == 0 {
+		errs = append(errs, errors.New("source_count must be at least 1"))
+	}
+	if cfg.DestinationCount == 0 {
+		errs = append(errs, errors.New("destination_count must be at least 1"))
+	}
+	if cfg.LevelCount == 0 || cfg.LevelCount > maxLevels {
+		errs = append(errs, fmt.Errorf("level_count must be between 1 and %d, got %d", maxLevels, cfg.LevelCount))
+	}
+	if len(cfg.LevelNames) > int(cfg.LevelCount) {
+		errs = append(errs, fmt.Errorf("level_names has %d names but level_count is %d", len(cfg.LevelNames), cfg.LevelCount))
+	} else if len(cfg.LevelNames) > 0 {
+		opts = append(opts, WithLevelNames(cfg.LevelNames))
+	}
+	switch cfg.SyncErrorPolicy {
+	case "", "strict":
+	case "best-effort":
+		opts = append(opts, WithSyncErrorPolicy(SyncBestEffort))
+	default:
+		errs = append(errs, fmt.Errorf("sync_error_policy must be \"strict\" or \"best-effort\", got %q", cfg.SyncErrorPolicy))
+	}
+	if cfg.SyncConcurrency < 0 {
+		errs = append(errs, fmt.Errorf("sync_concurrency must not be negative, got %d", cfg.SyncConcurrency))
+	} else if cfg.SyncConcurrency > 0 {
+		opts = append(opts, WithSyncConcurrency(cfg.SyncConcurrency))
+	}
+	if cfg.StateDebounce != "" {
+		d, err := time.ParseDuration(cfg.StateDebounce)
+		if err != nil || d < 0 {
+			errs = append(errs, fmt.Errorf("state_debounce must be a non negative duration, got %q", cfg.StateDebounce))
+		} else {
+			opts = append(opts, WithStateDebounce(d))
+		}
+	}
+	if cfg.RouteHistoryDepth < 0 {
+		errs = append(errs, fmt.Errorf("route_history_depth must not be negative, got %d", cfg.RouteHistoryDepth))
+	} else if cfg.RouteHistoryDepth > 0 {
+		opts = append(opts, WithRouteHistory(cfg.RouteHistoryDepth))
+	}
+	if cfg.SparseRouteTable {
+		opts = append(opts, WithSparseRouteTable(true))
+	}
+	if cfg.ValidateEndpoints {
+		opts = append(opts, WithValidateEndpoints(true))
+	}
+	if cfg.LevelNameQuery {
+		opts = append(opts, WithLevelNameQuery(true))
+	}
+
+	if len(errs) > 0 {
+		return nil, fmt.Errorf("invalid config: %w", errors.Join(errs...))
+	}
+	return opts, nil
+}
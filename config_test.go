@@ -0,0 +1,76 @@
+package magnumrouter
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestRouterFromCompleteConfig(t *testing.T) {
+	var cfg Config
+	err := json.Unmarshal([]byte(`{
+		"address": "10.0.0.5",
+		"port": 6543,
+		"source_count": 16,
+		"destination_count": 8,
+		"level_count": 3,
+		"level_names": ["VIDEO", "AUDIO"],
+		"sync_error_policy": "best-effort",
+		"sync_concurrency": 4,
+		"state_debounce": "500ms",
+		"route_history_depth": 10,
+		"sparse_route_table": true,
+		"validate_endpoints": true,
+		"level_name_query": true
+	}`), &cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	m, err := NewMagnumRouterFromConfig(cfg)
+	if err != nil {
+		t.Fatalf("NewMagnumRouterFromConfig() = %v", err)
+	}
+	if got := m.ActiveEndpoint(); got != "10.0.0.5:6543" {
+		t.Errorf("ActiveEndpoint() = %q", got)
+	}
+	if src, dest, lvl := m.counts(); src != 16 || dest != 8 || lvl != 3 {
+		t.Errorf("counts = %d %d %d, want 16 8 3", src, dest, lvl)
+	}
+	if m.GetLevelName(1) != "AUDIO" || m.GetLevelName(2) != "B" {
+		t.Errorf("level names = %q %q, want AUDIO B", m.GetLevelName(1), m.GetLevelName(2))
+	}
+	o := m.opts
+	if o.syncErrorPolicy != SyncBestEffort || o.syncConcurrency != 4 || o.stateDebounce != 500*time.Millisecond ||
+		o.routeHistoryDepth != 10 || !o.sparseRouteTable || !o.validateEndpoints || !o.levelNameQuery {
+		t.Errorf("options not applied from the config: %+v", o)
+	}
+}
+
+func TestRouterFromMinimalConfig(t *testing.T) {
+	m, err := NewMagnumRouterFromConfig(Config{Address: "router", Port: 6543, SourceCount: 1, DestinationCount: 1, LevelCount: 1})
+	if err != nil {
+		t.Fatalf("NewMagnumRouterFromConfig() = %v", err)
+	}
+	o := m.opts
+	if o.syncErrorPolicy != SyncStrict || o.stateDebounce != 0 || o.routeHistoryDepth != 0 || o.sparseRouteTable {
+		t.Errorf("minimal config changed option defaults: %+v", o)
+	}
+}
+
+func TestRouterFromInvalidConfig(t *testing.T) {
+	_, err := NewMagnumRouterFromConfig(Config{
+		LevelCount:      2,
+		LevelNames:      []string{"V", "A", "B"},
+		SyncErrorPolicy: "lenient",
+		StateDebounce:   "soon",
+	})
+	if err == nil {
+		t.Fatal("NewMagnumRouterFromConfig() accepted an invalid config")
+	}
+	for _, want := range []string{"address", "port", "source_count", "destination_count", "level_names", "sync_error_policy", "state_debounce"} {
+		if !strings.Contains(err.Error(), want) {
+			t.Errorf("error %q does not report %s", err, want)
+		}
+	}
+}
@@ -0,0 +1,72 @@
+package magnumrouter
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/cassaram/quartz"
+)
+
+// The subset of the quartz connection used by the router
+// Implemented for quartz.Quartz by NewQuartzConn(), and can be implemented by mocks for testing
+// Quartz always dials its own TCP connection, use NewNetConn() or NewMagnumRouterWithNetConn() for other transports
+// With WithSyncConcurrency() above 1, queries are sent from several goroutines at once
+type QuartzConn interface {
+	Connect() error
+	Disconnect() error
+	GetSourceName(src uint) error
+	GetDestinationName(dest uint) error
+	GetDestinationLock(dest uint) error
+	GetRoute(level quartz.QuartzLevel, dest uint) error
+	SetCrosspoint(levels []quartz.QuartzLevel, dest uint, src uint) error
+	LockDestination(dest uint) error
+	UnlockDestination(dest uint) error
+	// Returns the channel of messages received from the server
+	// Called after each Connect, closing the channel signals the connection was lost
+	RxMessages() <-chan quartz.QuartzResponse
+}
+
+// Adapts a quartz.Quartz to the QuartzConn interface
+type quartzConn struct {
+	*quartz.Quartz
+}
+
+// Returns a QuartzConn backed by a quartz connection
+func NewQuartzConn(q *quartz.Quartz) QuartzConn {
+	return quartzConn{Quartz: q}
+}
+
+func (c quartzConn) RxMessages() <-chan quartz.QuartzResponse {
+	return c.Quartz.RxMessages
+}
+
+func (c quartzConn) WriteSourceName(src uint, name string) error {
+	return nameWriteError(c.Quartz.WriteSourceName(src, name))
+}
+
+func (c quartzConn) WriteDestinationName(dest uint, name string) error {
+	return nameWriteError(c.Quartz.WriteDestinationName(dest, name))
+}
+
+// Quartz refuses name writes in magnum mode with an untyped error, so it is recognised by its text
+func nameWriteError(err error) error {
+	if err != nil && strings.Contains(err.Error(), "not supported by magnum") {
+		return fmt.Errorf("%w: %w", ErrNameWriteUnsupported, err)
+	}
+	return err
+}
+
+// Implemented by connections able to query the names of a contiguous range of endpoints in one command
+// The device must answer with one name response per endpoint, as for single queries
+// Quartz has no range query, so the magnum connection does not implement this and syncs query names one at a time
+type NameRangeQuerier interface {
+	GetSourceNameRange(start uint, end uint) error
+	GetDestinationNameRange(start uint, end uint) error
+}
+
+// Implemented by connections able to report the size of the device
+// Quartz has no size query, so the magnum connection does not implement this
+type DeviceSizeQuerier interface {
+	DeviceSize(ctx context.Context) (sources uint, destinations uint, levels uint, err error)
+}
@@ -0,0 +1,29 @@
+package magnumrouter
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/cassaram/quartz"
+)
+
+// Checked at compile time, as the router depends on nothing else
+var (
+	_ QuartzConn = quartzConn{}
+	_ QuartzConn = (*FakeConn)(nil)
+	_ QuartzConn = (*scriptConn)(nil)
+)
+
+func TestQuartzConnNameWriteUnsupported(t *testing.T) {
+	conn := NewQuartzConn(quartz.NewQuartz("127.0.0.1", 1, true)).(NameWriter)
+	if err := conn.WriteSourceName(1, "CAM 1"); !errors.Is(err, ErrNameWriteUnsupported) {
+		t.Errorf("WriteSourceName() = %v, want ErrNameWriteUnsupported in magnum mode", err)
+	}
+	if err := nameWriteError(nil); err != nil {
+		t.Errorf("nameWriteError(nil) = %v", err)
+	}
+	other := errors.New("broken pipe")
+	if err := nameWriteError(other); !errors.Is(err, other) || errors.Is(err, ErrNameWriteUnsupported) {
+		t.Errorf("nameWriteError() = %v, want the error unchanged", err)
+	}
+}
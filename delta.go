@@ -0,0 +1,150 @@
+package magnumrouter
+
+// The differences between two snapshots, for shipping frequent snapshots without resending whole tables
+// Encodes with encoding/json using the tags below, or with encoding/gob for a binary form
+type SnapshotDelta struct {
+	// The whole new snapshot, set instead of the changes when the snapshots differ in shape
+	Full *RouterSnapshot `json:"full,omitempty"`
+	// Changed entries, keyed by ID
+	SourceNames      map[uint]string `json:"source_names,omitempty"`
+	DestinationNames map[uint]string `json:"destination_names,omitempty"`
+	DestinationLocks map[uint]bool   `json:"destination_locks,omitempty"`
+	LevelNames       map[uint]string `json:"level_names,omitempty"`
+	Routes           []DeltaRoute    `json:"routes,omitempty"`
+	// Whole tag sets, set only when they changed
+	SourceTags      *map[uint]map[string]string `json:"source_tags,omitempty"`
+	DestinationTags *map[uint]map[string]string `json:"destination_tags,omitempty"`
+}
+
+// A crosspoint changed within a SnapshotDelta
+type DeltaRoute struct {
+	Destination uint `json:"destination"`
+	Level       uint `json:"level"`
+	Source      uint `json:"source"`
+}
+
+// Returns the changes that turn base into next
+// Applying the result to base with ApplyDelta() reproduces next exactly
+func DeltaSnapshot(base RouterSnapshot, next RouterSnapshot) SnapshotDelta {
+	if !sameShape(base, next) {
+		full := copySnapshot(next)
+		return SnapshotDelta{Full: &full}
+	}
+	d := SnapshotDelta{
+		SourceNames:      changed(base.SourceNames, next.SourceNames),
+		DestinationNames: changed(base.DestinationNames, next.DestinationNames),
+		DestinationLocks: changed(base.DestinationLocks, next.DestinationLocks),
+		LevelNames:       changed(base.LevelNames, next.LevelNames),
+	}
+	if !tagsEqual(base.SourceTags, next.SourceTags) {
+		tags := copyAllTags(next.SourceTags)
+		d.SourceTags = &tags
+	}
+	if !tagsEqual(base.DestinationTags, next.DestinationTags) {
+		tags := copyAllTags(next.DestinationTags)
+		d.DestinationTags = &tags
+	}
+	for dest := range next.Routes {
+		for lvl := range next.Routes[dest] {
+			if base.Routes[dest][lvl] != next.Routes[dest][lvl] {
+				d.Routes = append(d.Routes, DeltaRoute{Destination: uint(dest), Level: uint(lvl), Source: next.Routes[dest][lvl]})
+			}
+		}
+	}
+	return d
+}
+
+// Returns base with a delta from DeltaSnapshot() applied, leaving base unmodified
+// Changes outside the tables of base are ignored
+func ApplyDelta(base RouterSnapshot, d SnapshotDelta) RouterSnapshot {
+	if d.Full != nil {
+		return copySnapshot(*d.Full)
+	}
+	s := copySnapshot(base)
+	apply(s.SourceNames, d.SourceNames)
+	apply(s.DestinationNames, d.DestinationNames)
+	apply(s.DestinationLocks, d.DestinationLocks)
+	apply(s.LevelNames, d.LevelNames)
+	if d.SourceTags != nil {
+		s.SourceTags = copyAllTags(*d.SourceTags)
+	}
+	if d.DestinationTags != nil {
+		s.DestinationTags = copyAllTags(*d.DestinationTags)
+	}
+	for _, r := range d.Routes {
+		if r.Destination < uint(len(s.Routes)) && r.Level < uint(len(s.Routes[r.Destination])) {
+			s.Routes[r.Destination][r.Level] = r.Source
+		}
+	}
+	return s
+}
+
+func sameShape(a RouterSnapshot, b RouterSnapshot) bool {
+	if len(a.SourceNames) != len(b.SourceNames) || len(a.DestinationNames) != len(b.DestinationNames) ||
+		len(a.DestinationLocks) != len(b.DestinationLocks) || len(a.LevelNames) != len(b.LevelNames) || len(a.Routes) != len(b.Routes) {
+		return false
+	}
+	for dest := range a.Routes {
+		if len(a.Routes[dest]) != len(b.Routes[dest]) {
+			return false
+		}
+	}
+	return true
+}
+
+func copySnapshot(s RouterSnapshot) RouterSnapshot {
+	routes := make([][]uint, len(s.Routes))
+	for i := range s.Routes {
+		routes[i] = append([]uint{}, s.Routes[i]...)
+	}
+	return RouterSnapshot{
+		SchemaVersion:    s.SchemaVersion,
+		SourceNames:      append([]string{}, s.SourceNames...),
+		DestinationNames: append([]string{}, s.DestinationNames...),
+		DestinationLocks: append([]bool{}, s.DestinationLocks...),
+		Routes:           routes,
+		LevelNames:       append([]string{}, s.LevelNames...),
+		SourceTags:       copyAllTags(s.SourceTags),
+		DestinationTags:  copyAllTags(s.DestinationTags),
+	}
+}
+
+func tagsEqual(a map[uint]map[string]string, b map[uint]map[string]string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for id, tagsA := range a {
+		tagsB, ok := b[id]
+		if !ok || len(tagsA) != len(tagsB) {
+			return false
+		}
+		for k, v := range tagsA {
+			if w, ok := tagsB[k]; !ok || v != w {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// Returns the entries of next that differ from base, or nil if none do
+func changed[T comparable](base []T, next []T) map[uint]T {
+	var diff map[uint]T
+	for i := range next {
+		if base[i] != next[i] {
+			if diff == nil {
+				diff = map[uint]T{}
+			}
+			diff[uint(i)] = next[i]
+		}
+	}
+	return diff
+}
+
+func apply[T any](s []T, changes map[uint]T) {
+	for i, v := range changes {
+		if i < uint(len(s)) {
+			s[i] = v
+		}
+	}
+}
@@ -0,0 +1,98 @@
+package magnumrouter
+
+import (
+	"bytes"
+	"encoding/gob"
+	"encoding/json"
+	"reflect"
+	"testing"
+
+	"github.com/cassaram/quartz"
+)
+
+// Returns a snapshot before and after changing a route, names, a lock and tags
+func deltaSnapshots(t *testing.T) (RouterSnapshot, RouterSnapshot) {
+	t.Helper()
+	m := NewMagnumRouterWithConn(NewFakeConn(4, 4), 4, 4, 2)
+	m.processMessage(update(1, 2, quartz.QUARTZ_LVL_V, quartz.QUARTZ_LVL_A))
+	m.processMessage(&quartz.ResponseReadSource{Source: 1, Name: "CAM 1"})
+	base := m.ExportState()
+
+	m.processMessage(update(1, 3, quartz.QUARTZ_LVL_A))
+	m.processMessage(&quartz.ResponseReadSource{Source: 1, Name: "CAM 1 WIDE"})
+	m.processMessage(&quartz.ResponseReadDestination{Destination: 4, Name: "MON 4"})
+	m.processMessage(&quartz.ResponseLockStatus{Destination: 2, Locked: true})
+	if err := m.SetSourceTags(3, map[string]string{"studio": "A"}); err != nil {
+		t.Fatalf("SetSourceTags(): %v", err)
+	}
+	return base, m.ExportState()
+}
+
+func TestDeltaRoundTrip(t *testing.T) {
+	base, next := deltaSnapshots(t)
+	d := DeltaSnapshot(base, next)
+	if d.Full != nil {
+		t.Fatal("delta of snapshots of the same shape carries the full snapshot")
+	}
+	want := SnapshotDelta{
+		SourceNames:      map[uint]string{1: "CAM 1 WIDE"},
+		DestinationNames: map[uint]string{4: "MON 4"},
+		DestinationLocks: map[uint]bool{2: true},
+		Routes:           []DeltaRoute{{Destination: 1, Level: 1, Source: 3}},
+		SourceTags:       &map[uint]map[string]string{3: {"studio": "A"}},
+	}
+	if !reflect.DeepEqual(d, want) {
+		t.Errorf("DeltaSnapshot() = %+v, want %+v", d, want)
+	}
+	if got := ApplyDelta(base, d); !reflect.DeepEqual(got, next) {
+		t.Errorf("ApplyDelta() = %+v, want %+v", got, next)
+	}
+	if got := ApplyDelta(base, DeltaSnapshot(base, base)); !reflect.DeepEqual(got, base) {
+		t.Errorf("ApplyDelta() of an empty delta = %+v, want the base", got)
+	}
+}
+
+func TestDeltaEncodings(t *testing.T) {
+	base, next := deltaSnapshots(t)
+	d := DeltaSnapshot(base, next)
+
+	data, err := json.Marshal(d)
+	if err != nil {
+		t.Fatalf("json.Marshal(): %v", err)
+	}
+	var fromJSON SnapshotDelta
+	if err := json.Unmarshal(data, &fromJSON); err != nil {
+		t.Fatalf("json.Unmarshal(): %v", err)
+	}
+	if got := ApplyDelta(base, fromJSON); !reflect.DeepEqual(got, next) {
+		t.Errorf("ApplyDelta() of a JSON delta = %+v, want %+v", got, next)
+	}
+
+	var buf bytes.Buffer
+	if err := gob.NewEncoder(&buf).Encode(d); err != nil {
+		t.Fatalf("gob encode: %v", err)
+	}
+	var fromGob SnapshotDelta
+	if err := gob.NewDecoder(&buf).Decode(&fromGob); err != nil {
+		t.Fatalf("gob decode: %v", err)
+	}
+	if got := ApplyDelta(base, fromGob); !reflect.DeepEqual(got, next) {
+		t.Errorf("ApplyDelta() of a gob delta = %+v, want %+v", got, next)
+	}
+}
+
+func TestDeltaOfResizedSnapshotIsFull(t *testing.T) {
+	m := NewMagnumRouterWithConn(NewFakeConn(4, 4), 4, 4, 2)
+	base := m.ExportState()
+	if err := m.Resize(4, 6, 2, false); err != nil {
+		t.Fatalf("Resize(): %v", err)
+	}
+	next := m.ExportState()
+	d := DeltaSnapshot(base, next)
+	if d.Full == nil {
+		t.Fatal("delta across a resize does not carry the full snapshot")
+	}
+	if got := ApplyDelta(base, d); !reflect.DeepEqual(got, next) {
+		t.Errorf("ApplyDelta() = %+v, want %+v", got, next)
+	}
+}
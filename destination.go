@@ -0,0 +1,77 @@
+package magnumrouter
+
+// The cached state of a destination composed for rendering, as returned by MagnumRouter.DestinationState()
+type DestinationState struct {
+	ID     uint
+	Name   string
+	Locked bool
+	// Always SignalUnknown over quartz, see MagnumRouter.DestinationSignal()
+	Signal SignalPresence
+	Levels []LevelState
+}
+
+// Whether a destination output carries signal, as reported by the device
+type SignalPresence int
+
+const (
+	// The device does not report signal presence, as with magnum over quartz
+	SignalUnknown SignalPresence = iota
+	SignalPresent
+	SignalAbsent
+)
+
+func (s SignalPresence) String() string {
+	switch s {
+	case SignalUnknown:
+		return "unknown"
+	case SignalPresent:
+		return "present"
+	case SignalAbsent:
+		return "absent"
+	}
+	return "invalid"
+}
+
+// Returns the output signal presence of a destination
+// The quartz protocol has no response reporting signal presence, so this is SignalUnknown for every destination
+// and EventSignalChange is never published, letting callers code against it for devices that may report it
+func (m *MagnumRouter) DestinationSignal(destination uint) SignalPresence {
+	return SignalUnknown
+}
+
+// Returns whether a destination output has signal, treating unknown presence as present
+// Always true over quartz, see DestinationSignal()
+func (m *MagnumRouter) DestinationHasSignal(destination uint) bool {
+	return m.DestinationSignal(destination) != SignalAbsent
+}
+
+// The cached route of one level of a destination
+type LevelState struct {
+	Level     uint
+	LevelName string
+	// SourceUnknown with an empty name where the route is not known
+	Source     uint
+	SourceName string
+}
+
+// Returns the name, lock and routes of a destination read together under one lock, so they are consistent
+// Levels are in level ID order, and an out of range destination returns only its ID
+func (m *MagnumRouter) DestinationState(destination uint) DestinationState {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	state := DestinationState{ID: destination}
+	if m.checkDestinationLocked(destination) != nil {
+		return state
+	}
+	state.Name = m.destinationNames[destination]
+	state.Locked = m.destinationLocks[destination]
+	state.Levels = make([]LevelState, m.levelCount)
+	for lvl := uint(0); lvl < m.levelCount; lvl++ {
+		src := m.routes.get(destination, lvl)
+		state.Levels[lvl] = LevelState{Level: lvl, LevelName: m.levelNameLocked(lvl), Source: src}
+		if src != SourceUnknown && src < uint(len(m.sourceNames)) {
+			state.Levels[lvl].SourceName = m.sourceNames[src]
+		}
+	}
+	return state
+}
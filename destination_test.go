@@ -0,0 +1,88 @@
+package magnumrouter
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/cassaram/quartz"
+)
+
+func TestDestinationStateFull(t *testing.T) {
+	m := NewMagnumRouterWithConn(NewFakeConn(3, 2), 3, 2, 2, WithLevelNames([]string{"VIDEO", "AUDIO"}))
+	m.processMessage(&quartz.ResponseReadDestination{Destination: 1, Name: "MON 1"})
+	m.processMessage(&quartz.ResponseReadSource{Source: 2, Name: "CAM 2"})
+	m.processMessage(&quartz.ResponseReadSource{Source: 3, Name: "CAM 3"})
+	m.processMessage(&quartz.ResponseLockStatus{Destination: 1, Locked: true})
+	m.processMessage(update(1, 2, quartz.QUARTZ_LVL_V))
+	m.processMessage(update(1, 3, quartz.QuartzLevel("A")))
+	want := DestinationState{
+		ID:     1,
+		Name:   "MON 1",
+		Locked: true,
+		Levels: []LevelState{
+			{Level: 0, LevelName: "VIDEO", Source: 2, SourceName: "CAM 2"},
+			{Level: 1, LevelName: "AUDIO", Source: 3, SourceName: "CAM 3"},
+		},
+	}
+	if got := m.DestinationState(1); !reflect.DeepEqual(got, want) {
+		t.Errorf("DestinationState(1) = %+v, want %+v", got, want)
+	}
+}
+
+func TestDestinationStateSparse(t *testing.T) {
+	m := NewMagnumRouterWithConn(NewFakeConn(3, 2), 3, 2, 2)
+	// Routed to a source with no known name, and unknown on audio
+	m.processMessage(update(2, 3, quartz.QUARTZ_LVL_V))
+	want := DestinationState{
+		ID: 2,
+		Levels: []LevelState{
+			{Level: 0, LevelName: "V", Source: 3},
+			{Level: 1, LevelName: "A", Source: SourceUnknown},
+		},
+	}
+	if got := m.DestinationState(2); !reflect.DeepEqual(got, want) {
+		t.Errorf("DestinationState(2) = %+v, want %+v", got, want)
+	}
+	if got := m.DestinationState(3); !reflect.DeepEqual(got, DestinationState{ID: 3}) {
+		t.Errorf("DestinationState(3) = %+v, want only the ID", got)
+	}
+}
+
+func TestDestinationSignalDegradesToUnknown(t *testing.T) {
+	m, _ := newFakeRouter(t, 2, 2, 1)
+	for dest := uint(1); dest <= 2; dest++ {
+		if got := m.DestinationSignal(dest); got != SignalUnknown {
+			t.Errorf("DestinationSignal(%d) = %v, want unknown", dest, got)
+		}
+		if !m.DestinationHasSignal(dest) {
+			t.Errorf("DestinationHasSignal(%d) = false, want true", dest)
+		}
+		if got := m.DestinationState(dest).Signal; got != SignalUnknown {
+			t.Errorf("DestinationState(%d).Signal = %v, want unknown", dest, got)
+		}
+	}
+}
+
+func TestResponsesNeverChangeSignal(t *testing.T) {
+	m := NewMagnumRouterWithConn(NewFakeConn(2, 2), 2, 2, 1)
+	defer m.Close()
+	events, unsubscribe := m.Subscribe()
+	defer unsubscribe()
+	for _, msg := range []quartz.QuartzResponse{
+		update(1, 2),
+		&quartz.ResponseLockStatus{Destination: 1, Locked: true},
+		&quartz.ResponseReadDestination{Destination: 1, Name: "MON 1"},
+		&quartz.ResponseError{RawData: ".E\r"},
+		&quartz.ResponsePowerOn{RawData: ".P\r"},
+	} {
+		m.processMessage(msg)
+	}
+	for len(events) > 0 {
+		if ev := <-events; ev.Type == EventSignalChange {
+			t.Errorf("signal event %+v published over quartz", ev)
+		}
+	}
+	if got := m.DestinationSignal(1); got != SignalUnknown {
+		t.Errorf("DestinationSignal(1) = %v, want unknown", got)
+	}
+}
@@ -0,0 +1,104 @@
+package magnumrouter
+
+import (
+	"context"
+	"errors"
+	"fmt"
+)
+
+var (
+	// Returned when an operation needs a connection to the magnum server but there is none
+	ErrNotConnected = errors.New("magnumrouter: not connected")
+	// Returned by Connect when the router is already connected or connecting
+	ErrAlreadyConnected = errors.New("magnumrouter: already connected")
+	// Returned when a destination ID is outside the configured destination count
+	ErrDestinationOutOfRange = errors.New("magnumrouter: destination out of range")
+	// Returned when a source ID is outside the configured source count
+	ErrSourceOutOfRange = errors.New("magnumrouter: source out of range")
+	// Returned when a level ID is outside the configured level count
+	ErrLevelOutOfRange = errors.New("magnumrouter: level out of range")
+	// Returned when an operation is refused because the destination is locked
+	ErrDestinationLocked = errors.New("magnumrouter: destination locked")
+	// Returned when a control operation is attempted on a router that only permits reads
+	ErrReadOnly = errors.New("magnumrouter: router is read only")
+	// Returned when a lookup by name matches no source or destination
+	ErrNameNotFound = errors.New("magnumrouter: name not found")
+	// Returned when endpoint validation is enabled and a source or destination has no known name
+	ErrEndpointNotConfigured = errors.New("magnumrouter: endpoint not configured")
+	// Returned when a pattern matches endpoints that cannot be paired unambiguously
+	ErrAmbiguousMatch = errors.New("magnumrouter: ambiguous match")
+	// Returned by lookups by name when several endpoints share the name, with DuplicateNameError
+	ErrAmbiguousName = errors.New("magnumrouter: ambiguous name")
+	// Returned when a route was not confirmed by the server in time
+	ErrRouteNotConfirmed = errors.New("magnumrouter: route not confirmed")
+	// Returned when the server reports a different source than the one requested
+	ErrRouteMismatch = errors.New("magnumrouter: route mismatch")
+	// Returned when a source is not on the whitelist of the destination it is routed to
+	ErrSourceNotAllowed = errors.New("magnumrouter: source not allowed")
+	// Returned when ack waiting is enabled and the server does not acknowledge a command in time
+	ErrAckTimeout = errors.New("magnumrouter: command not acknowledged")
+	// Returned when the server responds to a command with an error
+	ErrCommandRejected = errors.New("magnumrouter: command rejected")
+	// Returned by cache dependent operations called while a sync is rewriting the cache
+	ErrResyncInProgress = errors.New("magnumrouter: resync in progress")
+	// Returned when following a destination would make a destination follow itself
+	ErrFollowCycle = errors.New("magnumrouter: follow cycle")
+	// Returned when a sync left cache entries unknown that it should have filled
+	ErrIncompleteSync = errors.New("magnumrouter: incomplete sync")
+	// Returned when a conditional operation finds the cache changed from the expected state
+	ErrConcurrentModification = errors.New("magnumrouter: concurrent modification")
+	// Returned by operations on a router after Close()
+	ErrClosed = errors.New("magnumrouter: router closed")
+	// Returned by Connect when Disconnect is called before it finishes
+	ErrConnectAborted = errors.New("magnumrouter: connect aborted")
+	// Returned by NewMagnumRouterWithOptions() when the options are invalid, wrapping every problem found
+	ErrInvalidOptions = errors.New("magnumrouter: invalid options")
+	// Returned when no salvo has the given name
+	ErrSalvoNotFound = errors.New("magnumrouter: salvo not found")
+	// Returned when a RouterGroup has no frame with the given name
+	ErrFrameNotFound = errors.New("magnumrouter: frame not found")
+	// Returned when tracing a signal through tie lines returns to a destination already visited
+	ErrTieLineCycle = errors.New("magnumrouter: tie line cycle")
+	// Returned when the device cannot write endpoint names, as with magnum
+	ErrNameWriteUnsupported = errors.New("magnumrouter: name writes not supported")
+	// Returned when a written name was not reported back by the device in time
+	ErrNameNotConfirmed = errors.New("magnumrouter: name not confirmed")
+	// Returned when the connection does not support an optional query or command
+	ErrNotSupported = errors.New("magnumrouter: not supported by connection")
+	// Published in an EventError when the server reports a source, destination or level outside the configured counts
+	ErrResponseOutOfRange = errors.New("magnumrouter: response out of range")
+	// Published in an EventError when processing a message from the server panics
+	ErrMessagePanic = errors.New("magnumrouter: panic processing message")
+)
+
+// Error returned by operations that wait on the server, identifying the operation that failed
+// Unwraps to the underlying cause, so errors.Is works against sentinels and context errors
+type OpError struct {
+	// Name of the operation, e.g. "SetRouteConfirmed"
+	Op          string
+	Destination uint
+	// Correlation ID of the operation, matching its audit entries and log lines
+	CorrelationID string
+	Err           error
+}
+
+func (e *OpError) Error() string {
+	return fmt.Sprintf("magnumrouter: %s destination %d: %v", e.Op, e.Destination, e.Err)
+}
+
+func (e *OpError) Unwrap() error {
+	return e.Err
+}
+
+// Returns whether the operation failed because its deadline passed, meaning the device was slow rather than rejecting it
+func (e *OpError) Timeout() bool {
+	return errors.Is(e.Err, context.DeadlineExceeded)
+}
+
+// Wraps an error in an OpError with the correlation ID of the context, passing nil through
+func opError(ctx context.Context, op string, destination uint, err error) error {
+	if err == nil {
+		return nil
+	}
+	return &OpError{Op: op, Destination: destination, CorrelationID: CorrelationID(ctx), Err: err}
+}
@@ -0,0 +1,111 @@
+package magnumrouter
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/cassaram/quartz"
+)
+
+func TestSentinelErrors(t *testing.T) {
+	m, _ := newScriptRouter(t, 4, 4, 2)
+	unconnected := NewMagnumRouterWithConn(newScriptConn(), 4, 4, 2)
+	tests := []struct {
+		name string
+		err  error
+		want error
+	}{
+		{"not connected", unconnected.SetRoute([]uint{0}, 1, 1), ErrNotConnected},
+		{"already connected", m.Connect(), ErrAlreadyConnected},
+		{"destination out of range", m.SetRoute([]uint{0}, 5, 1), ErrDestinationOutOfRange},
+		{"source out of range", m.SetRoute([]uint{0}, 1, 5), ErrSourceOutOfRange},
+		{"level out of range", m.SetRoute([]uint{2}, 1, 1), ErrLevelOutOfRange},
+		{"lock out of range", m.SetLock(5, true), ErrDestinationOutOfRange},
+	}
+	for _, tt := range tests {
+		if !errors.Is(tt.err, tt.want) {
+			t.Errorf("%s: got %v, want %v", tt.name, tt.err, tt.want)
+		}
+	}
+}
+
+func TestSetRouteIfUnlockedLocked(t *testing.T) {
+	m, conn := newScriptRouter(t, 4, 4, 1)
+	m.processMessage(&quartz.ResponseLockStatus{Destination: 2, Locked: true})
+	err := m.SetRouteIfUnlocked(context.Background(), []uint{0}, 2, 1)
+	if !errors.Is(err, ErrDestinationLocked) {
+		t.Fatalf("SetRouteIfUnlocked() on a locked destination = %v, want ErrDestinationLocked", err)
+	}
+	for _, call := range conn.recorded() {
+		if strings.HasPrefix(call, "route") {
+			t.Errorf("sent %q to a locked destination", call)
+		}
+	}
+}
+
+// A scriptConn accepting name writes but never reporting names back
+type silentNameConn struct {
+	*scriptConn
+}
+
+func (c silentNameConn) WriteSourceName(src uint, name string) error {
+	return c.record("write source %d %s", src, name)
+}
+
+func (c silentNameConn) WriteDestinationName(dest uint, name string) error {
+	return c.record("write destination %d %s", dest, name)
+}
+
+func TestNameNotConfirmed(t *testing.T) {
+	conn := silentNameConn{newScriptConn()}
+	m := NewMagnumRouterWithConn(conn, 4, 4, 1, WithNoInitialSync())
+	defer m.Close()
+	if err := m.Connect(); err != nil {
+		t.Fatalf("Connect() = %v", err)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	err := m.SetSourceName(ctx, 1, "CAM 1")
+	if !errors.Is(err, ErrNameNotConfirmed) || !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("SetSourceName() = %v, want ErrNameNotConfirmed with the deadline", err)
+	}
+	if got := m.GetSourceName(1); got == "CAM 1" {
+		t.Error("name cached without the device reporting it")
+	}
+}
+
+func TestOpErrorTimeout(t *testing.T) {
+	m, _ := newScriptRouter(t, 4, 4, 1)
+	ops := map[string]func(ctx context.Context) error{
+		"WaitForRoute": func(ctx context.Context) error {
+			return m.WaitForRoute(ctx, 0, 1, 2)
+		},
+		"SetRouteConfirmed": func(ctx context.Context) error {
+			return m.SetRouteConfirmed(ctx, []uint{0}, 1, 2)
+		},
+		"SetLockAndWait": func(ctx context.Context) error {
+			return m.SetLockAndWait(ctx, 1, true)
+		},
+	}
+	for name, op := range ops {
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+		err := op(ctx)
+		cancel()
+		if !errors.Is(err, context.DeadlineExceeded) {
+			t.Errorf("%s: %v does not match context.DeadlineExceeded", name, err)
+		}
+		var opErr *OpError
+		if !errors.As(err, &opErr) || opErr.Op != name || opErr.Destination != 1 || !opErr.Timeout() {
+			t.Errorf("%s: %v is not a timed out OpError for the operation", name, err)
+		}
+	}
+
+	// A rejection is not a timeout
+	rejected := &OpError{Op: "SetRouteConfirmed", Err: ErrCommandRejected}
+	if rejected.Timeout() {
+		t.Error("Timeout() = true for a rejection")
+	}
+}
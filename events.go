@@ -0,0 +1,165 @@
+package magnumrouter
+
+import "context"
+
+// Type of change described by an Event
+type EventType int
+
+const (
+	// A crosspoint changed source, Destination, Level and Source are set
+	EventRouteChange EventType = iota
+	// A destination lock changed, Destination and Locked are set
+	EventLockChange
+	// A source name changed, Source and Name are set
+	EventSourceNameChange
+	// A destination name changed, Destination and Name are set
+	EventDestinationNameChange
+	// Processing a message from the server failed, such as for an out of range ID, Err is set
+	EventError
+	// Many crosspoints changed at once without individual route events, consumers should reload the route table
+	EventBulkChange
+	// Output signal presence of a destination changed, Destination and Signal are set
+	// Never published over quartz, which has no response reporting signal presence
+	EventSignalChange
+	// A level name reported by the device changed, Level and Name are set
+	EventLevelNameChange
+)
+
+// A change to the cached router state
+type Event struct {
+	Type        EventType
+	Destination uint
+	Level       uint
+	Source      uint
+	Locked      bool
+	Name        string
+	Signal      SignalPresence
+	Err         error
+	// Set for events re-emitting the current state from Republish() rather than reporting a change
+	Resync bool
+	// Set with WithEmitInitialSync() for the first report of a value after connecting, whether or not it changed
+	Initial bool
+	// Increases by one for every event published, so a gap means events were dropped for this subscriber
+	// Numbering continues across reconnects, call Republish() to recover after a gap
+	Seq uint64
+}
+
+// Number of events buffered per subscriber before further events are dropped
+const subscriberBuffer = 256
+
+// Returns a channel receiving every change to the cached state, and a function to unsubscribe
+// Events are only sent when a cached value actually changes, apart from the initial values with WithEmitInitialSync()
+// Events are dropped for a subscriber whose buffer is full, so receivers should not block for long
+// Unsubscribing closes the channel, as does Close(), and after Close() the channel is returned already closed
+func (m *MagnumRouter) Subscribe() (<-chan Event, func()) {
+	ch := make(chan Event, subscriberBuffer)
+	m.subMu.Lock()
+	if m.subsClosed {
+		m.subMu.Unlock()
+		close(ch)
+		return ch, func() {}
+	}
+	id := m.nextSubID
+	m.nextSubID++
+	m.subscribers[id] = ch
+	m.subMu.Unlock()
+
+	unsubscribe := func() {
+		m.subMu.Lock()
+		defer m.subMu.Unlock()
+		if _, ok := m.subscribers[id]; ok {
+			delete(m.subscribers, id)
+			close(ch)
+		}
+	}
+	return ch, unsubscribe
+}
+
+// Returns a channel receiving events as per Subscribe(), which is unsubscribed and closed once the context is done
+// No goroutine is held while waiting for the context, so nothing leaks if it is never done
+func (m *MagnumRouter) SubscribeContext(ctx context.Context) <-chan Event {
+	events, unsubscribe := m.Subscribe()
+	context.AfterFunc(ctx, unsubscribe)
+	return events
+}
+
+// Runs fn with mu held, then dispatches the events it built once mu is released, returning them
+// User code such as subscribers, hooks, resolvers and loggers must only be called without mu held, so that it can
+// reenter the router, for example calling GetRoute() from a handler, without deadlocking
+// Changes to the cache therefore build their events under mu and publish them through here
+func (m *MagnumRouter) update(fn func() []Event) []Event {
+	events := func() []Event {
+		m.mu.Lock()
+		defer m.mu.Unlock()
+		return fn()
+	}()
+	m.dispatch(events)
+	return events
+}
+
+// Sends events to all subscribers, must be called without mu held
+// Events are numbered here rather than where they are built, as events built on different goroutines
+// are dispatched after mu is released, and numbering in delivery order keeps Seq increasing for every subscriber
+func (m *MagnumRouter) dispatch(events []Event) {
+	if len(events) == 0 {
+		return
+	}
+	m.subMu.Lock()
+	defer m.subMu.Unlock()
+	for i := range events {
+		m.eventSeq++
+		events[i].Seq = m.eventSeq
+	}
+	for _, ch := range m.subscribers {
+		for _, ev := range events {
+			select {
+			case ch <- ev:
+			default:
+			}
+		}
+	}
+	for _, sub := range m.throttled {
+		for _, ev := range events {
+			sub.add(ev)
+		}
+	}
+}
+
+// Sends the whole cached state to all subscribers as events marked Resync
+// Emits a name event for every endpoint, a lock event for every destination and a route event for every crosspoint
+// Lets consumers that missed earlier events re-prime themselves, though a subscriber whose buffer
+// fills during the burst drops the remainder as usual
+func (m *MagnumRouter) Republish() {
+	m.mu.RLock()
+	events := []Event{}
+	for src := m.base(); src < uint(len(m.sourceNames)); src++ {
+		events = append(events, Event{Type: EventSourceNameChange, Source: src, Name: m.sourceNames[src], Resync: true})
+	}
+	for dest := m.base(); dest < uint(len(m.destinationNames)); dest++ {
+		events = append(events, Event{Type: EventDestinationNameChange, Destination: dest, Name: m.destinationNames[dest], Resync: true})
+		events = append(events, Event{Type: EventLockChange, Destination: dest, Locked: m.destinationLocks[dest], Resync: true})
+		for lvl := uint(0); lvl < m.levelCount; lvl++ {
+			events = append(events, Event{Type: EventRouteChange, Destination: dest, Level: lvl, Source: m.routes.get(dest, lvl), Resync: true})
+		}
+	}
+	m.mu.RUnlock()
+	m.dispatch(events)
+}
+
+// Calls cb whenever a crosspoint of one destination changes, until the returned function is called
+// Multiple watchers may watch the same destination, and each is called
+// Callbacks run on a goroutine per watcher, in the order changes occur
+func (m *MagnumRouter) WatchDestination(destination uint, cb func(level uint, source uint)) (func(), error) {
+	if err := m.checkDestination(destination); err != nil {
+		return nil, err
+	}
+	events, unsubscribe := m.Subscribe()
+	go func() {
+		for ev := range events {
+			if ev.Type == EventRouteChange && ev.Destination == destination {
+				cb(ev.Level, ev.Source)
+			}
+		}
+	}()
+	return unsubscribe, nil
+}
@@ -0,0 +1,287 @@
+package magnumrouter
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/cassaram/quartz"
+)
+
+type watched struct {
+	level  uint
+	source uint
+}
+
+func watch(t *testing.T, m *MagnumRouter, dest uint) (<-chan watched, func()) {
+	t.Helper()
+	calls := make(chan watched, 16)
+	unwatch, err := m.WatchDestination(dest, func(level uint, source uint) {
+		calls <- watched{level, source}
+	})
+	if err != nil {
+		t.Fatalf("WatchDestination(%d): %v", dest, err)
+	}
+	return calls, unwatch
+}
+
+func expectWatched(t *testing.T, calls <-chan watched, want watched) {
+	t.Helper()
+	select {
+	case got := <-calls:
+		if got != want {
+			t.Errorf("watcher called with %+v, want %+v", got, want)
+		}
+	case <-time.After(time.Second):
+		t.Fatalf("watcher not called, want %+v", want)
+	}
+}
+
+func expectNotWatched(t *testing.T, calls <-chan watched) {
+	t.Helper()
+	select {
+	case got := <-calls:
+		t.Errorf("watcher called with %+v, want no call", got)
+	case <-time.After(50 * time.Millisecond):
+	}
+}
+
+func TestWatchDestination(t *testing.T) {
+	m := NewMagnumRouterWithConn(NewFakeConn(3, 2), 3, 2, 1)
+	first, unwatchFirst := watch(t, m, 2)
+	second, unwatchSecond := watch(t, m, 2)
+	defer unwatchSecond()
+	other, unwatchOther := watch(t, m, 1)
+	defer unwatchOther()
+
+	m.processMessage(update(2, 3))
+	expectWatched(t, first, watched{0, 3})
+	expectWatched(t, second, watched{0, 3})
+	expectNotWatched(t, other)
+
+	unwatchFirst()
+	m.processMessage(update(2, 1))
+	expectWatched(t, second, watched{0, 1})
+	expectNotWatched(t, first)
+}
+
+func TestWatchDestinationOutOfRange(t *testing.T) {
+	m := NewMagnumRouterWithConn(NewFakeConn(3, 2), 3, 2, 1)
+	if _, err := m.WatchDestination(3, func(uint, uint) {}); !errors.Is(err, ErrDestinationOutOfRange) {
+		t.Errorf("WatchDestination(3) = %v, want ErrDestinationOutOfRange", err)
+	}
+}
+
+func TestRepublish(t *testing.T) {
+	m := NewMagnumRouterWithConn(NewFakeConn(3, 4), 3, 4, 2)
+	m.processMessage(update(2, 3))
+	m.processMessage(&quartz.ResponseLockStatus{Destination: 4, Locked: true})
+	events, unsubscribe := m.Subscribe()
+	defer unsubscribe()
+	m.Republish()
+
+	counts := map[EventType]int{}
+	for len(events) > 0 {
+		ev := <-events
+		if !ev.Resync {
+			t.Errorf("event %+v not marked Resync", ev)
+		}
+		counts[ev.Type]++
+		if ev.Type == EventRouteChange && ev.Destination == 2 && ev.Level == 0 && ev.Source != 3 {
+			t.Errorf("route event of destination 2 = %+v, want source 3", ev)
+		}
+		if ev.Type == EventLockChange && ev.Locked != (ev.Destination == 4) {
+			t.Errorf("lock event %+v, want only destination 4 locked", ev)
+		}
+	}
+	want := map[EventType]int{
+		EventSourceNameChange:      3,
+		EventDestinationNameChange: 4,
+		EventLockChange:            4,
+		EventRouteChange:           8,
+	}
+	if !reflect.DeepEqual(counts, want) {
+		t.Errorf("event counts = %v, want %v", counts, want)
+	}
+}
+
+func TestEmitInitialSync(t *testing.T) {
+	m := NewMagnumRouterWithConn(NewFakeConn(2, 3), 2, 3, 1, WithEmitInitialSync(true))
+	// Already cached, so announced only because it is learned for the first time
+	m.processMessage(update(1, 0))
+	m.resetLearned()
+	events, unsubscribe := m.Subscribe()
+	defer unsubscribe()
+	if err := m.Connect(); err != nil {
+		t.Fatalf("Connect() = %v", err)
+	}
+	defer m.Close()
+	want := map[EventType]int{
+		EventSourceNameChange:      2,
+		EventDestinationNameChange: 3,
+		EventLockChange:            3,
+		EventRouteChange:           3,
+	}
+	counts := map[EventType]int{}
+	for total := 0; total < 11; total++ {
+		select {
+		case ev := <-events:
+			if !ev.Initial {
+				t.Errorf("event %+v not marked Initial", ev)
+			}
+			counts[ev.Type]++
+		case <-time.After(time.Second):
+			t.Fatalf("event counts = %v, want %v", counts, want)
+		}
+	}
+	if !reflect.DeepEqual(counts, want) {
+		t.Errorf("event counts = %v, want %v", counts, want)
+	}
+
+	// Learned values are no longer reported unless they change
+	m.processMessage(update(2, 0))
+	m.processMessage(update(3, 1))
+	select {
+	case ev := <-events:
+		if ev.Initial || ev.Destination != 3 {
+			t.Errorf("event %+v, want only the change of destination 3", ev)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("no event for a changed route")
+	}
+}
+
+func TestEventSeqMonotonic(t *testing.T) {
+	m := NewMagnumRouterWithConn(NewFakeConn(3, 3), 3, 3, 2)
+	first, unsubscribeFirst := m.Subscribe()
+	defer unsubscribeFirst()
+	m.processMessage(update(1, 2))
+	// Joins late, so it sees a later part of the same numbering
+	second, unsubscribeSecond := m.Subscribe()
+	defer unsubscribeSecond()
+	m.processMessage(&quartz.ResponseLockStatus{Destination: 2, Locked: true})
+	m.processMessage(&quartz.ResponseReadSource{Source: 3, Name: "CAM 3"})
+	m.processMessage(malformedResponse{})
+	m.processMessage(update(3, 1, quartz.QUARTZ_LVL_V, quartz.QuartzLevel("A")))
+	m.Republish()
+
+	check := func(name string, events <-chan Event, want int) uint64 {
+		var last uint64
+		types := map[EventType]bool{}
+		count := 0
+		for len(events) > 0 {
+			ev := <-events
+			if last != 0 && ev.Seq != last+1 {
+				t.Errorf("%s: event %+v follows Seq %d, want %d", name, ev, last, last+1)
+			}
+			last = ev.Seq
+			types[ev.Type] = true
+			count++
+		}
+		if count != want {
+			t.Errorf("%s: received %d events, want %d", name, count, want)
+		}
+		if len(types) < 4 {
+			t.Errorf("%s: received event types %v, want a mix", name, types)
+		}
+		return last
+	}
+	// Republish() emits 3 source names and 3 times a destination name, a lock and 2 routes
+	const republished = 3 + 3*4
+	lastFirst := check("first", first, 1+1+1+1+2+republished)
+	lastSecond := check("second", second, 1+1+1+2+republished)
+	if lastFirst != lastSecond {
+		t.Errorf("subscribers end on Seq %d and %d, want the same", lastFirst, lastSecond)
+	}
+}
+
+func TestSubscribeContext(t *testing.T) {
+	m := NewMagnumRouterWithConn(NewFakeConn(3, 2), 3, 2, 1)
+	ctx, cancel := context.WithCancel(context.Background())
+	events := m.SubscribeContext(ctx)
+	m.processMessage(update(1, 2))
+	select {
+	case ev := <-events:
+		if ev.Type != EventRouteChange || ev.Destination != 1 || ev.Source != 2 {
+			t.Errorf("got %+v, want the route change", ev)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("no event before cancelling")
+	}
+
+	cancel()
+	select {
+	case _, ok := <-events:
+		if ok {
+			t.Error("received an event after cancelling, want the channel closed")
+		}
+	case <-time.After(time.Second):
+		t.Fatal("channel not closed after cancelling")
+	}
+	m.subMu.Lock()
+	subscribers := len(m.subscribers)
+	m.subMu.Unlock()
+	if subscribers != 0 {
+		t.Errorf("%d subscribers left after cancelling, want 0", subscribers)
+	}
+}
+
+// A log handler reading the router on every record, as a handler adding router state to logs might
+type reenteringHandler struct {
+	m *MagnumRouter
+}
+
+func (h reenteringHandler) Enabled(context.Context, slog.Level) bool { return true }
+
+func (h reenteringHandler) Handle(context.Context, slog.Record) error {
+	if m := h.m; m != nil {
+		m.GetRoute(0, 1)
+		m.ExportState()
+	}
+	return nil
+}
+
+func (h reenteringHandler) WithAttrs([]slog.Attr) slog.Handler { return h }
+
+func (h reenteringHandler) WithGroup(string) slog.Handler { return h }
+
+func TestCallbacksMayReenter(t *testing.T) {
+	var m *MagnumRouter
+	handler := &reenteringHandler{}
+	audit := func(AuditEntry) { m.GetRoute(0, 1) }
+	hook := func(quartz.QuartzResponse) { m.GetSourceName(1) }
+	states := func(ConnectionState) { m.DestinationState(1) }
+	resolver := func(NameKind, uint) (string, bool) { return m.GetDestinationName(1), true }
+	m = NewMagnumRouterWithConn(NewFakeConn(3, 3), 3, 3, 1,
+		WithLogger(slog.New(handler)), WithAuditLog(audit), WithRawMessageHook(hook),
+		WithStateHandler(states), WithNameResolver(resolver))
+	handler.m = m
+	defer m.Close()
+	calls, unwatch := watch(t, m, 1)
+	defer unwatch()
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		if err := m.Connect(); err != nil {
+			t.Errorf("connect: %v", err)
+			return
+		}
+		if err := m.SetRoute([]uint{0}, 1, 2); err != nil {
+			t.Errorf("SetRoute() = %v", err)
+		}
+		// Logged as out of range, through the reentering handler
+		m.processMessage(update(9, 1))
+		m.ImportState(m.ExportState())
+		m.SourceDisplayName(3)
+	}()
+	select {
+	case <-done:
+	case <-time.After(2 * time.Second):
+		t.Fatal("deadlocked calling back into the router")
+	}
+	expectWatched(t, calls, watched{0, 2})
+}
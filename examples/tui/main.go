@@ -0,0 +1,139 @@
+// A minimal terminal front-end for a magnum router
+// Renders the route grid and redraws it live from the event stream
+//
+// Commands (followed by enter):
+//
+//	r <dest> <src> [level...]  route a source to a destination, on all levels if none given
+//	l <dest>                   toggle the lock on a destination
+//	q                          quit
+//
+// Run with -fake to use a simulated router instead of hardware
+package main
+
+import (
+	"bufio"
+	"context"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/cassaram/magnumrouter"
+)
+
+func main() {
+	address := flag.String("address", "127.0.0.1", "router address")
+	port := flag.Uint("port", 6543, "router port")
+	sources := flag.Uint("sources", 8, "number of sources")
+	destinations := flag.Uint("destinations", 8, "number of destinations")
+	levels := flag.Uint("levels", 2, "number of levels")
+	fake := flag.Bool("fake", false, "use a simulated router")
+	flag.Parse()
+
+	var router *magnumrouter.MagnumRouter
+	if *fake {
+		router = magnumrouter.NewMagnumRouterWithConn(magnumrouter.NewFakeConn(*sources, *destinations), *sources, *destinations, *levels)
+	} else {
+		router = magnumrouter.NewMagnumRouter(*address, uint16(*port), *sources, *destinations, *levels)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	err := router.ConnectContext(ctx)
+	cancel()
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer router.Disconnect()
+
+	events, unsubscribe := router.Subscribe()
+	defer unsubscribe()
+
+	var status string
+	var statusMu sync.Mutex
+	setStatus := func(s string) {
+		statusMu.Lock()
+		status = s
+		statusMu.Unlock()
+	}
+	redraw := func() {
+		statusMu.Lock()
+		defer statusMu.Unlock()
+		render(router, status)
+	}
+
+	go func() {
+		for range events {
+			redraw()
+		}
+	}()
+
+	redraw()
+	scanner := bufio.NewScanner(os.Stdin)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) == 0 {
+			redraw()
+			continue
+		}
+		if fields[0] == "q" {
+			return
+		}
+		if err := command(router, *levels, fields); err != nil {
+			setStatus(err.Error())
+		} else {
+			setStatus("")
+		}
+		redraw()
+	}
+}
+
+// Executes a single parsed command line
+func command(router *magnumrouter.MagnumRouter, levelCount uint, fields []string) error {
+	args := make([]uint, 0, len(fields)-1)
+	for _, field := range fields[1:] {
+		v, err := strconv.ParseUint(field, 10, 0)
+		if err != nil {
+			return fmt.Errorf("invalid number %q", field)
+		}
+		args = append(args, uint(v))
+	}
+
+	switch fields[0] {
+	case "r":
+		if len(args) < 2 {
+			return fmt.Errorf("usage: r <dest> <src> [level...]")
+		}
+		levels := args[2:]
+		if len(levels) == 0 {
+			for i := uint(0); i < levelCount; i++ {
+				levels = append(levels, i)
+			}
+		}
+		return router.SetRoute(levels, args[0], args[1])
+	case "l":
+		if len(args) != 1 {
+			return fmt.Errorf("usage: l <dest>")
+		}
+		// DestinationState is bounds checked, leaving SetLock to reject an unknown destination
+		return router.SetLock(args[0], !router.DestinationState(args[0]).Locked)
+	}
+	return fmt.Errorf("unknown command %q", fields[0])
+}
+
+// Clears the terminal and draws the route grid with a status line
+func render(router *magnumrouter.MagnumRouter, status string) {
+	fmt.Print("\033[H\033[2J")
+	fmt.Printf("magnum router - %s\n\n", router.State())
+	if err := router.WriteRouteTableText(os.Stdout, magnumrouter.TextOpts{Label: magnumrouter.TextLabelBoth}); err != nil {
+		fmt.Println("render:", err)
+	}
+	fmt.Println()
+	if status != "" {
+		fmt.Println("error:", status)
+	}
+	fmt.Print("r <dest> <src> [level...] | l <dest> | q > ")
+}
@@ -0,0 +1,170 @@
+package magnumrouter
+
+import (
+	"fmt"
+	"net"
+	"strconv"
+	"sync"
+
+	"github.com/cassaram/quartz"
+)
+
+const defaultFailoverAttempts = 3
+
+// Connection switching between a primary and a backup endpoint, installed by WithBackupAddress() or WithBackupConn()
+// Only switched by MagnumRouter.ConnectRetry() between attempts, while the router is disconnected
+type failoverConn struct {
+	mu     sync.Mutex
+	conns  [2]QuartzConn
+	backup string
+	active int
+	// Connection last dialed, so a late Disconnect reaches it even after a switch
+	dialed QuartzConn
+}
+
+func (c *failoverConn) current() QuartzConn {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.conns[c.active]
+}
+
+// Makes the endpoint at index i active, returning whether it changed
+func (c *failoverConn) use(i int) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.active == i {
+		return false
+	}
+	c.active = i
+	return true
+}
+
+func (c *failoverConn) activeIndex() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.active
+}
+
+func (c *failoverConn) Connect() error {
+	c.mu.Lock()
+	conn := c.conns[c.active]
+	c.dialed = conn
+	c.mu.Unlock()
+	return conn.Connect()
+}
+
+func (c *failoverConn) Disconnect() error {
+	c.mu.Lock()
+	conn := c.dialed
+	c.mu.Unlock()
+	if conn == nil {
+		conn = c.current()
+	}
+	return conn.Disconnect()
+}
+
+func (c *failoverConn) GetSourceName(src uint) error {
+	return c.current().GetSourceName(src)
+}
+
+func (c *failoverConn) GetDestinationName(dest uint) error {
+	return c.current().GetDestinationName(dest)
+}
+
+func (c *failoverConn) GetDestinationLock(dest uint) error {
+	return c.current().GetDestinationLock(dest)
+}
+
+func (c *failoverConn) GetRoute(level quartz.QuartzLevel, dest uint) error {
+	return c.current().GetRoute(level, dest)
+}
+
+func (c *failoverConn) SetCrosspoint(levels []quartz.QuartzLevel, dest uint, src uint) error {
+	return c.current().SetCrosspoint(levels, dest, src)
+}
+
+func (c *failoverConn) LockDestination(dest uint) error {
+	return c.current().LockDestination(dest)
+}
+
+func (c *failoverConn) UnlockDestination(dest uint) error {
+	return c.current().UnlockDestination(dest)
+}
+
+func (c *failoverConn) RxMessages() <-chan quartz.QuartzResponse {
+	return c.current().RxMessages()
+}
+
+func (c *failoverConn) GetLevelName(level quartz.QuartzLevel) error {
+	querier, ok := c.current().(LevelNameQuerier)
+	if !ok {
+		return fmt.Errorf("%w: level name query", ErrNotSupported)
+	}
+	return querier.GetLevelName(level)
+}
+
+func (c *failoverConn) WriteSourceName(src uint, name string) error {
+	writer, ok := c.current().(NameWriter)
+	if !ok {
+		return ErrNameWriteUnsupported
+	}
+	return writer.WriteSourceName(src, name)
+}
+
+func (c *failoverConn) WriteDestinationName(dest uint, name string) error {
+	writer, ok := c.current().(NameWriter)
+	if !ok {
+		return ErrNameWriteUnsupported
+	}
+	return writer.WriteDestinationName(dest, name)
+}
+
+// Wraps the primary connection with the backup configured by WithBackupAddress() or WithBackupConn(), if any
+func (m *MagnumRouter) installFailover() {
+	switch {
+	case m.opts.backupConn != nil:
+		m.failover = &failoverConn{conns: [2]QuartzConn{m.conn, m.opts.backupConn}, backup: m.opts.backupEndpoint}
+	case m.opts.backupAddress != "":
+		m.failover = &failoverConn{
+			conns:  [2]QuartzConn{m.conn, NewQuartzConn(quartz.NewQuartz(m.opts.backupAddress, m.opts.backupPort, true))},
+			backup: net.JoinHostPort(m.opts.backupAddress, strconv.Itoa(int(m.opts.backupPort))),
+		}
+	default:
+		return
+	}
+	m.conn = m.failover
+}
+
+// Returns the address and port of the endpoint the router connects to, as "host:port"
+// Only differs from the primary address once failed over to the backup set by WithBackupAddress() or WithBackupConn()
+// Returns an empty string for a router constructed with NewMagnumRouterWithConn() while on its connection
+func (m *MagnumRouter) ActiveEndpoint() string {
+	if m.failover != nil && m.failover.activeIndex() == 1 {
+		return m.failover.backup
+	}
+	if m.address == "" {
+		return ""
+	}
+	return net.JoinHostPort(m.address, strconv.Itoa(int(m.port)))
+}
+
+// Called by ConnectRetry() before it starts, returning to the primary when failback is enabled
+func (m *MagnumRouter) failoverStart() {
+	if m.failover == nil || !m.opts.failback || m.State() != StateDisconnected {
+		return
+	}
+	if m.failover.use(0) {
+		m.opts.logger.Info("magnum failing back to primary", "endpoint", m.ActiveEndpoint())
+	}
+}
+
+// Called by ConnectRetry() after consecutive failed attempts, switching endpoint once they reach the threshold
+// Returns whether it switched, after which the failure count starts again
+func (m *MagnumRouter) failoverAfter(failures int) bool {
+	if m.failover == nil || failures < m.opts.failoverAttempts {
+		return false
+	}
+	m.failover.use(1 - m.failover.activeIndex())
+	m.opts.logger.Warn("magnum failing over", "endpoint", m.ActiveEndpoint(), "failed_attempts", failures)
+	return true
+}
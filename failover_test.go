@@ -0,0 +1,89 @@
+package magnumrouter
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+// Returns a router failing over from primary to backup, both scripted
+func newFailoverRouter(t *testing.T, primary *scriptConn, backup *scriptConn, opts ...Option) *MagnumRouter {
+	t.Helper()
+	opts = append([]Option{
+		WithNoInitialSync(),
+		WithBackupConn(backup, "10.0.0.2:5000"),
+		WithFailoverAttempts(2),
+		WithConnectBackoff(time.Millisecond, time.Millisecond),
+	}, opts...)
+	m := NewMagnumRouterWithConn(primary, 2, 2, 1, opts...)
+	t.Cleanup(func() { m.Close() })
+	return m
+}
+
+func countCalls(conn *scriptConn, call string) int {
+	n := 0
+	for _, got := range conn.recorded() {
+		if got == call {
+			n++
+		}
+	}
+	return n
+}
+
+func TestFailoverToBackup(t *testing.T) {
+	primary, backup := newScriptConn(), newScriptConn()
+	primary.connectErr = errors.New("refused")
+	m := newFailoverRouter(t, primary, backup)
+	if got := m.ActiveEndpoint(); got != "" {
+		t.Errorf("ActiveEndpoint() = %q on the primary connection, want empty", got)
+	}
+	if err := m.ConnectRetry(context.Background(), time.Second); err != nil {
+		t.Fatalf("ConnectRetry() = %v", err)
+	}
+	if got := countCalls(primary, "connect"); got != 2 {
+		t.Errorf("%d attempts on the primary, want 2", got)
+	}
+	if got := m.ActiveEndpoint(); got != "10.0.0.2:5000" {
+		t.Errorf("ActiveEndpoint() = %q, want the backup", got)
+	}
+	// Commands go to the backup once failed over
+	if err := m.SetRoute([]uint{0}, 1, 2); err != nil {
+		t.Fatal(err)
+	}
+	if got := countCalls(backup, "route [V] 1 2"); got != 1 {
+		t.Errorf("backup sent %q, want the route", backup.recorded())
+	}
+}
+
+func TestFailback(t *testing.T) {
+	tests := []struct {
+		failback bool
+		want     string
+	}{
+		{false, "10.0.0.2:5000"},
+		{true, ""},
+	}
+	for _, tt := range tests {
+		primary, backup := newScriptConn(), newScriptConn()
+		primary.connectErr = errors.New("refused")
+		m := newFailoverRouter(t, primary, backup, WithFailback(tt.failback))
+		if err := m.ConnectRetry(context.Background(), time.Second); err != nil {
+			t.Fatalf("ConnectRetry() = %v", err)
+		}
+		if err := m.Disconnect(); err != nil {
+			t.Fatal(err)
+		}
+
+		// The primary recovers before the next connect
+		primary.mu.Lock()
+		primary.connectErr = nil
+		primary.mu.Unlock()
+		if err := m.ConnectRetry(context.Background(), time.Second); err != nil {
+			t.Fatalf("ConnectRetry() = %v", err)
+		}
+		if got := m.ActiveEndpoint(); got != tt.want {
+			t.Errorf("failback %v: ActiveEndpoint() = %q, want %q", tt.failback, got, tt.want)
+		}
+	}
+}
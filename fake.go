@@ -0,0 +1,170 @@
+package magnumrouter
+
+import (
+	"fmt"
+	"sync"
+
+	"github.com/cassaram/quartz"
+)
+
+// An in-memory QuartzConn simulating a magnum device, for examples and testing without hardware
+// Queries are answered from its own state, and routes and locks are applied and reported as a device would
+// Routing to a locked destination is rejected with an error response
+// Unlike magnum it accepts name writes
+// Commands sent while disconnected are not applied
+type FakeConn struct {
+	mu          sync.Mutex
+	connected   bool
+	rx          chan quartz.QuartzResponse
+	sourceNames []string
+	destNames   []string
+	locks       []bool
+	routes      map[crosspoint]uint
+}
+
+// Returns a fake device with the given counts, with sources and destinations named "SRC n" and "DST n"
+func NewFakeConn(sourceCount uint, destinationCount uint) *FakeConn {
+	f := &FakeConn{
+		rx:          make(chan quartz.QuartzResponse, 1024),
+		sourceNames: make([]string, sourceCount+1),
+		destNames:   make([]string, destinationCount+1),
+		locks:       make([]bool, destinationCount+1),
+		routes:      map[crosspoint]uint{},
+	}
+	for i := uint(1); i <= sourceCount; i++ {
+		f.sourceNames[i] = fmt.Sprintf("SRC %d", i)
+	}
+	for i := uint(1); i <= destinationCount; i++ {
+		f.destNames[i] = fmt.Sprintf("DST %d", i)
+	}
+	return f
+}
+
+func (f *FakeConn) Connect() error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.connected = true
+	return nil
+}
+
+func (f *FakeConn) Disconnect() error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.connected = false
+	return nil
+}
+
+func (f *FakeConn) GetSourceName(src uint) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if src >= uint(len(f.sourceNames)) {
+		return f.reply(&quartz.ResponseError{RawData: ".E\r"})
+	}
+	return f.reply(&quartz.ResponseReadSource{Source: src, Name: f.sourceNames[src]})
+}
+
+func (f *FakeConn) GetDestinationName(dest uint) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if dest >= uint(len(f.destNames)) {
+		return f.reply(&quartz.ResponseError{RawData: ".E\r"})
+	}
+	return f.reply(&quartz.ResponseReadDestination{Destination: dest, Name: f.destNames[dest]})
+}
+
+func (f *FakeConn) GetDestinationLock(dest uint) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if dest >= uint(len(f.locks)) {
+		return f.reply(&quartz.ResponseError{RawData: ".E\r"})
+	}
+	return f.reply(&quartz.ResponseLockStatus{Destination: dest, Locked: f.locks[dest]})
+}
+
+func (f *FakeConn) GetRoute(level quartz.QuartzLevel, dest uint) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	src := f.routes[crosspoint{destination: dest, level: quartzLevelToID(level)}]
+	return f.reply(&quartz.ResponseUpdate{Levels: []quartz.QuartzLevel{level}, Destination: dest, Source: src})
+}
+
+func (f *FakeConn) SetCrosspoint(levels []quartz.QuartzLevel, dest uint, src uint) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if !f.connected {
+		return ErrNotConnected
+	}
+	if dest >= uint(len(f.locks)) || src >= uint(len(f.sourceNames)) || f.locks[dest] {
+		return f.reply(&quartz.ResponseError{RawData: ".E\r"})
+	}
+	for _, lvl := range levels {
+		f.routes[crosspoint{destination: dest, level: quartzLevelToID(lvl)}] = src
+	}
+	if err := f.reply(&quartz.ResponseAcknowledge{RawData: ".A\r"}); err != nil {
+		return err
+	}
+	return f.reply(&quartz.ResponseUpdate{Levels: levels, Destination: dest, Source: src})
+}
+
+func (f *FakeConn) LockDestination(dest uint) error {
+	return f.setLock(dest, true)
+}
+
+func (f *FakeConn) UnlockDestination(dest uint) error {
+	return f.setLock(dest, false)
+}
+
+func (f *FakeConn) setLock(dest uint, lock bool) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if !f.connected {
+		return ErrNotConnected
+	}
+	if dest >= uint(len(f.locks)) {
+		return f.reply(&quartz.ResponseError{RawData: ".E\r"})
+	}
+	f.locks[dest] = lock
+	if err := f.reply(&quartz.ResponseAcknowledge{RawData: ".A\r"}); err != nil {
+		return err
+	}
+	return f.reply(&quartz.ResponseLockStatus{Destination: dest, Locked: lock})
+}
+
+func (f *FakeConn) WriteSourceName(src uint, name string) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if !f.connected {
+		return ErrNotConnected
+	}
+	if src >= uint(len(f.sourceNames)) {
+		return f.reply(&quartz.ResponseError{RawData: ".E\r"})
+	}
+	f.sourceNames[src] = name
+	return f.reply(&quartz.ResponseAcknowledge{RawData: ".A\r"})
+}
+
+func (f *FakeConn) WriteDestinationName(dest uint, name string) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if !f.connected {
+		return ErrNotConnected
+	}
+	if dest >= uint(len(f.destNames)) {
+		return f.reply(&quartz.ResponseError{RawData: ".E\r"})
+	}
+	f.destNames[dest] = name
+	return f.reply(&quartz.ResponseAcknowledge{RawData: ".A\r"})
+}
+
+func (f *FakeConn) RxMessages() <-chan quartz.QuartzResponse {
+	return f.rx
+}
+
+// Queues a response, must be called with mu held
+func (f *FakeConn) reply(msg quartz.QuartzResponse) error {
+	if !f.connected {
+		return ErrNotConnected
+	}
+	f.rx <- msg
+	return nil
+}
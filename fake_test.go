@@ -0,0 +1,57 @@
+package magnumrouter
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/cassaram/quartz"
+)
+
+// Returns the next queued response of a fake device, failing if there is none
+func nextReply(t *testing.T, f *FakeConn) quartz.QuartzResponse {
+	t.Helper()
+	select {
+	case msg := <-f.RxMessages():
+		return msg
+	default:
+		t.Fatal("no response queued")
+		return nil
+	}
+}
+
+func TestFakeConnSyncsRouter(t *testing.T) {
+	m, _ := newFakeRouter(t, 3, 2, 1)
+	if got := m.GetSourceName(3); got != "SRC 3" {
+		t.Errorf("GetSourceName(3) = %q, want SRC 3", got)
+	}
+	if got := m.GetDestinationName(2); got != "DST 2" {
+		t.Errorf("GetDestinationName(2) = %q, want DST 2", got)
+	}
+	if err := m.SetRoute([]uint{0}, 2, 3); err != nil {
+		t.Fatalf("SetRoute(): %v", err)
+	}
+	eventually(t, func() bool { return m.GetRoute(0, 2) == 3 })
+}
+
+func TestFakeConnRejectsLockedDestination(t *testing.T) {
+	f := NewFakeConn(3, 2)
+	if err := f.SetCrosspoint([]quartz.QuartzLevel{quartz.QUARTZ_LVL_V}, 1, 1); !errors.Is(err, ErrNotConnected) {
+		t.Fatalf("SetCrosspoint() before Connect() = %v, want ErrNotConnected", err)
+	}
+	f.Connect()
+	if err := f.LockDestination(1); err != nil {
+		t.Fatalf("LockDestination(): %v", err)
+	}
+	nextReply(t, f)
+	if msg := nextReply(t, f); msg.GetType() != quartz.QUARTZ_RESP_TYPE_LOCK_STS {
+		t.Errorf("lock reply = %#v, want a lock status", msg)
+	}
+	f.SetCrosspoint([]quartz.QuartzLevel{quartz.QUARTZ_LVL_V}, 1, 2)
+	if msg := nextReply(t, f); msg.GetType() != quartz.QUARTZ_RESP_TYPE_ERR {
+		t.Errorf("route to a locked destination replied %#v, want an error", msg)
+	}
+	f.GetRoute(quartz.QUARTZ_LVL_V, 1)
+	if msg := nextReply(t, f).(*quartz.ResponseUpdate); msg.Source != 0 {
+		t.Errorf("route of a locked destination = %d, want unchanged", msg.Source)
+	}
+}
@@ -0,0 +1,81 @@
+package magnumrouter
+
+import (
+	"context"
+	"fmt"
+)
+
+// Makes follower mirror every route change seen on leader, by routing follower to the same source on the same level
+// Implemented on the event stream, so the follower is routed after the leader's update arrives
+// and only changes seen after this call are followed
+// Followers may lead other followers, but a follow that would form a cycle returns ErrFollowCycle
+// Replaces any existing leader of follower
+func (m *MagnumRouter) SetFollow(follower uint, leader uint) error {
+	if err := m.checkDestination(follower); err != nil {
+		return err
+	}
+	if err := m.checkDestination(leader); err != nil {
+		return err
+	}
+	m.followMu.Lock()
+	defer m.followMu.Unlock()
+	for dest, ok := leader, true; ok; dest, ok = m.follows[dest] {
+		if dest == follower {
+			return fmt.Errorf("%w: destination %d following %d", ErrFollowCycle, follower, leader)
+		}
+	}
+	if m.follows == nil {
+		m.follows = map[uint]uint{}
+	}
+	m.follows[follower] = leader
+	if m.followStop == nil {
+		events, unsubscribe := m.Subscribe()
+		m.followStop = unsubscribe
+		go m.runFollows(events)
+	}
+	return nil
+}
+
+// Stops follower mirroring its leader, does nothing if it is not following
+func (m *MagnumRouter) ClearFollow(follower uint) {
+	m.followMu.Lock()
+	defer m.followMu.Unlock()
+	delete(m.follows, follower)
+	if len(m.follows) == 0 && m.followStop != nil {
+		m.followStop()
+		m.followStop = nil
+	}
+}
+
+// Returns the leader a destination is following, or false if it is not following
+func (m *MagnumRouter) GetFollow(follower uint) (uint, bool) {
+	m.followMu.Lock()
+	defer m.followMu.Unlock()
+	leader, ok := m.follows[follower]
+	return leader, ok
+}
+
+// Routes followers as their leaders change, until the subscription is closed
+func (m *MagnumRouter) runFollows(events <-chan Event) {
+	for ev := range events {
+		if ev.Type != EventRouteChange || ev.Source == SourceUnknown {
+			continue
+		}
+		m.followMu.Lock()
+		followers := []uint{}
+		for follower, leader := range m.follows {
+			if leader == ev.Destination {
+				followers = append(followers, follower)
+			}
+		}
+		m.followMu.Unlock()
+		for _, follower := range followers {
+			if m.GetRoute(ev.Level, follower) == ev.Source {
+				continue
+			}
+			if _, err := m.setRoute(context.Background(), "Follow", []uint{ev.Level}, follower, ev.Source, nil); err != nil {
+				m.opts.logger.Warn("magnum follow route failed", "follower", follower, "leader", ev.Destination, "level", ev.Level, "err", err)
+			}
+		}
+	}
+}
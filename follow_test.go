@@ -0,0 +1,62 @@
+package magnumrouter
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestFollow(t *testing.T) {
+	m, _ := newFakeRouter(t, 4, 4, 1)
+	if err := m.SetFollow(2, 1); err != nil {
+		t.Fatalf("SetFollow(2, 1): %v", err)
+	}
+	// Followers may lead other followers
+	if err := m.SetFollow(3, 2); err != nil {
+		t.Fatalf("SetFollow(3, 2): %v", err)
+	}
+	if err := m.SetRoute([]uint{0}, 1, 3); err != nil {
+		t.Fatalf("SetRoute(): %v", err)
+	}
+	eventually(t, func() bool { return m.GetRoute(0, 2) == 3 && m.GetRoute(0, 3) == 3 })
+	if got := m.GetRoute(0, 4); got == 3 {
+		t.Error("destination 4 routed without following")
+	}
+
+	m.ClearFollow(3)
+	if _, ok := m.GetFollow(3); ok {
+		t.Error("GetFollow(3) after ClearFollow() still following")
+	}
+	if err := m.SetRoute([]uint{0}, 1, 4); err != nil {
+		t.Fatalf("SetRoute(): %v", err)
+	}
+	eventually(t, func() bool { return m.GetRoute(0, 2) == 4 })
+	time.Sleep(20 * time.Millisecond)
+	if got := m.GetRoute(0, 3); got != 3 {
+		t.Errorf("cleared follower routed to %d, want 3", got)
+	}
+}
+
+func TestFollowCycleRejected(t *testing.T) {
+	m := NewMagnumRouterWithConn(NewFakeConn(4, 4), 4, 4, 1)
+	if err := m.SetFollow(2, 1); err != nil {
+		t.Fatalf("SetFollow(2, 1): %v", err)
+	}
+	if err := m.SetFollow(3, 2); err != nil {
+		t.Fatalf("SetFollow(3, 2): %v", err)
+	}
+	cycles := [][2]uint{{1, 3}, {1, 2}, {4, 4}}
+	for _, c := range cycles {
+		if err := m.SetFollow(c[0], c[1]); !errors.Is(err, ErrFollowCycle) {
+			t.Errorf("SetFollow(%d, %d) = %v, want ErrFollowCycle", c[0], c[1], err)
+		}
+	}
+	if leader, ok := m.GetFollow(1); ok {
+		t.Errorf("destination 1 following %d after rejected follows", leader)
+	}
+	if err := m.SetFollow(5, 1); !errors.Is(err, ErrDestinationOutOfRange) {
+		t.Errorf("SetFollow(5, 1) = %v, want ErrDestinationOutOfRange", err)
+	}
+	m.ClearFollow(2)
+	m.ClearFollow(3)
+}
@@ -0,0 +1,139 @@
+package magnumrouter
+
+import (
+	"context"
+	"sort"
+)
+
+// Returns the destinations currently routed to a source at a level, in ID order
+// Returns an empty slice if the level is out of range
+func (m *MagnumRouter) DestinationsForSource(level uint, source uint) []uint {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	return m.destinationsForSourceLocked(level, source)
+}
+
+func (m *MagnumRouter) destinationsForSourceLocked(level uint, source uint) []uint {
+	if level >= m.levelCount {
+		return []uint{}
+	}
+	// The index does not track unrouted crosspoints
+	if indexed, ok := m.routes.(*indexedRoutes); ok && source != SourceUnknown {
+		return indexed.destinations(level, source)
+	}
+	dests := []uint{}
+	for dest := m.base(); dest < uint(len(m.destinationNames)); dest++ {
+		if m.routes.get(dest, level) == source {
+			dests = append(dests, dest)
+		}
+	}
+	return dests
+}
+
+// Returns the destinations currently routed to each of two sources at a level
+// Useful for planning a source swap, destinations on neither source are not returned
+// Both are empty if the level is out of range
+func (m *MagnumRouter) SourceFootprintDiff(level uint, srcA uint, srcB uint) (onA []uint, onB []uint) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	onA = m.destinationsForSourceLocked(level, srcA)
+	onB = []uint{}
+	if srcB != srcA {
+		onB = m.destinationsForSourceLocked(level, srcB)
+	}
+	return onA, onB
+}
+
+// Returns the ops that would move every destination on one source to another source at a level
+// Nothing is sent, apply the ops to replace a source everywhere
+// Returns no ops if the level is out of range
+func (m *MagnumRouter) SourceMigrationOps(level uint, from uint, to uint) []RouteOp {
+	onFrom, _ := m.SourceFootprintDiff(level, from, to)
+	ops := make([]RouteOp, 0, len(onFrom))
+	for _, dest := range onFrom {
+		ops = append(ops, RouteOp{Levels: []uint{level}, Destination: dest, Source: to})
+	}
+	return ops
+}
+
+// Routes every destination on srcA at a level to srcB and every destination on srcB to srcA, in one SetRoutes() call
+// Footprints are read from the cache, destinations on neither source are left alone and nothing is sent if neither is in use
+// Returns the ops in destination order, and on error the SetRoutes() error naming the op that failed
+func (m *MagnumRouter) SwapSources(ctx context.Context, level uint, srcA uint, srcB uint) ([]RouteOp, error) {
+	if err := m.checkLevel(level); err != nil {
+		return nil, err
+	}
+	if err := m.checkSource(srcA); err != nil {
+		return nil, err
+	}
+	if err := m.checkSource(srcB); err != nil {
+		return nil, err
+	}
+	onA, onB := m.SourceFootprintDiff(level, srcA, srcB)
+	ops := make([]RouteOp, 0, len(onA)+len(onB))
+	if srcA == srcB {
+		return ops, nil
+	}
+	for _, dest := range onA {
+		ops = append(ops, RouteOp{Levels: []uint{level}, Destination: dest, Source: srcB})
+	}
+	for _, dest := range onB {
+		ops = append(ops, RouteOp{Levels: []uint{level}, Destination: dest, Source: srcA})
+	}
+	sort.Slice(ops, func(i, j int) bool { return ops[i].Destination < ops[j].Destination })
+	if len(ops) == 0 {
+		return ops, nil
+	}
+	return ops, m.SetRoutes(ctx, ops)
+}
+
+// Returns whether a source is routed to any destination at any level
+func (m *MagnumRouter) IsSourceInUse(source uint) bool {
+	return m.SourceUsageCount(source) > 0
+}
+
+// Returns the number of crosspoints, across all destinations and levels, routed to a source
+func (m *MagnumRouter) SourceUsageCount(source uint) int {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	if indexed, ok := m.routes.(*indexedRoutes); ok && source != SourceUnknown {
+		return indexed.usage(source)
+	}
+	count := 0
+	for dest := m.base(); dest < uint(len(m.destinationNames)); dest++ {
+		for lvl := uint(0); lvl < m.levelCount; lvl++ {
+			if m.routes.get(dest, lvl) == source {
+				count++
+			}
+		}
+	}
+	return count
+}
+
+// Returns the destinations with no known source at a level, in ID order
+// Useful when commissioning to catch destinations that were never routed
+// Returns an empty slice if the level is out of range
+func (m *MagnumRouter) UnroutedDestinations(level uint) []uint {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	if level >= m.levelCount {
+		return []uint{}
+	}
+	return m.destinationsForSourceLocked(level, SourceUnknown)
+}
+
+// Returns the destinations with no known source on at least one level, in ID order
+func (m *MagnumRouter) UnroutedDestinationsAnyLevel() []uint {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	dests := []uint{}
+	for dest := m.base(); dest < uint(len(m.destinationNames)); dest++ {
+		for lvl := uint(0); lvl < m.levelCount; lvl++ {
+			if m.routes.get(dest, lvl) == SourceUnknown {
+				dests = append(dests, dest)
+				break
+			}
+		}
+	}
+	return dests
+}
@@ -0,0 +1,203 @@
+package magnumrouter
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+
+	"github.com/cassaram/quartz"
+)
+
+func TestFootprintOutOfRangeLevel(t *testing.T) {
+	stores := map[string][]Option{
+		"dense":   nil,
+		"sparse":  {WithSparseRouteTable(true)},
+		"indexed": {WithInverseIndex(true)},
+	}
+	for name, opts := range stores {
+		t.Run(name, func(t *testing.T) {
+			m := NewMagnumRouterWithConn(NewFakeConn(4, 4), 4, 4, 2, opts...)
+			if got := m.DestinationsForSource(2, 1); len(got) != 0 {
+				t.Errorf("DestinationsForSource = %v, want empty", got)
+			}
+			onA, onB := m.SourceFootprintDiff(5, 1, 2)
+			if len(onA) != 0 || len(onB) != 0 {
+				t.Errorf("SourceFootprintDiff = %v %v, want empty", onA, onB)
+			}
+			if got := m.SourceMigrationOps(2, 1, 2); len(got) != 0 {
+				t.Errorf("SourceMigrationOps = %v, want none", got)
+			}
+		})
+	}
+}
+
+func TestSourceFootprintDiff(t *testing.T) {
+	m := NewMagnumRouterWithConn(NewFakeConn(4, 5), 4, 5, 2)
+	// Destinations 1 and 2 take source 1 on video but source 2 on audio, so the footprints overlap across levels
+	m.processMessage(update(1, 1, quartz.QUARTZ_LVL_V))
+	m.processMessage(update(2, 1, quartz.QUARTZ_LVL_V))
+	m.processMessage(update(3, 2, quartz.QUARTZ_LVL_V))
+	m.processMessage(update(1, 2, quartz.QUARTZ_LVL_A))
+	m.processMessage(update(2, 2, quartz.QUARTZ_LVL_A))
+	m.processMessage(update(4, 3, quartz.QUARTZ_LVL_V))
+
+	onA, onB := m.SourceFootprintDiff(0, 1, 2)
+	if !reflect.DeepEqual(onA, []uint{1, 2}) || !reflect.DeepEqual(onB, []uint{3}) {
+		t.Errorf("video footprints = %v %v, want [1 2] [3]", onA, onB)
+	}
+	onA, onB = m.SourceFootprintDiff(1, 1, 2)
+	if len(onA) != 0 || !reflect.DeepEqual(onB, []uint{1, 2}) {
+		t.Errorf("audio footprints = %v %v, want [] [1 2]", onA, onB)
+	}
+	onA, onB = m.SourceFootprintDiff(0, 1, 1)
+	if !reflect.DeepEqual(onA, []uint{1, 2}) || len(onB) != 0 {
+		t.Errorf("footprints of one source = %v %v, want [1 2] []", onA, onB)
+	}
+
+	ops := m.SourceMigrationOps(0, 1, 4)
+	want := []RouteOp{{Levels: []uint{0}, Destination: 1, Source: 4}, {Levels: []uint{0}, Destination: 2, Source: 4}}
+	if !reflect.DeepEqual(ops, want) {
+		t.Errorf("SourceMigrationOps() = %v, want %v", ops, want)
+	}
+	if ops := m.SourceMigrationOps(1, 4, 1); len(ops) != 0 {
+		t.Errorf("SourceMigrationOps() of an unused source = %v, want none", ops)
+	}
+}
+
+func TestSwapSources(t *testing.T) {
+	cases := map[string]struct {
+		routes map[uint]uint
+		want   []RouteOp
+	}{
+		"overlapping": {
+			routes: map[uint]uint{1: 1, 2: 2, 3: 1, 4: 3},
+			want: []RouteOp{
+				{Levels: []uint{0}, Destination: 1, Source: 2},
+				{Levels: []uint{0}, Destination: 2, Source: 1},
+				{Levels: []uint{0}, Destination: 3, Source: 2},
+			},
+		},
+		"single source": {
+			routes: map[uint]uint{2: 1, 4: 1, 5: 3},
+			want: []RouteOp{
+				{Levels: []uint{0}, Destination: 2, Source: 2},
+				{Levels: []uint{0}, Destination: 4, Source: 2},
+			},
+		},
+		"neither": {
+			routes: map[uint]uint{1: 3, 2: 4},
+			want:   []RouteOp{},
+		},
+	}
+	for name, c := range cases {
+		t.Run(name, func(t *testing.T) {
+			m, _ := newFakeRouter(t, 4, 5, 1)
+			for dest, src := range c.routes {
+				if err := m.SetRoute([]uint{0}, dest, src); err != nil {
+					t.Fatalf("SetRoute() = %v", err)
+				}
+			}
+			eventually(t, func() bool {
+				for dest, src := range c.routes {
+					if m.GetRoute(0, dest) != src {
+						return false
+					}
+				}
+				return true
+			})
+
+			ops, err := m.SwapSources(context.Background(), 0, 1, 2)
+			if err != nil {
+				t.Fatalf("SwapSources() = %v", err)
+			}
+			if !reflect.DeepEqual(ops, c.want) {
+				t.Fatalf("SwapSources() = %v, want %v", ops, c.want)
+			}
+			eventually(t, func() bool {
+				for _, op := range ops {
+					if m.GetRoute(0, op.Destination) != op.Source {
+						return false
+					}
+				}
+				return true
+			})
+			// Destinations on neither source are left alone
+			for dest, src := range c.routes {
+				if src != 1 && src != 2 && m.GetRoute(0, dest) != src {
+					t.Errorf("destination %d moved to %d, want %d", dest, m.GetRoute(0, dest), src)
+				}
+			}
+		})
+	}
+}
+
+func TestSwapSourcesValidates(t *testing.T) {
+	m := NewMagnumRouterWithConn(NewFakeConn(4, 4), 4, 4, 1)
+	if _, err := m.SwapSources(context.Background(), 0, 1, 9); !errors.Is(err, ErrSourceOutOfRange) {
+		t.Errorf("SwapSources() with source 9 = %v, want ErrSourceOutOfRange", err)
+	}
+	if _, err := m.SwapSources(context.Background(), 3, 1, 2); !errors.Is(err, ErrLevelOutOfRange) {
+		t.Errorf("SwapSources() at level 3 = %v, want ErrLevelOutOfRange", err)
+	}
+}
+
+func TestSourceUsage(t *testing.T) {
+	stores := map[string][]Option{
+		"dense":   nil,
+		"indexed": {WithInverseIndex(true)},
+	}
+	for name, opts := range stores {
+		t.Run(name, func(t *testing.T) {
+			m := NewMagnumRouterWithConn(NewFakeConn(4, 4), 4, 4, 2, opts...)
+			m.processMessage(update(1, 2, quartz.QUARTZ_LVL_V, quartz.QUARTZ_LVL_A))
+			m.processMessage(update(2, 2, quartz.QUARTZ_LVL_V))
+			m.processMessage(update(3, 3, quartz.QUARTZ_LVL_A))
+			// A source routed away again is no longer in use
+			m.processMessage(update(4, 4, quartz.QUARTZ_LVL_V))
+			m.processMessage(update(4, 2, quartz.QUARTZ_LVL_V))
+
+			tests := []struct {
+				name   string
+				source uint
+				count  int
+			}{
+				{"unused", 1, 0},
+				{"single use", 3, 1},
+				{"multi use", 2, 4},
+				{"routed away", 4, 0},
+			}
+			for _, tt := range tests {
+				if got := m.SourceUsageCount(tt.source); got != tt.count {
+					t.Errorf("%s: SourceUsageCount(%d) = %d, want %d", tt.name, tt.source, got, tt.count)
+				}
+				if got := m.IsSourceInUse(tt.source); got != (tt.count > 0) {
+					t.Errorf("%s: IsSourceInUse(%d) = %v", tt.name, tt.source, got)
+				}
+			}
+		})
+	}
+}
+
+func TestUnroutedDestinations(t *testing.T) {
+	m := NewMagnumRouterWithConn(NewFakeConn(4, 4), 4, 4, 2)
+	m.processMessage(update(1, 2, quartz.QUARTZ_LVL_V, quartz.QUARTZ_LVL_A))
+	m.processMessage(update(2, 3, quartz.QUARTZ_LVL_V))
+	m.processMessage(update(3, 1, quartz.QUARTZ_LVL_A))
+	m.processMessage(update(4, 4, quartz.QUARTZ_LVL_V, quartz.QUARTZ_LVL_A))
+	// Routing to source 0 leaves the crosspoint unrouted
+	m.processMessage(update(4, 0, quartz.QUARTZ_LVL_A))
+
+	if got := m.UnroutedDestinations(0); !reflect.DeepEqual(got, []uint{3}) {
+		t.Errorf("UnroutedDestinations(0) = %v, want [3]", got)
+	}
+	if got := m.UnroutedDestinations(1); !reflect.DeepEqual(got, []uint{2, 4}) {
+		t.Errorf("UnroutedDestinations(1) = %v, want [2 4]", got)
+	}
+	if got := m.UnroutedDestinations(2); len(got) != 0 {
+		t.Errorf("UnroutedDestinations() of an out of range level = %v, want empty", got)
+	}
+	if got := m.UnroutedDestinationsAnyLevel(); !reflect.DeepEqual(got, []uint{2, 3, 4}) {
+		t.Errorf("UnroutedDestinationsAnyLevel() = %v, want [2 3 4]", got)
+	}
+}
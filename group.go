@@ -0,0 +1,181 @@
+package magnumrouter
+
+import (
+	"sort"
+	"sync"
+)
+
+// A set of routers making up a multi-frame plant, each member identified by a frame name
+type RouterGroup struct {
+	members  map[string]*MagnumRouter
+	tieMu    sync.Mutex
+	tieLines map[tieEnd]tieEnd
+}
+
+// Returns a group of the given routers keyed by frame name
+// The map is copied, and the routers are still connected and controlled individually
+func NewRouterGroup(members map[string]*MagnumRouter) *RouterGroup {
+	g := &RouterGroup{members: make(map[string]*MagnumRouter, len(members))}
+	for name, r := range members {
+		g.members[name] = r
+	}
+	return g
+}
+
+// Returns the router of a frame, or nil if the group has no such frame
+func (g *RouterGroup) Router(frame string) *MagnumRouter {
+	return g.members[frame]
+}
+
+// Returns the frame names of the group in sorted order
+func (g *RouterGroup) Frames() []string {
+	frames := make([]string, 0, len(g.members))
+	for name := range g.members {
+		frames = append(frames, name)
+	}
+	sort.Strings(frames)
+	return frames
+}
+
+// Aggregate connection state of a RouterGroup
+type GroupState int
+
+const (
+	// No member is connected, including an empty group
+	GroupDown GroupState = iota
+	// Some but not all members are connected
+	GroupDegraded
+	// Every member is connected
+	GroupUp
+)
+
+func (s GroupState) String() string {
+	switch s {
+	case GroupDown:
+		return "down"
+	case GroupDegraded:
+		return "degraded"
+	case GroupUp:
+		return "up"
+	}
+	return "unknown"
+}
+
+// Returns the aggregate of member states, where only StateConnected counts as connected
+func aggregateState(states map[string]ConnectionState) GroupState {
+	connected := 0
+	for _, state := range states {
+		if state == StateConnected {
+			connected++
+		}
+	}
+	switch {
+	case connected == 0:
+		return GroupDown
+	case connected == len(states):
+		return GroupUp
+	}
+	return GroupDegraded
+}
+
+// Returns whether every member is connected with its initial sync complete
+// Returns false for an empty group
+func (g *RouterGroup) AllReady() bool {
+	if len(g.members) == 0 {
+		return false
+	}
+	for _, r := range g.members {
+		if r.State() != StateConnected || !r.SyncComplete() {
+			return false
+		}
+	}
+	return true
+}
+
+// Returns the current aggregate state from the actual state of each member
+func (g *RouterGroup) State() GroupState {
+	states := make(map[string]ConnectionState, len(g.members))
+	for name, r := range g.members {
+		states[name] = r.State()
+	}
+	return aggregateState(states)
+}
+
+// Returns a channel receiving aggregate state changes, and a function to unsubscribe
+// The aggregate is built from the published state of each member as per MagnumRouter.SubscribeState(),
+// so follows any debounce configured on the members
+// The current aggregate is sent once every member has reported, then each change
+// A receiver that falls behind misses intermediate states but always receives the latest
+// Unsubscribing closes the channel
+func (g *RouterGroup) SubscribeState() (<-chan GroupState, func()) {
+	type update struct {
+		frame string
+		state ConnectionState
+	}
+	out := make(chan GroupState, 1)
+	updates := make(chan update)
+	stop := make(chan struct{})
+	unsubscribes := []func(){}
+	var wg sync.WaitGroup
+	for name, r := range g.members {
+		states, unsubscribe := r.SubscribeState()
+		unsubscribes = append(unsubscribes, unsubscribe)
+		wg.Add(1)
+		go func(frame string) {
+			defer wg.Done()
+			for state := range states {
+				select {
+				case updates <- update{frame: frame, state: state}:
+				case <-stop:
+					return
+				}
+			}
+		}(name)
+	}
+	go func() {
+		wg.Wait()
+		close(updates)
+	}()
+
+	go func() {
+		defer close(out)
+		states := map[string]ConnectionState{}
+		sent := false
+		var last GroupState
+		if len(g.members) == 0 {
+			out <- GroupDown
+		}
+		for u := range updates {
+			states[u.frame] = u.state
+			if len(states) < len(g.members) {
+				continue
+			}
+			state := aggregateState(states)
+			if sent && state == last {
+				continue
+			}
+			sent, last = true, state
+			// Replace a state the receiver has not taken yet so it always sees the latest
+			select {
+			case out <- state:
+			default:
+				select {
+				case <-out:
+				default:
+				}
+				out <- state
+			}
+		}
+	}()
+
+	var once sync.Once
+	unsubscribe := func() {
+		once.Do(func() {
+			close(stop)
+			for _, unsubscribe := range unsubscribes {
+				unsubscribe()
+			}
+		})
+	}
+	return out, unsubscribe
+}
@@ -0,0 +1,93 @@
+package magnumrouter
+
+import (
+	"testing"
+	"time"
+)
+
+// Receives the next aggregate state from a RouterGroup.SubscribeState() channel
+func nextGroupState(t *testing.T, states <-chan GroupState) GroupState {
+	t.Helper()
+	select {
+	case state := <-states:
+		return state
+	case <-time.After(time.Second):
+		t.Fatal("no group state received")
+		return 0
+	}
+}
+
+func TestAggregateState(t *testing.T) {
+	tests := []struct {
+		states map[string]ConnectionState
+		want   GroupState
+	}{
+		{map[string]ConnectionState{}, GroupDown},
+		{map[string]ConnectionState{"a": StateDisconnected, "b": StateConnecting}, GroupDown},
+		{map[string]ConnectionState{"a": StateConnected, "b": StateConnecting}, GroupDegraded},
+		{map[string]ConnectionState{"a": StateConnected, "b": StateDisconnected}, GroupDegraded},
+		{map[string]ConnectionState{"a": StateConnected, "b": StateConnected}, GroupUp},
+	}
+	for _, tt := range tests {
+		if got := aggregateState(tt.states); got != tt.want {
+			t.Errorf("aggregateState(%v) = %v, want %v", tt.states, got, tt.want)
+		}
+	}
+}
+
+func TestRouterGroupMixedStates(t *testing.T) {
+	a, _ := newScriptRouter(t, 2, 2, 1)
+	b := NewMagnumRouterWithConn(newScriptConn(), 2, 2, 1, WithNoInitialSync())
+	defer b.Close()
+	g := NewRouterGroup(map[string]*MagnumRouter{"a": a, "b": b})
+	if g.AllReady() {
+		t.Error("AllReady() with frame b disconnected")
+	}
+	if got := g.State(); got != GroupDegraded {
+		t.Errorf("State() = %v, want degraded", got)
+	}
+	states, unsubscribe := g.SubscribeState()
+	if got := nextGroupState(t, states); got != GroupDegraded {
+		t.Errorf("initial group state %v, want degraded", got)
+	}
+
+	if err := b.Connect(); err != nil {
+		t.Fatal(err)
+	}
+	if got := nextGroupState(t, states); got != GroupUp {
+		t.Errorf("group state %v with every frame connected, want up", got)
+	}
+	if !g.AllReady() {
+		t.Error("AllReady() = false with every frame connected and synced")
+	}
+
+	if err := a.Disconnect(); err != nil {
+		t.Fatal(err)
+	}
+	if got := nextGroupState(t, states); got != GroupDegraded {
+		t.Errorf("group state %v with frame a down, want degraded", got)
+	}
+	if err := b.Disconnect(); err != nil {
+		t.Fatal(err)
+	}
+	if got := nextGroupState(t, states); got != GroupDown {
+		t.Errorf("group state %v with every frame down, want down", got)
+	}
+	unsubscribe()
+	if _, ok := <-states; ok {
+		t.Error("channel open after unsubscribing")
+	}
+	unsubscribe()
+}
+
+func TestRouterGroupEmpty(t *testing.T) {
+	g := NewRouterGroup(nil)
+	if g.AllReady() {
+		t.Error("AllReady() = true for an empty group")
+	}
+	states, unsubscribe := g.SubscribeState()
+	defer unsubscribe()
+	if got := nextGroupState(t, states); got != GroupDown {
+		t.Errorf("state of an empty group %v, want down", got)
+	}
+}
@@ -0,0 +1,207 @@
+package magnumrouter
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/cassaram/quartz"
+)
+
+// Returns a router connected to a FakeConn with the given counts, closed when the test ends
+// The initial sync responses are processed before it returns
+func newFakeRouter(t *testing.T, sources uint, destinations uint, levels uint, opts ...Option) (*MagnumRouter, *FakeConn) {
+	t.Helper()
+	conn := NewFakeConn(sources, destinations)
+	m := NewMagnumRouterWithConn(conn, sources, destinations, levels, opts...)
+	if err := m.Connect(); err != nil {
+		t.Fatalf("connect: %v", err)
+	}
+	t.Cleanup(func() { m.Close() })
+	eventually(t, func() bool { return m.GetDestinationName(destinations) != "" })
+	return m, conn
+}
+
+// Fails the test unless cond becomes true within a second
+func eventually(t *testing.T, cond func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatal("condition not met in time")
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+// Returns the error sent on errs, failing the test if none arrives within a second
+func receiveErr(t *testing.T, errs <-chan error) error {
+	t.Helper()
+	select {
+	case err := <-errs:
+		return err
+	case <-time.After(time.Second):
+		t.Fatal("no result in time")
+		return nil
+	}
+}
+
+// A QuartzConn that records every call and only delivers the responses a test injects
+type scriptConn struct {
+	mu         sync.Mutex
+	rx         chan quartz.QuartzResponse
+	calls      []string
+	connectErr error
+}
+
+func newScriptConn() *scriptConn {
+	return &scriptConn{rx: make(chan quartz.QuartzResponse, 1024)}
+}
+
+func (c *scriptConn) record(format string, args ...any) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.calls = append(c.calls, fmt.Sprintf(format, args...))
+	return nil
+}
+
+// Returns the calls recorded so far, such as "route A 1 2" or "lock 3"
+func (c *scriptConn) recorded() []string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return append([]string{}, c.calls...)
+}
+
+// Queues a response as if received from the server
+func (c *scriptConn) inject(msgs ...quartz.QuartzResponse) {
+	for _, msg := range msgs {
+		c.rx <- msg
+	}
+}
+
+// Closes the message channel as the quartz layer does when the link drops
+func (c *scriptConn) drop() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	close(c.rx)
+	c.rx = make(chan quartz.QuartzResponse, 1024)
+}
+
+func (c *scriptConn) Connect() error {
+	c.record("connect")
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.connectErr
+}
+
+func (c *scriptConn) Disconnect() error { return c.record("disconnect") }
+
+func (c *scriptConn) GetSourceName(src uint) error { return c.record("get source %d", src) }
+
+func (c *scriptConn) GetDestinationName(dest uint) error { return c.record("get destination %d", dest) }
+
+func (c *scriptConn) GetDestinationLock(dest uint) error { return c.record("get lock %d", dest) }
+
+func (c *scriptConn) GetRoute(level quartz.QuartzLevel, dest uint) error {
+	return c.record("get route %s %d", level, dest)
+}
+
+func (c *scriptConn) SetCrosspoint(levels []quartz.QuartzLevel, dest uint, src uint) error {
+	return c.record("route %v %d %d", levels, dest, src)
+}
+
+func (c *scriptConn) LockDestination(dest uint) error { return c.record("lock %d", dest) }
+
+func (c *scriptConn) UnlockDestination(dest uint) error { return c.record("unlock %d", dest) }
+
+func (c *scriptConn) RxMessages() <-chan quartz.QuartzResponse {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.rx
+}
+
+// Returns a router on a scriptConn with names, locks and routes left to the test, closed when the test ends
+func newScriptRouter(t *testing.T, sources uint, destinations uint, levels uint, opts ...Option) (*MagnumRouter, *scriptConn) {
+	t.Helper()
+	conn := newScriptConn()
+	m := NewMagnumRouterWithConn(conn, sources, destinations, levels, append([]Option{WithNoInitialSync()}, opts...)...)
+	if err := m.Connect(); err != nil {
+		t.Fatalf("connect: %v", err)
+	}
+	t.Cleanup(func() { m.Close() })
+	return m, conn
+}
+
+// A Clock only moving when advanced by the test, firing due timers in order of their deadlines
+type fakeClock struct {
+	mu     sync.Mutex
+	now    time.Time
+	timers []*fakeTimer
+}
+
+type fakeTimer struct {
+	clock *fakeClock
+	at    time.Time
+	f     func()
+}
+
+func newFakeClock() *fakeClock {
+	return &fakeClock{now: time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)}
+}
+
+func (c *fakeClock) Now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.now
+}
+
+func (c *fakeClock) AfterFunc(d time.Duration, f func()) Timer {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	t := &fakeTimer{clock: c, at: c.now.Add(d), f: f}
+	c.timers = append(c.timers, t)
+	return t
+}
+
+func (t *fakeTimer) Stop() bool {
+	t.clock.mu.Lock()
+	defer t.clock.mu.Unlock()
+	for i, pending := range t.clock.timers {
+		if pending == t {
+			t.clock.timers = append(t.clock.timers[:i], t.clock.timers[i+1:]...)
+			return true
+		}
+	}
+	return false
+}
+
+// Returns the number of timers not yet fired or stopped
+func (c *fakeClock) pending() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return len(c.timers)
+}
+
+// Moves the clock forward by d, calling each timer falling due on the way, including timers they create
+func (c *fakeClock) Advance(d time.Duration) {
+	c.mu.Lock()
+	end := c.now.Add(d)
+	for {
+		sort.SliceStable(c.timers, func(i, j int) bool { return c.timers[i].at.Before(c.timers[j].at) })
+		if len(c.timers) == 0 || c.timers[0].at.After(end) {
+			break
+		}
+		t := c.timers[0]
+		c.timers = c.timers[1:]
+		if t.at.After(c.now) {
+			c.now = t.at
+		}
+		c.mu.Unlock()
+		t.f()
+		c.mu.Lock()
+	}
+	c.now = end
+	c.mu.Unlock()
+}
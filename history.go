@@ -0,0 +1,58 @@
+package magnumrouter
+
+import "time"
+
+// A source value seen on a crosspoint and when it was received
+type RouteHistoryEntry struct {
+	Time   time.Time
+	Source uint
+}
+
+// Fixed size ring buffer of route history entries
+type routeHistory struct {
+	entries []RouteHistoryEntry
+	next    int
+	full    bool
+}
+
+func (h *routeHistory) add(entry RouteHistoryEntry) {
+	h.entries[h.next] = entry
+	h.next = (h.next + 1) % len(h.entries)
+	if h.next == 0 {
+		h.full = true
+	}
+}
+
+// Returns the entries oldest first
+func (h *routeHistory) list() []RouteHistoryEntry {
+	if !h.full {
+		return append([]RouteHistoryEntry{}, h.entries[:h.next]...)
+	}
+	return append(append([]RouteHistoryEntry{}, h.entries[h.next:]...), h.entries[:h.next]...)
+}
+
+// Returns the recorded history of a crosspoint, oldest first
+// Empty unless route history is enabled with WithRouteHistory
+func (m *MagnumRouter) RouteHistory(level uint, destination uint) []RouteHistoryEntry {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	h, ok := m.routeHistory[crosspoint{destination: destination, level: level}]
+	if !ok {
+		return []RouteHistoryEntry{}
+	}
+	return h.list()
+}
+
+// Records a received route in the history, must be called with mu held
+func (m *MagnumRouter) recordRouteHistory(destination uint, level uint, source uint) {
+	if m.opts.routeHistoryDepth <= 0 {
+		return
+	}
+	key := crosspoint{destination: destination, level: level}
+	h, ok := m.routeHistory[key]
+	if !ok {
+		h = &routeHistory{entries: make([]RouteHistoryEntry, m.opts.routeHistoryDepth)}
+		m.routeHistory[key] = h
+	}
+	h.add(RouteHistoryEntry{Time: m.opts.clock.Now(), Source: source})
+}
@@ -0,0 +1,56 @@
+package magnumrouter
+
+import (
+	"testing"
+	"time"
+
+	"github.com/cassaram/quartz"
+)
+
+func update(dest uint, src uint, levels ...quartz.QuartzLevel) *quartz.ResponseUpdate {
+	if len(levels) == 0 {
+		levels = []quartz.QuartzLevel{quartz.QUARTZ_LVL_V}
+	}
+	return &quartz.ResponseUpdate{Levels: levels, Destination: dest, Source: src}
+}
+
+func TestRouteHistoryEvictsOldest(t *testing.T) {
+	clock := newFakeClock()
+	start := clock.Now()
+	m := NewMagnumRouterWithConn(NewFakeConn(5, 2), 5, 2, 1, WithClock(clock), WithRouteHistory(3))
+	for src := uint(1); src <= 5; src++ {
+		m.processMessage(update(1, src))
+		clock.Advance(time.Second)
+	}
+	got := m.RouteHistory(0, 1)
+	if len(got) != 3 {
+		t.Fatalf("RouteHistory() = %v, want 3 entries", got)
+	}
+	for i, entry := range got {
+		want := RouteHistoryEntry{Time: start.Add(time.Duration(i+2) * time.Second), Source: uint(i + 3)}
+		if entry != want {
+			t.Errorf("entry %d = %+v, want %+v", i, entry, want)
+		}
+	}
+	if got := m.RouteHistory(0, 2); len(got) != 0 {
+		t.Errorf("RouteHistory() of an unrouted destination = %v, want empty", got)
+	}
+}
+
+func TestRouteHistoryPartiallyFilled(t *testing.T) {
+	m := NewMagnumRouterWithConn(NewFakeConn(5, 2), 5, 2, 1, WithRouteHistory(3))
+	m.processMessage(update(1, 4))
+	m.processMessage(update(1, 2))
+	got := m.RouteHistory(0, 1)
+	if len(got) != 2 || got[0].Source != 4 || got[1].Source != 2 {
+		t.Errorf("RouteHistory() = %v, want sources 4 then 2", got)
+	}
+}
+
+func TestRouteHistoryDisabledByDefault(t *testing.T) {
+	m := NewMagnumRouterWithConn(NewFakeConn(5, 2), 5, 2, 1)
+	m.processMessage(update(1, 1))
+	if got := m.RouteHistory(0, 1); len(got) != 0 {
+		t.Errorf("RouteHistory() = %v, want empty without WithRouteHistory", got)
+	}
+}
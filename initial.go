@@ -0,0 +1,35 @@
+package magnumrouter
+
+// Identifies a cached value for WithEmitInitialSync(), by event type and the IDs the value is for
+type learnedKey struct {
+	kind  EventType
+	id    uint
+	level uint
+}
+
+// Records a cached value as learned from the device, returning whether this is the first time since connecting
+// Always false without WithEmitInitialSync(), mu must be held
+func (m *MagnumRouter) firstLearnedLocked(kind EventType, id uint, level uint) bool {
+	if !m.opts.emitInitialSync {
+		return false
+	}
+	key := learnedKey{kind: kind, id: id, level: level}
+	if _, ok := m.learned[key]; ok {
+		return false
+	}
+	if m.learned == nil {
+		m.learned = map[learnedKey]struct{}{}
+	}
+	m.learned[key] = struct{}{}
+	return true
+}
+
+// Forgets which values were learned, so the next connect reports each one again
+func (m *MagnumRouter) resetLearned() {
+	if !m.opts.emitInitialSync {
+		return
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.learned = nil
+}
@@ -0,0 +1,85 @@
+package magnumrouter
+
+import (
+	"fmt"
+
+	"github.com/cassaram/quartz"
+)
+
+// Implemented by connections able to query level names
+// quartz.Quartz implements this, but rejects it when in magnum mode
+type LevelNameQuerier interface {
+	GetLevelName(level quartz.QuartzLevel) error
+}
+
+// Request all level names from the device
+// Magnum does not support this, so it is only useful for devices enabled with WithLevelNameQuery()
+// Results are cached and can be accessed via MagnumRouter.GetLevelName(level)
+// Returns ErrNotSupported if the connection does not implement LevelNameQuerier
+func (m *MagnumRouter) RequestAllLevelNames() error {
+	querier, ok := m.conn.(LevelNameQuerier)
+	if !ok {
+		return fmt.Errorf("%w: level name query", ErrNotSupported)
+	}
+	for i := uint(0); i < m.levelCount; i++ {
+		lvl, ok := idToQuartzLevel(i)
+		if !ok {
+			return fmt.Errorf("%w: %d", ErrLevelOutOfRange, i)
+		}
+		err := m.send(func() error { return querier.GetLevelName(lvl) })
+		if err != nil {
+			return fmt.Errorf("level %d name: %w", i, err)
+		}
+	}
+	return nil
+}
+
+// Returns the name of a level
+// Uses the name reported by the device, then the name set by WithLevelNames(), then the quartz level letter
+// Levels beyond the quartz levels are named by their ID
+func (m *MagnumRouter) GetLevelName(level uint) string {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	return m.levelNameLocked(level)
+}
+
+func (m *MagnumRouter) levelNameLocked(level uint) string {
+	if level < uint(len(m.levelNames)) && m.levelNames[level] != "" {
+		return m.levelNames[level]
+	}
+	return m.levelFallbackLocked(level)
+}
+
+// Returns the name of a level used when the device has not reported one
+func (m *MagnumRouter) levelFallbackLocked(level uint) string {
+	if level < uint(len(m.opts.levelNames)) && m.opts.levelNames[level] != "" {
+		return m.opts.levelNames[level]
+	}
+	lvl, ok := idToQuartzLevel(level)
+	if !ok {
+		return fmt.Sprint(level)
+	}
+	return string(lvl)
+}
+
+// Returns a copy of the mapping from level ID to quartz level for all configured levels
+// Level IDs follow the quartz level letters in order, video first then audio
+func (m *MagnumRouter) LevelMapping() map[uint]quartz.QuartzLevel {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	mapping := make(map[uint]quartz.QuartzLevel, m.levelCount)
+	for id := uint(0); id < m.levelCount; id++ {
+		if lvl, ok := idToQuartzLevel(id); ok {
+			mapping[id] = lvl
+		}
+	}
+	return mapping
+}
+
+// Returns the quartz level of a level ID, or false if the level is not configured
+func (m *MagnumRouter) LevelForID(id uint) (quartz.QuartzLevel, bool) {
+	if err := m.checkLevel(id); err != nil {
+		return "", false
+	}
+	return idToQuartzLevel(id)
+}
@@ -0,0 +1,151 @@
+package magnumrouter
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/cassaram/quartz"
+)
+
+func TestGetLevelNameOutOfRange(t *testing.T) {
+	m := NewMagnumRouterWithConn(NewFakeConn(2, 2), 2, 2, 2, WithLevelNames([]string{"VIDEO"}))
+	tests := []struct {
+		level uint
+		want  string
+	}{
+		{0, "VIDEO"},
+		{1, "A"},
+		{2, "B"},
+		{maxLevels, fmt.Sprint(maxLevels)},
+		{1000, "1000"},
+	}
+	for _, tt := range tests {
+		if got := m.GetLevelName(tt.level); got != tt.want {
+			t.Errorf("GetLevelName(%d) = %q, want %q", tt.level, got, tt.want)
+		}
+	}
+}
+
+func TestLevelNameQueryNotSupported(t *testing.T) {
+	m := NewMagnumRouterWithConn(NewFakeConn(2, 2), 2, 2, 2)
+	if err := m.RequestAllLevelNames(); !errors.Is(err, ErrNotSupported) {
+		t.Errorf("RequestAllLevelNames() = %v, want ErrNotSupported", err)
+	}
+	failover := &failoverConn{conns: [2]QuartzConn{NewFakeConn(2, 2), NewFakeConn(2, 2)}}
+	if err := failover.GetLevelName(quartz.QUARTZ_LVL_V); !errors.Is(err, ErrNotSupported) {
+		t.Errorf("failover GetLevelName() = %v, want ErrNotSupported", err)
+	}
+}
+
+// A scriptConn able to query level names, as a device supporting them would be
+type levelQueryConn struct {
+	*scriptConn
+}
+
+func (c levelQueryConn) GetLevelName(level quartz.QuartzLevel) error {
+	return c.record("get level %s", level)
+}
+
+func TestLevelNamesFromDevice(t *testing.T) {
+	conn := levelQueryConn{newScriptConn()}
+	m := NewMagnumRouterWithConn(conn, 1, 1, 3, WithLevelNameQuery(true), WithSyncErrorPolicy(SyncBestEffort))
+	defer m.Close()
+	if err := m.Connect(); err != nil {
+		t.Fatalf("connect: %v", err)
+	}
+	queries := []string{}
+	for _, call := range conn.recorded() {
+		if strings.HasPrefix(call, "get level") {
+			queries = append(queries, call)
+		}
+	}
+	if want := []string{"get level V", "get level A", "get level B"}; !reflect.DeepEqual(queries, want) {
+		t.Errorf("sent %q, want %q", queries, want)
+	}
+
+	// Levels the device does not answer keep their static letter
+	conn.inject(&quartz.ResponseReadLevel{Level: quartz.QUARTZ_LVL_A, Name: "AUDIO"})
+	eventually(t, func() bool { return m.GetLevelName(1) == "AUDIO" })
+	if got := m.GetLevelName(0); got != "V" {
+		t.Errorf("GetLevelName(0) = %q, want V", got)
+	}
+}
+
+func TestLevelNameChange(t *testing.T) {
+	m := NewMagnumRouterWithConn(NewFakeConn(2, 2), 2, 2, 2)
+	events, unsubscribe := m.Subscribe()
+	defer unsubscribe()
+	_, gen, _ := m.RouteTableIfChanged(0)
+
+	m.processMessage(&quartz.ResponseReadLevel{Level: quartz.QUARTZ_LVL_A, Name: "AUDIO"})
+	if len(events) != 1 {
+		t.Fatalf("%d events for a new level name, want 1", len(events))
+	}
+	if ev := <-events; ev.Type != EventLevelNameChange || ev.Level != 1 || ev.Name != "AUDIO" {
+		t.Errorf("event %+v, want level 1 named AUDIO", ev)
+	}
+	if _, next, changed := m.RouteTableIfChanged(gen); !changed {
+		t.Error("generation unchanged by a new level name")
+	} else {
+		gen = next
+	}
+
+	// The same name again is not a change
+	m.processMessage(&quartz.ResponseReadLevel{Level: quartz.QUARTZ_LVL_A, Name: "AUDIO"})
+	if len(events) != 0 {
+		t.Errorf("event %+v for an unchanged level name", <-events)
+	}
+	if _, _, changed := m.RouteTableIfChanged(gen); changed {
+		t.Error("generation changed by an unchanged level name")
+	}
+}
+
+func TestLevelNamesNotQueriedByDefault(t *testing.T) {
+	conn := levelQueryConn{newScriptConn()}
+	m := NewMagnumRouterWithConn(conn, 1, 1, 3, WithSyncErrorPolicy(SyncBestEffort))
+	defer m.Close()
+	if err := m.Connect(); err != nil {
+		t.Fatalf("connect: %v", err)
+	}
+	for _, call := range conn.recorded() {
+		if strings.HasPrefix(call, "get level") {
+			t.Errorf("sent %q without WithLevelNameQuery", call)
+		}
+	}
+}
+
+func TestLevelMappingMatchesLegacyLetters(t *testing.T) {
+	m := NewMagnumRouterWithConn(NewFakeConn(2, 2), 2, 2, maxLevels)
+	mapping := m.LevelMapping()
+	if len(mapping) != int(maxLevels) {
+		t.Fatalf("LevelMapping() has %d levels, want %d", len(mapping), maxLevels)
+	}
+	for id, letter := range "VABCDEFGHIJKLMNOPQRSTUWXYZ" {
+		want := quartz.QuartzLevel(string(letter))
+		if got := mapping[uint(id)]; got != want {
+			t.Errorf("LevelMapping()[%d] = %q, want %q", id, got, want)
+		}
+		if got, ok := m.LevelForID(uint(id)); !ok || got != want {
+			t.Errorf("LevelForID(%d) = %q, %v, want %q", id, got, ok, want)
+		}
+	}
+
+	// A copy, so changing it leaves the router alone
+	mapping[0] = "X"
+	if got := m.LevelMapping()[0]; got != quartz.QUARTZ_LVL_V {
+		t.Errorf("LevelMapping()[0] after changing a copy = %q, want V", got)
+	}
+}
+
+func TestLevelForIDOutOfRange(t *testing.T) {
+	m := NewMagnumRouterWithConn(NewFakeConn(2, 2), 2, 2, 2)
+	if got := len(m.LevelMapping()); got != 2 {
+		t.Errorf("LevelMapping() has %d levels, want 2", got)
+	}
+	if got, ok := m.LevelForID(2); ok {
+		t.Errorf("LevelForID(2) = %q, want not configured", got)
+	}
+}
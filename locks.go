@@ -0,0 +1,105 @@
+package magnumrouter
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+)
+
+// Returns the IDs of all destinations whose cached lock status is locked
+func (m *MagnumRouter) LockedDestinations() []uint {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	locked := []uint{}
+	for i := int(m.base()); i < len(m.destinationLocks); i++ {
+		if m.destinationLocks[i] {
+			locked = append(locked, uint(i))
+		}
+	}
+	return locked
+}
+
+// Returns the IDs of destinations locked by this router, in ascending order
+// A destination is held from a successful lock command until this router unlocks it or the device reports it unlocked,
+// so locks taken by other operators are never included
+func (m *MagnumRouter) MyLockedDestinations() []uint {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	locked := make([]uint, 0, len(m.ownLocks))
+	for dest := range m.ownLocks {
+		locked = append(locked, dest)
+	}
+	sort.Slice(locked, func(i, j int) bool { return locked[i] < locked[j] })
+	return locked
+}
+
+// Unlocks every destination locked by this router, leaving locks held by others in place
+// Intended for shutdown, so a restarting service does not leave destinations locked
+// All destinations are attempted, failures are joined into the returned error per destination
+// Stops early if the context is cancelled
+func (m *MagnumRouter) ReleaseMyLocks(ctx context.Context) error {
+	ctx = m.correlate(ctx)
+	errs := []error{}
+	for _, dest := range m.MyLockedDestinations() {
+		if err := ctx.Err(); err != nil {
+			errs = append(errs, err)
+			break
+		}
+		if err := m.setLock(ctx, "ReleaseMyLocks", dest, false); err != nil {
+			errs = append(errs, fmt.Errorf("destination %d: %w", dest, err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// Unlocks every destination that is currently cached as locked
+// All destinations are attempted, failures are joined into the returned error per destination
+// Stops early if the context is cancelled
+func (m *MagnumRouter) UnlockAll(ctx context.Context) error {
+	ctx = m.correlate(ctx)
+	errs := []error{}
+	for _, dest := range m.LockedDestinations() {
+		if err := ctx.Err(); err != nil {
+			errs = append(errs, err)
+			break
+		}
+		if err := m.setLock(ctx, "UnlockAll", dest, false); err != nil {
+			errs = append(errs, fmt.Errorf("destination %d: %w", dest, err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// Sets a lock status for some levels of a destination
+// Magnum over quartz only locks whole destinations, so levels must cover every level, behaving as SetLock()
+// Returns ErrNotSupported if only some levels are given, and ErrLevelOutOfRange for an unknown level
+func (m *MagnumRouter) SetLevelLock(destination uint, levels []uint, lock bool) error {
+	m.mu.RLock()
+	covered := map[uint]bool{}
+	for _, lvl := range levels {
+		if err := m.checkLevelLocked(lvl); err != nil {
+			m.mu.RUnlock()
+			return err
+		}
+		covered[lvl] = true
+	}
+	all := uint(len(covered)) == m.levelCount
+	m.mu.RUnlock()
+	if !all {
+		return fmt.Errorf("%w: per level locks", ErrNotSupported)
+	}
+	return m.setLock(context.Background(), "SetLevelLock", destination, lock)
+}
+
+// Returns whether a level of a destination is locked
+// Locks cover whole destinations, so this is the destination's lock status for every valid level
+// Returns false for an unknown destination or level
+func (m *MagnumRouter) GetLevelLock(destination uint, level uint) bool {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	if m.checkDestinationLocked(destination) != nil || m.checkLevelLocked(level) != nil {
+		return false
+	}
+	return m.destinationLocks[destination]
+}
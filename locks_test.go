@@ -0,0 +1,157 @@
+package magnumrouter
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/cassaram/quartz"
+)
+
+// A scriptConn failing to send the unlock of one destination
+type failUnlockConn struct {
+	*scriptConn
+	fail uint
+}
+
+func (c *failUnlockConn) UnlockDestination(dest uint) error {
+	if dest == c.fail {
+		return errors.New("write failed")
+	}
+	return c.scriptConn.UnlockDestination(dest)
+}
+
+func TestUnlockAll(t *testing.T) {
+	conn := &failUnlockConn{scriptConn: newScriptConn(), fail: 3}
+	m := NewMagnumRouterWithConn(conn, 5, 5, 1, WithNoInitialSync())
+	if err := m.Connect(); err != nil {
+		t.Fatalf("connect: %v", err)
+	}
+	defer m.Close()
+	for _, dest := range []uint{1, 3, 4} {
+		m.processMessage(&quartz.ResponseLockStatus{Destination: dest, Locked: true})
+	}
+	if got, want := m.LockedDestinations(), []uint{1, 3, 4}; !reflect.DeepEqual(got, want) {
+		t.Fatalf("LockedDestinations() = %v, want %v", got, want)
+	}
+
+	err := m.UnlockAll(context.Background())
+	if err == nil || !strings.Contains(err.Error(), "destination 3") || strings.Contains(err.Error(), "destination 1") {
+		t.Errorf("UnlockAll() = %v, want only the failure of destination 3", err)
+	}
+	unlocks := []string{}
+	for _, call := range conn.recorded() {
+		if strings.HasPrefix(call, "unlock") {
+			unlocks = append(unlocks, call)
+		}
+	}
+	if want := []string{"unlock 1", "unlock 4"}; !reflect.DeepEqual(unlocks, want) {
+		t.Errorf("sent %v, want %v", unlocks, want)
+	}
+}
+
+func TestUnlockAllNothingLocked(t *testing.T) {
+	m, conn := newScriptRouter(t, 2, 2, 1)
+	if got := m.LockedDestinations(); len(got) != 0 {
+		t.Errorf("LockedDestinations() = %v, want none", got)
+	}
+	if err := m.UnlockAll(context.Background()); err != nil {
+		t.Errorf("UnlockAll() = %v", err)
+	}
+	for _, call := range conn.recorded() {
+		if strings.HasPrefix(call, "unlock") {
+			t.Errorf("sent %q with nothing locked", call)
+		}
+	}
+}
+
+func TestSetLevelLockAllLevels(t *testing.T) {
+	m, conn := newScriptRouter(t, 3, 3, 2)
+	if err := m.SetLevelLock(2, []uint{1, 0}, true); err != nil {
+		t.Fatalf("SetLevelLock() = %v", err)
+	}
+	if got, want := conn.recorded()[1:], []string{"lock 2"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("sent %q, want %q", got, want)
+	}
+	if err := m.SetLevelLock(2, []uint{0}, true); !errors.Is(err, ErrNotSupported) {
+		t.Errorf("SetLevelLock() of one level = %v, want ErrNotSupported", err)
+	}
+	if err := m.SetLevelLock(2, []uint{0, 1, 2}, true); !errors.Is(err, ErrLevelOutOfRange) {
+		t.Errorf("SetLevelLock() of level 2 = %v, want ErrLevelOutOfRange", err)
+	}
+	if got := len(conn.recorded()); got != 2 {
+		t.Errorf("%d calls recorded, want nothing sent for rejected locks", got)
+	}
+}
+
+func TestGetLevelLock(t *testing.T) {
+	m := NewMagnumRouterWithConn(NewFakeConn(3, 3), 3, 3, 2)
+	m.processMessage(&quartz.ResponseLockStatus{Destination: 2, Locked: true})
+	for lvl := uint(0); lvl < 2; lvl++ {
+		if !m.GetLevelLock(2, lvl) {
+			t.Errorf("GetLevelLock(2, %d) = false, want the destination lock", lvl)
+		}
+		if m.GetLevelLock(1, lvl) {
+			t.Errorf("GetLevelLock(1, %d) = true for an unlocked destination", lvl)
+		}
+	}
+	if m.GetLevelLock(2, 2) {
+		t.Error("GetLevelLock() = true for an unknown level")
+	}
+	if m.GetLevelLock(4, 0) {
+		t.Error("GetLevelLock() = true for an unknown destination")
+	}
+}
+
+func TestReleaseMyLocks(t *testing.T) {
+	m, conn := newScriptRouter(t, 5, 5, 1)
+	// Destination 2 was locked by another operator
+	m.processMessage(&quartz.ResponseLockStatus{Destination: 2, Locked: true})
+	for _, dest := range []uint{4, 1, 3} {
+		if err := m.SetLock(dest, true); err != nil {
+			t.Fatalf("SetLock(%d): %v", dest, err)
+		}
+	}
+	// Unlocked on the device by someone else, so no longer held
+	m.processMessage(&quartz.ResponseLockStatus{Destination: 3, Locked: false})
+	if got, want := m.MyLockedDestinations(), []uint{1, 4}; !reflect.DeepEqual(got, want) {
+		t.Fatalf("MyLockedDestinations() = %v, want %v", got, want)
+	}
+
+	if err := m.ReleaseMyLocks(context.Background()); err != nil {
+		t.Fatalf("ReleaseMyLocks() = %v", err)
+	}
+	unlocks := []string{}
+	for _, call := range conn.recorded() {
+		if strings.HasPrefix(call, "unlock") {
+			unlocks = append(unlocks, call)
+		}
+	}
+	if want := []string{"unlock 1", "unlock 4"}; !reflect.DeepEqual(unlocks, want) {
+		t.Errorf("sent %q, want %q", unlocks, want)
+	}
+	if got := m.MyLockedDestinations(); len(got) != 0 {
+		t.Errorf("MyLockedDestinations() after release = %v, want none", got)
+	}
+}
+
+func TestReleaseMyLocksFailedUnlock(t *testing.T) {
+	conn := &failUnlockConn{scriptConn: newScriptConn(), fail: 2}
+	m := NewMagnumRouterWithConn(conn, 3, 3, 1, WithNoInitialSync())
+	defer m.Close()
+	if err := m.Connect(); err != nil {
+		t.Fatalf("connect: %v", err)
+	}
+	if err := m.SetLock(2, true); err != nil {
+		t.Fatal(err)
+	}
+	if err := m.ReleaseMyLocks(context.Background()); err == nil {
+		t.Fatal("ReleaseMyLocks() = nil, want the failed unlock")
+	}
+	// The lock is still held, so the release can be retried
+	if got, want := m.MyLockedDestinations(), []uint{2}; !reflect.DeepEqual(got, want) {
+		t.Errorf("MyLockedDestinations() = %v, want %v", got, want)
+	}
+}
@@ -1,36 +1,149 @@
 package magnumrouter
 
-import "github.com/cassaram/quartz"
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/rand"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
+
+	"github.com/cassaram/quartz"
+)
 
 type MagnumRouter struct {
 	address          string
 	port             uint16
-	conn             quartz.Quartz
+	conn             QuartzConn
 	sourceNames      []string
 	destinationNames []string
 	destinationLocks []bool
-	routeTable       [][]uint
-	stop             bool
+	levelNames       []string
+	routes           routeStore
+	levelCount       uint
+	opts             options
+	mu               sync.RWMutex
+	stateMu          sync.Mutex
+	state            ConnectionState
+	publishedState   ConnectionState
+	// Last state handed to the state handler and subscribers, and whether a publish loop is running
+	deliveredState   ConnectionState
+	publishing       bool
+	stateTimer       Timer
+	syncErrors       []error
+	failedQueries    []syncQuery
+	syncRetryCancel  context.CancelFunc
+	stats            connStats
+	syncComplete     bool
+	syncing          int
+	syncIdle         chan struct{}
+	connectCancel    context.CancelCauseFunc
+	connectDone      chan struct{}
+	connectErr       error
+	retrying         int
+	readySignal      chan struct{}
+	closed           bool
+	linked           bool
+	routeHistory     map[crosspoint]*routeHistory
+	subMu            sync.Mutex
+	subscribers      map[uint64]chan Event
+	stateSubscribers map[uint64]*stateSubscriber
+	throttled        map[uint64]*throttledSubscriber
+	subsClosed       bool
+	nextSubID        uint64
+	eventSeq         uint64
+	respMu           sync.Mutex
+	respCount        uint64
+	rejectCount      uint64
+	respSignal       chan struct{}
+	recorder         *json.Encoder
+	whitelists       map[uint]map[uint]bool
+	handlerMu        sync.Mutex
+	handlerStop      chan struct{}
+	handlerExited    chan struct{}
+	abandonedDial    chan struct{}
+	failover         *failoverConn
+	jitterMu         sync.Mutex
+	jitter           *rand.Rand
+	writeMu          sync.Mutex
+	ackMu            sync.Mutex
+	ackQueue         []chan error
+	generation       uint64
+	resolved         resolverCache
+	followMu         sync.Mutex
+	follows          map[uint]uint
+	followStop       func()
+	sourceTags       map[uint]map[string]string
+	destinationTags  map[uint]map[string]string
+	ownLocks         map[uint]bool
+	pause            pauseState
+	learned          map[learnedKey]struct{}
+	salvos           salvoStore
+	auditMu          sync.Mutex
+	actor            string
+	bulkDepth        int
 }
 
 // Returns a reference to a new magnum router instance after configuration
 // Level count is the number of levels supported by the quartz interface
 // Typically 17 levels, 1 for video + 16 audio channels
 // DestinationCount and SourceCount are the number of destinations / sources available in the Magnum interface
-func NewMagnumRouter(address string, port uint16, sourceCount uint, destinationCount uint, levelCount uint) *MagnumRouter {
+// Optional behaviour can be configured with the With* options, use NewMagnumRouterWithOptions() to have them validated
+// The quartz connection is created in magnum mode, which only selects the magnum dialect of the protocol,
+// rejecting commands magnum does not support such as level name queries and name writes
+// It does not restrict routing, use WithMonitorMode() for a router that only observes
+func NewMagnumRouter(address string, port uint16, sourceCount uint, destinationCount uint, levelCount uint, opts ...Option) *MagnumRouter {
+	r := NewMagnumRouterWithConn(NewQuartzConn(quartz.NewQuartz(address, port, true)), sourceCount, destinationCount, levelCount, opts...)
+	r.address = address
+	r.port = port
+	return r
+}
+
+// Returns a new magnum router instance as per NewMagnumRouter(), after validating the options
+// Returns an error wrapping ErrInvalidOptions listing every problem found, such as negative durations or
+// more level names than levels
+func NewMagnumRouterWithOptions(address string, port uint16, sourceCount uint, destinationCount uint, levelCount uint, opts ...Option) (*MagnumRouter, error) {
+	if _, err := buildOptions(levelCount, opts); err != nil {
+		return nil, err
+	}
+	return NewMagnumRouter(address, port, sourceCount, destinationCount, levelCount, opts...), nil
+}
+
+// Returns a reference to a new magnum router instance using an existing quartz connection
+// The connection should not yet be connected, the router connects it in Connect()
+// Use NewQuartzConn() to supply a quartz.Quartz, or supply a custom QuartzConn for testing
+// Counts and options are as per NewMagnumRouter()
+func NewMagnumRouterWithConn(conn QuartzConn, sourceCount uint, destinationCount uint, levelCount uint, opts ...Option) *MagnumRouter {
 	r := MagnumRouter{
-		address:          address,
-		port:             port,
-		conn:             *quartz.NewQuartz(address, port, true),
-		sourceNames:      make([]string, sourceCount+1),
-		destinationNames: make([]string, destinationCount+1),
-		destinationLocks: make([]bool, destinationCount+1),
-		routeTable:       make([][]uint, destinationCount+1),
-		stop:             false,
+		conn:             conn,
+		levelNames:       make([]string, levelCount),
+		levelCount:       levelCount,
+		opts:             defaultOptions(),
+		routeHistory:     map[crosspoint]*routeHistory{},
+		subscribers:      map[uint64]chan Event{},
+		stateSubscribers: map[uint64]*stateSubscriber{},
+		respSignal:       make(chan struct{}),
+		whitelists:       map[uint]map[uint]bool{},
+		ownLocks:         map[uint]bool{},
+	}
+	for _, opt := range opts {
+		opt(&r.opts)
+	}
+	r.sourceNames = make([]string, r.base()+sourceCount)
+	r.destinationNames = make([]string, r.base()+destinationCount)
+	r.destinationLocks = make([]bool, r.base()+destinationCount)
+	if r.opts.recorder != nil {
+		r.recorder = json.NewEncoder(r.opts.recorder)
 	}
-	for i := 0; i < len(r.routeTable); i++ {
-		r.routeTable[i] = make([]uint, levelCount)
+	r.routes = r.newRouteStore(r.base()+destinationCount, levelCount)
+	if r.opts.jitterSource == nil {
+		r.opts.jitterSource = rand.NewSource(time.Now().UnixNano())
 	}
+	r.jitter = rand.New(r.opts.jitterSource)
+	r.installFailover()
 
 	return &r
 }
@@ -38,148 +151,416 @@ func NewMagnumRouter(address string, port uint16, sourceCount uint, destinationC
 // Connect to the magnum server
 // This will also try to pull all information from the server in terms of routes, names, and lock status
 // Any errors will cause the connection to close and will be returned
+// With SyncBestEffort, failed queries are recorded in SyncErrors() instead and only link errors are returned
+// With WithNoInitialSync(), no queries are sent and the cache is left for the application to fill
+// Returns ErrAlreadyConnected if the router is already connected or connecting, and ErrClosed after Close()
 func (m *MagnumRouter) Connect() error {
-	m.stop = false
-	go m.handleResponses(m.conn.RxMessages)
-	err := m.conn.Connect()
+	return m.ConnectContext(context.Background())
+}
+
+// Connect to the magnum server as per Connect(), giving up when the context is done
+// The context bounds both establishing the link and the initial sync
+// Calling Disconnect() while connecting aborts the connect, which then returns ErrConnectAborted
+func (m *MagnumRouter) ConnectContext(ctx context.Context) (err error) {
+	if err := m.checkOpen(); err != nil {
+		return err
+	}
+	ctx, cancel := context.WithCancelCause(ctx)
+	done := make(chan struct{})
+	// Registered with the state change so a Disconnect can never see connecting without a connect to abort
+	connecting := m.transitionState(func(current ConnectionState) bool {
+		if current != StateDisconnected || m.closed {
+			return false
+		}
+		m.connectCancel = cancel
+		m.connectDone = done
+		m.connectErr = nil
+		return true
+	}, StateConnecting)
+	if !connecting {
+		cancel(nil)
+		if err := m.checkOpen(); err != nil {
+			return err
+		}
+		return ErrAlreadyConnected
+	}
+	defer func() {
+		cancel(nil)
+		m.stateMu.Lock()
+		m.connectCancel = nil
+		m.connectDone = nil
+		m.connectErr = err
+		m.signalReadyLocked()
+		m.stateMu.Unlock()
+		close(done)
+	}()
+
+	err = m.connect(ctx)
+	if err != nil && errors.Is(context.Cause(ctx), ErrConnectAborted) {
+		return fmt.Errorf("%w: %w", ErrConnectAborted, err)
+	}
+	return err
+}
+
+func (m *MagnumRouter) connect(ctx context.Context) error {
+	m.setSyncComplete(false)
+	err := m.dial(ctx)
 	if err != nil {
-		m.stop = true
+		m.setState(StateDisconnected)
 		return err
 	}
+	m.stateMu.Lock()
+	m.linked = true
+	m.stateMu.Unlock()
+	m.resetLearned()
+	m.startHandler()
 
 	// Get all inital information
-	if m.RequestAllSourceNames() != nil {
-		m.stop = true
-		return err
+	if !m.opts.noInitialSync {
+		err = m.initialSync(ctx)
+		if err != nil {
+			m.stopHandler()
+			m.conn.Disconnect()
+			m.setState(StateDisconnected)
+			return err
+		}
 	}
-	if m.RequestAllDestinationNames() != nil {
-		m.stop = true
-		return err
+
+	m.setSyncComplete(true)
+	m.setState(StateConnected)
+	m.startSyncRetry()
+	return nil
+}
+
+// Runs the initial sync of a connection, then the post sync validation if set
+// Validation needs the responses, so with it set the sync waits for a response to every query
+func (m *MagnumRouter) initialSync(ctx context.Context) error {
+	if m.opts.postSyncValidation == nil {
+		return m.requestAll(ctx)
 	}
-	if m.RequestAllDestinationLocks() != nil {
-		m.stop = true
+	if err := m.requestAllAndWait(ctx); err != nil {
 		return err
 	}
-	if m.RequestAllRoutes() != nil {
-		m.stop = true
-		return err
+	if err := m.opts.postSyncValidation(m); err != nil {
+		return fmt.Errorf("post sync validation: %w", err)
 	}
-
 	return nil
 }
 
+// Establishes the link, abandoning it if the context is done first
+// The quartz layer cannot cancel a dial in progress, so an abandoned dial is closed once it completes
+// and the next dial waits for that to happen
+func (m *MagnumRouter) dial(ctx context.Context) error {
+	if m.abandonedDial != nil {
+		select {
+		case <-m.abandonedDial:
+			m.abandonedDial = nil
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+	result := make(chan error, 1)
+	go func() {
+		result <- m.conn.Connect()
+	}()
+	select {
+	case err := <-result:
+		return err
+	case <-ctx.Done():
+		abandoned := make(chan struct{})
+		m.abandonedDial = abandoned
+		go func() {
+			if <-result == nil {
+				m.conn.Disconnect()
+			}
+			close(abandoned)
+		}()
+		return ctx.Err()
+	}
+}
+
 // Disconnect from the magnum server
+// A connect in progress is aborted, returning once it has cleaned up
+// Returns ErrNotConnected if the router is not connected
 func (m *MagnumRouter) Disconnect() error {
-	m.stop = true
+	// Abort a connect in progress and wait for it to clean up
+	m.stateMu.Lock()
+	cancel, done := m.connectCancel, m.connectDone
+	m.stateMu.Unlock()
+	if cancel != nil {
+		cancel(ErrConnectAborted)
+		<-done
+		if m.State() == StateDisconnected {
+			return nil
+		}
+	}
+	if m.State() == StateDisconnected {
+		return ErrNotConnected
+	}
+	m.stopSyncRetry()
+	m.stopHandler()
+	m.setSyncComplete(false)
+	m.setState(StateDisconnected)
 	return m.conn.Disconnect()
 }
 
+// Starts the response handler for a new connection, after the previous handler has exited
+func (m *MagnumRouter) startHandler() {
+	m.handlerMu.Lock()
+	defer m.handlerMu.Unlock()
+	if m.handlerExited != nil {
+		<-m.handlerExited
+	}
+	stop := make(chan struct{})
+	exited := make(chan struct{})
+	m.handlerStop = stop
+	m.handlerExited = exited
+	// Taken now, as a channel closed before the goroutine runs must still be seen as the link dropping
+	rx := m.conn.RxMessages()
+	go func() {
+		defer close(exited)
+		m.handleResponses(rx, stop)
+	}()
+}
+
+// Signals the response handler to stop without waiting for it to exit
+func (m *MagnumRouter) stopHandler() {
+	m.handlerMu.Lock()
+	defer m.handlerMu.Unlock()
+	if m.handlerStop != nil {
+		close(m.handlerStop)
+		m.handlerStop = nil
+	}
+}
+
+// Moves to the disconnected state after the quartz layer closed its message channel
+// Called from the response handler, which exits straight after
+func (m *MagnumRouter) connectionLost() {
+	if m.State() == StateDisconnected {
+		return
+	}
+	m.opts.logger.Error("magnum connection lost, quartz closed its message channel")
+	m.stateMu.Lock()
+	m.connectErr = fmt.Errorf("%w: connection lost", ErrNotConnected)
+	m.stateMu.Unlock()
+	m.stopSyncRetry()
+	m.stopHandler()
+	m.setSyncComplete(false)
+	m.setState(StateDisconnected)
+}
+
 // Parses all return infromation from the server and stores it in cache
 // Is automatically stopped / started with Connect() and Disconnect() methods
-func (m *MagnumRouter) handleResponses(rxchan chan quartz.QuartzResponse) {
+// Returns once stop is closed or rxchan is closed, a nil stop never fires
+// A closed rxchan means the connection was lost, and moves the router to the disconnected state
+func (m *MagnumRouter) handleResponses(rxchan <-chan quartz.QuartzResponse, stop <-chan struct{}) {
 	for {
-		if m.stop {
+		var msg quartz.QuartzResponse
+		var ok bool
+		select {
+		case <-stop:
 			return
+		case msg, ok = <-rxchan:
 		}
-
-		msg := <-rxchan
-		switch msg.GetType() {
-		case quartz.QUARTZ_RESP_TYPE_ACK:
-			// Ignore
-		case quartz.QUARTZ_RESP_TYPE_ERR:
-			// Ignore
-		case quartz.QUARTZ_RESP_TYPE_PWRON:
-			// Ignore
-		case quartz.QUARTZ_RESP_TYPE_UPDATE:
-			// Update our route table
-			updateMsg := msg.(*quartz.ResponseUpdate)
-			for _, level := range updateMsg.Levels {
-				m.routeTable[updateMsg.Destination][quartzLevelToID(level)] = updateMsg.Source
-			}
-		case quartz.QUARTZ_RESP_TYPE_READ_DST:
-			// Update name table
-			nameMsg := msg.(*quartz.ResponseReadDestination)
-			m.destinationNames[nameMsg.Destination] = nameMsg.Name
-		case quartz.QUARTZ_RESP_TYPE_READ_SRC:
-			// Update name table
-			nameMsg := msg.(*quartz.ResponseReadSource)
-			m.sourceNames[nameMsg.Source] = nameMsg.Name
-		case quartz.QUARTZ_RESP_TYPE_READ_LVL:
-			// Not supported by magnum, ignore
-		case quartz.QUARTZ_RESP_TYPE_LOCK_STS:
-			lockMsg := msg.(*quartz.ResponseLockStatus)
-			m.destinationLocks[lockMsg.Destination] = lockMsg.Locked
-		}
-	}
-}
-
-// Request all source names from Magnum
-// Results are cached and can be accessed via MagnumRouter.GetSourceNameTable() or MagnumRouter.GetSourceName(source)
-func (m *MagnumRouter) RequestAllSourceNames() error {
-	for i := 1; i < len(m.sourceNames); i++ {
-		err := m.conn.GetSourceName(uint(i))
-		if err != nil {
-			return err
+		if !ok {
+			m.connectionLost()
+			return
 		}
+		m.processMessage(msg)
 	}
-	return nil
 }
 
-// Request all destination names from Magnum
-// Results are cached and can be accessed via MagnumRouter.GetDestinationNameTable() or MagnumRouter.GetDestinationName(destination)
-func (m *MagnumRouter) RequestAllDestinationNames() error {
-	for i := 1; i < len(m.destinationNames); i++ {
-		err := m.conn.GetDestinationName(uint(i))
-		if err != nil {
-			return err
+// Applies a single message from the server to the cache and publishes the resulting events
+// Does not touch the connection, so crafted messages can be fed directly to exercise the cache and events
+// A panic while processing, such as from a malformed message, drops the message and publishes an EventError
+// so the response loop keeps running instead of taking down the host process
+func (m *MagnumRouter) processMessage(msg quartz.QuartzResponse) {
+	// Quartz delivers nil for lines it fails to parse
+	if msg == nil {
+		return
+	}
+	defer func() {
+		if r := recover(); r != nil {
+			err := fmt.Errorf("%w: %v", ErrMessagePanic, r)
+			m.opts.logger.Error("magnum message processing panicked, message dropped", "error", err, "message", fmt.Sprintf("%#v", msg))
+			m.dispatch([]Event{{Type: EventError, Err: err}})
 		}
+	}()
+	if m.opts.rawMessageHook != nil {
+		m.opts.rawMessageHook(msg)
 	}
-	return nil
+	m.record(msg)
+	if m.holdWhilePaused(msg) {
+		return
+	}
+	m.applyAndPublish(msg)
 }
 
-// Request all destination locks from Magnum
-// Results are cached and can be accessed via MagnumRouter.GetDestinationLockTable() or MagnumRouter.GetDestinationLock(destination)
-func (m *MagnumRouter) RequestAllDestinationLocks() error {
-	for i := 1; i < len(m.destinationLocks); i++ {
-		err := m.conn.GetDestinationLock(uint(i))
-		if err != nil {
-			return err
+// Applies a message to the cache, publishing its events and counting it if a query response
+func (m *MagnumRouter) applyAndPublish(msg quartz.QuartzResponse) {
+	events := m.update(func() []Event { return m.applyMessageLocked(msg) })
+	for _, ev := range events {
+		if ev.Type == EventError {
+			m.opts.logger.Warn("magnum response out of range, dropped", "error", ev.Err, "message", msg.GetRaw())
 		}
 	}
-	return nil
+	if isQueryResponse(msg) {
+		m.countResponse()
+	}
+	if msg.GetType() == quartz.QUARTZ_RESP_TYPE_ERR {
+		m.countRejection()
+	}
 }
 
-// Request all routes from Magnum
-// Results are cached and can be accessed via MagnumRouter.GetRouteTable() or MagnumRouter.GetRoute(levels, destination)
-func (m *MagnumRouter) RequestAllRoutes() error {
-	for destIdx := 1; destIdx < len(m.routeTable); destIdx++ {
-		for lvlIdx := 0; lvlIdx < len(m.routeTable[destIdx]); lvlIdx++ {
-			err := m.conn.GetRoute(idToQuartzLevel(uint(lvlIdx)), uint(destIdx))
-			if err != nil {
-				return err
+// Applies a message to the cache, returning the events to publish once unlocked, mu must be held
+func (m *MagnumRouter) applyMessageLocked(msg quartz.QuartzResponse) []Event {
+	events := []Event{}
+	changed := false
+	switch msg.GetType() {
+	case quartz.QUARTZ_RESP_TYPE_ACK:
+		m.resolveAck(nil)
+	case quartz.QUARTZ_RESP_TYPE_ERR:
+		m.resolveAck(fmt.Errorf("%w: %q", ErrCommandRejected, msg.GetRaw()))
+	case quartz.QUARTZ_RESP_TYPE_PWRON:
+		// Ignore
+	case quartz.QUARTZ_RESP_TYPE_UPDATE:
+		// Update our route table
+		updateMsg := msg.(*quartz.ResponseUpdate)
+		if err := errors.Join(m.checkDestinationLocked(updateMsg.Destination), m.checkSourceLocked(updateMsg.Source)); err != nil {
+			return []Event{m.responseOutOfRange(err)}
+		}
+		for _, level := range updateMsg.Levels {
+			lvl := quartzLevelToID(level)
+			// Only the offending level is dropped, levels within the configured count still apply
+			if err := m.checkLevelLocked(lvl); err != nil {
+				err = fmt.Errorf("level %q, the configured level count may be too small: %w", level, err)
+				events = append(events, m.responseOutOfRange(err))
+				continue
 			}
+			initial := m.firstLearnedLocked(EventRouteChange, updateMsg.Destination, lvl)
+			if updated := m.routes.get(updateMsg.Destination, lvl) != updateMsg.Source; updated || initial {
+				changed = changed || updated
+				// Suppressed during BulkApply(), which publishes one event at the end instead
+				if m.bulkDepth == 0 {
+					events = append(events, Event{Type: EventRouteChange, Destination: updateMsg.Destination, Level: lvl, Source: updateMsg.Source, Initial: initial})
+				}
+			}
+			m.routes.set(updateMsg.Destination, lvl, updateMsg.Source)
+			m.recordRouteHistory(updateMsg.Destination, lvl, updateMsg.Source)
+		}
+	case quartz.QUARTZ_RESP_TYPE_READ_DST:
+		// Update name table
+		nameMsg := msg.(*quartz.ResponseReadDestination)
+		if err := m.checkDestinationLocked(nameMsg.Destination); err != nil {
+			return []Event{m.responseOutOfRange(err)}
+		}
+		name := m.receivedName(nameMsg.Name)
+		initial := m.firstLearnedLocked(EventDestinationNameChange, nameMsg.Destination, 0)
+		if m.destinationNames[nameMsg.Destination] != name {
+			changed = true
+		}
+		if changed || initial {
+			events = append(events, Event{Type: EventDestinationNameChange, Destination: nameMsg.Destination, Name: name, Initial: initial})
+		}
+		m.destinationNames[nameMsg.Destination] = name
+	case quartz.QUARTZ_RESP_TYPE_READ_SRC:
+		// Update name table
+		nameMsg := msg.(*quartz.ResponseReadSource)
+		if err := m.checkSourceLocked(nameMsg.Source); err != nil {
+			return []Event{m.responseOutOfRange(err)}
+		}
+		name := m.receivedName(nameMsg.Name)
+		initial := m.firstLearnedLocked(EventSourceNameChange, nameMsg.Source, 0)
+		if m.sourceNames[nameMsg.Source] != name {
+			changed = true
+		}
+		if changed || initial {
+			events = append(events, Event{Type: EventSourceNameChange, Source: nameMsg.Source, Name: name, Initial: initial})
+		}
+		m.sourceNames[nameMsg.Source] = name
+	case quartz.QUARTZ_RESP_TYPE_READ_LVL:
+		// Not supported by magnum, but other devices may report names when enabled
+		levelMsg := msg.(*quartz.ResponseReadLevel)
+		lvl := quartzLevelToID(levelMsg.Level)
+		if lvl >= uint(len(m.levelNames)) {
+			break
+		}
+		name := m.receivedName(levelMsg.Name)
+		initial := m.firstLearnedLocked(EventLevelNameChange, 0, lvl)
+		if m.levelNames[lvl] != name {
+			changed = true
+		}
+		if changed || initial {
+			events = append(events, Event{Type: EventLevelNameChange, Level: lvl, Name: name, Initial: initial})
+		}
+		m.levelNames[lvl] = name
+	case quartz.QUARTZ_RESP_TYPE_LOCK_STS:
+		lockMsg := msg.(*quartz.ResponseLockStatus)
+		if err := m.checkDestinationLocked(lockMsg.Destination); err != nil {
+			return []Event{m.responseOutOfRange(err)}
+		}
+		initial := m.firstLearnedLocked(EventLockChange, lockMsg.Destination, 0)
+		if m.destinationLocks[lockMsg.Destination] != lockMsg.Locked {
+			changed = true
+		}
+		if changed || initial {
+			events = append(events, Event{Type: EventLockChange, Destination: lockMsg.Destination, Locked: lockMsg.Locked, Initial: initial})
+		}
+		m.destinationLocks[lockMsg.Destination] = lockMsg.Locked
+		if !lockMsg.Locked {
+			delete(m.ownLocks, lockMsg.Destination)
 		}
 	}
-	return nil
+	if changed {
+		m.generation++
+	}
+	return events
+}
+
+// Drops a response, or the part of one, referring to an ID outside the configured counts, returning the EventError to publish
+// These usually mean the router was constructed with counts smaller than the device
+// Logged by processMessage() once mu is released, as the logger is user code
+func (m *MagnumRouter) responseOutOfRange(err error) Event {
+	return Event{Type: EventError, Err: fmt.Errorf("%w: %w", ErrResponseOutOfRange, err)}
+}
+
+// Returns the ID of the first source and destination
+func (m *MagnumRouter) base() uint {
+	return m.opts.indexBase
+}
+
+// Returns a name received from the device in the form it is cached
+func (m *MagnumRouter) receivedName(name string) string {
+	if m.opts.nameCharset == NameCharsetUTF8 {
+		replacement := m.opts.nameReplacement
+		if replacement == "" {
+			replacement = string(utf8.RuneError)
+		}
+		name = strings.ToValidUTF8(name, replacement)
+	}
+	if !m.opts.nameTrimming {
+		return name
+	}
+	return normalizeName(name)
 }
 
 // Returns the cached names of sources.
 // Slice Index = Source ID
-// Index 0 is unused due to it being reserved for magnum operations
+// Index 0 is unused due to it being reserved for magnum operations, unless WithIndexBase(0) is set
 func (m *MagnumRouter) GetSourceNameTable() []string {
 	return m.sourceNames
 }
 
 // Returns the cached names of destinations.
 // Slice Index = Destination ID
-// Index 0 is unused due to it being reserved for magnum operations
+// Index 0 is unused due to it being reserved for magnum operations, unless WithIndexBase(0) is set
 func (m *MagnumRouter) GetDestinationNameTable() []string {
 	return m.destinationNames
 }
 
 // Returns the cached destination lock status
 // Slice Index = Destination ID
-// Index 0 is unused due to it being reserved for magnum operations
+// Index 0 is unused due to it being reserved for magnum operations, unless WithIndexBase(0) is set
 func (m *MagnumRouter) GetDestinationLockTable() []bool {
 	return m.destinationLocks
 }
@@ -188,44 +569,217 @@ func (m *MagnumRouter) GetDestinationLockTable() []bool {
 // Dimension 0 indexes by destination ID
 // Dimension 1 indexes by router level
 // Dimension 1 values are source IDs
+// With a sparse route table this is a copy built on each call
 func (m *MagnumRouter) GetRouteTable() [][]uint {
-	return m.routeTable
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	return m.routes.table()
+}
+
+// Returns a copy of the cached route table if the cache changed since generation sinceGen, and the current generation
+// Returns nil, the current generation and false without copying anything if it has not changed,
+// so pollers can pass back the returned generation on each call and only pay for a copy on change
+// The generation covers all cached state, so a name or lock change also counts, and starts at 0
+func (m *MagnumRouter) RouteTableIfChanged(sinceGen uint64) ([][]uint, uint64, bool) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	if m.generation == sinceGen {
+		return nil, m.generation, false
+	}
+	table := m.routes.table()
+	routes := make([][]uint, len(table))
+	for i := range table {
+		routes[i] = append([]uint{}, table[i]...)
+	}
+	return routes, m.generation, true
 }
 
 // Returns the cached source of a route
 func (m *MagnumRouter) GetRoute(level uint, destination uint) uint {
-	return m.routeTable[destination][level]
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	return m.routes.get(destination, level)
 }
 
 // Returns the cached name of a source
 func (m *MagnumRouter) GetSourceName(source uint) string {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
 	return m.sourceNames[source]
 }
 
 // Returns the cached name of a destination
 func (m *MagnumRouter) GetDestinationName(destination uint) string {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
 	return m.destinationNames[destination]
 }
 
 // Retruns whether a destination is locked or not
 func (m *MagnumRouter) GetDestinationLocked(destination uint) bool {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
 	return m.destinationLocks[destination]
 }
 
 // Sets a crosspoint / route in magnum across defined level(s)
+// Returns ErrDestinationOutOfRange, ErrSourceOutOfRange or ErrLevelOutOfRange if any ID is not configured
+// Returns ErrEndpointNotConfigured for unnamed endpoints when endpoint validation is enabled
+// Returns ErrSourceNotAllowed if the source is not on the destination's whitelist
+// Returns ErrReadOnly in monitor mode, and ErrNotConnected before Connect() or after a disconnect
 func (m *MagnumRouter) SetRoute(levels []uint, destination uint, source uint) error {
+	_, err := m.setRoute(context.Background(), "SetRoute", levels, destination, source, nil)
+	return err
+}
+
+// Validates a route, returning its levels converted for quartz
+func (m *MagnumRouter) prepareRoute(levels []uint, destination uint, source uint) ([]quartz.QuartzLevel, error) {
+	if err := m.checkControl(); err != nil {
+		return nil, err
+	}
+	if err := m.checkDestination(destination); err != nil {
+		return nil, err
+	}
+	if err := m.checkSource(source); err != nil {
+		return nil, err
+	}
+	if err := m.checkEndpointsConfigured(destination, source); err != nil {
+		return nil, err
+	}
+	if err := m.checkWhitelist(destination, source); err != nil {
+		return nil, err
+	}
 	quartzLevels := []quartz.QuartzLevel{}
 	for _, lvl := range levels {
-		quartzLevels = append(quartzLevels, idToQuartzLevel(lvl))
+		if err := m.checkLevel(lvl); err != nil {
+			return nil, err
+		}
+		quartzLevel, ok := idToQuartzLevel(lvl)
+		if !ok {
+			return nil, fmt.Errorf("%w: %d", ErrLevelOutOfRange, lvl)
+		}
+		quartzLevels = append(quartzLevels, quartzLevel)
 	}
-	return m.conn.SetCrosspoint(quartzLevels, destination, source)
+	return quartzLevels, nil
 }
 
 // Sets a lock status for a destination
+// Returns ErrDestinationOutOfRange if the destination is not configured
+// Returns ErrReadOnly in monitor mode, and ErrNotConnected before Connect() or after a disconnect
 func (m *MagnumRouter) SetLock(destination uint, lock bool) error {
-	if lock {
-		return m.conn.LockDestination(destination)
-	} else {
-		return m.conn.UnlockDestination(destination)
+	return m.setLock(context.Background(), "SetLock", destination, lock)
+}
+
+// Returns whether the router was constructed with WithMonitorMode(), refusing all control operations
+func (m *MagnumRouter) IsMonitorMode() bool {
+	return m.opts.monitorMode
+}
+
+// Rejects control operations in monitor mode
+func (m *MagnumRouter) checkControl() error {
+	if err := m.checkOpen(); err != nil {
+		return err
 	}
+	if m.opts.monitorMode {
+		return fmt.Errorf("%w: monitor mode", ErrReadOnly)
+	}
+	return nil
+}
+
+// Sends a command to the server through the serialized writer
+// Commands are written one at a time, in the order send is called
+// Returns ErrNotConnected without sending unless the link is up, which includes the initial sync
+func (m *MagnumRouter) send(cmd func() error) error {
+	m.writeMu.Lock()
+	defer m.writeMu.Unlock()
+	if err := m.checkLinked(); err != nil {
+		return err
+	}
+	return cmd()
+}
+
+// Sends a sync query as per send(), but with WithSyncConcurrency() above 1 without waiting for other writes
+// Queries need no ordering against other commands, so this lets them overlap on a slow link
+func (m *MagnumRouter) sendQuery(cmd func() error) error {
+	if m.opts.syncConcurrency <= 1 {
+		return m.send(cmd)
+	}
+	if err := m.checkLinked(); err != nil {
+		return err
+	}
+	return cmd()
+}
+
+// Returns ErrNotConnected unless the link to the server is up, or ErrClosed after Close()
+// The link is up from a successful dial, so queries of the initial sync pass while commands before Connect() do not
+// Replayed routers have no device at all, so return ErrReadOnly as documented by NewReplayRouter()
+func (m *MagnumRouter) checkLinked() error {
+	if _, ok := m.conn.(replayConn); ok {
+		return ErrReadOnly
+	}
+	m.stateMu.Lock()
+	defer m.stateMu.Unlock()
+	if m.closed {
+		return ErrClosed
+	}
+	if !m.linked {
+		return ErrNotConnected
+	}
+	return nil
+}
+
+func (m *MagnumRouter) checkDestination(destination uint) error {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	return m.checkDestinationLocked(destination)
+}
+
+func (m *MagnumRouter) checkSource(source uint) error {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	return m.checkSourceLocked(source)
+}
+
+func (m *MagnumRouter) checkLevel(level uint) error {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	return m.checkLevelLocked(level)
+}
+
+// Range checks for callers already holding mu
+func (m *MagnumRouter) checkDestinationLocked(destination uint) error {
+	if destination >= uint(len(m.destinationNames)) {
+		return fmt.Errorf("%w: %d", ErrDestinationOutOfRange, destination)
+	}
+	return nil
+}
+
+func (m *MagnumRouter) checkSourceLocked(source uint) error {
+	if source >= uint(len(m.sourceNames)) {
+		return fmt.Errorf("%w: %d", ErrSourceOutOfRange, source)
+	}
+	return nil
+}
+
+func (m *MagnumRouter) checkLevelLocked(level uint) error {
+	if level >= m.levelCount {
+		return fmt.Errorf("%w: %d", ErrLevelOutOfRange, level)
+	}
+	return nil
+}
+
+// Checks both endpoints have a cached name when endpoint validation is enabled
+func (m *MagnumRouter) checkEndpointsConfigured(destination uint, source uint) error {
+	if !m.opts.validateEndpoints {
+		return nil
+	}
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	if m.destinationNames[destination] == "" {
+		return fmt.Errorf("%w: destination %d has no name", ErrEndpointNotConfigured, destination)
+	}
+	if m.sourceNames[source] == "" {
+		return fmt.Errorf("%w: source %d has no name", ErrEndpointNotConfigured, source)
+	}
+	return nil
 }
@@ -0,0 +1,503 @@
+package magnumrouter
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/cassaram/quartz"
+)
+
+func TestValidateEndpoints(t *testing.T) {
+	named := func(m *MagnumRouter) {
+		m.processMessage(&quartz.ResponseReadSource{Source: 1, Name: "CAM 1"})
+		m.processMessage(&quartz.ResponseReadDestination{Destination: 1, Name: "MON 1"})
+	}
+	tests := []struct {
+		name     string
+		validate bool
+		dest     uint
+		src      uint
+		want     error
+	}{
+		{"named endpoints", true, 1, 1, nil},
+		{"unnamed destination", true, 2, 1, ErrEndpointNotConfigured},
+		{"unnamed source", true, 1, 2, ErrEndpointNotConfigured},
+		{"unnamed without validation", false, 2, 2, nil},
+	}
+	for _, tt := range tests {
+		m, _ := newScriptRouter(t, 2, 2, 1, WithValidateEndpoints(tt.validate))
+		named(m)
+		if err := m.SetRoute([]uint{0}, tt.dest, tt.src); !errors.Is(err, tt.want) {
+			t.Errorf("%s: SetRoute() = %v, want %v", tt.name, err, tt.want)
+		}
+	}
+}
+
+func TestRawMessageHookCountsSync(t *testing.T) {
+	var mu sync.Mutex
+	counts := map[quartz.QuartzResponseType]int{}
+	total := func() int {
+		mu.Lock()
+		defer mu.Unlock()
+		n := 0
+		for _, c := range counts {
+			n += c
+		}
+		return n
+	}
+	newFakeRouter(t, 3, 2, 2, WithRawMessageHook(func(msg quartz.QuartzResponse) {
+		mu.Lock()
+		defer mu.Unlock()
+		counts[msg.GetType()]++
+	}))
+	// 3 source names, 2 destination names, 2 locks and a route for each of 2 levels on 2 destinations
+	eventually(t, func() bool { return total() >= 11 })
+	mu.Lock()
+	defer mu.Unlock()
+	want := map[quartz.QuartzResponseType]int{
+		quartz.QUARTZ_RESP_TYPE_READ_SRC: 3,
+		quartz.QUARTZ_RESP_TYPE_READ_DST: 2,
+		quartz.QUARTZ_RESP_TYPE_LOCK_STS: 2,
+		quartz.QUARTZ_RESP_TYPE_UPDATE:   4,
+	}
+	for typ, n := range want {
+		if counts[typ] != n {
+			t.Errorf("hook saw %d messages of type %v, want %d", counts[typ], typ, n)
+		}
+	}
+}
+
+func TestInjectedConnCarriesSync(t *testing.T) {
+	conn := newScriptConn()
+	m := NewMagnumRouterWithConn(conn, 2, 1, 2, WithSyncErrorPolicy(SyncBestEffort))
+	defer m.Close()
+	if err := m.Connect(); err != nil {
+		t.Fatalf("connect: %v", err)
+	}
+	want := []string{
+		"connect",
+		"get source 1", "get source 2",
+		"get destination 1",
+		"get lock 1",
+		"get route V 1", "get route A 1",
+	}
+	if got := conn.recorded(); !reflect.DeepEqual(got, want) {
+		t.Errorf("sent %q, want %q", got, want)
+	}
+}
+
+func TestNoInitialSyncSendsNoQueries(t *testing.T) {
+	m, conn := newScriptRouter(t, 4, 4, 2)
+	if got := conn.recorded(); !reflect.DeepEqual(got, []string{"connect"}) {
+		t.Errorf("sent %q on connect, want only the connect", got)
+	}
+	if !m.SyncComplete() {
+		t.Error("SyncComplete() = false with no sync to wait for")
+	}
+	if got := m.State(); got != StateConnected {
+		t.Errorf("State() = %v, want connected", got)
+	}
+	// The application can still fill the cache itself
+	if err := m.RequestAllDestinationLocks(); err != nil {
+		t.Fatalf("RequestAllDestinationLocks() = %v", err)
+	}
+	if got := len(conn.recorded()); got != 5 {
+		t.Errorf("sent %d commands after a lock refresh, want 5", got)
+	}
+}
+
+func TestClosedRxChannelStopsHandler(t *testing.T) {
+	var mu sync.Mutex
+	received := 0
+	m, conn := newScriptRouter(t, 2, 2, 1, WithRawMessageHook(func(quartz.QuartzResponse) {
+		mu.Lock()
+		received++
+		mu.Unlock()
+	}))
+	m.handlerMu.Lock()
+	exited := m.handlerExited
+	m.handlerMu.Unlock()
+
+	conn.drop()
+	select {
+	case <-exited:
+	case <-time.After(time.Second):
+		t.Fatal("handler still running after its channel closed")
+	}
+	if got := m.State(); got != StateDisconnected {
+		t.Errorf("State() = %v, want disconnected", got)
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	if received != 0 {
+		t.Errorf("handler processed %d messages from the closed channel", received)
+	}
+	if err := m.SetRoute([]uint{0}, 1, 1); !errors.Is(err, ErrNotConnected) {
+		t.Errorf("SetRoute() after the loss = %v, want ErrNotConnected", err)
+	}
+}
+
+func TestReceivedNamesTrimmed(t *testing.T) {
+	m := NewMagnumRouterWithConn(NewFakeConn(2, 2), 2, 2, 1)
+	events, unsubscribe := m.Subscribe()
+	defer unsubscribe()
+	m.processMessage(&quartz.ResponseReadSource{Source: 1, Name: "  CAM 1\x00\x00  "})
+	m.processMessage(&quartz.ResponseReadDestination{Destination: 2, Name: "MON\r\n2        "})
+	if got := m.GetSourceName(1); got != "CAM 1" {
+		t.Errorf("GetSourceName(1) = %q, want CAM 1", got)
+	}
+	if got := m.GetDestinationName(2); got != "MON 2" {
+		t.Errorf("GetDestinationName(2) = %q, want MON 2", got)
+	}
+	if ev := <-events; ev.Name != "CAM 1" {
+		t.Errorf("name change event = %q, want CAM 1", ev.Name)
+	}
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	if id, err := m.idByNameLocked(m.sourceNames, "CAM 1"); err != nil || id != 1 {
+		t.Errorf("source by name = %d, %v, want 1", id, err)
+	}
+}
+
+func TestReceivedNamesUntrimmed(t *testing.T) {
+	m := NewMagnumRouterWithConn(NewFakeConn(2, 2), 2, 2, 1, WithNameTrimming(false))
+	m.processMessage(&quartz.ResponseReadSource{Source: 1, Name: "  CAM 1  "})
+	if got := m.GetSourceName(1); got != "  CAM 1  " {
+		t.Errorf("GetSourceName(1) = %q, want the name as received", got)
+	}
+}
+
+func TestReceivedNamesCharset(t *testing.T) {
+	tests := []struct {
+		name string
+		opt  Option
+		in   string
+		want string
+	}{
+		{"raw", WithNameCharset(NameCharsetRaw, ""), "CAM\xff\xfe1", "CAM\xff\xfe1"},
+		{"replacement char", WithNameCharset(NameCharsetUTF8, ""), "CAM\xff\xfe1", "CAM\uFFFD1"},
+		{"custom replacement", WithNameCharset(NameCharsetUTF8, "?"), "CAM\xff1\xc3", "CAM?1?"},
+		{"valid kept", WithNameCharset(NameCharsetUTF8, "?"), "CAMÉRA 1", "CAMÉRA 1"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// Trimming is disabled as it would clean invalid bytes itself
+			m := NewMagnumRouterWithConn(NewFakeConn(2, 2), 2, 2, 1, WithNameTrimming(false), tt.opt)
+			m.processMessage(&quartz.ResponseReadSource{Source: 1, Name: tt.in})
+			m.processMessage(&quartz.ResponseReadDestination{Destination: 1, Name: tt.in})
+			if got := m.GetSourceName(1); got != tt.want {
+				t.Errorf("GetSourceName(1) = %q, want %q", got, tt.want)
+			}
+			if got := m.GetDestinationName(1); got != tt.want {
+				t.Errorf("GetDestinationName(1) = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestProcessMessage(t *testing.T) {
+	m := NewMagnumRouterWithConn(NewFakeConn(3, 3), 3, 3, 2)
+	events, unsubscribe := m.Subscribe()
+	defer unsubscribe()
+	msgs := []quartz.QuartzResponse{
+		update(2, 3, quartz.QUARTZ_LVL_V, quartz.QUARTZ_LVL_A),
+		// Unchanged, so no event
+		update(2, 3, quartz.QUARTZ_LVL_A),
+		&quartz.ResponseReadSource{Source: 1, Name: "CAM 1"},
+		&quartz.ResponseReadDestination{Destination: 3, Name: "MON 3"},
+		&quartz.ResponseLockStatus{Destination: 2, Locked: true},
+		&quartz.ResponseAcknowledge{RawData: ".A\r"},
+		nil,
+	}
+	for _, msg := range msgs {
+		m.processMessage(msg)
+	}
+
+	if got := m.GetRoute(0, 2); got != 3 {
+		t.Errorf("video route of destination 2 = %d, want 3", got)
+	}
+	if got := m.GetRoute(1, 2); got != 3 {
+		t.Errorf("audio route of destination 2 = %d, want 3", got)
+	}
+	if got := m.GetSourceName(1); got != "CAM 1" {
+		t.Errorf("GetSourceName(1) = %q, want CAM 1", got)
+	}
+	if got := m.GetDestinationName(3); got != "MON 3" {
+		t.Errorf("GetDestinationName(3) = %q, want MON 3", got)
+	}
+	if !m.GetDestinationLocked(2) {
+		t.Error("destination 2 not locked")
+	}
+
+	want := []Event{
+		{Type: EventRouteChange, Destination: 2, Level: 0, Source: 3},
+		{Type: EventRouteChange, Destination: 2, Level: 1, Source: 3},
+		{Type: EventSourceNameChange, Source: 1, Name: "CAM 1"},
+		{Type: EventDestinationNameChange, Destination: 3, Name: "MON 3"},
+		{Type: EventLockChange, Destination: 2, Locked: true},
+	}
+	got := []Event{}
+	for len(events) > 0 {
+		ev := <-events
+		ev.Seq = 0
+		got = append(got, ev)
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("events = %+v, want %+v", got, want)
+	}
+}
+
+// A response claiming to be an update without being a *quartz.ResponseUpdate
+type malformedResponse struct{}
+
+func (malformedResponse) GetType() quartz.QuartzResponseType { return quartz.QUARTZ_RESP_TYPE_UPDATE }
+
+func (malformedResponse) GetRaw() string { return ".UV1,1\r" }
+
+func TestMessagePanicRecovered(t *testing.T) {
+	m, conn := newScriptRouter(t, 2, 2, 1)
+	events, unsubscribe := m.Subscribe()
+	defer unsubscribe()
+	conn.inject(malformedResponse{}, update(1, 2))
+
+	select {
+	case ev := <-events:
+		if ev.Type != EventError || !errors.Is(ev.Err, ErrMessagePanic) {
+			t.Errorf("first event = %+v, want an EventError with ErrMessagePanic", ev)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("no event for the malformed message")
+	}
+	// The response loop survived and processes the next message
+	eventually(t, func() bool { return m.GetRoute(0, 1) == 2 })
+	if got := m.State(); got != StateConnected {
+		t.Errorf("State() = %v, want connected", got)
+	}
+}
+
+func TestMonitorMode(t *testing.T) {
+	for _, monitor := range []bool{false, true} {
+		t.Run(fmt.Sprint("monitor ", monitor), func(t *testing.T) {
+			m, conn := newScriptRouter(t, 2, 2, 1, WithMonitorMode(monitor))
+			if got := m.IsMonitorMode(); got != monitor {
+				t.Errorf("IsMonitorMode() = %v, want %v", got, monitor)
+			}
+			controls := map[string]func() error{
+				"SetRoute": func() error { return m.SetRoute([]uint{0}, 1, 2) },
+				"SetLock":  func() error { return m.SetLock(1, true) },
+				"SetRoutes": func() error {
+					return m.SetRoutes(context.Background(), []RouteOp{{Levels: []uint{0}, Destination: 2, Source: 1}})
+				},
+			}
+			for name, control := range controls {
+				err := control()
+				if monitor && !errors.Is(err, ErrReadOnly) {
+					t.Errorf("%s() = %v, want ErrReadOnly", name, err)
+				}
+				if !monitor && err != nil {
+					t.Errorf("%s() = %v, want nil", name, err)
+				}
+			}
+			// Queries are allowed either way
+			if err := m.RequestAllDestinationLocks(); err != nil {
+				t.Errorf("RequestAllDestinationLocks() = %v, want nil", err)
+			}
+			sent := 0
+			for _, call := range conn.recorded() {
+				if strings.HasPrefix(call, "route") || strings.HasPrefix(call, "lock") {
+					sent++
+				}
+			}
+			if want := map[bool]int{false: 3, true: 0}[monitor]; sent != want {
+				t.Errorf("sent %d control commands, want %d", sent, want)
+			}
+		})
+	}
+}
+
+func TestCommandsBeforeConnect(t *testing.T) {
+	conn := newScriptConn()
+	m := NewMagnumRouterWithConn(conn, 2, 2, 1)
+	m.processMessage(update(1, 2))
+	commands := map[string]func() error{
+		"SetRoute": func() error { return m.SetRoute([]uint{0}, 1, 2) },
+		"SetLock":  func() error { return m.SetLock(1, true) },
+	}
+	for name, command := range commands {
+		if err := command(); !errors.Is(err, ErrNotConnected) {
+			t.Errorf("%s() before Connect() = %v, want ErrNotConnected", name, err)
+		}
+	}
+	if got := conn.recorded(); len(got) != 0 {
+		t.Errorf("sent %q before Connect(), want nothing", got)
+	}
+	// The cache stays readable while disconnected
+	if got := m.GetRoute(0, 1); got != 2 {
+		t.Errorf("GetRoute(0, 1) = %d, want 2", got)
+	}
+	if m.GetDestinationLocked(2) {
+		t.Error("GetDestinationLocked(2) = true, want false")
+	}
+}
+
+func TestDisconnectAbortsConnect(t *testing.T) {
+	// The script never answers and the validation waits for responses, so the sync stays in progress until aborted
+	conn := newScriptConn()
+	m := NewMagnumRouterWithConn(conn, 2, 2, 1, WithPostSyncValidation((*MagnumRouter).ValidateFullySynced))
+	defer m.Close()
+	connected := make(chan error, 1)
+	go func() { connected <- m.Connect() }()
+	awaitSent(t, conn, "get route V 2")
+	if got := m.State(); got != StateConnecting {
+		t.Fatalf("State() = %v while syncing, want connecting", got)
+	}
+
+	var wg sync.WaitGroup
+	for i := 0; i < 2; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			m.Disconnect()
+		}()
+	}
+	if err := receiveErr(t, connected); !errors.Is(err, ErrConnectAborted) {
+		t.Fatalf("Connect() = %v, want ErrConnectAborted", err)
+	}
+	wg.Wait()
+	if got := m.State(); got != StateDisconnected {
+		t.Errorf("State() = %v, want disconnected", got)
+	}
+	if m.IsSyncing() {
+		t.Error("IsSyncing() after the connect was aborted")
+	}
+	if err := m.Disconnect(); !errors.Is(err, ErrNotConnected) {
+		t.Errorf("Disconnect() again = %v, want ErrNotConnected", err)
+	}
+	// Left clean enough to start connecting again
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	if err := m.ConnectContext(ctx); errors.Is(err, ErrAlreadyConnected) {
+		t.Errorf("ConnectContext() after the abort = %v", err)
+	}
+}
+
+func TestOutOfRangeResponsesDropped(t *testing.T) {
+	tests := []struct {
+		name string
+		msg  quartz.QuartzResponse
+	}{
+		{"update destination", update(5000, 1)},
+		{"update source", update(1, 5000)},
+		{"source name", &quartz.ResponseReadSource{Source: 5000, Name: "CAM"}},
+		{"destination name", &quartz.ResponseReadDestination{Destination: 5000, Name: "MON"}},
+		{"lock status", &quartz.ResponseLockStatus{Destination: 5000, Locked: true}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m := NewMagnumRouterWithConn(NewFakeConn(2, 2), 2, 2, 1)
+			events, unsubscribe := m.Subscribe()
+			defer unsubscribe()
+			before := m.ExportState()
+			m.processMessage(tt.msg)
+			select {
+			case ev := <-events:
+				if ev.Type != EventError || !errors.Is(ev.Err, ErrResponseOutOfRange) {
+					t.Errorf("event %+v, want an EventError with ErrResponseOutOfRange", ev)
+				}
+			case <-time.After(time.Second):
+				t.Fatal("no error event for the out of range response")
+			}
+			if got := m.ExportState(); !reflect.DeepEqual(got, before) {
+				t.Errorf("cache changed to %+v, want %+v", got, before)
+			}
+		})
+	}
+}
+
+func TestRouteTableIfChanged(t *testing.T) {
+	m := NewMagnumRouterWithConn(NewFakeConn(3, 3), 3, 3, 1)
+	routes, gen, changed := m.RouteTableIfChanged(0)
+	if changed || routes != nil {
+		t.Fatalf("RouteTableIfChanged(0) on a new router = %v, %v, want no change", routes, changed)
+	}
+
+	m.processMessage(update(2, 3))
+	routes, next, changed := m.RouteTableIfChanged(gen)
+	if !changed || next == gen {
+		t.Fatalf("RouteTableIfChanged() after an update = changed %v, generation %d, want a new generation", changed, next)
+	}
+	if routes[2][0] != 3 {
+		t.Errorf("routes[2][0] = %d, want 3", routes[2][0])
+	}
+	// The copy is the caller's
+	routes[2][0] = 1
+	if got := m.GetRoute(0, 2); got != 3 {
+		t.Errorf("GetRoute() = %d after changing the copy, want 3", got)
+	}
+
+	if _, again, changed := m.RouteTableIfChanged(next); changed || again != next {
+		t.Errorf("RouteTableIfChanged() unchanged = changed %v, generation %d, want %d", changed, again, next)
+	}
+	// Unchanged routes are not a change
+	m.processMessage(update(2, 3))
+	if _, _, changed := m.RouteTableIfChanged(next); changed {
+		t.Error("RouteTableIfChanged() reported a repeated update as a change")
+	}
+}
+
+func BenchmarkRouteTablePolling(b *testing.B) {
+	const destinations, levels = 2000, 17
+	m := NewMagnumRouterWithConn(NewFakeConn(destinations, destinations), destinations, destinations, levels)
+	for dest := uint(1); dest <= destinations; dest++ {
+		m.processMessage(update(dest, dest))
+	}
+	_, current, _ := m.RouteTableIfChanged(0)
+	// A stale generation copies on every poll, as polling without generations would
+	for _, poll := range []struct {
+		name string
+		gen  uint64
+	}{{"changed", current - 1}, {"unchanged", current}} {
+		b.Run(poll.name, func(b *testing.B) {
+			b.ReportAllocs()
+			for i := 0; i < b.N; i++ {
+				m.RouteTableIfChanged(poll.gen)
+			}
+		})
+	}
+}
+
+func TestUpdateLevelBeyondCountDropped(t *testing.T) {
+	m := NewMagnumRouterWithConn(NewFakeConn(3, 3), 3, 3, 1)
+	events, unsubscribe := m.Subscribe()
+	defer unsubscribe()
+	m.processMessage(update(1, 2, quartz.QUARTZ_LVL_V, quartz.QuartzLevel("A")))
+
+	types := map[EventType]int{}
+	for i := 0; i < 2; i++ {
+		select {
+		case ev := <-events:
+			types[ev.Type]++
+			if ev.Type == EventError && (!errors.Is(ev.Err, ErrResponseOutOfRange) || !errors.Is(ev.Err, ErrLevelOutOfRange)) {
+				t.Errorf("error %v, want ErrResponseOutOfRange for the level", ev.Err)
+			}
+		case <-time.After(time.Second):
+			t.Fatalf("events %v, want a route change and an error", types)
+		}
+	}
+	if types[EventRouteChange] != 1 || types[EventError] != 1 {
+		t.Errorf("events %v, want a route change and an error", types)
+	}
+	// The level within the count still applies
+	if got := m.GetRoute(0, 1); got != 2 {
+		t.Errorf("GetRoute(0, 1) = %d, want 2", got)
+	}
+	if got := m.GetRouteTable()[1]; len(got) != 1 {
+		t.Errorf("route row has %d levels, want 1", len(got))
+	}
+}
@@ -0,0 +1,123 @@
+package magnumrouter
+
+import (
+	"fmt"
+	"sync"
+)
+
+// Kind of endpoint a name belongs to
+type NameKind int
+
+const (
+	NameSource NameKind = iota
+	NameDestination
+)
+
+// Selects how received names are interpreted, see WithNameCharset()
+type NameCharset int
+
+const (
+	// Names are cached as received
+	NameCharsetRaw NameCharset = iota
+	// Names are cached as valid UTF-8, invalid bytes being replaced
+	NameCharsetUTF8
+)
+
+// Selects how a name shared by several endpoints is resolved to an ID, see WithDuplicateNamePolicy()
+type DuplicateNamePolicy int
+
+const (
+	// The endpoint with the lowest ID is used (default)
+	DuplicateNameFirstWins DuplicateNamePolicy = iota
+	// The endpoint with the highest ID is used
+	DuplicateNameLastWins
+	// The lookup fails with ErrAmbiguousName listing the IDs sharing the name
+	DuplicateNameError
+)
+
+// Returns the name of an endpoint from an external source, or false if it has none
+type NameResolver func(kind NameKind, id uint) (string, bool)
+
+type resolvedName struct {
+	name string
+	ok   bool
+}
+
+type nameKey struct {
+	kind NameKind
+	id   uint
+}
+
+// Memoized resolver results, guarded separately from the cache as the resolver runs without mu held
+type resolverCache struct {
+	mu    sync.Mutex
+	names map[nameKey]resolvedName
+}
+
+// Returns the display name of a source
+// Uses the name reported by the device, then the name from the WithNameResolver() resolver, then the source ID
+func (m *MagnumRouter) SourceDisplayName(source uint) string {
+	m.mu.RLock()
+	name := ""
+	if source < uint(len(m.sourceNames)) {
+		name = m.sourceNames[source]
+	}
+	m.mu.RUnlock()
+	return m.displayName(NameSource, source, name)
+}
+
+// Returns the display name of a destination
+// Uses the name reported by the device, then the name from the WithNameResolver() resolver, then the destination ID
+func (m *MagnumRouter) DestinationDisplayName(destination uint) string {
+	m.mu.RLock()
+	name := ""
+	if destination < uint(len(m.destinationNames)) {
+		name = m.destinationNames[destination]
+	}
+	m.mu.RUnlock()
+	return m.displayName(NameDestination, destination, name)
+}
+
+// Returns the display name of an endpoint given its cached device name
+// Must be called without mu held as the resolver is user code
+func (m *MagnumRouter) displayName(kind NameKind, id uint, deviceName string) string {
+	if deviceName != "" {
+		return deviceName
+	}
+	if name, ok := m.resolveName(kind, id); ok {
+		return name
+	}
+	return fmt.Sprint(id)
+}
+
+// Consults the resolver for an endpoint, memoizing the result when enabled
+func (m *MagnumRouter) resolveName(kind NameKind, id uint) (string, bool) {
+	if m.opts.nameResolver == nil {
+		return "", false
+	}
+	if !m.opts.nameResolverCache {
+		return m.opts.nameResolver(kind, id)
+	}
+	key := nameKey{kind: kind, id: id}
+	m.resolved.mu.Lock()
+	cached, ok := m.resolved.names[key]
+	m.resolved.mu.Unlock()
+	if ok {
+		return cached.name, cached.ok
+	}
+	name, found := m.opts.nameResolver(kind, id)
+	m.resolved.mu.Lock()
+	if m.resolved.names == nil {
+		m.resolved.names = map[nameKey]resolvedName{}
+	}
+	m.resolved.names[key] = resolvedName{name: name, ok: found}
+	m.resolved.mu.Unlock()
+	return name, found
+}
+
+// Discards memoized resolver results so they are resolved again on next use
+func (m *MagnumRouter) ClearResolvedNames() {
+	m.resolved.mu.Lock()
+	defer m.resolved.mu.Unlock()
+	m.resolved.names = nil
+}
@@ -0,0 +1,91 @@
+package magnumrouter
+
+import (
+	"fmt"
+	"sync"
+	"testing"
+
+	"github.com/cassaram/quartz"
+)
+
+// A resolver naming even IDs, counting its calls
+type assetResolver struct {
+	mu    sync.Mutex
+	calls int
+}
+
+func (r *assetResolver) resolve(kind NameKind, id uint) (string, bool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.calls++
+	if id%2 != 0 {
+		return "", false
+	}
+	if kind == NameSource {
+		return fmt.Sprintf("ASSET SRC %d", id), true
+	}
+	return fmt.Sprintf("ASSET DST %d", id), true
+}
+
+func (r *assetResolver) called() int {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.calls
+}
+
+func TestDisplayNamesMixDeviceAndResolver(t *testing.T) {
+	resolver := &assetResolver{}
+	m := NewMagnumRouterWithConn(NewFakeConn(4, 4), 4, 4, 1, WithNameResolver(resolver.resolve))
+	m.processMessage(&quartz.ResponseReadSource{Source: 2, Name: "CAM 2"})
+	m.processMessage(&quartz.ResponseReadDestination{Destination: 1, Name: "MON 1"})
+
+	tests := []struct {
+		got  string
+		want string
+	}{
+		{m.SourceDisplayName(2), "CAM 2"},
+		{m.SourceDisplayName(4), "ASSET SRC 4"},
+		{m.SourceDisplayName(3), "3"},
+		{m.DestinationDisplayName(1), "MON 1"},
+		{m.DestinationDisplayName(2), "ASSET DST 2"},
+	}
+	for i, tt := range tests {
+		if tt.got != tt.want {
+			t.Errorf("display name %d = %q, want %q", i, tt.got, tt.want)
+		}
+	}
+	// Device-named endpoints do not consult the resolver
+	if got := resolver.called(); got != 3 {
+		t.Errorf("resolver called %d times, want 3", got)
+	}
+	if got := m.GetSourceName(4); got != "" {
+		t.Errorf("GetSourceName(4) = %q, want the device name left empty", got)
+	}
+}
+
+func TestResolvedNamesMemoized(t *testing.T) {
+	resolver := &assetResolver{}
+	m := NewMagnumRouterWithConn(NewFakeConn(4, 4), 4, 4, 1, WithNameResolver(resolver.resolve), WithNameResolverCache(true))
+	for i := 0; i < 3; i++ {
+		m.SourceDisplayName(2)
+		m.SourceDisplayName(3)
+	}
+	if got := resolver.called(); got != 2 {
+		t.Errorf("resolver called %d times, want 2 including the unnamed source", got)
+	}
+	m.ClearResolvedNames()
+	m.SourceDisplayName(2)
+	if got := resolver.called(); got != 3 {
+		t.Errorf("resolver called %d times after clearing, want 3", got)
+	}
+}
+
+func TestResolvedNamesNotMemoizedByDefault(t *testing.T) {
+	resolver := &assetResolver{}
+	m := NewMagnumRouterWithConn(NewFakeConn(4, 4), 4, 4, 1, WithNameResolver(resolver.resolve))
+	m.SourceDisplayName(2)
+	m.SourceDisplayName(2)
+	if got := resolver.called(); got != 2 {
+		t.Errorf("resolver called %d times, want 2", got)
+	}
+}
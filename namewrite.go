@@ -0,0 +1,104 @@
+package magnumrouter
+
+import (
+	"context"
+	"errors"
+	"fmt"
+)
+
+// Implemented by connections able to write endpoint names to the device
+// quartz.Quartz implements this, but rejects it when in magnum mode, which is reported as ErrNameWriteUnsupported
+type NameWriter interface {
+	WriteSourceName(src uint, name string) error
+	WriteDestinationName(dest uint, name string) error
+}
+
+// A name to write to the device with MagnumRouter.SetNames()
+type NameEntry struct {
+	Kind NameKind
+	ID   uint
+	Name string
+}
+
+// Writes the name of a source to the device, returning once the device reports the new name
+// The name is read back after writing, so the cache only changes once the device has it
+// Returns ErrNameNotConfirmed if the context is done before the device reports the name
+// Returns ErrNameWriteUnsupported if the device cannot write names, which includes magnum
+func (m *MagnumRouter) SetSourceName(ctx context.Context, id uint, name string) error {
+	return m.setName(ctx, NameEntry{Kind: NameSource, ID: id, Name: name})
+}
+
+// Writes the name of a destination to the device as per SetSourceName()
+func (m *MagnumRouter) SetDestinationName(ctx context.Context, id uint, name string) error {
+	return m.setName(ctx, NameEntry{Kind: NameDestination, ID: id, Name: name})
+}
+
+// Writes many names to the device, such as to program a frame from a config
+// All entries are attempted, failures are joined into the returned error per entry
+// Stops early if the context is done or the device cannot write names
+func (m *MagnumRouter) SetNames(ctx context.Context, entries []NameEntry) error {
+	errs := []error{}
+	for i, entry := range entries {
+		if err := ctx.Err(); err != nil {
+			errs = append(errs, err)
+			break
+		}
+		if err := m.setName(ctx, entry); err != nil {
+			errs = append(errs, fmt.Errorf("entry %d: %w", i, err))
+			if errors.Is(err, ErrNameWriteUnsupported) {
+				break
+			}
+		}
+	}
+	return errors.Join(errs...)
+}
+
+func (m *MagnumRouter) setName(ctx context.Context, entry NameEntry) error {
+	if err := m.checkControl(); err != nil {
+		return err
+	}
+	writer, ok := m.conn.(NameWriter)
+	if !ok {
+		return ErrNameWriteUnsupported
+	}
+	check, write, query := m.checkSource, writer.WriteSourceName, m.conn.GetSourceName
+	if entry.Kind == NameDestination {
+		check, write, query = m.checkDestination, writer.WriteDestinationName, m.conn.GetDestinationName
+	}
+	if err := check(entry.ID); err != nil {
+		return err
+	}
+
+	// Subscribe before writing so the read back cannot be missed
+	events, unsubscribe := m.Subscribe()
+	defer unsubscribe()
+	if err := m.sendControl(func() error { return write(entry.ID, entry.Name) }); err != nil {
+		return err
+	}
+	if err := m.send(func() error { return query(entry.ID) }); err != nil {
+		return err
+	}
+	want := m.receivedName(entry.Name)
+	for {
+		if m.cachedName(entry.Kind, entry.ID) == want {
+			return nil
+		}
+		select {
+		case <-ctx.Done():
+			return fmt.Errorf("%w: %w", ErrNameNotConfirmed, ctx.Err())
+		case _, ok := <-events:
+			if !ok {
+				return ErrNotConnected
+			}
+		}
+	}
+}
+
+func (m *MagnumRouter) cachedName(kind NameKind, id uint) string {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	if kind == NameDestination {
+		return m.destinationNames[id]
+	}
+	return m.sourceNames[id]
+}
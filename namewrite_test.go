@@ -0,0 +1,69 @@
+package magnumrouter
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestSetNames(t *testing.T) {
+	m, fake := newFakeRouter(t, 3, 3, 1)
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	if err := m.SetSourceName(ctx, 1, "CAM 1"); err != nil {
+		t.Fatalf("SetSourceName() = %v", err)
+	}
+	if err := m.SetDestinationName(ctx, 2, "MON 2"); err != nil {
+		t.Fatalf("SetDestinationName() = %v", err)
+	}
+	if got := m.GetSourceName(1); got != "CAM 1" {
+		t.Errorf("GetSourceName(1) = %q, want CAM 1", got)
+	}
+	if got := m.GetDestinationName(2); got != "MON 2" {
+		t.Errorf("GetDestinationName(2) = %q, want MON 2", got)
+	}
+
+	entries := []NameEntry{
+		{Kind: NameSource, ID: 2, Name: "CAM 2"},
+		{Kind: NameSource, ID: 9, Name: "CAM 9"},
+		{Kind: NameDestination, ID: 3, Name: "REC"},
+	}
+	err := m.SetNames(ctx, entries)
+	if !errors.Is(err, ErrSourceOutOfRange) {
+		t.Fatalf("SetNames() = %v, want ErrSourceOutOfRange for entry 1", err)
+	}
+	// Entries after the failed one are still written
+	if got := m.GetSourceName(2); got != "CAM 2" {
+		t.Errorf("GetSourceName(2) = %q, want CAM 2", got)
+	}
+	if got := m.GetDestinationName(3); got != "REC" {
+		t.Errorf("GetDestinationName(3) = %q, want REC", got)
+	}
+	fake.mu.Lock()
+	defer fake.mu.Unlock()
+	if fake.destNames[3] != "REC" {
+		t.Errorf("device destination 3 named %q, want REC", fake.destNames[3])
+	}
+}
+
+func TestSetNamesUnsupported(t *testing.T) {
+	// The script conn has no name writes, as with magnum
+	m, conn := newScriptRouter(t, 3, 3, 1)
+	if err := m.SetSourceName(context.Background(), 1, "CAM 1"); !errors.Is(err, ErrNameWriteUnsupported) {
+		t.Errorf("SetSourceName() = %v, want ErrNameWriteUnsupported", err)
+	}
+	entries := []NameEntry{{Kind: NameSource, ID: 1, Name: "CAM 1"}, {Kind: NameDestination, ID: 1, Name: "MON 1"}}
+	err := m.SetNames(context.Background(), entries)
+	if !errors.Is(err, ErrNameWriteUnsupported) {
+		t.Fatalf("SetNames() = %v, want ErrNameWriteUnsupported", err)
+	}
+	// Stops at the first entry rather than repeating the same error
+	if strings.Contains(err.Error(), "entry 1") {
+		t.Errorf("SetNames() = %v, want it stopped after entry 0", err)
+	}
+	if got := conn.recorded(); len(got) != 1 {
+		t.Errorf("sent %q, want only the connect", got)
+	}
+}
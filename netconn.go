@@ -0,0 +1,259 @@
+package magnumrouter
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"net"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+
+	"github.com/cassaram/quartz"
+)
+
+// A QuartzConn speaking the magnum dialect of quartz over connections supplied by a dial function
+// Lets the router run over a transport the quartz layer cannot dial itself, such as a net.Pipe or a multiplexer
+// This copies the command encoding and response parsing of quartz.Quartz, which cannot be given a connection,
+// never closes RxMessages when the link drops, and overflows its receive buffer after a few responses
+// netconn_test.go checks both against quartz.Quartz so the copy cannot drift from upstream
+type netConn struct {
+	dial func() (net.Conn, error)
+	mu   sync.Mutex
+	conn net.Conn
+	rx   chan quartz.QuartzResponse
+	// Closed by Disconnect so a reader blocked on a full rx exits
+	done chan struct{}
+}
+
+// Returns a QuartzConn over the connections returned by dial, called on each Connect
+// Commands and responses are those of quartz.Quartz in magnum mode, so level name queries and name writes are not supported
+func NewNetConn(dial func() (net.Conn, error)) QuartzConn {
+	return &netConn{dial: dial, rx: make(chan quartz.QuartzResponse, 100)}
+}
+
+// Returns a new magnum router instance using an already established connection to the server, without dialing
+// The connection is used for the first Connect only, later connects return an error, so use NewNetConn() to reconnect
+func NewMagnumRouterWithNetConn(conn net.Conn, sourceCount uint, destinationCount uint, levelCount uint, opts ...Option) *MagnumRouter {
+	// Atomic as a retrying connect or failover may dial from another goroutine
+	var used atomic.Bool
+	dial := func() (net.Conn, error) {
+		if used.Swap(true) {
+			return nil, errors.New("net.Conn already used, it cannot be redialed")
+		}
+		return conn, nil
+	}
+	return NewMagnumRouterWithConn(NewNetConn(dial), sourceCount, destinationCount, levelCount, opts...)
+}
+
+func (c *netConn) Connect() error {
+	conn, err := c.dial()
+	if err != nil {
+		return err
+	}
+	c.mu.Lock()
+	c.conn = conn
+	c.rx = make(chan quartz.QuartzResponse, 100)
+	c.done = make(chan struct{})
+	rx, done := c.rx, c.done
+	c.mu.Unlock()
+	go c.readLoop(conn, rx, done)
+	return nil
+}
+
+func (c *netConn) Disconnect() error {
+	c.mu.Lock()
+	conn := c.conn
+	c.conn = nil
+	if conn != nil {
+		close(c.done)
+	}
+	c.mu.Unlock()
+	if conn == nil {
+		return nil
+	}
+	return conn.Close()
+}
+
+// Parses responses from conn until it fails, then closes rx to report the connection lost
+func (c *netConn) readLoop(conn net.Conn, rx chan quartz.QuartzResponse, done <-chan struct{}) {
+	defer close(rx)
+	reader := bufio.NewReader(conn)
+	for {
+		line, err := reader.ReadString('\r')
+		if err != nil {
+			return
+		}
+		// Anything before the start of a response is noise
+		if i := strings.IndexByte(line, '.'); i >= 0 {
+			select {
+			case rx <- parseResponse(line[i:]):
+			case <-done:
+				return
+			}
+		}
+	}
+}
+
+func (c *netConn) send(format string, args ...any) error {
+	c.mu.Lock()
+	conn := c.conn
+	c.mu.Unlock()
+	if conn == nil {
+		return ErrNotConnected
+	}
+	_, err := fmt.Fprintf(conn, format, args...)
+	return err
+}
+
+func (c *netConn) GetSourceName(src uint) error {
+	return c.send(".RS%d\r", src)
+}
+
+func (c *netConn) GetDestinationName(dest uint) error {
+	return c.send(".RD%d\r", dest)
+}
+
+func (c *netConn) GetDestinationLock(dest uint) error {
+	return c.send(".BI%d\r", dest)
+}
+
+func (c *netConn) GetRoute(level quartz.QuartzLevel, dest uint) error {
+	return c.send(".I%s%d\r", level, dest)
+}
+
+func (c *netConn) SetCrosspoint(levels []quartz.QuartzLevel, dest uint, src uint) error {
+	return c.send(".S%s%d,%d\r", levelString(levels), dest, src)
+}
+
+func (c *netConn) LockDestination(dest uint) error {
+	return c.send(".BL%d\r", dest)
+}
+
+func (c *netConn) UnlockDestination(dest uint) error {
+	return c.send(".BU%d\r", dest)
+}
+
+func (c *netConn) RxMessages() <-chan quartz.QuartzResponse {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.rx
+}
+
+// Returns levels as sent in a crosspoint command, in the order of quartzLevelOrder()
+func levelString(levels []quartz.QuartzLevel) string {
+	var b strings.Builder
+	for _, lvl := range quartzLevelOrder(levels) {
+		b.WriteString(string(lvl))
+	}
+	return b.String()
+}
+
+// Returns a copy of levels in the order quartz uses both ways, video first then the other levels in letter order
+func quartzLevelOrder(levels []quartz.QuartzLevel) []quartz.QuartzLevel {
+	sorted := append([]quartz.QuartzLevel{}, levels...)
+	sort.Slice(sorted, func(i, j int) bool {
+		if sorted[i] == quartz.QUARTZ_LVL_V || sorted[j] == quartz.QUARTZ_LVL_V {
+			return sorted[i] == quartz.QUARTZ_LVL_V && sorted[j] != quartz.QUARTZ_LVL_V
+		}
+		return sorted[i] < sorted[j]
+	})
+	return sorted
+}
+
+// Parses a response line starting with '.' and ending with '\r' as quartz.Quartz does
+// Returns nil for lines that cannot be parsed, which the router ignores
+func parseResponse(line string) quartz.QuartzResponse {
+	if len(line) < 3 {
+		return nil
+	}
+	body := line[1 : len(line)-1]
+	switch body[0] {
+	case 'A':
+		if len(body) == 1 {
+			return &quartz.ResponseAcknowledge{RawData: line}
+		}
+		// A route list answering a route query has the form of an update
+		return parseUpdate(line, body[1:])
+	case 'U':
+		return parseUpdate(line, body[1:])
+	case 'E':
+		return &quartz.ResponseError{RawData: line}
+	case 'P':
+		return &quartz.ResponsePowerOn{RawData: line}
+	case 'R':
+		// Read name responses, .RA{D|S|L}{id},{name}
+		if len(body) < 3 {
+			return nil
+		}
+		id, name, ok := strings.Cut(body[3:], ",")
+		if !ok {
+			return nil
+		}
+		switch body[2] {
+		case 'D':
+			dest, err := strconv.ParseUint(id, 10, 0)
+			if err != nil {
+				return nil
+			}
+			return &quartz.ResponseReadDestination{RawData: line, Destination: uint(dest), Name: name}
+		case 'S':
+			src, err := strconv.ParseUint(id, 10, 0)
+			if err != nil {
+				return nil
+			}
+			return &quartz.ResponseReadSource{RawData: line, Source: uint(src), Name: name}
+		case 'L':
+			if id == "" {
+				return nil
+			}
+			return &quartz.ResponseReadLevel{RawData: line, Level: quartz.QuartzLevel(id[:1]), Name: name}
+		}
+	case 'B':
+		// Lock status, .BA{dest},{status} where quartz.Quartz reads a status of 0 as locked
+		if len(body) < 2 {
+			return nil
+		}
+		id, status, ok := strings.Cut(body[2:], ",")
+		if !ok {
+			return nil
+		}
+		dest, err := strconv.ParseUint(id, 10, 0)
+		if err != nil {
+			return nil
+		}
+		value, err := strconv.Atoi(status)
+		if err != nil {
+			return nil
+		}
+		return &quartz.ResponseLockStatus{RawData: line, Destination: uint(dest), Locked: value == 0}
+	}
+	return nil
+}
+
+// Parses the {levels}{dest},{src} part of an update or route list
+func parseUpdate(line string, body string) quartz.QuartzResponse {
+	digits := strings.IndexFunc(body, func(r rune) bool { return r >= '0' && r <= '9' })
+	if digits < 1 {
+		return nil
+	}
+	dest, src, ok := strings.Cut(body[digits:], ",")
+	if !ok {
+		return nil
+	}
+	destID, err := strconv.ParseUint(dest, 10, 0)
+	if err != nil {
+		return nil
+	}
+	srcID, err := strconv.ParseUint(src, 10, 0)
+	if err != nil {
+		return nil
+	}
+	levels := []quartz.QuartzLevel{}
+	for _, r := range body[:digits] {
+		levels = append(levels, quartz.QuartzLevel(string(r)))
+	}
+	return &quartz.ResponseUpdate{RawData: line, Levels: quartzLevelOrder(levels), Destination: uint(destID), Source: uint(srcID)}
+}
@@ -0,0 +1,243 @@
+package magnumrouter
+
+import (
+	"bufio"
+	"fmt"
+	"net"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/cassaram/quartz"
+)
+
+// Answers quartz commands on conn as a magnum device with sources named "CAM n" and destinations named "MON n"
+func servePipeDevice(conn net.Conn) {
+	defer conn.Close()
+	routes := map[string]string{}
+	reader := bufio.NewReader(conn)
+	for {
+		cmd, err := reader.ReadString('\r')
+		if err != nil {
+			return
+		}
+		cmd = strings.TrimSuffix(strings.TrimPrefix(cmd, "."), "\r")
+		var reply string
+		switch {
+		case strings.HasPrefix(cmd, "RS"):
+			reply = fmt.Sprintf(".RAS%s,CAM %s\r", cmd[2:], cmd[2:])
+		case strings.HasPrefix(cmd, "RD"):
+			reply = fmt.Sprintf(".RAD%s,MON %s\r", cmd[2:], cmd[2:])
+		case strings.HasPrefix(cmd, "BI"):
+			reply = fmt.Sprintf(".BA%s,1\r", cmd[2:])
+		case strings.HasPrefix(cmd, "I"):
+			src := routes[cmd[1:]]
+			if src == "" {
+				src = "1"
+			}
+			reply = fmt.Sprintf(".A%s,%s\r", cmd[1:], src)
+		case strings.HasPrefix(cmd, "S"):
+			crosspoint, src, _ := strings.Cut(cmd[1:], ",")
+			routes[crosspoint] = src
+			reply = fmt.Sprintf(".A\r.U%s,%s\r", crosspoint, src)
+		default:
+			reply = ".E\r"
+		}
+		if _, err := conn.Write([]byte(reply)); err != nil {
+			return
+		}
+	}
+}
+
+func TestNetConnOverPipe(t *testing.T) {
+	client, device := net.Pipe()
+	go servePipeDevice(device)
+	m := NewMagnumRouterWithNetConn(client, 3, 2, 1)
+	t.Cleanup(func() { m.Close() })
+	if err := m.Connect(); err != nil {
+		t.Fatalf("connect: %v", err)
+	}
+	eventually(t, func() bool { return m.GetDestinationName(2) == "MON 2" && m.GetRoute(0, 2) == 1 })
+	if got := m.GetSourceName(3); got != "CAM 3" {
+		t.Errorf("source 3 name = %q, want CAM 3", got)
+	}
+	if m.GetDestinationLocked(1) {
+		t.Error("destination 1 locked, want unlocked")
+	}
+	if err := m.SetRoute([]uint{0}, 2, 3); err != nil {
+		t.Fatalf("set route: %v", err)
+	}
+	eventually(t, func() bool { return m.GetRoute(0, 2) == 3 })
+}
+
+func TestParseResponse(t *testing.T) {
+	tests := map[string]string{
+		".A\r":         "*quartz.ResponseAcknowledge",
+		".E\r":         "*quartz.ResponseError",
+		".UVA12,3\r":   "*quartz.ResponseUpdate",
+		".AV1,2\r":     "*quartz.ResponseUpdate",
+		".RAS4,CAM\r":  "*quartz.ResponseReadSource",
+		".RAD4,MON\r":  "*quartz.ResponseReadDestination",
+		".BA4,0\r":     "*quartz.ResponseLockStatus",
+		".U12,3\r":     "<nil>",
+		".RAS,CAM\r":   "<nil>",
+		".Q\r":         "<nil>",
+		".BAx,0\r":     "<nil>",
+		".UV12,3x\r":   "<nil>",
+		".RAX1,name\r": "<nil>",
+	}
+	for line, want := range tests {
+		if got := fmt.Sprintf("%T", parseResponse(line)); got != want {
+			t.Errorf("parseResponse(%q) = %s, want %s", line, got, want)
+		}
+	}
+}
+
+func TestNetConnRedials(t *testing.T) {
+	dials := 0
+	conn := NewNetConn(func() (net.Conn, error) {
+		dials++
+		client, device := net.Pipe()
+		go servePipeDevice(device)
+		return client, nil
+	})
+	m := NewMagnumRouterWithConn(conn, 3, 2, 1)
+	t.Cleanup(func() { m.Close() })
+	for i := 0; i < 2; i++ {
+		if err := m.Connect(); err != nil {
+			t.Fatalf("connect %d: %v", i, err)
+		}
+		eventually(t, func() bool { return m.GetDestinationName(2) == "MON 2" })
+		if err := m.Disconnect(); err != nil {
+			t.Fatalf("disconnect %d: %v", i, err)
+		}
+	}
+	if dials != 2 {
+		t.Errorf("dialed %d times, want 2", dials)
+	}
+}
+
+func TestNetConnUsedOnce(t *testing.T) {
+	client, device := net.Pipe()
+	go servePipeDevice(device)
+	m := NewMagnumRouterWithNetConn(client, 3, 2, 1)
+	t.Cleanup(func() { m.Close() })
+	if err := m.Connect(); err != nil {
+		t.Fatalf("connect: %v", err)
+	}
+	if err := m.Disconnect(); err != nil {
+		t.Fatalf("disconnect: %v", err)
+	}
+	if err := m.Connect(); err == nil {
+		t.Error("second connect over the same net.Conn succeeded, want an error")
+	}
+}
+
+// Returns a loopback listener's port and a function accepting its next connection
+func loopback(t *testing.T) (uint16, func() net.Conn) {
+	t.Helper()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Skipf("no loopback: %v", err)
+	}
+	t.Cleanup(func() { ln.Close() })
+	accept := func() net.Conn {
+		t.Helper()
+		conn, err := ln.Accept()
+		if err != nil {
+			t.Fatalf("accept: %v", err)
+		}
+		return conn
+	}
+	return uint16(ln.Addr().(*net.TCPAddr).Port), accept
+}
+
+// Server ends of upstreamQuartz() connections, kept open for good as quartz's reader spins once its connection is gone
+var upstreamServers []net.Conn
+
+// Connects quartz.Quartz to a loopback server, returning it and the server's end
+func upstreamQuartz(t *testing.T) (*quartz.Quartz, net.Conn) {
+	t.Helper()
+	port, accept := loopback(t)
+	q := quartz.NewQuartz("127.0.0.1", port, true)
+	if err := q.Connect(); err != nil {
+		t.Fatalf("quartz connect: %v", err)
+	}
+	server := accept()
+	upstreamServers = append(upstreamServers, server)
+	return q, server
+}
+
+// The command encoding and response parsing of netConn are a copy of quartz's, so they are checked against quartz itself
+func TestNetConnMatchesQuartzCommands(t *testing.T) {
+	q, upstream := upstreamQuartz(t)
+	port, accept := loopback(t)
+	conn := NewNetConn(func() (net.Conn, error) { return net.Dial("tcp", fmt.Sprintf("127.0.0.1:%d", port)) })
+	if err := conn.Connect(); err != nil {
+		t.Fatalf("connect: %v", err)
+	}
+	defer conn.Disconnect()
+	server := accept()
+	defer server.Close()
+
+	levels := func() []quartz.QuartzLevel {
+		return []quartz.QuartzLevel{quartz.QUARTZ_LVL_B, quartz.QUARTZ_LVL_V, quartz.QUARTZ_LVL_A}
+	}
+	commands := map[string]func(c QuartzConn) error{
+		"SetCrosspoint":      func(c QuartzConn) error { return c.SetCrosspoint(levels(), 12, 3) },
+		"GetRoute":           func(c QuartzConn) error { return c.GetRoute(quartz.QUARTZ_LVL_A, 7) },
+		"GetSourceName":      func(c QuartzConn) error { return c.GetSourceName(4) },
+		"GetDestinationName": func(c QuartzConn) error { return c.GetDestinationName(5) },
+		"GetDestinationLock": func(c QuartzConn) error { return c.GetDestinationLock(6) },
+		"LockDestination":    func(c QuartzConn) error { return c.LockDestination(8) },
+		"UnlockDestination":  func(c QuartzConn) error { return c.UnlockDestination(9) },
+	}
+	upstreamReader, serverReader := bufio.NewReader(upstream), bufio.NewReader(server)
+	for name, send := range commands {
+		if err := send(NewQuartzConn(q)); err != nil {
+			t.Fatalf("quartz %s: %v", name, err)
+		}
+		want, _ := upstreamReader.ReadString('\r')
+		if err := send(conn); err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+		got, _ := serverReader.ReadString('\r')
+		if got != want {
+			t.Errorf("%s sent %q, quartz sends %q", name, got, want)
+		}
+	}
+}
+
+func TestParseResponseMatchesQuartz(t *testing.T) {
+	lines := []string{
+		".A\r",
+		".E\r",
+		".P\r",
+		".AV12,3\r",
+		".UV12,3\r",
+		".UAV4,7\r",
+		".UBVA4,7\r",
+		".RAS2,CAM 2\r",
+		".RAD5,MON 5\r",
+		".RALA,AUDIO\r",
+		".BA3,0\r",
+		".BA3,1\r",
+	}
+	for _, line := range lines {
+		// A connection per line, as quartz overflows its buffer on later reads
+		q, upstream := upstreamQuartz(t)
+		if _, err := upstream.Write([]byte(line)); err != nil {
+			t.Fatalf("write: %v", err)
+		}
+		var want quartz.QuartzResponse
+		select {
+		case want = <-q.RxMessages:
+		case <-time.After(time.Second):
+			t.Fatalf("quartz did not parse %q", line)
+		}
+		if got := parseResponse(line); !reflect.DeepEqual(got, want) {
+			t.Errorf("parseResponse(%q) = %#v, quartz parses %#v", line, got, want)
+		}
+	}
+}
@@ -0,0 +1,493 @@
+package magnumrouter
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"math/rand"
+	"time"
+
+	"github.com/cassaram/quartz"
+)
+
+// Option configures optional behaviour of a MagnumRouter at construction
+type Option func(*options)
+
+type options struct {
+	clock              Clock
+	stateHandler       func(ConnectionState)
+	stateDebounce      time.Duration
+	logger             *slog.Logger
+	syncErrorPolicy    SyncErrorPolicy
+	validateEndpoints  bool
+	routeHistoryDepth  int
+	patternSyntax      PatternSyntax
+	rawMessageHook     func(quartz.QuartzResponse)
+	sparseRouteTable   bool
+	levelNameQuery     bool
+	syncConcurrency    int
+	syncMaxInflight    int
+	levelNames         []string
+	noInitialSync      bool
+	emitInitialSync    bool
+	recorder           io.Writer
+	backoffInitial     time.Duration
+	backoffMax         time.Duration
+	backoffJitter      float64
+	jitterSource       rand.Source
+	backupAddress      string
+	backupPort         uint16
+	backupConn         QuartzConn
+	backupEndpoint     string
+	failoverAttempts   int
+	failback           bool
+	ackWait            time.Duration
+	inverseIndex       bool
+	nameTrimming       bool
+	nameCharset        NameCharset
+	nameReplacement    string
+	duplicateNames     DuplicateNamePolicy
+	nameResolver       NameResolver
+	nameResolverCache  bool
+	indexBase          uint
+	resyncWait         bool
+	monitorMode        bool
+	postSyncValidation func(*MagnumRouter) error
+	auditLog           func(AuditEntry)
+	refreshOnReject    bool
+	syncRetryInterval  time.Duration
+	syncRetryMax       int
+	pauseMode          PauseMode
+}
+
+// Applies opts over the defaults and checks the result, collecting every problem found
+func buildOptions(levelCount uint, opts []Option) (options, error) {
+	o := defaultOptions()
+	for _, opt := range opts {
+		opt(&o)
+	}
+	return o, o.validate(levelCount)
+}
+
+func (o options) validate(levelCount uint) error {
+	errs := []error{}
+	if levelCount == 0 || levelCount > maxLevels {
+		errs = append(errs, fmt.Errorf("level count must be between 1 and %d, got %d", maxLevels, levelCount))
+	}
+	if o.clock == nil {
+		errs = append(errs, errors.New("clock must not be nil"))
+	}
+	if o.logger == nil {
+		errs = append(errs, errors.New("logger must not be nil"))
+	}
+	if o.stateDebounce < 0 {
+		errs = append(errs, fmt.Errorf("state debounce must not be negative, got %v", o.stateDebounce))
+	}
+	if o.routeHistoryDepth < 0 {
+		errs = append(errs, fmt.Errorf("route history depth must not be negative, got %d", o.routeHistoryDepth))
+	}
+	if o.syncConcurrency < 0 {
+		errs = append(errs, fmt.Errorf("sync concurrency must not be negative, got %d", o.syncConcurrency))
+	}
+	if o.syncMaxInflight < 0 {
+		errs = append(errs, fmt.Errorf("sync max inflight must not be negative, got %d", o.syncMaxInflight))
+	}
+	if len(o.levelNames) > int(levelCount) {
+		errs = append(errs, fmt.Errorf("%d level names given but level count is %d", len(o.levelNames), levelCount))
+	}
+	if o.backoffInitial <= 0 || o.backoffMax < o.backoffInitial {
+		errs = append(errs, fmt.Errorf("connect backoff must be positive with max at least initial, got %v up to %v", o.backoffInitial, o.backoffMax))
+	}
+	if (o.backupAddress != "" || o.backupConn != nil) && o.failoverAttempts < 1 {
+		errs = append(errs, fmt.Errorf("failover attempts must be at least 1, got %d", o.failoverAttempts))
+	}
+	if o.backupAddress != "" && o.backupConn != nil {
+		errs = append(errs, errors.New("a backup address and a backup conn cannot both be set"))
+	}
+	if o.syncRetryInterval < 0 || o.syncRetryMax < 0 {
+		errs = append(errs, fmt.Errorf("sync retry must not be negative, got %v up to %d times", o.syncRetryInterval, o.syncRetryMax))
+	}
+	if o.ackWait < 0 {
+		errs = append(errs, fmt.Errorf("ack wait must not be negative, got %v", o.ackWait))
+	}
+	if len(errs) > 0 {
+		return fmt.Errorf("%w: %w", ErrInvalidOptions, errors.Join(errs...))
+	}
+	return nil
+}
+
+func defaultOptions() options {
+	return options{
+		clock:            systemClock{},
+		logger:           slog.New(slog.NewTextHandler(io.Discard, nil)),
+		backoffInitial:   defaultBackoffInitial,
+		backoffMax:       defaultBackoffMax,
+		nameTrimming:     true,
+		indexBase:        1,
+		failoverAttempts: defaultFailoverAttempts,
+	}
+}
+
+// Sets the clock used for all timing within the router
+// Defaults to the system clock
+func WithClock(clock Clock) Option {
+	return func(o *options) {
+		o.clock = clock
+	}
+}
+
+// Sets a function to be called whenever the connection state changes
+// The function is called from its own goroutine when debouncing is enabled, and should not block
+func WithStateHandler(handler func(ConnectionState)) Option {
+	return func(o *options) {
+		o.stateHandler = handler
+	}
+}
+
+// Only publishes a connection state once it has persisted for the debounce window
+// Brief blips between states are not published, but the final stable state always is
+// A duration of 0 (default) publishes every transition immediately
+func WithStateDebounce(d time.Duration) Option {
+	return func(o *options) {
+		o.stateDebounce = d
+	}
+}
+
+// Sets the logger used for diagnostics
+// Defaults to discarding all output
+func WithLogger(logger *slog.Logger) Option {
+	return func(o *options) {
+		o.logger = logger
+	}
+}
+
+// Sets how Connect handles queries that fail during the initial sync
+// Defaults to SyncStrict
+func WithSyncErrorPolicy(policy SyncErrorPolicy) Option {
+	return func(o *options) {
+		o.syncErrorPolicy = policy
+	}
+}
+
+// Rejects routes to or from endpoints with no cached name, returning ErrEndpointNotConfigured
+// An unnamed endpoint is usually an unconfigured one, so routing it is likely an operator error
+// However magnum permits valid endpoints without names, and names are unknown until synced, so this is off by default
+func WithValidateEndpoints(validate bool) Option {
+	return func(o *options) {
+		o.validateEndpoints = validate
+	}
+}
+
+// Records the last depth routes received for every crosspoint, queryable via MagnumRouter.RouteHistory()
+// Disabled by default (depth 0) to avoid the memory overhead
+func WithRouteHistory(depth int) Option {
+	return func(o *options) {
+		o.routeHistoryDepth = depth
+	}
+}
+
+// Sets the syntax used by pattern based operations such as MagnumRouter.SetRouteByPattern()
+// Defaults to PatternGlob
+func WithPatternSyntax(syntax PatternSyntax) Option {
+	return func(o *options) {
+		o.patternSyntax = syntax
+	}
+}
+
+// Sets a function to be called with every message received from the server, before it is processed
+// This includes message types that are otherwise ignored, which is useful for protocol debugging
+// The hook runs synchronously in the response loop, so it must return quickly and must not block
+// Raw outgoing commands cannot be observed as the quartz layer does not expose them
+func WithRawMessageHook(hook func(quartz.QuartzResponse)) Option {
+	return func(o *options) {
+		o.rawMessageHook = hook
+	}
+}
+
+// Backs the route table with a map holding only crosspoints with a known source
+// Saves memory on very large frames that are sparsely routed, at the cost of slower access
+// All getters behave the same, absent crosspoints read as SourceUnknown
+func WithSparseRouteTable(sparse bool) Option {
+	return func(o *options) {
+		o.sparseRouteTable = sparse
+	}
+}
+
+// Queries level names from the device during sync
+// Magnum does not support level names so this is off by default to avoid sending unsupported queries
+// Devices that fail the query keep the static level letters
+func WithLevelNameQuery(query bool) Option {
+	return func(o *options) {
+		o.levelNameQuery = query
+	}
+}
+
+// Sets the maximum number of sync queries outstanding at once
+// Higher values greatly reduce sync time on high latency links
+// Above 1 the connection is called from several goroutines at once, as all connections of this package allow
+// Defaults to 1, sending queries one at a time in order
+func WithSyncConcurrency(n int) Option {
+	return func(o *options) {
+		o.syncConcurrency = n
+	}
+}
+
+// Caps the number of sync queries sent without a response yet, 0 for no cap (default)
+// Unlike WithSyncConcurrency(), which only bounds queries being written, this holds back new queries until
+// responses arrive, so a device that answers slowly is not flooded and its responses cannot overflow the channel
+// A lost response releases its slot once no response has arrived for a second, so the sync cannot stall
+func WithSyncMaxInflight(n int) Option {
+	return func(o *options) {
+		o.syncMaxInflight = n
+	}
+}
+
+// Sets names for levels, indexed by level ID
+// Names reported by the device take precedence, and unnamed levels fall back to the quartz level letter
+func WithLevelNames(names []string) Option {
+	return func(o *options) {
+		o.levelNames = append([]string{}, names...)
+	}
+}
+
+// Skips the initial sync in Connect, leaving the cache empty until the application requests what it needs
+// Useful for very large frames where an eager sync is prohibitive
+func WithNoInitialSync() Option {
+	return func(o *options) {
+		o.noInitialSync = true
+	}
+}
+
+// Publishes an event flagged Initial the first time each route, name and lock is learned after connecting,
+// including values the cache already held, so the event stream alone describes the full state
+// Useful for consumers subscribed before Connect that do not read the cache
+// With WithNoInitialSync(), values are reported as the application requests them
+func WithEmitInitialSync(emit bool) Option {
+	return func(o *options) {
+		o.emitInitialSync = emit
+	}
+}
+
+// Records every message received from the server to w, one JSON object per line
+// Recordings can be replayed for offline analysis with NewReplayRouter()
+func WithRecorder(w io.Writer) Option {
+	return func(o *options) {
+		o.recorder = w
+	}
+}
+
+// Sets the backoff between attempts in MagnumRouter.ConnectRetry()
+// The delay starts at initial and doubles after each failed attempt up to max
+// Defaults to 250ms doubling up to 10s, see WithReconnectJitter() to randomise the delays
+func WithConnectBackoff(initial time.Duration, max time.Duration) Option {
+	return func(o *options) {
+		o.backoffInitial = initial
+		o.backoffMax = max
+	}
+}
+
+// Randomly shortens each MagnumRouter.ConnectRetry() backoff by up to factor of the delay, clamped to 0 to 1
+// Staggers many routers reconnecting to the same frame, 0.5 gives equal jitter and 1 full jitter
+// Defaults to 0, no jitter
+func WithReconnectJitter(factor float64) Option {
+	return func(o *options) {
+		o.backoffJitter = max(0, min(factor, 1))
+	}
+}
+
+// Sets the random source used for backoff jitter, for reproducible delays
+// Defaults to a source seeded from the system time
+func WithJitterSource(src rand.Source) Option {
+	return func(o *options) {
+		o.jitterSource = src
+	}
+}
+
+// Sets a backup control interface for MagnumRouter.ConnectRetry() to fail over to
+// After WithFailoverAttempts() consecutive failed attempts it switches endpoint, the router resyncing on connect as usual
+// There is no automatic reconnect, so a lost connection fails over on the next ConnectRetry()
+// Optional capabilities of a connection given to NewMagnumRouterWithConn(), other than level name queries,
+// are not available with a backup set
+func WithBackupAddress(address string, port uint16) Option {
+	return func(o *options) {
+		o.backupAddress = address
+		o.backupPort = port
+	}
+}
+
+// Sets a backup connection to fail over to as per WithBackupAddress(), for a transport quartz cannot dial itself
+// endpoint is reported by MagnumRouter.ActiveEndpoint() while on the backup, such as its "host:port"
+func WithBackupConn(conn QuartzConn, endpoint string) Option {
+	return func(o *options) {
+		o.backupConn = conn
+		o.backupEndpoint = endpoint
+	}
+}
+
+// Sets the consecutive failed connect attempts on one endpoint before failing over to the other
+// Defaults to 3, only used with WithBackupAddress() or WithBackupConn()
+func WithFailoverAttempts(n int) Option {
+	return func(o *options) {
+		o.failoverAttempts = n
+	}
+}
+
+// Makes each MagnumRouter.ConnectRetry() try the primary first, failing back once it has recovered
+// Without this the router stays on the backup until the backup fails
+func WithFailback(failback bool) Option {
+	return func(o *options) {
+		o.failback = failback
+	}
+}
+
+// Makes SetRoute and SetLock wait up to timeout for the server to acknowledge each command
+// Catches commands dropped by the device without waiting for the resulting update
+// Returns ErrAckTimeout if no acknowledgement arrives, or ErrCommandRejected if the server responds with an error
+// Quartz errors carry no identifier, so an error answering a query, such as one sent by the initial sync,
+// is taken as rejecting the oldest waiting command, so only rely on rejections once MagnumRouter.SyncComplete()
+// Disabled by default (timeout 0), sending commands fire and forget
+func WithAckWait(timeout time.Duration) Option {
+	return func(o *options) {
+		o.ackWait = timeout
+	}
+}
+
+// Maintains an index of destinations by level and source as routes change
+// Makes source usage queries such as MagnumRouter.DestinationsForSource() and MagnumRouter.IsSourceInUse()
+// proportional to the result instead of scanning the whole route table
+// Off by default to avoid the memory and maintenance cost when unused
+func WithInverseIndex(index bool) Option {
+	return func(o *options) {
+		o.inverseIndex = index
+	}
+}
+
+// Normalizes names as they are received from the device, before they are cached
+// Surrounding whitespace is trimmed, and runs of control characters within a name are collapsed to a single space
+// Magnum commonly pads names to a fixed width, so this is on by default
+func WithNameTrimming(trim bool) Option {
+	return func(o *options) {
+		o.nameTrimming = trim
+	}
+}
+
+// Sets how the bytes of received names are interpreted before caching
+// With NameCharsetUTF8 each run of invalid bytes is replaced with replacement, or U+FFFD if it is empty
+// Defaults to NameCharsetRaw, though name trimming already replaces invalid bytes with U+FFFD when enabled
+func WithNameCharset(charset NameCharset, replacement string) Option {
+	return func(o *options) {
+		o.nameCharset = charset
+		o.nameReplacement = replacement
+	}
+}
+
+// Sets how lookups by exact name, such as MagnumRouter.SetRouteByName() and MagnumRouter.PlanByNames(),
+// resolve a name shared by several sources or destinations
+// Defaults to DuplicateNameFirstWins
+func WithDuplicateNamePolicy(policy DuplicateNamePolicy) Option {
+	return func(o *options) {
+		o.duplicateNames = policy
+	}
+}
+
+// Sets a resolver for names of endpoints the device does not name, such as from an asset database
+// Consulted lazily by display name helpers such as MagnumRouter.SourceDisplayName(), resolved names are never cached as device names
+// The resolver is called without the router locked, and may be called concurrently
+func WithNameResolver(resolver NameResolver) Option {
+	return func(o *options) {
+		o.nameResolver = resolver
+	}
+}
+
+// Memoizes results from the WithNameResolver() resolver, including endpoints it has no name for
+// Use MagnumRouter.ClearResolvedNames() to discard memoized results
+func WithNameResolverCache(cache bool) Option {
+	return func(o *options) {
+		o.nameResolverCache = cache
+	}
+}
+
+// Sets the ID of the first source and destination, 0 or 1, with other values treated as 1
+// Defaults to 1, as magnum reserves index 0, leaving index 0 of the returned tables unused
+// With base 0 the tables are indexed from ID 0 with no unused entry, but a crosspoint routed to
+// source 0 cannot be told apart from one whose route is unknown, as both read as SourceUnknown
+func WithIndexBase(base uint) Option {
+	return func(o *options) {
+		o.indexBase = min(base, 1)
+	}
+}
+
+// Sets whether index 0 is reserved, equivalent to WithIndexBase(1) when true and WithIndexBase(0) when false
+// Defaults to true, see WithIndexBase() for how getters and SourceUnknown behave when index 0 is usable
+func WithReserveZero(reserve bool) Option {
+	if reserve {
+		return WithIndexBase(1)
+	}
+	return WithIndexBase(0)
+}
+
+// Makes cache dependent operations such as MagnumRouter.EnsureRoute() wait for a sync in progress to finish
+// instead of returning ErrResyncInProgress
+func WithResyncWait(wait bool) Option {
+	return func(o *options) {
+		o.resyncWait = wait
+	}
+}
+
+// Only observes the router, refusing routes and lock changes with ErrReadOnly before anything is sent
+// Queries and sync are unaffected, making this safe for dashboards and monitoring connected to live gear
+func WithMonitorMode(monitor bool) Option {
+	return func(o *options) {
+		o.monitorMode = monitor
+	}
+}
+
+// Runs a check once the initial sync has completed, failing Connect with its error
+// With this set, Connect waits for a response to every sync query before running the check,
+// so should be bounded with ConnectContext() in case the device drops responses
+// MagnumRouter.ValidateFullySynced() can be used directly as the check
+func WithPostSyncValidation(validate func(*MagnumRouter) error) Option {
+	return func(o *options) {
+		o.postSyncValidation = validate
+	}
+}
+
+// Sets a function to be called with an AuditEntry for every route and lock attempt, whether it succeeded or not
+// Intended for compliance audit trails, separate from diagnostic logging
+// The function is called synchronously from the operation, without the router locked, and should return quickly
+func WithAuditLog(log func(AuditEntry)) Option {
+	return func(o *options) {
+		o.auditLog = log
+	}
+}
+
+// Resends queries that failed during a best-effort sync every interval, up to max times, 0 for no limit
+// Retries run in the background from when Connect succeeds until every query has been sent or the router disconnects,
+// and their responses update the cache and publish events as usual
+// Only applies with SyncBestEffort, disabled by default (interval 0)
+func WithSyncRetry(interval time.Duration, max int) Option {
+	return func(o *options) {
+		o.syncRetryInterval = interval
+		o.syncRetryMax = max
+	}
+}
+
+// Sets what MagnumRouter.PauseUpdates() does with updates received while paused
+// Defaults to PauseBuffer
+func WithPauseMode(mode PauseMode) Option {
+	return func(o *options) {
+		o.pauseMode = mode
+	}
+}
+
+// Re-queries the lock status and routes of a destination when the server rejects a command for it
+// The cache is only updated from the server, so it is never wrong after a rejection,
+// but a rejection usually means a lock the cache missed, which this picks up
+// Rejections can only be attributed to a command with WithAckWait() enabled, so this has no effect without it,
+// and are subject to the same limits on queries in flight
+func WithRefreshOnReject(refresh bool) Option {
+	return func(o *options) {
+		o.refreshOnReject = refresh
+	}
+}
@@ -0,0 +1,50 @@
+package magnumrouter
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestNewMagnumRouterWithOptionsApplied(t *testing.T) {
+	m, err := NewMagnumRouterWithOptions("127.0.0.1", 12345, 4, 4, 2, WithLevelNames([]string{"VIDEO"}), WithRouteHistory(3))
+	if err != nil {
+		t.Fatalf("NewMagnumRouterWithOptions() = %v", err)
+	}
+	defer m.Close()
+	if got := m.GetLevelName(0); got != "VIDEO" {
+		t.Errorf("GetLevelName(0) = %q, want VIDEO", got)
+	}
+	if got := m.opts.routeHistoryDepth; got != 3 {
+		t.Errorf("route history depth %d, want 3", got)
+	}
+}
+
+func TestNewMagnumRouterWithOptionsValidated(t *testing.T) {
+	m, err := NewMagnumRouterWithOptions("127.0.0.1", 12345, 4, 4, 1,
+		WithLevelNames([]string{"VIDEO", "AUDIO"}),
+		WithConnectBackoff(time.Second, time.Millisecond),
+		WithAckWait(-time.Second),
+		WithBackupAddress("10.0.0.2", 5000),
+		WithBackupConn(newScriptConn(), "backup"))
+	if !errors.Is(err, ErrInvalidOptions) {
+		t.Fatalf("NewMagnumRouterWithOptions() = %v, want ErrInvalidOptions", err)
+	}
+	if m != nil {
+		t.Error("returned a router along with the error")
+	}
+	for _, want := range []string{"level names", "connect backoff", "ack wait", "backup"} {
+		if !strings.Contains(err.Error(), want) {
+			t.Errorf("error %q does not report the %s", err, want)
+		}
+	}
+}
+
+func TestNewMagnumRouterWithOptionsLevelCount(t *testing.T) {
+	for _, levels := range []uint{0, maxLevels + 1} {
+		if _, err := NewMagnumRouterWithOptions("127.0.0.1", 12345, 4, 4, levels); !errors.Is(err, ErrInvalidOptions) {
+			t.Errorf("level count %d: got %v, want ErrInvalidOptions", levels, err)
+		}
+	}
+}
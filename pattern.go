@@ -0,0 +1,121 @@
+package magnumrouter
+
+import (
+	"context"
+	"fmt"
+	"path"
+	"regexp"
+)
+
+// Syntax used to match names in pattern based operations
+type PatternSyntax int
+
+const (
+	// Shell style globs as implemented by path.Match, e.g. "CAM*" (default)
+	PatternGlob PatternSyntax = iota
+	// Regular expressions as implemented by regexp, e.g. "^CAM[0-9]+$"
+	PatternRegexp
+)
+
+// Routes every destination whose cached name matches destPattern from the source(s) whose name matches srcPattern
+// Matches are ordered by ID, and unnamed endpoints never match
+// A single matched source is routed to all matched destinations
+// Multiple matched sources are paired positionally with the matched destinations, and must be equal in number
+// Any other combination returns ErrAmbiguousMatch without routing anything
+// Returns the ops that were applied, which on error are those applied before the failure
+func (m *MagnumRouter) SetRouteByPattern(ctx context.Context, destPattern string, srcPattern string, levels []uint) ([]RouteOp, error) {
+	destinations, err := m.matchNames(func() []string { return m.destinationNames }, destPattern)
+	if err != nil {
+		return nil, err
+	}
+	sources, err := m.matchNames(func() []string { return m.sourceNames }, srcPattern)
+	if err != nil {
+		return nil, err
+	}
+	if len(destinations) == 0 {
+		return nil, fmt.Errorf("%w: no destination matches %q", ErrNameNotFound, destPattern)
+	}
+	if len(sources) == 0 {
+		return nil, fmt.Errorf("%w: no source matches %q", ErrNameNotFound, srcPattern)
+	}
+	if len(sources) > 1 && len(sources) != len(destinations) {
+		return nil, fmt.Errorf("%w: %d sources cannot be paired with %d destinations", ErrAmbiguousMatch, len(sources), len(destinations))
+	}
+
+	ops := make([]RouteOp, 0, len(destinations))
+	for i, dest := range destinations {
+		src := sources[0]
+		if len(sources) > 1 {
+			src = sources[i]
+		}
+		ops = append(ops, RouteOp{Levels: levels, Destination: dest, Source: src})
+	}
+
+	ctx = m.correlate(ctx)
+	applied := []RouteOp{}
+	for _, op := range ops {
+		if err := ctx.Err(); err != nil {
+			return applied, err
+		}
+		if _, err := m.setRoute(ctx, "SetRouteByPattern", op.Levels, op.Destination, op.Source, nil); err != nil {
+			return applied, err
+		}
+		applied = append(applied, op)
+	}
+	return applied, nil
+}
+
+// Routes the destination with the given cached name from the source with the given cached name, as per SetRoute()
+// Names must match exactly, and a name shared by several endpoints is resolved by WithDuplicateNamePolicy(),
+// returning ErrAmbiguousName listing the candidates with DuplicateNameError
+// Returns ErrNameNotFound if no endpoint has the name
+func (m *MagnumRouter) SetRouteByName(ctx context.Context, levels []uint, destination string, source string) error {
+	m.mu.RLock()
+	dest, destErr := m.idByNameLocked(m.destinationNames, destination)
+	src, srcErr := m.idByNameLocked(m.sourceNames, source)
+	m.mu.RUnlock()
+	if destErr != nil {
+		return fmt.Errorf("destination %q: %w", destination, destErr)
+	}
+	if srcErr != nil {
+		return fmt.Errorf("source %q: %w", source, srcErr)
+	}
+	_, err := m.setRoute(ctx, "SetRouteByName", levels, dest, src, nil)
+	return err
+}
+
+// Returns the IDs of all named entries in a cached name table matching the pattern
+// The table is selected with mu held
+func (m *MagnumRouter) matchNames(table func() []string, pattern string) ([]uint, error) {
+	match, err := m.compilePattern(pattern)
+	if err != nil {
+		return nil, err
+	}
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	names := table()
+	ids := []uint{}
+	for i := int(m.base()); i < len(names); i++ {
+		if names[i] != "" && match(names[i]) {
+			ids = append(ids, uint(i))
+		}
+	}
+	return ids, nil
+}
+
+func (m *MagnumRouter) compilePattern(pattern string) (func(string) bool, error) {
+	if m.opts.patternSyntax == PatternRegexp {
+		re, err := regexp.Compile(pattern)
+		if err != nil {
+			return nil, err
+		}
+		return re.MatchString, nil
+	}
+	if _, err := path.Match(pattern, ""); err != nil {
+		return nil, fmt.Errorf("invalid glob %q: %w", pattern, err)
+	}
+	return func(name string) bool {
+		ok, _ := path.Match(pattern, name)
+		return ok
+	}, nil
+}
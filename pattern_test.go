@@ -0,0 +1,103 @@
+package magnumrouter
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/cassaram/quartz"
+)
+
+func TestSetRouteByPatternFanout(t *testing.T) {
+	m, _ := newFakeRouter(t, 4, 3, 1)
+	ops, err := m.SetRouteByPattern(context.Background(), "DST *", "SRC 2", []uint{0})
+	if err != nil {
+		t.Fatalf("SetRouteByPattern() = %v", err)
+	}
+	want := []RouteOp{
+		{Levels: []uint{0}, Destination: 1, Source: 2},
+		{Levels: []uint{0}, Destination: 2, Source: 2},
+		{Levels: []uint{0}, Destination: 3, Source: 2},
+	}
+	if !reflect.DeepEqual(ops, want) {
+		t.Errorf("ops = %v, want %v", ops, want)
+	}
+	eventually(t, func() bool { return m.GetRoute(0, 1) == 2 && m.GetRoute(0, 2) == 2 && m.GetRoute(0, 3) == 2 })
+}
+
+func TestSetRouteByPatternPositional(t *testing.T) {
+	m, _ := newFakeRouter(t, 4, 3, 1, WithPatternSyntax(PatternRegexp))
+	ops, err := m.SetRouteByPattern(context.Background(), "^DST [12]$", "^SRC [34]$", []uint{0})
+	if err != nil {
+		t.Fatalf("SetRouteByPattern() = %v", err)
+	}
+	want := []RouteOp{
+		{Levels: []uint{0}, Destination: 1, Source: 3},
+		{Levels: []uint{0}, Destination: 2, Source: 4},
+	}
+	if !reflect.DeepEqual(ops, want) {
+		t.Errorf("ops = %v, want %v", ops, want)
+	}
+	eventually(t, func() bool { return m.GetRoute(0, 1) == 3 && m.GetRoute(0, 2) == 4 })
+}
+
+func TestSetRouteByPatternAmbiguous(t *testing.T) {
+	m, conn := newFakeRouter(t, 4, 3, 1)
+	if _, err := m.SetRouteByPattern(context.Background(), "DST *", "SRC [12]", []uint{0}); !errors.Is(err, ErrAmbiguousMatch) {
+		t.Errorf("SetRouteByPattern() = %v, want ErrAmbiguousMatch", err)
+	}
+	if _, err := m.SetRouteByPattern(context.Background(), "MON *", "SRC 1", []uint{0}); !errors.Is(err, ErrNameNotFound) {
+		t.Errorf("SetRouteByPattern() = %v, want ErrNameNotFound", err)
+	}
+	conn.mu.Lock()
+	defer conn.mu.Unlock()
+	if len(conn.routes) != 0 {
+		t.Errorf("routed %v despite the errors", conn.routes)
+	}
+}
+
+func TestSetRouteByNameDuplicates(t *testing.T) {
+	policies := map[string]struct {
+		policy DuplicateNamePolicy
+		want   []string
+		err    error
+	}{
+		"first wins": {policy: DuplicateNameFirstWins, want: []string{"route [V] 1 2"}},
+		"last wins":  {policy: DuplicateNameLastWins, want: []string{"route [V] 1 4"}},
+		"error":      {policy: DuplicateNameError, err: ErrAmbiguousName},
+	}
+	for name, c := range policies {
+		t.Run(name, func(t *testing.T) {
+			m, conn := newScriptRouter(t, 4, 2, 1, WithDuplicateNamePolicy(c.policy))
+			m.processMessage(&quartz.ResponseReadDestination{Destination: 1, Name: "MON 1"})
+			for _, src := range []uint{2, 4} {
+				m.processMessage(&quartz.ResponseReadSource{Source: src, Name: "CAM"})
+			}
+			err := m.SetRouteByName(context.Background(), []uint{0}, "MON 1", "CAM")
+			if !errors.Is(err, c.err) {
+				t.Fatalf("SetRouteByName() = %v, want %v", err, c.err)
+			}
+			if c.err != nil && !strings.Contains(err.Error(), "[2 4]") {
+				t.Errorf("error %q does not list the candidates 2 and 4", err)
+			}
+			sent := []string{}
+			for _, call := range conn.recorded() {
+				if strings.HasPrefix(call, "route") {
+					sent = append(sent, call)
+				}
+			}
+			if len(sent) != len(c.want) || (len(sent) > 0 && sent[0] != c.want[0]) {
+				t.Errorf("sent %q, want %q", sent, c.want)
+			}
+		})
+	}
+}
+
+func TestSetRouteByNameNotFound(t *testing.T) {
+	m, _ := newScriptRouter(t, 2, 2, 1)
+	if err := m.SetRouteByName(context.Background(), []uint{0}, "MON 1", "CAM"); !errors.Is(err, ErrNameNotFound) {
+		t.Errorf("SetRouteByName() with unknown names = %v, want ErrNameNotFound", err)
+	}
+}
@@ -0,0 +1,105 @@
+package magnumrouter
+
+import (
+	"context"
+	"sync"
+
+	"github.com/cassaram/quartz"
+)
+
+// Most updates buffered while paused before the buffer is discarded and resuming resyncs instead
+const pauseBufferLimit = 65536
+
+// Selects what happens to updates received while paused, see WithPauseMode()
+type PauseMode int
+
+const (
+	// Updates are buffered and applied in order on resume, falling back to a resync if too many arrive (default)
+	PauseBuffer PauseMode = iota
+	// Updates are dropped and resuming resyncs the whole cache from the device
+	PauseDrop
+)
+
+type pauseState struct {
+	mu       sync.Mutex
+	paused   bool
+	buffer   []quartz.QuartzResponse
+	overflow bool
+}
+
+// Stops applying updates from the device to the cache, freezing it without disconnecting, such as to take a stable snapshot
+// While paused the cache goes stale: route, lock and name changes on the device are not seen, no events are published
+// for them, and operations waiting on them such as SetRouteConfirmed() wait until resumed
+// Commands are still sent, and acknowledgements still processed
+// Has no effect if already paused
+func (m *MagnumRouter) PauseUpdates() {
+	m.pause.mu.Lock()
+	defer m.pause.mu.Unlock()
+	m.pause.paused = true
+}
+
+// Returns whether updates are paused by PauseUpdates()
+func (m *MagnumRouter) UpdatesPaused() bool {
+	m.pause.mu.Lock()
+	defer m.pause.mu.Unlock()
+	return m.pause.paused
+}
+
+// Resumes applying updates paused by PauseUpdates(), bringing the cache up to date
+// With PauseBuffer the buffered updates are applied in the order received, before any update arriving after this call
+// With PauseDrop, or if the buffer overflowed, the cache is resynced from the device, bounded by the context
+// Returns the resync error, or nil if not paused
+func (m *MagnumRouter) ResumeUpdates(ctx context.Context) error {
+	m.pause.mu.Lock()
+	if !m.pause.paused {
+		m.pause.mu.Unlock()
+		return nil
+	}
+	m.pause.paused = false
+	resync := m.opts.pauseMode == PauseDrop || m.pause.overflow
+	buffer := m.pause.buffer
+	m.pause.buffer = nil
+	m.pause.overflow = false
+	if !resync {
+		// Replayed with the lock held so newly received updates queue behind the buffered ones
+		for _, msg := range buffer {
+			m.applyAndPublish(msg)
+		}
+	}
+	m.pause.mu.Unlock()
+	if resync {
+		return m.requestAll(ctx)
+	}
+	return nil
+}
+
+// Holds back a message that would change the cache while paused, returning whether it was held
+// Dropped query responses are still counted so waiters on responses are not left waiting on them
+func (m *MagnumRouter) holdWhilePaused(msg quartz.QuartzResponse) bool {
+	if !isQueryResponse(msg) && msg.GetType() != quartz.QUARTZ_RESP_TYPE_READ_LVL {
+		return false
+	}
+	m.pause.mu.Lock()
+	defer m.pause.mu.Unlock()
+	if !m.pause.paused {
+		return false
+	}
+	if m.opts.pauseMode == PauseBuffer && !m.pause.overflow {
+		if len(m.pause.buffer) < pauseBufferLimit {
+			m.pause.buffer = append(m.pause.buffer, msg)
+			return true
+		}
+		m.opts.logger.Warn("magnum paused update buffer full, resuming will resync")
+		for _, buffered := range m.pause.buffer {
+			if isQueryResponse(buffered) {
+				m.countResponse()
+			}
+		}
+		m.pause.buffer = nil
+		m.pause.overflow = true
+	}
+	if isQueryResponse(msg) {
+		m.countResponse()
+	}
+	return true
+}
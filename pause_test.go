@@ -0,0 +1,80 @@
+package magnumrouter
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestPauseBufferReplays(t *testing.T) {
+	m, _ := newFakeRouter(t, 4, 4, 1)
+	events, unsubscribe := m.Subscribe()
+	defer unsubscribe()
+	m.PauseUpdates()
+	if !m.UpdatesPaused() {
+		t.Fatal("UpdatesPaused() = false after pausing")
+	}
+	m.processMessage(update(1, 2))
+	m.processMessage(update(1, 3))
+	m.processMessage(update(2, 1))
+	if got := m.GetRoute(0, 1); got == 2 || got == 3 {
+		t.Errorf("GetRoute(0, 1) = %d while paused, want the cache frozen", got)
+	}
+	select {
+	case ev := <-events:
+		t.Fatalf("event %+v while paused", ev)
+	case <-time.After(20 * time.Millisecond):
+	}
+
+	if err := m.ResumeUpdates(context.Background()); err != nil {
+		t.Fatalf("ResumeUpdates() = %v", err)
+	}
+	// Replayed in order, so the later update wins
+	if got := m.GetRoute(0, 1); got != 3 {
+		t.Errorf("GetRoute(0, 1) = %d after resuming, want 3", got)
+	}
+	if got := m.GetRoute(0, 2); got != 1 {
+		t.Errorf("GetRoute(0, 2) = %d after resuming, want 1", got)
+	}
+	for _, want := range []uint{2, 3} {
+		select {
+		case ev := <-events:
+			if ev.Destination != 1 || ev.Source != want {
+				t.Errorf("event %+v, want destination 1 routed to %d", ev, want)
+			}
+		case <-time.After(time.Second):
+			t.Fatal("no event for a replayed update")
+		}
+	}
+}
+
+func TestPauseDropResyncs(t *testing.T) {
+	m, fake := newFakeRouter(t, 4, 4, 1, WithPauseMode(PauseDrop))
+	m.PauseUpdates()
+	// The device changes while paused, and the update is dropped
+	fake.mu.Lock()
+	fake.routes[crosspoint{destination: 1, level: 0}] = 3
+	fake.mu.Unlock()
+	m.processMessage(update(1, 3))
+	if got := m.GetRoute(0, 1); got == 3 {
+		t.Fatal("update applied while paused")
+	}
+
+	if err := m.ResumeUpdates(context.Background()); err != nil {
+		t.Fatalf("ResumeUpdates() = %v", err)
+	}
+	if m.UpdatesPaused() {
+		t.Error("UpdatesPaused() = true after resuming")
+	}
+	eventually(t, func() bool { return m.GetRoute(0, 1) == 3 })
+}
+
+func TestResumeWhenNotPaused(t *testing.T) {
+	m, conn := newScriptRouter(t, 2, 2, 1, WithPauseMode(PauseDrop))
+	if err := m.ResumeUpdates(context.Background()); err != nil {
+		t.Errorf("ResumeUpdates() = %v when not paused", err)
+	}
+	if got := conn.recorded(); len(got) != 1 {
+		t.Errorf("sent %q, want no resync", got)
+	}
+}
@@ -0,0 +1,106 @@
+package magnumrouter
+
+import (
+	"cmp"
+	"fmt"
+	"sort"
+)
+
+// Returns the routes needed to move the cache to a desired state given by names, without sending anything
+// desired maps destination name to level name to source name, with level names as per GetLevelName()
+// Crosspoints already routed to the desired source are skipped, and levels sharing a destination
+// and source are combined into one op, so the plan can be applied as is with SetRoutes()
+// Entries naming an unknown endpoint or level are skipped and reported in the returned errors,
+// as are those naming a duplicated endpoint name with DuplicateNameError
+func (m *MagnumRouter) PlanByNames(desired map[string]map[string]string) ([]RouteOp, []error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	errs := []error{}
+	type target struct {
+		destination uint
+		source      uint
+	}
+	planned := map[target][]uint{}
+
+	for _, destName := range sortedKeys(desired) {
+		dest, err := m.idByNameLocked(m.destinationNames, destName)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("destination %q: %w", destName, err))
+			continue
+		}
+		levels := desired[destName]
+		for _, levelName := range sortedKeys(levels) {
+			srcName := levels[levelName]
+			lvl, err := m.levelByNameLocked(levelName)
+			if err != nil {
+				errs = append(errs, fmt.Errorf("destination %q level %q: %w", destName, levelName, err))
+				continue
+			}
+			src, err := m.idByNameLocked(m.sourceNames, srcName)
+			if err != nil {
+				errs = append(errs, fmt.Errorf("destination %q level %q source %q: %w", destName, levelName, srcName, err))
+				continue
+			}
+			if m.routes.get(dest, lvl) == src {
+				continue
+			}
+			key := target{destination: dest, source: src}
+			planned[key] = append(planned[key], lvl)
+		}
+	}
+
+	ops := make([]RouteOp, 0, len(planned))
+	for key, levels := range planned {
+		sort.Slice(levels, func(i, j int) bool { return levels[i] < levels[j] })
+		ops = append(ops, RouteOp{Levels: levels, Destination: key.destination, Source: key.source})
+	}
+	sort.Slice(ops, func(i, j int) bool {
+		if ops[i].Destination != ops[j].Destination {
+			return ops[i].Destination < ops[j].Destination
+		}
+		return ops[i].Source < ops[j].Source
+	})
+	return ops, errs
+}
+
+// Returns the ID of the entry in a name table with exactly the given name
+// A name shared by several entries is resolved by the WithDuplicateNamePolicy() policy
+func (m *MagnumRouter) idByNameLocked(names []string, name string) (uint, error) {
+	found := []uint{}
+	for i := m.base(); i < uint(len(names)); i++ {
+		if name != "" && names[i] == name {
+			found = append(found, i)
+		}
+	}
+	if len(found) == 0 {
+		return 0, ErrNameNotFound
+	}
+	switch m.opts.duplicateNames {
+	case DuplicateNameLastWins:
+		return found[len(found)-1], nil
+	case DuplicateNameError:
+		if len(found) > 1 {
+			return 0, fmt.Errorf("%w: IDs %v share the name %q", ErrAmbiguousName, found, name)
+		}
+	}
+	return found[0], nil
+}
+
+// Returns the ID of the level with the given name, as per GetLevelName()
+func (m *MagnumRouter) levelByNameLocked(name string) (uint, error) {
+	for lvl := uint(0); lvl < m.levelCount; lvl++ {
+		if m.levelNameLocked(lvl) == name {
+			return lvl, nil
+		}
+	}
+	return 0, ErrNameNotFound
+}
+
+func sortedKeys[K cmp.Ordered, V any](m map[K]V) []K {
+	keys := make([]K, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Slice(keys, func(i, j int) bool { return keys[i] < keys[j] })
+	return keys
+}
@@ -0,0 +1,50 @@
+package magnumrouter
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+)
+
+func TestPlanByNames(t *testing.T) {
+	m, _ := newFakeRouter(t, 4, 4, 2)
+	if err := m.SetRoute([]uint{0}, 1, 2); err != nil {
+		t.Fatalf("SetRoute(): %v", err)
+	}
+	eventually(t, func() bool { return m.GetRoute(0, 1) == 2 })
+
+	desired := map[string]map[string]string{
+		// Video is already routed, so only audio is planned
+		"DST 1": {"V": "SRC 2", "A": "SRC 2"},
+		// Both levels take the same source, so they share an op
+		"DST 2": {"V": "SRC 3", "A": "SRC 3"},
+		"DST 3": {"X": "SRC 1"},
+		"DST 4": {"V": "MISSING"},
+		"NOPE":  {"V": "SRC 1"},
+	}
+	ops, errs := m.PlanByNames(desired)
+	want := []RouteOp{
+		{Levels: []uint{1}, Destination: 1, Source: 2},
+		{Levels: []uint{0, 1}, Destination: 2, Source: 3},
+	}
+	if !reflect.DeepEqual(ops, want) {
+		t.Errorf("PlanByNames() ops = %v, want %v", ops, want)
+	}
+	if len(errs) != 3 {
+		t.Fatalf("PlanByNames() errors = %v, want 3", errs)
+	}
+	for _, err := range errs {
+		if !errors.Is(err, ErrNameNotFound) {
+			t.Errorf("error %v, want ErrNameNotFound", err)
+		}
+	}
+
+	if err := m.SetRoutes(context.Background(), ops); err != nil {
+		t.Fatalf("SetRoutes(): %v", err)
+	}
+	eventually(t, func() bool { return m.GetRoute(1, 2) == 3 })
+	if ops, _ := m.PlanByNames(desired); len(ops) != 0 {
+		t.Errorf("PlanByNames() after applying = %v, want nothing to do", ops)
+	}
+}
@@ -0,0 +1,53 @@
+package magnumrouter
+
+import "context"
+
+// Blocks until the router is connected with its sync finished, the connection fails, or the context is done
+// This is the call a startup sequence needs after starting Connect() or ConnectRetry() in the background
+// A connect, resync or ConnectRetry() in progress is waited for, so a failed attempt that will be retried is not reported
+// Returns the error of the failed connect, an ErrNotConnected if the connection was lost or never started,
+// or the context's error
+// In best-effort mode the sync may have finished with errors, see SyncErrors()
+func (m *MagnumRouter) WaitReady(ctx context.Context) error {
+	for {
+		m.stateMu.Lock()
+		if m.state == StateConnected && m.syncComplete && m.syncing == 0 {
+			m.stateMu.Unlock()
+			return nil
+		}
+		if m.state == StateDisconnected && m.connectCancel == nil && m.retrying == 0 {
+			err := m.connectErr
+			m.stateMu.Unlock()
+			if err == nil {
+				err = ErrNotConnected
+			}
+			return err
+		}
+		if m.readySignal == nil {
+			m.readySignal = make(chan struct{})
+		}
+		signal := m.readySignal
+		m.stateMu.Unlock()
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-signal:
+		}
+	}
+}
+
+// Wakes WaitReady() callers after a change to the state they wait on, stateMu must be held
+func (m *MagnumRouter) signalReadyLocked() {
+	if m.readySignal != nil {
+		close(m.readySignal)
+		m.readySignal = nil
+	}
+}
+
+// Counts ConnectRetry() calls in progress so WaitReady() waits between their attempts
+func (m *MagnumRouter) setRetrying(delta int) {
+	m.stateMu.Lock()
+	defer m.stateMu.Unlock()
+	m.retrying += delta
+	m.signalReadyLocked()
+}
@@ -0,0 +1,101 @@
+package magnumrouter
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+// Starts WaitReady() in the background, returning its result channel
+func waitReady(ctx context.Context, m *MagnumRouter) <-chan error {
+	ready := make(chan error, 1)
+	go func() { ready <- m.WaitReady(ctx) }()
+	return ready
+}
+
+func expectWaiting(t *testing.T, ready <-chan error) {
+	t.Helper()
+	select {
+	case err := <-ready:
+		t.Fatalf("WaitReady() = %v, want still waiting", err)
+	case <-time.After(50 * time.Millisecond):
+	}
+}
+
+func TestWaitReady(t *testing.T) {
+	m, _, release := newSyncingRouter(t)
+	ready := waitReady(context.Background(), m)
+	expectWaiting(t, ready)
+	release()
+	if err := receiveErr(t, ready); err != nil {
+		t.Fatalf("WaitReady() = %v, want ready", err)
+	}
+	// Returns straight away once ready
+	if err := m.WaitReady(context.Background()); err != nil {
+		t.Errorf("WaitReady() when ready = %v", err)
+	}
+}
+
+func TestWaitReadyConnectFailed(t *testing.T) {
+	conn := newScriptConn()
+	conn.connectErr = errors.New("refused")
+	m := NewMagnumRouterWithConn(conn, 2, 2, 1)
+	defer m.Close()
+	if err := m.WaitReady(context.Background()); !errors.Is(err, ErrNotConnected) {
+		t.Errorf("WaitReady() before connecting = %v, want ErrNotConnected", err)
+	}
+	if err := m.Connect(); err == nil {
+		t.Fatal("Connect() succeeded, want refused")
+	}
+	if err := m.WaitReady(context.Background()); err == nil || err.Error() != "refused" {
+		t.Errorf("WaitReady() = %v, want the connect error", err)
+	}
+}
+
+func TestWaitReadyConnectionLost(t *testing.T) {
+	m, conn := newScriptRouter(t, 2, 2, 1)
+	if err := m.WaitReady(context.Background()); err != nil {
+		t.Fatalf("WaitReady() = %v, want ready", err)
+	}
+	conn.drop()
+	eventually(t, func() bool { return m.State() == StateDisconnected })
+	if err := m.WaitReady(context.Background()); !errors.Is(err, ErrNotConnected) {
+		t.Errorf("WaitReady() after the link dropped = %v, want ErrNotConnected", err)
+	}
+}
+
+func TestWaitReadyTimeout(t *testing.T) {
+	m, _, release := newSyncingRouter(t)
+	defer release()
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	if err := m.WaitReady(ctx); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("WaitReady() = %v, want context.DeadlineExceeded", err)
+	}
+}
+
+func TestWaitReadyWaitsForRetries(t *testing.T) {
+	conn := &blockingConn{scriptConn: newScriptConn(), dialing: make(chan struct{}), release: make(chan struct{})}
+	m := NewMagnumRouterWithConn(conn, 2, 2, 1, WithConnectBackoff(time.Millisecond, time.Millisecond))
+	defer m.Close()
+	retried := make(chan error, 1)
+	go func() { retried <- m.ConnectRetry(context.Background(), time.Minute) }()
+	<-conn.dialing
+	ready := waitReady(context.Background(), m)
+	expectWaiting(t, ready)
+
+	// A failed attempt that will be retried is not reported
+	conn.release <- struct{}{}
+	<-conn.dialing
+	expectWaiting(t, ready)
+
+	go m.Disconnect()
+	if err := receiveErr(t, retried); !errors.Is(err, ErrConnectAborted) {
+		t.Fatalf("ConnectRetry() = %v, want ErrConnectAborted", err)
+	}
+	if err := receiveErr(t, ready); !errors.Is(err, ErrConnectAborted) {
+		t.Errorf("WaitReady() = %v, want ErrConnectAborted", err)
+	}
+	close(conn.release)
+}
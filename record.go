@@ -0,0 +1,140 @@
+package magnumrouter
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/cassaram/quartz"
+)
+
+// A received quartz message as written by WithRecorder(), one JSON object per line
+type recordedMessage struct {
+	Time        time.Time `json:"time"`
+	Type        string    `json:"type"`
+	Raw         string    `json:"raw,omitempty"`
+	Levels      string    `json:"levels,omitempty"`
+	Destination uint      `json:"destination,omitempty"`
+	Source      uint      `json:"source,omitempty"`
+	Name        string    `json:"name,omitempty"`
+	Locked      bool      `json:"locked,omitempty"`
+}
+
+func recordMessage(t time.Time, msg quartz.QuartzResponse) recordedMessage {
+	rec := recordedMessage{Time: t, Raw: msg.GetRaw()}
+	switch msg := msg.(type) {
+	case *quartz.ResponseAcknowledge:
+		rec.Type = "ack"
+	case *quartz.ResponseError:
+		rec.Type = "err"
+	case *quartz.ResponsePowerOn:
+		rec.Type = "pwron"
+	case *quartz.ResponseUpdate:
+		rec.Type = "update"
+		for _, lvl := range msg.Levels {
+			rec.Levels += string(lvl)
+		}
+		rec.Destination = msg.Destination
+		rec.Source = msg.Source
+	case *quartz.ResponseReadDestination:
+		rec.Type = "read_dst"
+		rec.Destination = msg.Destination
+		rec.Name = msg.Name
+	case *quartz.ResponseReadSource:
+		rec.Type = "read_src"
+		rec.Source = msg.Source
+		rec.Name = msg.Name
+	case *quartz.ResponseReadLevel:
+		rec.Type = "read_lvl"
+		rec.Levels = string(msg.Level)
+		rec.Name = msg.Name
+	case *quartz.ResponseLockStatus:
+		rec.Type = "lock_sts"
+		rec.Destination = msg.Destination
+		rec.Locked = msg.Locked
+	}
+	return rec
+}
+
+func (rec recordedMessage) message() (quartz.QuartzResponse, error) {
+	switch rec.Type {
+	case "ack":
+		return &quartz.ResponseAcknowledge{RawData: rec.Raw}, nil
+	case "err":
+		return &quartz.ResponseError{RawData: rec.Raw}, nil
+	case "pwron":
+		return &quartz.ResponsePowerOn{RawData: rec.Raw}, nil
+	case "update":
+		levels := []quartz.QuartzLevel{}
+		for i := 0; i < len(rec.Levels); i++ {
+			levels = append(levels, quartz.QuartzLevel(rec.Levels[i]))
+		}
+		return &quartz.ResponseUpdate{RawData: rec.Raw, Levels: levels, Destination: rec.Destination, Source: rec.Source}, nil
+	case "read_dst":
+		return &quartz.ResponseReadDestination{RawData: rec.Raw, Destination: rec.Destination, Name: rec.Name}, nil
+	case "read_src":
+		return &quartz.ResponseReadSource{RawData: rec.Raw, Source: rec.Source, Name: rec.Name}, nil
+	case "read_lvl":
+		return &quartz.ResponseReadLevel{RawData: rec.Raw, Level: quartz.QuartzLevel(rec.Levels), Name: rec.Name}, nil
+	case "lock_sts":
+		return &quartz.ResponseLockStatus{RawData: rec.Raw, Destination: rec.Destination, Locked: rec.Locked}, nil
+	}
+	return nil, fmt.Errorf("unknown recorded message type %q", rec.Type)
+}
+
+// Writes a received message to the recorder if one is configured
+func (m *MagnumRouter) record(msg quartz.QuartzResponse) {
+	if m.recorder == nil {
+		return
+	}
+	if err := m.recorder.Encode(recordMessage(m.opts.clock.Now(), msg)); err != nil {
+		m.opts.logger.Warn("magnum recorder write failed", "err", err)
+	}
+}
+
+// Returns a router whose cache is built by replaying a session recorded with WithRecorder()
+// Every recorded message is processed through the normal response handling before returning
+// The router has no connection, all operations sending to a device return ErrReadOnly
+func NewReplayRouter(r io.Reader, sourceCount uint, destinationCount uint, levelCount uint, opts ...Option) (*MagnumRouter, error) {
+	msgs := []quartz.QuartzResponse{}
+	scanner := bufio.NewScanner(r)
+	for line := 1; scanner.Scan(); line++ {
+		rec := recordedMessage{}
+		if err := json.Unmarshal(scanner.Bytes(), &rec); err != nil {
+			return nil, fmt.Errorf("recording line %d: %w", line, err)
+		}
+		msg, err := rec.message()
+		if err != nil {
+			return nil, fmt.Errorf("recording line %d: %w", line, err)
+		}
+		msgs = append(msgs, msg)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	rx := make(chan quartz.QuartzResponse, len(msgs))
+	for _, msg := range msgs {
+		rx <- msg
+	}
+	close(rx)
+	m := NewMagnumRouterWithConn(replayConn{}, sourceCount, destinationCount, levelCount, opts...)
+	m.handleResponses(rx, nil)
+	return m, nil
+}
+
+// Connection for replayed routers, which have no device to send to
+type replayConn struct{}
+
+func (replayConn) Connect() error                                       { return ErrReadOnly }
+func (replayConn) Disconnect() error                                    { return ErrReadOnly }
+func (replayConn) GetSourceName(uint) error                             { return ErrReadOnly }
+func (replayConn) GetDestinationName(uint) error                        { return ErrReadOnly }
+func (replayConn) GetDestinationLock(uint) error                        { return ErrReadOnly }
+func (replayConn) GetRoute(quartz.QuartzLevel, uint) error              { return ErrReadOnly }
+func (replayConn) SetCrosspoint([]quartz.QuartzLevel, uint, uint) error { return ErrReadOnly }
+func (replayConn) LockDestination(uint) error                           { return ErrReadOnly }
+func (replayConn) UnlockDestination(uint) error                         { return ErrReadOnly }
+func (replayConn) RxMessages() <-chan quartz.QuartzResponse             { return nil }
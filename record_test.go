@@ -0,0 +1,85 @@
+package magnumrouter
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// A bytes.Buffer safe to write from the response handler while the test reads it
+type syncBuffer struct {
+	mu  sync.Mutex
+	buf bytes.Buffer
+}
+
+func (b *syncBuffer) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.Write(p)
+}
+
+func (b *syncBuffer) String() string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.String()
+}
+
+func TestReplayRouterSendsReturnErrReadOnly(t *testing.T) {
+	m, err := NewReplayRouter(strings.NewReader(""), 2, 2, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sends := map[string]func() error{
+		"SetRoute": func() error { return m.SetRoute([]uint{0}, 1, 1) },
+		"SetLock":  func() error { return m.SetLock(1, true) },
+		"SetRoutes": func() error {
+			return m.SetRoutes(context.Background(), []RouteOp{{Levels: []uint{0}, Destination: 1, Source: 2}})
+		},
+		"RequestAllSourceNames": m.RequestAllSourceNames,
+		"Connect":               m.Connect,
+	}
+	for name, send := range sends {
+		if err := send(); !errors.Is(err, ErrReadOnly) {
+			t.Errorf("%s = %v, want ErrReadOnly", name, err)
+		}
+	}
+}
+
+func TestRecordReplayRoundTrip(t *testing.T) {
+	var recording syncBuffer
+	live, _ := newFakeRouter(t, 3, 2, 2, WithRecorder(&recording))
+	if err := live.SetRoute([]uint{0, 1}, 2, 3); err != nil {
+		t.Fatal(err)
+	}
+	if err := live.SetLock(1, true); err != nil {
+		t.Fatal(err)
+	}
+	eventually(t, func() bool { return live.GetRoute(1, 2) == 3 && live.GetDestinationLocked(1) })
+	live.Close()
+	want := live.ExportState()
+
+	lines := strings.Count(recording.String(), "\n")
+	// 3 source names, 2 destination names, 2 locks, 4 routes, then 2 acks, an update and a lock status
+	if lines != 15 {
+		t.Errorf("recorded %d messages, want 15", lines)
+	}
+	replayed, err := NewReplayRouter(strings.NewReader(recording.String()), 3, 2, 2)
+	if err != nil {
+		t.Fatalf("NewReplayRouter() = %v", err)
+	}
+	if got := replayed.ExportState(); !reflect.DeepEqual(got, want) {
+		t.Errorf("replayed state %+v, want %+v", got, want)
+	}
+}
+
+func TestReplayRejectsBadRecording(t *testing.T) {
+	for _, recording := range []string{"not json\n", `{"type":"mystery"}` + "\n"} {
+		if _, err := NewReplayRouter(strings.NewReader(recording), 1, 1, 1); err == nil || !strings.Contains(err.Error(), "line 1") {
+			t.Errorf("NewReplayRouter(%q) = %v, want an error for line 1", recording, err)
+		}
+	}
+}
@@ -0,0 +1,116 @@
+package magnumrouter
+
+import (
+	"context"
+	"errors"
+	"fmt"
+)
+
+// Returns the configured source, destination and level counts
+func (m *MagnumRouter) counts() (sources uint, destinations uint, levels uint) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	return uint(len(m.sourceNames)) - m.base(), uint(len(m.destinationNames)) - m.base(), m.levelCount
+}
+
+// Asks the device for its source, destination and level counts, for use with Resize() after connecting
+// Returns ErrNotSupported if the connection does not implement DeviceSizeQuerier, which includes magnum over quartz
+func (m *MagnumRouter) QueryDeviceSize(ctx context.Context) (sources uint, destinations uint, levels uint, err error) {
+	querier, ok := m.conn.(DeviceSizeQuerier)
+	if !ok {
+		return 0, 0, 0, fmt.Errorf("%w: device size query", ErrNotSupported)
+	}
+	if err := m.checkLinked(); err != nil {
+		return 0, 0, 0, err
+	}
+	return querier.DeviceSize(ctx)
+}
+
+// Changes the source, destination and level counts, preserving all cached entries that remain in range
+// Supports discovering the true size of a device after connecting
+// Shrinking is rejected if it would drop any named, locked or routed entry, unless force is set
+// Should not be called while a sync is in progress, as queries already issued were sized for the old counts
+func (m *MagnumRouter) Resize(sourceCount uint, destinationCount uint, levelCount uint, force bool) error {
+	if levelCount > maxLevels {
+		return fmt.Errorf("%w: level count %d exceeds %d", ErrLevelOutOfRange, levelCount, maxLevels)
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if !force {
+		errs := []error{}
+		for i := m.base() + sourceCount; i < uint(len(m.sourceNames)); i++ {
+			if m.sourceNames[i] != "" {
+				errs = append(errs, fmt.Errorf("source %d is named", i))
+			}
+		}
+		for i := m.base() + destinationCount; i < uint(len(m.destinationNames)); i++ {
+			if m.destinationNames[i] != "" {
+				errs = append(errs, fmt.Errorf("destination %d is named", i))
+			}
+			if m.destinationLocks[i] {
+				errs = append(errs, fmt.Errorf("destination %d is locked", i))
+			}
+		}
+		for dest := m.base(); dest < uint(len(m.destinationNames)); dest++ {
+			for lvl := uint(0); lvl < m.levelCount; lvl++ {
+				if (dest >= m.base()+destinationCount || lvl >= levelCount) && m.routes.get(dest, lvl) != SourceUnknown {
+					errs = append(errs, fmt.Errorf("destination %d level %d is routed", dest, lvl))
+				}
+			}
+		}
+		if len(errs) > 0 {
+			return fmt.Errorf("shrink would drop cached entries: %w", errors.Join(errs...))
+		}
+	}
+
+	oldDestinations := uint(len(m.destinationNames))
+	m.sourceNames = resizeSlice(m.sourceNames, m.base()+sourceCount)
+	m.destinationNames = resizeSlice(m.destinationNames, m.base()+destinationCount)
+	m.destinationLocks = resizeSlice(m.destinationLocks, m.base()+destinationCount)
+	m.levelNames = resizeSlice(m.levelNames, levelCount)
+
+	routes := m.newRouteStore(m.base()+destinationCount, levelCount)
+	for dest := m.base(); dest < m.base()+destinationCount && dest < oldDestinations; dest++ {
+		for lvl := uint(0); lvl < levelCount && lvl < m.levelCount; lvl++ {
+			routes.set(dest, lvl, m.routes.get(dest, lvl))
+		}
+	}
+	m.routes = routes
+	m.generation++
+	m.levelCount = levelCount
+
+	for dest := range m.whitelists {
+		if dest >= m.base()+destinationCount {
+			delete(m.whitelists, dest)
+		}
+	}
+	for src := range m.sourceTags {
+		if src >= m.base()+sourceCount {
+			delete(m.sourceTags, src)
+		}
+	}
+	for dest := range m.ownLocks {
+		if dest >= m.base()+destinationCount {
+			delete(m.ownLocks, dest)
+		}
+	}
+	for dest := range m.destinationTags {
+		if dest >= m.base()+destinationCount {
+			delete(m.destinationTags, dest)
+		}
+	}
+	for key := range m.routeHistory {
+		if key.destination >= m.base()+destinationCount || key.level >= levelCount {
+			delete(m.routeHistory, key)
+		}
+	}
+	return nil
+}
+
+// Returns a copy of a slice with a new length, keeping the leading values
+func resizeSlice[T any](s []T, length uint) []T {
+	resized := make([]T, length)
+	copy(resized, s)
+	return resized
+}
@@ -0,0 +1,98 @@
+package magnumrouter
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/cassaram/quartz"
+)
+
+// Returns a 2x2x1 router with every entry populated
+func newPopulatedRouter() *MagnumRouter {
+	m := NewMagnumRouterWithConn(NewFakeConn(2, 2), 2, 2, 1)
+	m.processMessage(&quartz.ResponseReadSource{Source: 2, Name: "CAM 2"})
+	m.processMessage(&quartz.ResponseReadDestination{Destination: 2, Name: "MON 2"})
+	m.processMessage(&quartz.ResponseLockStatus{Destination: 2, Locked: true})
+	m.processMessage(update(2, 2))
+	return m
+}
+
+func TestResizeGrowPreservesData(t *testing.T) {
+	m := newPopulatedRouter()
+	if err := m.Resize(10, 20, 3, false); err != nil {
+		t.Fatalf("Resize() = %v", err)
+	}
+	if src, dest, lvl := m.counts(); src != 10 || dest != 20 || lvl != 3 {
+		t.Errorf("counts = %d %d %d, want 10 20 3", src, dest, lvl)
+	}
+	if m.GetSourceName(2) != "CAM 2" || m.GetDestinationName(2) != "MON 2" || !m.GetDestinationLocked(2) || m.GetRoute(0, 2) != 2 {
+		t.Error("grow lost cached entries")
+	}
+	// New entries are usable and start unknown
+	if m.GetRoute(2, 20) != SourceUnknown || m.GetDestinationName(20) != "" {
+		t.Error("new entries are not empty")
+	}
+	m.processMessage(update(20, 10, quartz.QUARTZ_LVL_B))
+	if got := m.GetRoute(2, 20); got != 10 {
+		t.Errorf("GetRoute() in the grown range = %d, want 10", got)
+	}
+}
+
+func TestResizeShrink(t *testing.T) {
+	m := newPopulatedRouter()
+	if err := m.Resize(1, 1, 1, false); err == nil {
+		t.Fatal("Resize() dropped populated entries without force")
+	}
+	if src, dest, _ := m.counts(); src != 2 || dest != 2 {
+		t.Errorf("counts changed to %d %d by a rejected shrink", src, dest)
+	}
+	if err := m.Resize(1, 1, 1, true); err != nil {
+		t.Fatalf("forced Resize() = %v", err)
+	}
+	if src, dest, _ := m.counts(); src != 1 || dest != 1 {
+		t.Errorf("counts = %d %d after a forced shrink, want 1 1", src, dest)
+	}
+	if err := m.Resize(1, 1, maxLevels+1, true); err == nil {
+		t.Error("Resize() accepted more levels than quartz can address")
+	}
+}
+
+// A connection reporting a device size, as a non quartz transport might
+type sizedConn struct {
+	*scriptConn
+	sources, destinations, levels uint
+}
+
+func (c sizedConn) DeviceSize(ctx context.Context) (uint, uint, uint, error) {
+	return c.sources, c.destinations, c.levels, ctx.Err()
+}
+
+func TestQueryDeviceSizeThenResize(t *testing.T) {
+	conn := sizedConn{scriptConn: newScriptConn(), sources: 8, destinations: 6, levels: 2}
+	m := NewMagnumRouterWithConn(conn, 2, 2, 1, WithNoInitialSync())
+	defer m.Close()
+	if err := m.Connect(); err != nil {
+		t.Fatal(err)
+	}
+	sources, destinations, levels, err := m.QueryDeviceSize(context.Background())
+	if err != nil {
+		t.Fatalf("QueryDeviceSize() = %v", err)
+	}
+	if sources != 8 || destinations != 6 || levels != 2 {
+		t.Fatalf("QueryDeviceSize() = %d, %d, %d, want 8, 6, 2", sources, destinations, levels)
+	}
+	if err := m.Resize(sources, destinations, levels, false); err != nil {
+		t.Fatalf("Resize() = %v", err)
+	}
+	if got := len(m.GetSourceNameTable()); got != 9 {
+		t.Errorf("%d source entries after resizing, want 9", got)
+	}
+}
+
+func TestQueryDeviceSizeNotSupported(t *testing.T) {
+	m, _ := newScriptRouter(t, 2, 2, 1)
+	if _, _, _, err := m.QueryDeviceSize(context.Background()); !errors.Is(err, ErrNotSupported) {
+		t.Errorf("QueryDeviceSize() = %v, want ErrNotSupported", err)
+	}
+}
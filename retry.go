@@ -0,0 +1,76 @@
+package magnumrouter
+
+import (
+	"context"
+	"errors"
+	"time"
+)
+
+const (
+	defaultBackoffInitial = 250 * time.Millisecond
+	defaultBackoffMax     = 10 * time.Second
+)
+
+// Repeatedly attempts ConnectContext() until it succeeds or the context is done
+// Each attempt is bounded by perAttemptTimeout, and attempts are spaced by an exponential backoff (see WithConnectBackoff())
+// Returns nil on success, or the last attempt's error once the context is done
+// Stops without retrying if an attempt is aborted by Disconnect() or the router is closed
+// This only covers establishing a connection, it does not reconnect a connection lost later on
+// With WithBackupAddress() attempts fail over between the primary and backup endpoints
+func (m *MagnumRouter) ConnectRetry(ctx context.Context, perAttemptTimeout time.Duration) error {
+	m.setRetrying(1)
+	defer m.setRetrying(-1)
+	m.failoverStart()
+	var lastErr error
+	failures := 0
+	for attempt := 0; ; attempt++ {
+		attemptCtx, cancel := context.WithTimeout(ctx, perAttemptTimeout)
+		err := m.ConnectContext(attemptCtx)
+		cancel()
+		if err == nil || errors.Is(err, ErrAlreadyConnected) || errors.Is(err, ErrClosed) || errors.Is(err, ErrConnectAborted) {
+			return err
+		}
+		lastErr = err
+		m.opts.logger.Warn("magnum connect attempt failed", "attempt", attempt+1, "endpoint", m.ActiveEndpoint(), "err", err)
+		failures++
+		if m.failoverAfter(failures) {
+			failures = 0
+		}
+
+		if sleep(ctx, m.opts.clock, m.backoff(attempt)) != nil {
+			return lastErr
+		}
+	}
+}
+
+// Returns the delay before retrying after a failed attempt, counting attempts from 0
+// With jitter the delay is shortened by a random amount up to the jitter factor of it
+func (m *MagnumRouter) backoff(attempt int) time.Duration {
+	delay := m.opts.backoffInitial
+	for i := 0; i < attempt && delay < m.opts.backoffMax; i++ {
+		delay *= 2
+	}
+	delay = min(delay, m.opts.backoffMax)
+	if m.opts.backoffJitter <= 0 {
+		return delay
+	}
+	m.jitterMu.Lock()
+	r := m.jitter.Float64()
+	m.jitterMu.Unlock()
+	return delay - time.Duration(float64(delay)*m.opts.backoffJitter*r)
+}
+
+// Waits for d on the clock, returning early with the context's error if it is done first
+func sleep(ctx context.Context, clock Clock, d time.Duration) error {
+	done := make(chan struct{})
+	timer := clock.AfterFunc(d, func() {
+		close(done)
+	})
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		timer.Stop()
+		return ctx.Err()
+	}
+}
@@ -0,0 +1,138 @@
+package magnumrouter
+
+import (
+	"context"
+	"errors"
+	"math/rand"
+	"reflect"
+	"testing"
+	"time"
+)
+
+// A connection whose Connect blocks until released, so a test can act while an attempt is in progress
+type blockingConn struct {
+	*scriptConn
+	dialing chan struct{}
+	release chan struct{}
+}
+
+func (c *blockingConn) Connect() error {
+	c.dialing <- struct{}{}
+	<-c.release
+	return errors.New("refused")
+}
+
+func TestConnectRetryStopsOnClose(t *testing.T) {
+	m := NewMagnumRouterWithConn(newScriptConn(), 2, 2, 1, WithConnectBackoff(time.Millisecond, time.Millisecond))
+	m.Close()
+	errs := make(chan error, 1)
+	go func() { errs <- m.ConnectRetry(context.Background(), time.Second) }()
+	if err := receiveErr(t, errs); !errors.Is(err, ErrClosed) {
+		t.Fatalf("got %v, want ErrClosed", err)
+	}
+}
+
+func TestConnectRetryStopsOnDisconnect(t *testing.T) {
+	conn := &blockingConn{scriptConn: newScriptConn(), dialing: make(chan struct{}), release: make(chan struct{})}
+	m := NewMagnumRouterWithConn(conn, 2, 2, 1, WithConnectBackoff(time.Millisecond, time.Millisecond))
+	defer close(conn.release)
+	errs := make(chan error, 1)
+	go func() { errs <- m.ConnectRetry(context.Background(), time.Minute) }()
+	<-conn.dialing
+	m.Disconnect()
+	if err := receiveErr(t, errs); !errors.Is(err, ErrConnectAborted) {
+		t.Fatalf("got %v, want ErrConnectAborted", err)
+	}
+}
+
+// A connection refusing its first failures connect attempts
+type flakyConn struct {
+	*scriptConn
+	failures int
+	attempts int
+}
+
+func (c *flakyConn) Connect() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.attempts++
+	if c.attempts <= c.failures {
+		return errors.New("refused")
+	}
+	return nil
+}
+
+func TestConnectRetrySucceedsAfterFailures(t *testing.T) {
+	conn := &flakyConn{scriptConn: newScriptConn(), failures: 3}
+	m := NewMagnumRouterWithConn(conn, 2, 2, 1, WithNoInitialSync(), WithConnectBackoff(time.Millisecond, 4*time.Millisecond))
+	defer m.Close()
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	if err := m.ConnectRetry(ctx, 100*time.Millisecond); err != nil {
+		t.Fatalf("ConnectRetry() = %v", err)
+	}
+	if conn.attempts != 4 {
+		t.Errorf("%d attempts, want 4", conn.attempts)
+	}
+	if got := m.State(); got != StateConnected {
+		t.Errorf("State() = %v, want connected", got)
+	}
+}
+
+func TestConnectRetryReturnsLastErrorOnBudget(t *testing.T) {
+	conn := &flakyConn{scriptConn: newScriptConn(), failures: 1 << 30}
+	m := NewMagnumRouterWithConn(conn, 2, 2, 1, WithConnectBackoff(time.Millisecond, 2*time.Millisecond))
+	defer m.Close()
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Millisecond)
+	defer cancel()
+	// The budget may run out during an attempt, making the deadline the last error
+	err := m.ConnectRetry(ctx, 100*time.Millisecond)
+	if err == nil || err.Error() != "refused" && !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("ConnectRetry() = %v, want the last attempt's error", err)
+	}
+	conn.mu.Lock()
+	defer conn.mu.Unlock()
+	if conn.attempts < 2 {
+		t.Errorf("%d attempts within the budget, want several", conn.attempts)
+	}
+}
+
+func TestBackoffDoubles(t *testing.T) {
+	m := NewMagnumRouterWithConn(newScriptConn(), 1, 1, 1, WithConnectBackoff(100*time.Millisecond, time.Second))
+	want := []time.Duration{100 * time.Millisecond, 200 * time.Millisecond, 400 * time.Millisecond, 800 * time.Millisecond, time.Second, time.Second}
+	for attempt, d := range want {
+		if got := m.backoff(attempt); got != d {
+			t.Errorf("backoff(%d) = %v, want %v", attempt, got, d)
+		}
+	}
+}
+
+func TestBackoffJitterRange(t *testing.T) {
+	m := NewMagnumRouterWithConn(newScriptConn(), 2, 2, 1,
+		WithConnectBackoff(100*time.Millisecond, time.Second),
+		WithReconnectJitter(0.5),
+		WithJitterSource(rand.NewSource(1)))
+	for attempt := 0; attempt < 8; attempt++ {
+		full := min(100*time.Millisecond<<attempt, time.Second)
+		for i := 0; i < 20; i++ {
+			if got := m.backoff(attempt); got < full/2 || got > full {
+				t.Fatalf("backoff(%d) = %v, want between %v and %v", attempt, got, full/2, full)
+			}
+		}
+	}
+}
+
+func TestBackoffJitterReproducible(t *testing.T) {
+	delays := func() []time.Duration {
+		m := NewMagnumRouterWithConn(newScriptConn(), 2, 2, 1, WithReconnectJitter(1), WithJitterSource(rand.NewSource(7)))
+		got := []time.Duration{}
+		for attempt := 0; attempt < 5; attempt++ {
+			got = append(got, m.backoff(attempt))
+		}
+		return got
+	}
+	first, second := delays(), delays()
+	if !reflect.DeepEqual(first, second) {
+		t.Errorf("delays %v then %v from the same seed", first, second)
+	}
+}
@@ -0,0 +1,263 @@
+package magnumrouter
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+
+	"github.com/cassaram/quartz"
+)
+
+// A single route to be applied, a source to a destination across level(s)
+type RouteOp struct {
+	Levels      []uint
+	Destination uint
+	Source      uint
+}
+
+// Applies a list of routes, sending them to the server in exactly the order given
+// All ops are validated before anything is sent, so an invalid op means none are applied
+// The whole list is sent through the serialized writer without interleaving commands from other callers,
+// so order dependent lists (e.g. breaking a route before making a conflicting one) are safe under concurrency
+// Stops at the first failed send or when the context is done, returning which op failed
+// With ack waiting enabled, returns once every sent op has been acknowledged or timed out
+func (m *MagnumRouter) SetRoutes(ctx context.Context, ops []RouteOp) error {
+	ctx = m.correlate(ctx)
+	prepared := make([][]quartz.QuartzLevel, len(ops))
+	for i, op := range ops {
+		levels, err := m.prepareRoute(op.Levels, op.Destination, op.Source)
+		if err != nil {
+			m.audit(ctx, AuditEntry{Op: "SetRoutes", Destination: op.Destination, Source: op.Source, Levels: op.Levels, Err: err})
+			return fmt.Errorf("op %d: %w", i, err)
+		}
+		prepared[i] = levels
+	}
+	entries := make([]AuditEntry, len(ops))
+	for i, op := range ops {
+		entries[i] = AuditEntry{Op: "SetRoutes", Destination: op.Destination, Source: op.Source, Levels: op.Levels, PrevSources: m.cachedSources(op.Levels, op.Destination)}
+	}
+
+	acks := []chan error{}
+	attempted := 0
+	err := func() error {
+		m.writeMu.Lock()
+		defer m.writeMu.Unlock()
+		if err := m.checkLinked(); err != nil {
+			return err
+		}
+		for i, op := range ops {
+			if err := ctx.Err(); err != nil {
+				return fmt.Errorf("op %d: %w", i, err)
+			}
+			attempted++
+			var ack chan error
+			if m.opts.ackWait > 0 {
+				ack = m.expectAck()
+			}
+			if err := m.conn.SetCrosspoint(prepared[i], op.Destination, op.Source); err != nil {
+				if ack != nil {
+					m.dropAck(ack)
+				}
+				entries[i].Err = err
+				return fmt.Errorf("op %d: %w", i, err)
+			}
+			if ack != nil {
+				acks = append(acks, ack)
+			}
+		}
+		return nil
+	}()
+	// Wait for every sent op to be acknowledged, even after a failure, so the queue stays aligned
+	errs := []error{err}
+	for i, ack := range acks {
+		if err := m.waitAck(ack); err != nil {
+			entries[i].Err = err
+			errs = append(errs, fmt.Errorf("op %d: %w", i, err))
+		}
+	}
+	for _, entry := range entries[:attempted] {
+		m.audit(ctx, entry)
+		m.refreshRejected(entry.Err, entry.Destination, entry.Levels)
+	}
+	return errors.Join(errs...)
+}
+
+// Alias of SetRoutes(), for call sites where the ordering guarantee is the point
+func (m *MagnumRouter) ApplyOrdered(ctx context.Context, ops []RouteOp) error {
+	return m.SetRoutes(ctx, ops)
+}
+
+// Sets a route only on the levels not already routed to the source in the cache
+// Sends nothing if every level is already routed to the source
+// Returns ErrResyncInProgress while a sync is in progress, unless WithResyncWait() is set
+func (m *MagnumRouter) EnsureRoute(ctx context.Context, levels []uint, destination uint, source uint) error {
+	if err := m.awaitSync(ctx); err != nil {
+		return err
+	}
+	if err := m.checkDestination(destination); err != nil {
+		return err
+	}
+	pending := []uint{}
+	for _, lvl := range levels {
+		if err := m.checkLevel(lvl); err != nil {
+			return err
+		}
+		if m.GetRoute(lvl, destination) != source {
+			pending = append(pending, lvl)
+		}
+	}
+	if len(pending) == 0 {
+		return nil
+	}
+	_, err := m.setRoute(ctx, "EnsureRoute", pending, destination, source, nil)
+	return err
+}
+
+// Sets a route unless the destination is locked in the cache
+// Returns ErrDestinationLocked without sending anything for a locked destination
+// Returns ErrResyncInProgress while a sync is in progress, unless WithResyncWait() is set
+func (m *MagnumRouter) SetRouteIfUnlocked(ctx context.Context, levels []uint, destination uint, source uint) error {
+	if err := m.awaitSync(ctx); err != nil {
+		return err
+	}
+	if err := m.checkDestination(destination); err != nil {
+		return err
+	}
+	if m.GetDestinationLocked(destination) {
+		return fmt.Errorf("%w: %d", ErrDestinationLocked, destination)
+	}
+	_, err := m.setRoute(ctx, "SetRouteIfUnlocked", levels, destination, source, nil)
+	return err
+}
+
+// Sets a route as per SetRoute(), returning the source each level was routed to beforehand
+// Previous sources are read from the cache as the route is validated, so they are the best known values
+// rather than confirmed by the device, and read as SourceUnknown where the route was not known
+func (m *MagnumRouter) SetRouteReturningPrev(levels []uint, destination uint, source uint) (map[uint]uint, error) {
+	return m.setRoute(context.Background(), "SetRouteReturningPrev", levels, destination, source, nil)
+}
+
+// Sets a route only if every level is still routed to expected in the cache, for optimistic concurrency
+// Returns ErrConcurrentModification without sending anything if any level has changed, such as from another operator
+// The check is against the cache at the time of the call, so a change still in flight can be missed
+func (m *MagnumRouter) SetRouteExpect(levels []uint, destination uint, source uint, expected uint) error {
+	_, err := m.setRoute(context.Background(), "SetRouteExpect", levels, destination, source, func(prev map[uint]uint) error {
+		for _, lvl := range levels {
+			if prev[lvl] != expected {
+				return fmt.Errorf("%w: destination %d level %d is routed to source %d, expected %d", ErrConcurrentModification, destination, lvl, prev[lvl], expected)
+			}
+		}
+		return nil
+	})
+	return err
+}
+
+// Applies a list of routes as per SetRoutes(), publishing one EventBulkChange instead of a route event per crosspoint
+// Route events are suppressed from when the ops are sent until the cache shows every op applied, an op is rejected
+// or the context is done, including those for changes made elsewhere in that window, and EventBulkChange is published either way
+// Without WithAckWait(), errors carry no identifier, so any error response while waiting is taken as a rejected op
+// With it, rejections are returned by SetRoutes(), and the wait for updates after the acknowledgements is bounded by the ack wait
+// Returns the error from SetRoutes(), ErrCommandRejected or ErrRouteNotConfirmed if the routes were not all applied, or the context error
+func (m *MagnumRouter) BulkApply(ctx context.Context, ops []RouteOp) error {
+	m.mu.Lock()
+	m.bulkDepth++
+	m.mu.Unlock()
+	defer func() {
+		m.mu.Lock()
+		m.bulkDepth--
+		m.mu.Unlock()
+		m.dispatch([]Event{{Type: EventBulkChange}})
+	}()
+	rejections := m.rejectionCount()
+	if err := m.SetRoutes(ctx, ops); err != nil {
+		return err
+	}
+	if m.opts.ackWait > 0 {
+		waitCtx, cancel := context.WithTimeout(ctx, m.opts.ackWait)
+		defer cancel()
+		err := m.waitRoutesApplied(waitCtx, ops, nil)
+		if err != nil && ctx.Err() == nil {
+			return fmt.Errorf("%w: no update within %s of the acknowledgements", ErrRouteNotConfirmed, m.opts.ackWait)
+		}
+		return err
+	}
+	return m.waitRoutesApplied(ctx, ops, func() bool { return m.rejectionCount() > rejections })
+}
+
+// Blocks until the cache shows every op applied, with later ops taking precedence, or the context is done
+// Returns ErrCommandRejected once rejected, if not nil, reports an op rejected
+func (m *MagnumRouter) waitRoutesApplied(ctx context.Context, ops []RouteOp, rejected func() bool) error {
+	want := map[crosspoint]uint{}
+	for _, op := range ops {
+		for _, lvl := range op.Levels {
+			want[crosspoint{destination: op.Destination, level: lvl}] = op.Source
+		}
+	}
+	for {
+		// Take the signal before checking so a response arriving in between is not missed
+		m.respMu.Lock()
+		signal := m.respSignal
+		m.respMu.Unlock()
+		m.mu.RLock()
+		for key, src := range want {
+			if m.routes.get(key.destination, key.level) == src {
+				delete(want, key)
+			}
+		}
+		m.mu.RUnlock()
+		if len(want) == 0 {
+			return nil
+		}
+		if rejected != nil && rejected() {
+			return fmt.Errorf("%w: %d crosspoints not applied", ErrCommandRejected, len(want))
+		}
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-signal:
+		}
+	}
+}
+
+// Routes toDestination from whatever is routed to fromDestination in the cache, level by level
+// Breakaway routes are copied per level, levels sharing a source being sent as one op
+// All levels are copied if levels is empty, and levels whose source is not known are left unchanged
+func (m *MagnumRouter) CopyRoute(ctx context.Context, fromDestination uint, toDestination uint, levels []uint) error {
+	if err := m.checkDestination(fromDestination); err != nil {
+		return err
+	}
+	if err := m.checkDestination(toDestination); err != nil {
+		return err
+	}
+	if len(levels) == 0 {
+		_, _, levelCount := m.counts()
+		for lvl := uint(0); lvl < levelCount; lvl++ {
+			levels = append(levels, lvl)
+		}
+	}
+	for _, lvl := range levels {
+		if err := m.checkLevel(lvl); err != nil {
+			return err
+		}
+	}
+	ops := []RouteOp{}
+	bySource := map[uint]int{}
+	for lvl, src := range m.cachedSources(levels, fromDestination) {
+		if src == SourceUnknown {
+			continue
+		}
+		i, ok := bySource[src]
+		if !ok {
+			i = len(ops)
+			bySource[src] = i
+			ops = append(ops, RouteOp{Destination: toDestination, Source: src})
+		}
+		ops[i].Levels = append(ops[i].Levels, lvl)
+	}
+	for i := range ops {
+		sort.Slice(ops[i].Levels, func(a, b int) bool { return ops[i].Levels[a] < ops[i].Levels[b] })
+	}
+	sort.Slice(ops, func(a, b int) bool { return ops[a].Levels[0] < ops[b].Levels[0] })
+	return m.SetRoutes(ctx, ops)
+}
@@ -0,0 +1,321 @@
+package magnumrouter
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/cassaram/quartz"
+)
+
+func TestApplyOrderedUnderConcurrency(t *testing.T) {
+	const callers, opsPerCaller = 8, 20
+	m, conn := newScriptRouter(t, callers, opsPerCaller, 1)
+	var wg sync.WaitGroup
+	for caller := uint(1); caller <= callers; caller++ {
+		ops := make([]RouteOp, opsPerCaller)
+		for i := range ops {
+			ops[i] = RouteOp{Levels: []uint{0}, Destination: uint(i + 1), Source: caller}
+		}
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if err := m.ApplyOrdered(context.Background(), ops); err != nil {
+				t.Error(err)
+			}
+		}()
+	}
+	wg.Wait()
+
+	routes := []string{}
+	for _, call := range conn.recorded() {
+		if strings.HasPrefix(call, "route") {
+			routes = append(routes, call)
+		}
+	}
+	if len(routes) != callers*opsPerCaller {
+		t.Fatalf("sent %d routes, want %d", len(routes), callers*opsPerCaller)
+	}
+	// Each caller's list is sent whole and in input order
+	for block := 0; block < callers; block++ {
+		var src uint
+		fmt.Sscanf(routes[block*opsPerCaller], "route [V] 1 %d", &src)
+		for i := 0; i < opsPerCaller; i++ {
+			if got, want := routes[block*opsPerCaller+i], fmt.Sprintf("route [V] %d %d", i+1, src); got != want {
+				t.Fatalf("command %d = %q, want %q", block*opsPerCaller+i, got, want)
+			}
+		}
+	}
+}
+
+// A scriptConn whose route queries block until released, holding a sync in progress
+type blockingRouteConn struct {
+	*scriptConn
+	release chan struct{}
+}
+
+func (c blockingRouteConn) GetRoute(level quartz.QuartzLevel, dest uint) error {
+	<-c.release
+	return c.scriptConn.GetRoute(level, dest)
+}
+
+// Returns a router with its initial sync blocked in progress, and a function releasing it and waiting for Connect()
+func newSyncingRouter(t *testing.T, opts ...Option) (*MagnumRouter, *scriptConn, func()) {
+	t.Helper()
+	conn := blockingRouteConn{scriptConn: newScriptConn(), release: make(chan struct{})}
+	m := NewMagnumRouterWithConn(conn, 2, 2, 1, opts...)
+	t.Cleanup(func() { m.Close() })
+	connected := make(chan error, 1)
+	go func() { connected <- m.Connect() }()
+	eventually(t, m.IsSyncing)
+	return m, conn.scriptConn, func() {
+		close(conn.release)
+		if err := receiveErr(t, connected); err != nil {
+			t.Fatalf("connect: %v", err)
+		}
+	}
+}
+
+func TestCacheOperationsRejectedWhileSyncing(t *testing.T) {
+	m, conn, release := newSyncingRouter(t)
+	ctx := context.Background()
+	if err := m.EnsureRoute(ctx, []uint{0}, 1, 2); !errors.Is(err, ErrResyncInProgress) {
+		t.Errorf("EnsureRoute() = %v, want ErrResyncInProgress", err)
+	}
+	if err := m.SetRouteIfUnlocked(ctx, []uint{0}, 1, 2); !errors.Is(err, ErrResyncInProgress) {
+		t.Errorf("SetRouteIfUnlocked() = %v, want ErrResyncInProgress", err)
+	}
+	if _, err := m.Verify(ctx); !errors.Is(err, ErrResyncInProgress) {
+		t.Errorf("Verify() = %v, want ErrResyncInProgress", err)
+	}
+	release()
+	if m.IsSyncing() {
+		t.Error("IsSyncing() after the sweep ended")
+	}
+	if err := m.EnsureRoute(ctx, []uint{0}, 1, 2); err != nil {
+		t.Errorf("EnsureRoute() after the sweep = %v, want nil", err)
+	}
+	if got := conn.recorded(); got[len(got)-1] != "route [V] 1 2" {
+		t.Errorf("last sent %q, want the route", got[len(got)-1])
+	}
+}
+
+func TestCacheOperationsWaitForSync(t *testing.T) {
+	m, conn, release := newSyncingRouter(t, WithResyncWait(true))
+	errs := make(chan error, 1)
+	go func() { errs <- m.EnsureRoute(context.Background(), []uint{0}, 1, 2) }()
+	select {
+	case err := <-errs:
+		t.Fatalf("EnsureRoute() returned %v while syncing", err)
+	case <-time.After(20 * time.Millisecond):
+	}
+	release()
+	if err := receiveErr(t, errs); err != nil {
+		t.Errorf("EnsureRoute() = %v, want nil", err)
+	}
+	if got := conn.recorded(); got[len(got)-1] != "route [V] 1 2" {
+		t.Errorf("last sent %q, want the route after the sweep", got[len(got)-1])
+	}
+
+	// A done context ends the wait
+	waiting, _, release := newSyncingRouter(t, WithResyncWait(true))
+	defer release()
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	if err := waiting.EnsureRoute(ctx, []uint{0}, 1, 2); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("EnsureRoute() with a done context = %v, want DeadlineExceeded", err)
+	}
+}
+
+func TestSetRouteReturningPrev(t *testing.T) {
+	m, conn := newScriptRouter(t, 4, 2, 3)
+	m.processMessage(update(1, 2, quartz.QUARTZ_LVL_V))
+	m.processMessage(update(1, 3, quartz.QuartzLevel("A")))
+	prev, err := m.SetRouteReturningPrev([]uint{0, 1, 2}, 1, 4)
+	if err != nil {
+		t.Fatalf("SetRouteReturningPrev(): %v", err)
+	}
+	// Level B was never reported, so its previous source is unknown
+	want := map[uint]uint{0: 2, 1: 3, 2: SourceUnknown}
+	if !reflect.DeepEqual(prev, want) {
+		t.Errorf("SetRouteReturningPrev() = %v, want %v", prev, want)
+	}
+	if got := conn.recorded(); got[len(got)-1] != "route [V A B] 1 4" {
+		t.Errorf("last sent %q, want the route", got[len(got)-1])
+	}
+
+	prev, err = m.SetRouteReturningPrev([]uint{0}, 3, 4)
+	if !errors.Is(err, ErrDestinationOutOfRange) || prev != nil {
+		t.Errorf("SetRouteReturningPrev() of destination 3 = %v, %v, want nil, ErrDestinationOutOfRange", prev, err)
+	}
+}
+
+func TestSetRouteExpect(t *testing.T) {
+	m, conn := newScriptRouter(t, 4, 2, 2)
+	m.processMessage(update(1, 2, quartz.QUARTZ_LVL_V, quartz.QuartzLevel("A")))
+	if err := m.SetRouteExpect([]uint{0, 1}, 1, 3, 2); err != nil {
+		t.Fatalf("SetRouteExpect() with the current source = %v, want nil", err)
+	}
+	if got := conn.recorded(); got[len(got)-1] != "route [V A] 1 3" {
+		t.Errorf("last sent %q, want the route", got[len(got)-1])
+	}
+
+	// Another operator moved audio meanwhile
+	m.processMessage(update(1, 4, quartz.QuartzLevel("A")))
+	sent := len(conn.recorded())
+	err := m.SetRouteExpect([]uint{0, 1}, 1, 3, 2)
+	if !errors.Is(err, ErrConcurrentModification) || !strings.Contains(err.Error(), "level 1 is routed to source 4") {
+		t.Errorf("SetRouteExpect() after a change = %v, want ErrConcurrentModification naming level 1", err)
+	}
+	if got := len(conn.recorded()); got != sent {
+		t.Errorf("sent %v after a mismatch, want nothing", conn.recorded()[sent:])
+	}
+}
+
+func TestBulkApplyPublishesOneEvent(t *testing.T) {
+	m, _ := newFakeRouter(t, 4, 4, 2)
+	events, unsubscribe := m.Subscribe()
+	defer unsubscribe()
+	ops := []RouteOp{}
+	for dest := uint(1); dest <= 4; dest++ {
+		ops = append(ops, RouteOp{Levels: []uint{0, 1}, Destination: dest, Source: 5 - dest})
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	if err := m.BulkApply(ctx, ops); err != nil {
+		t.Fatalf("BulkApply() = %v", err)
+	}
+	for _, op := range ops {
+		for _, lvl := range op.Levels {
+			if got := m.GetRoute(lvl, op.Destination); got != op.Source {
+				t.Errorf("destination %d level %d routed to %d, want %d", op.Destination, lvl, got, op.Source)
+			}
+		}
+	}
+
+	got := []EventType{}
+	for len(got) == 0 || got[len(got)-1] != EventBulkChange {
+		select {
+		case ev := <-events:
+			got = append(got, ev.Type)
+		case <-time.After(time.Second):
+			t.Fatalf("events %v, no bulk change", got)
+		}
+	}
+	if !reflect.DeepEqual(got, []EventType{EventBulkChange}) {
+		t.Errorf("events %v, want a single bulk change", got)
+	}
+
+	// Route events resume once the bulk apply is over
+	if err := m.SetRoute([]uint{0}, 1, 1); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case ev := <-events:
+		if ev.Type != EventRouteChange {
+			t.Errorf("event %v after BulkApply(), want a route change", ev.Type)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("no route event after BulkApply()")
+	}
+}
+
+func TestBulkApplyRejectedOp(t *testing.T) {
+	for _, ackWait := range []time.Duration{0, time.Second} {
+		t.Run(fmt.Sprint("ack wait ", ackWait), func(t *testing.T) {
+			m, fake := newFakeRouter(t, 4, 4, 1, WithAckWait(ackWait))
+			// Locked on the device only, so the cache lets the op through and the device answers with an error
+			fake.mu.Lock()
+			fake.locks[2] = true
+			fake.mu.Unlock()
+			events, unsubscribe := m.Subscribe()
+			defer unsubscribe()
+			ops := []RouteOp{
+				{Levels: []uint{0}, Destination: 1, Source: 3},
+				{Levels: []uint{0}, Destination: 2, Source: 3},
+				{Levels: []uint{0}, Destination: 3, Source: 3},
+			}
+			errs := make(chan error, 1)
+			go func() { errs <- m.BulkApply(context.Background(), ops) }()
+			if err := receiveErr(t, errs); !errors.Is(err, ErrCommandRejected) {
+				t.Fatalf("BulkApply() = %v, want ErrCommandRejected", err)
+			}
+			for len(events) > 0 {
+				<-events
+			}
+
+			// Route events are no longer suppressed
+			if err := m.SetRoute([]uint{0}, 4, 1); err != nil {
+				t.Fatal(err)
+			}
+			select {
+			case ev := <-events:
+				if ev.Type != EventRouteChange || ev.Destination != 4 {
+					t.Errorf("event %+v, want the route of destination 4", ev)
+				}
+			case <-time.After(time.Second):
+				t.Fatal("no route event after the rejected bulk apply")
+			}
+		})
+	}
+}
+func TestCopyRoute(t *testing.T) {
+	tests := []struct {
+		name    string
+		updates []quartz.QuartzResponse
+		want    []string
+	}{
+		{
+			name:    "clean source",
+			updates: []quartz.QuartzResponse{update(3, 2, quartz.QUARTZ_LVL_V, quartz.QuartzLevel("A"))},
+			want:    []string{"route [V A] 5 2"},
+		},
+		{
+			name:    "breakaway source",
+			updates: []quartz.QuartzResponse{update(3, 1, quartz.QUARTZ_LVL_V), update(3, 2, quartz.QuartzLevel("A"))},
+			want:    []string{"route [V] 5 1", "route [A] 5 2"},
+		},
+		{
+			name:    "unknown level left unchanged",
+			updates: []quartz.QuartzResponse{update(3, 4, quartz.QuartzLevel("A"))},
+			want:    []string{"route [A] 5 4"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m, conn := newScriptRouter(t, 5, 5, 2)
+			for _, msg := range tt.updates {
+				m.processMessage(msg)
+			}
+			if err := m.CopyRoute(context.Background(), 3, 5, nil); err != nil {
+				t.Fatalf("CopyRoute() = %v", err)
+			}
+			if got := conn.recorded()[1:]; !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("sent %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCopyRouteValidates(t *testing.T) {
+	m, conn := newScriptRouter(t, 5, 5, 2)
+	m.processMessage(update(3, 2))
+	ctx := context.Background()
+	if err := m.CopyRoute(ctx, 6, 5, nil); !errors.Is(err, ErrDestinationOutOfRange) {
+		t.Errorf("CopyRoute() from 6 = %v, want ErrDestinationOutOfRange", err)
+	}
+	if err := m.CopyRoute(ctx, 3, 6, nil); !errors.Is(err, ErrDestinationOutOfRange) {
+		t.Errorf("CopyRoute() to 6 = %v, want ErrDestinationOutOfRange", err)
+	}
+	if err := m.CopyRoute(ctx, 3, 5, []uint{2}); !errors.Is(err, ErrLevelOutOfRange) {
+		t.Errorf("CopyRoute() of level 2 = %v, want ErrLevelOutOfRange", err)
+	}
+	if got := conn.recorded(); len(got) != 1 {
+		t.Errorf("sent %q, want only the connect", got)
+	}
+}
@@ -0,0 +1,219 @@
+package magnumrouter
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"time"
+)
+
+// Client-side configuration held by the router and never sent to the device, suitable for saving as JSON
+// Restoring it after a restart brings back the same tags, whitelists, follows and salvos
+// Live state such as routes, names and locks is covered by RouterSnapshot instead,
+// and level names are set with WithLevelNames() when constructing the router
+type RouterConfig struct {
+	SourceTags      map[uint]map[string]string `json:"source_tags,omitempty"`
+	DestinationTags map[uint]map[string]string `json:"destination_tags,omitempty"`
+	// Allowed sources by destination, see MagnumRouter.SetSourceWhitelist()
+	Whitelists map[uint][]uint `json:"whitelists,omitempty"`
+	// Leader by follower, see MagnumRouter.SetFollow()
+	Follows map[uint]uint `json:"follows,omitempty"`
+	// Routes by salvo name, see MagnumRouter.DefineSalvo()
+	Salvos map[string][]RouteOp `json:"salvos,omitempty"`
+	// Schedules by salvo name, see MagnumRouter.ScheduleSalvo()
+	Schedules map[string]ScheduleConfig `json:"schedules,omitempty"`
+}
+
+// A Schedule in a form that survives JSON, with the time zone by name
+type ScheduleConfig struct {
+	Hour   int `json:"hour"`
+	Minute int `json:"minute"`
+	Second int `json:"second,omitempty"`
+	// IANA time zone name such as "Europe/London", empty for the zone of the clock's times
+	Location string `json:"location,omitempty"`
+}
+
+// Returns the client-side configuration of the router, see RouterConfig
+func (m *MagnumRouter) ExportConfig() RouterConfig {
+	cfg := RouterConfig{}
+	m.mu.RLock()
+	cfg.SourceTags = copyAllTags(m.sourceTags)
+	cfg.DestinationTags = copyAllTags(m.destinationTags)
+	for dest, allowed := range m.whitelists {
+		if cfg.Whitelists == nil {
+			cfg.Whitelists = map[uint][]uint{}
+		}
+		for src := range allowed {
+			cfg.Whitelists[dest] = append(cfg.Whitelists[dest], src)
+		}
+		sort.Slice(cfg.Whitelists[dest], func(i, j int) bool { return cfg.Whitelists[dest][i] < cfg.Whitelists[dest][j] })
+	}
+	m.mu.RUnlock()
+
+	m.followMu.Lock()
+	for follower, leader := range m.follows {
+		if cfg.Follows == nil {
+			cfg.Follows = map[uint]uint{}
+		}
+		cfg.Follows[follower] = leader
+	}
+	m.followMu.Unlock()
+
+	m.salvos.mu.Lock()
+	for name, ops := range m.salvos.salvos {
+		if cfg.Salvos == nil {
+			cfg.Salvos = map[string][]RouteOp{}
+		}
+		copied := make([]RouteOp, len(ops))
+		for i, op := range ops {
+			copied[i] = RouteOp{Levels: append([]uint{}, op.Levels...), Destination: op.Destination, Source: op.Source}
+		}
+		cfg.Salvos[name] = copied
+	}
+	for name, sched := range m.salvos.schedules {
+		if cfg.Schedules == nil {
+			cfg.Schedules = map[string]ScheduleConfig{}
+		}
+		at := ScheduleConfig{Hour: sched.at.Hour, Minute: sched.at.Minute, Second: sched.at.Second}
+		if sched.at.Location != nil {
+			at.Location = sched.at.Location.String()
+		}
+		cfg.Schedules[name] = at
+	}
+	m.salvos.mu.Unlock()
+	return cfg
+}
+
+// Replaces the client-side configuration of the router with cfg, as returned by ExportConfig()
+// The whole config is validated first, and all problems found are returned together without changing anything
+// Follows are only applied to route changes seen after the import, as per SetFollow()
+func (m *MagnumRouter) ImportConfig(cfg RouterConfig) error {
+	schedules, err := m.validateConfig(cfg)
+	if err != nil {
+		return err
+	}
+
+	m.mu.Lock()
+	m.sourceTags = nil
+	for src, tags := range cfg.SourceTags {
+		m.sourceTags = setTags(m.sourceTags, src, tags)
+	}
+	m.destinationTags = nil
+	for dest, tags := range cfg.DestinationTags {
+		m.destinationTags = setTags(m.destinationTags, dest, tags)
+	}
+	m.whitelists = map[uint]map[uint]bool{}
+	for dest, sources := range cfg.Whitelists {
+		if len(sources) == 0 {
+			continue
+		}
+		allowed := map[uint]bool{}
+		for _, src := range sources {
+			allowed[src] = true
+		}
+		m.whitelists[dest] = allowed
+	}
+	m.generation++
+	m.mu.Unlock()
+
+	m.followMu.Lock()
+	followers := make([]uint, 0, len(m.follows))
+	for follower := range m.follows {
+		followers = append(followers, follower)
+	}
+	m.followMu.Unlock()
+	for _, follower := range followers {
+		m.ClearFollow(follower)
+	}
+	errs := []error{}
+	for follower, leader := range cfg.Follows {
+		// Validated as acyclic, so this only fails if the router was resized meanwhile
+		if err := m.SetFollow(follower, leader); err != nil {
+			errs = append(errs, err)
+		}
+	}
+
+	m.salvos.mu.Lock()
+	names := make([]string, 0, len(m.salvos.salvos))
+	for name := range m.salvos.salvos {
+		names = append(names, name)
+	}
+	m.salvos.mu.Unlock()
+	for _, name := range names {
+		m.DeleteSalvo(name)
+	}
+	for name, ops := range cfg.Salvos {
+		m.DefineSalvo(name, ops)
+	}
+	for name, at := range schedules {
+		if err := m.ScheduleSalvo(name, at); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// Checks every ID, follow and schedule of a config against the router, returning the parsed schedules
+func (m *MagnumRouter) validateConfig(cfg RouterConfig) (map[string]Schedule, error) {
+	errs := []error{}
+	for src := range cfg.SourceTags {
+		if err := m.checkSource(src); err != nil {
+			errs = append(errs, fmt.Errorf("source_tags: %w", err))
+		}
+	}
+	for dest := range cfg.DestinationTags {
+		if err := m.checkDestination(dest); err != nil {
+			errs = append(errs, fmt.Errorf("destination_tags: %w", err))
+		}
+	}
+	for dest, sources := range cfg.Whitelists {
+		if err := m.checkDestination(dest); err != nil {
+			errs = append(errs, fmt.Errorf("whitelists: %w", err))
+		}
+		for _, src := range sources {
+			if err := m.checkSource(src); err != nil {
+				errs = append(errs, fmt.Errorf("whitelists: destination %d: %w", dest, err))
+			}
+		}
+	}
+	for follower, leader := range cfg.Follows {
+		if err := errors.Join(m.checkDestination(follower), m.checkDestination(leader)); err != nil {
+			errs = append(errs, fmt.Errorf("follows: %w", err))
+			continue
+		}
+		// Bounded by the number of follows, as the chain may reach a cycle not involving follower
+		dest, ok := leader, true
+		for steps := 0; ok && steps <= len(cfg.Follows); steps++ {
+			if dest == follower {
+				errs = append(errs, fmt.Errorf("follows: %w: destination %d following %d", ErrFollowCycle, follower, leader))
+				break
+			}
+			dest, ok = cfg.Follows[dest]
+		}
+	}
+	schedules := map[string]Schedule{}
+	for name, at := range cfg.Schedules {
+		if _, ok := cfg.Salvos[name]; !ok {
+			errs = append(errs, fmt.Errorf("schedules: %w: %q", ErrSalvoNotFound, name))
+			continue
+		}
+		sched := Schedule{Hour: at.Hour, Minute: at.Minute, Second: at.Second}
+		if at.Location != "" {
+			loc, err := time.LoadLocation(at.Location)
+			if err != nil {
+				errs = append(errs, fmt.Errorf("schedules: salvo %q: %w", name, err))
+				continue
+			}
+			sched.Location = loc
+		}
+		if err := sched.validate(); err != nil {
+			errs = append(errs, fmt.Errorf("schedules: salvo %q: %w", name, err))
+			continue
+		}
+		schedules[name] = sched
+	}
+	if len(errs) > 0 {
+		return nil, fmt.Errorf("invalid router config: %w", errors.Join(errs...))
+	}
+	return schedules, nil
+}
@@ -0,0 +1,80 @@
+package magnumrouter
+
+import (
+	"encoding/json"
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestConfigRoundTrip(t *testing.T) {
+	london, err := time.LoadLocation("Europe/London")
+	if err != nil {
+		t.Skipf("no tz data: %v", err)
+	}
+	m := NewMagnumRouterWithConn(NewFakeConn(4, 4), 4, 4, 1)
+	m.SetSourceTags(2, map[string]string{"camera": "3"})
+	m.SetDestinationTags(1, map[string]string{"room": "studio a"})
+	m.SetSourceWhitelist(3, []uint{2, 1})
+	if err := m.SetFollow(4, 3); err != nil {
+		t.Fatalf("SetFollow() = %v", err)
+	}
+	m.DefineSalvo("news", []RouteOp{{Levels: []uint{0}, Destination: 1, Source: 2}})
+	if err := m.ScheduleSalvo("news", Schedule{Hour: 18, Location: london}); err != nil {
+		t.Fatalf("ScheduleSalvo() = %v", err)
+	}
+	data, err := json.Marshal(m.ExportConfig())
+	if err != nil {
+		t.Fatalf("marshal: %v", err)
+	}
+	m.Close()
+
+	restored := NewMagnumRouterWithConn(NewFakeConn(4, 4), 4, 4, 1)
+	defer restored.Close()
+	var cfg RouterConfig
+	if err := json.Unmarshal(data, &cfg); err != nil {
+		t.Fatalf("unmarshal: %v", err)
+	}
+	if err := restored.ImportConfig(cfg); err != nil {
+		t.Fatalf("ImportConfig() = %v", err)
+	}
+	if got := restored.GetSourceTags(2); got["camera"] != "3" {
+		t.Errorf("source 2 tags = %v, want camera 3", got)
+	}
+	if got := restored.GetDestinationTags(1); got["room"] != "studio a" {
+		t.Errorf("destination 1 tags = %v, want room studio a", got)
+	}
+	if got := restored.GetSourceWhitelist(3); !reflect.DeepEqual(got, []uint{1, 2}) {
+		t.Errorf("whitelist of destination 3 = %v, want [1 2]", got)
+	}
+	if leader, ok := restored.GetFollow(4); !ok || leader != 3 {
+		t.Errorf("GetFollow(4) = %d %v, want 3", leader, ok)
+	}
+	again := restored.ExportConfig()
+	want := ScheduleConfig{Hour: 18, Location: "Europe/London"}
+	if got := again.Schedules["news"]; got != want {
+		t.Errorf("schedule = %+v, want %+v", got, want)
+	}
+	if got := again.Salvos["news"]; len(got) != 1 || got[0].Source != 2 {
+		t.Errorf("salvo = %v, want one op from source 2", got)
+	}
+}
+
+func TestImportConfigInvalid(t *testing.T) {
+	m := NewMagnumRouterWithConn(NewFakeConn(4, 4), 4, 4, 1)
+	defer m.Close()
+	m.SetSourceTags(1, map[string]string{"keep": "me"})
+	cfg := RouterConfig{
+		SourceTags: map[uint]map[string]string{9: {"bad": "id"}},
+		Follows:    map[uint]uint{1: 2, 2: 1},
+		Schedules:  map[string]ScheduleConfig{"missing": {Hour: 1}},
+	}
+	err := m.ImportConfig(cfg)
+	if !errors.Is(err, ErrSourceOutOfRange) || !errors.Is(err, ErrFollowCycle) || !errors.Is(err, ErrSalvoNotFound) {
+		t.Errorf("ImportConfig() = %v, want every problem reported", err)
+	}
+	if got := m.GetSourceTags(1); got["keep"] != "me" {
+		t.Errorf("source 1 tags = %v after a failed import, want unchanged", got)
+	}
+}
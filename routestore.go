@@ -0,0 +1,158 @@
+package magnumrouter
+
+import "sort"
+
+// Identifies a single crosspoint in the route table
+type crosspoint struct {
+	destination uint
+	level       uint
+}
+
+// Backing storage for the cached route table
+// Indexes must be bounds checked by the caller
+type routeStore interface {
+	get(destination uint, level uint) uint
+	set(destination uint, level uint, source uint)
+	// Returns the table indexed by destination then level
+	table() [][]uint
+	// Returns the number of destination entries and the level count of each entry, without copying the table
+	dimensions() (destinations int, levelsOf func(destination int) int)
+}
+
+// Route store allocating every crosspoint up front
+type denseRoutes [][]uint
+
+func newDenseRoutes(destinations uint, levels uint) denseRoutes {
+	d := make(denseRoutes, destinations)
+	for i := 0; i < len(d); i++ {
+		d[i] = make([]uint, levels)
+	}
+	return d
+}
+
+func (d denseRoutes) get(destination uint, level uint) uint {
+	return d[destination][level]
+}
+
+func (d denseRoutes) set(destination uint, level uint, source uint) {
+	d[destination][level] = source
+}
+
+func (d denseRoutes) table() [][]uint {
+	return d
+}
+
+func (d denseRoutes) dimensions() (int, func(int) int) {
+	return len(d), func(destination int) int { return len(d[destination]) }
+}
+
+// Route store only allocating crosspoints with a known source
+// Absent crosspoints read as SourceUnknown
+type sparseRoutes struct {
+	destinations uint
+	levels       uint
+	routes       map[crosspoint]uint
+}
+
+func newSparseRoutes(destinations uint, levels uint) *sparseRoutes {
+	return &sparseRoutes{
+		destinations: destinations,
+		levels:       levels,
+		routes:       map[crosspoint]uint{},
+	}
+}
+
+func (s *sparseRoutes) get(destination uint, level uint) uint {
+	return s.routes[crosspoint{destination: destination, level: level}]
+}
+
+func (s *sparseRoutes) set(destination uint, level uint, source uint) {
+	key := crosspoint{destination: destination, level: level}
+	if source == SourceUnknown {
+		delete(s.routes, key)
+		return
+	}
+	s.routes[key] = source
+}
+
+// Builds a dense copy of the table
+func (s *sparseRoutes) table() [][]uint {
+	t := newDenseRoutes(s.destinations, s.levels)
+	for key, source := range s.routes {
+		t[key.destination][key.level] = source
+	}
+	return t
+}
+
+func (s *sparseRoutes) dimensions() (int, func(int) int) {
+	return int(s.destinations), func(int) int { return int(s.levels) }
+}
+
+// Returns a new empty route store using the configured backing
+func (m *MagnumRouter) newRouteStore(destinations uint, levels uint) routeStore {
+	var store routeStore
+	if m.opts.sparseRouteTable {
+		store = newSparseRoutes(destinations, levels)
+	} else {
+		store = newDenseRoutes(destinations, levels)
+	}
+	if m.opts.inverseIndex {
+		store = newIndexedRoutes(store)
+	}
+	return store
+}
+
+// Route store decorator maintaining an index of destinations by level and source
+type indexedRoutes struct {
+	routeStore
+	// Level ID -> source ID -> set of destination IDs
+	index map[uint]map[uint]map[uint]struct{}
+}
+
+func newIndexedRoutes(store routeStore) *indexedRoutes {
+	return &indexedRoutes{routeStore: store, index: map[uint]map[uint]map[uint]struct{}{}}
+}
+
+func (r *indexedRoutes) set(destination uint, level uint, source uint) {
+	old := r.routeStore.get(destination, level)
+	if old == source {
+		return
+	}
+	if old != SourceUnknown {
+		delete(r.index[level][old], destination)
+		if len(r.index[level][old]) == 0 {
+			delete(r.index[level], old)
+		}
+	}
+	if source != SourceUnknown {
+		if r.index[level] == nil {
+			r.index[level] = map[uint]map[uint]struct{}{}
+		}
+		if r.index[level][source] == nil {
+			r.index[level][source] = map[uint]struct{}{}
+		}
+		r.index[level][source][destination] = struct{}{}
+	}
+	r.routeStore.set(destination, level, source)
+}
+
+// Returns the destinations routed to a source at a level, in ID order
+func (r *indexedRoutes) destinations(level uint, source uint) []uint {
+	dests := make([]uint, 0, len(r.index[level][source]))
+	for dest := range r.index[level][source] {
+		dests = append(dests, dest)
+	}
+	sort.Slice(dests, func(i, j int) bool {
+		return dests[i] < dests[j]
+	})
+	return dests
+}
+
+// Returns the number of crosspoints routed to a source across all levels
+func (r *indexedRoutes) usage(source uint) int {
+	count := 0
+	for _, sources := range r.index {
+		count += len(sources[source])
+	}
+	return count
+}
@@ -0,0 +1,157 @@
+package magnumrouter
+
+import (
+	"math/rand"
+	"reflect"
+	"testing"
+
+	"github.com/cassaram/quartz"
+)
+
+func TestSparseRoutesMatchDense(t *testing.T) {
+	const destinations, levels = 50, 4
+	dense := newDenseRoutes(destinations, levels)
+	sparse := newSparseRoutes(destinations, levels)
+	rng := rand.New(rand.NewSource(1))
+	for i := 0; i < 1000; i++ {
+		dest, lvl := uint(rng.Intn(destinations)), uint(rng.Intn(levels))
+		// Includes SourceUnknown so clearing a crosspoint is covered
+		src := uint(rng.Intn(8))
+		dense.set(dest, lvl, src)
+		sparse.set(dest, lvl, src)
+	}
+	for dest := uint(0); dest < destinations; dest++ {
+		for lvl := uint(0); lvl < levels; lvl++ {
+			if got, want := sparse.get(dest, lvl), dense.get(dest, lvl); got != want {
+				t.Fatalf("get(%d, %d) = %d, want %d", dest, lvl, got, want)
+			}
+		}
+	}
+	if !reflect.DeepEqual(sparse.table(), dense.table()) {
+		t.Error("sparse table differs from the dense table")
+	}
+	for key, src := range sparse.routes {
+		if src == SourceUnknown {
+			t.Errorf("sparse store kept unknown crosspoint %+v", key)
+		}
+	}
+}
+
+func TestSparseRouteTableRouter(t *testing.T) {
+	dense := NewMagnumRouterWithConn(NewFakeConn(4, 4), 4, 4, 2)
+	sparse := NewMagnumRouterWithConn(NewFakeConn(4, 4), 4, 4, 2, WithSparseRouteTable(true))
+	for _, msg := range []quartz.QuartzResponse{
+		update(1, 2, quartz.QUARTZ_LVL_V, quartz.QUARTZ_LVL_A),
+		update(3, 4, quartz.QUARTZ_LVL_A),
+		update(1, 0, quartz.QUARTZ_LVL_A),
+	} {
+		dense.processMessage(msg)
+		sparse.processMessage(msg)
+	}
+	if got, want := sparse.GetRouteTable(), dense.GetRouteTable(); !reflect.DeepEqual(got, want) {
+		t.Errorf("GetRouteTable() = %v, want %v", got, want)
+	}
+	if got := sparse.GetRoute(1, 2); got != SourceUnknown {
+		t.Errorf("GetRoute() of an absent crosspoint = %d, want SourceUnknown", got)
+	}
+}
+
+// Memory of a 10000x32 frame with a few hundred routes, see B/op
+func BenchmarkRouteStoreMemory(b *testing.B) {
+	const destinations, levels, routed = 10000, 32, 500
+	stores := []struct {
+		name     string
+		newStore func() routeStore
+	}{
+		{"dense", func() routeStore { return newDenseRoutes(destinations+1, levels) }},
+		{"sparse", func() routeStore { return newSparseRoutes(destinations+1, levels) }},
+	}
+	for _, s := range stores {
+		b.Run(s.name, func(b *testing.B) {
+			b.ReportAllocs()
+			for i := 0; i < b.N; i++ {
+				store := s.newStore()
+				for dest := uint(1); dest <= routed; dest++ {
+					store.set(dest, dest%levels, dest)
+				}
+			}
+		})
+	}
+}
+
+// Checks the indexed source queries of a router against a scan of its route table
+func checkInverseIndex(t *testing.T, m *MagnumRouter) {
+	t.Helper()
+	table := m.GetRouteTable()
+	for lvl := uint(0); lvl < m.levelCount; lvl++ {
+		for src := uint(1); src < uint(len(m.sourceNames)); src++ {
+			want := []uint{}
+			for dest := uint(1); dest < uint(len(table)); dest++ {
+				if table[dest][lvl] == src {
+					want = append(want, dest)
+				}
+			}
+			if got := m.DestinationsForSource(lvl, src); !reflect.DeepEqual(got, want) {
+				t.Fatalf("DestinationsForSource(%d, %d) = %v, want %v", lvl, src, got, want)
+			}
+		}
+	}
+	for src := uint(1); src < uint(len(m.sourceNames)); src++ {
+		want := 0
+		for dest := uint(1); dest < uint(len(table)); dest++ {
+			for _, routed := range table[dest] {
+				if routed == src {
+					want++
+				}
+			}
+		}
+		if got := m.SourceUsageCount(src); got != want {
+			t.Fatalf("SourceUsageCount(%d) = %d, want %d", src, got, want)
+		}
+	}
+}
+
+func TestInverseIndexConsistent(t *testing.T) {
+	m := NewMagnumRouterWithConn(NewFakeConn(6, 10), 6, 10, 2, WithInverseIndex(true))
+	levels := []quartz.QuartzLevel{quartz.QUARTZ_LVL_V, quartz.QuartzLevel("A")}
+	rng := rand.New(rand.NewSource(1))
+	for i := 0; i < 500; i++ {
+		// Includes source 0 so clearing a crosspoint is covered
+		m.processMessage(update(uint(rng.Intn(10)+1), uint(rng.Intn(7)), levels[rng.Intn(2)]))
+	}
+	checkInverseIndex(t, m)
+
+	snapshot := m.ExportState()
+	if err := m.Resize(6, 5, 1, true); err != nil {
+		t.Fatalf("Resize(): %v", err)
+	}
+	checkInverseIndex(t, m)
+	if err := m.Resize(6, 10, 2, false); err != nil {
+		t.Fatalf("Resize(): %v", err)
+	}
+	if err := m.ImportState(snapshot); err != nil {
+		t.Fatalf("ImportState(): %v", err)
+	}
+	checkInverseIndex(t, m)
+}
+
+// Source queries on a 2000x4 frame with every destination routed, scanning against the index
+func BenchmarkDestinationsForSource(b *testing.B) {
+	const sources, destinations = 100, 2000
+	for _, indexed := range []bool{false, true} {
+		name := "scan"
+		if indexed {
+			name = "indexed"
+		}
+		b.Run(name, func(b *testing.B) {
+			m := NewMagnumRouterWithConn(NewFakeConn(sources, destinations), sources, destinations, 4, WithInverseIndex(indexed))
+			for dest := uint(1); dest <= destinations; dest++ {
+				m.processMessage(update(dest, dest%sources+1))
+			}
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				m.DestinationsForSource(0, uint(i%sources)+1)
+			}
+		})
+	}
+}
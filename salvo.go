@@ -0,0 +1,174 @@
+package magnumrouter
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+)
+
+// Routes applied together by name, held by the router rather than on the device
+// Magnum salvos stored on the frame are not reachable through QuartzConn
+type salvoStore struct {
+	mu        sync.Mutex
+	salvos    map[string][]RouteOp
+	schedules map[string]*salvoSchedule
+}
+
+type salvoSchedule struct {
+	at    Schedule
+	next  time.Time
+	timer Timer
+}
+
+// A daily time of day to recall a salvo at
+// Cron style expressions are not supported
+type Schedule struct {
+	Hour   int
+	Minute int
+	Second int
+	// Time zone the time is in, nil for the zone of the clock's times
+	Location *time.Location
+}
+
+// Returns a schedule for the given time every day
+func DailyAt(hour int, minute int) Schedule {
+	return Schedule{Hour: hour, Minute: minute}
+}
+
+func (s Schedule) validate() error {
+	if s.Hour < 0 || s.Hour > 23 || s.Minute < 0 || s.Minute > 59 || s.Second < 0 || s.Second > 59 {
+		return fmt.Errorf("invalid schedule time %02d:%02d:%02d", s.Hour, s.Minute, s.Second)
+	}
+	return nil
+}
+
+// Returns the first time the schedule is due strictly after now
+func (s Schedule) next(now time.Time) time.Time {
+	loc := s.Location
+	if loc == nil {
+		loc = now.Location()
+	}
+	local := now.In(loc)
+	due := time.Date(local.Year(), local.Month(), local.Day(), s.Hour, s.Minute, s.Second, 0, loc)
+	if !due.After(local) {
+		due = time.Date(local.Year(), local.Month(), local.Day()+1, s.Hour, s.Minute, s.Second, 0, loc)
+	}
+	return due
+}
+
+// A scheduled salvo as reported by MagnumRouter.Schedules()
+type ScheduledSalvo struct {
+	Name string
+	At   Schedule
+	// When the salvo is next due
+	Next time.Time
+}
+
+// Defines or replaces a named salvo, a set of routes recalled together with RecallSalvo()
+// The ops are validated when recalled, not here, as the router may be resized in between
+func (m *MagnumRouter) DefineSalvo(name string, ops []RouteOp) {
+	m.salvos.mu.Lock()
+	defer m.salvos.mu.Unlock()
+	if m.salvos.salvos == nil {
+		m.salvos.salvos = map[string][]RouteOp{}
+	}
+	copied := make([]RouteOp, len(ops))
+	for i, op := range ops {
+		copied[i] = RouteOp{Levels: append([]uint{}, op.Levels...), Destination: op.Destination, Source: op.Source}
+	}
+	m.salvos.salvos[name] = copied
+}
+
+// Removes a named salvo along with its schedule
+func (m *MagnumRouter) DeleteSalvo(name string) {
+	m.CancelSchedule(name)
+	m.salvos.mu.Lock()
+	defer m.salvos.mu.Unlock()
+	delete(m.salvos.salvos, name)
+}
+
+// Applies the routes of a named salvo as per SetRoutes()
+// Returns ErrSalvoNotFound if no salvo has the name
+func (m *MagnumRouter) RecallSalvo(ctx context.Context, name string) error {
+	m.salvos.mu.Lock()
+	ops, ok := m.salvos.salvos[name]
+	m.salvos.mu.Unlock()
+	if !ok {
+		return fmt.Errorf("%w: %q", ErrSalvoNotFound, name)
+	}
+	return m.SetRoutes(ctx, ops)
+}
+
+// Recalls a named salvo every day at the scheduled time, replacing any existing schedule for it
+// Timing uses the router's clock, and a recall that fails, such as while disconnected, is logged and not retried
+// Returns ErrSalvoNotFound if no salvo has the name
+func (m *MagnumRouter) ScheduleSalvo(name string, at Schedule) error {
+	if err := at.validate(); err != nil {
+		return err
+	}
+	m.salvos.mu.Lock()
+	defer m.salvos.mu.Unlock()
+	if _, ok := m.salvos.salvos[name]; !ok {
+		return fmt.Errorf("%w: %q", ErrSalvoNotFound, name)
+	}
+	if m.salvos.schedules == nil {
+		m.salvos.schedules = map[string]*salvoSchedule{}
+	}
+	if existing, ok := m.salvos.schedules[name]; ok {
+		existing.timer.Stop()
+	}
+	sched := &salvoSchedule{at: at}
+	m.salvos.schedules[name] = sched
+	m.armScheduleLocked(name, sched)
+	return nil
+}
+
+// Starts the timer for the next due time of a schedule, salvos.mu must be held
+func (m *MagnumRouter) armScheduleLocked(name string, sched *salvoSchedule) {
+	now := m.opts.clock.Now()
+	sched.next = sched.at.next(now)
+	sched.timer = m.opts.clock.AfterFunc(sched.next.Sub(now), func() {
+		m.salvos.mu.Lock()
+		current := m.salvos.schedules[name] == sched
+		m.salvos.mu.Unlock()
+		if !current {
+			return
+		}
+		if err := m.RecallSalvo(context.Background(), name); err != nil {
+			m.opts.logger.Warn("magnum scheduled salvo failed", "salvo", name, "err", err)
+		}
+		m.salvos.mu.Lock()
+		defer m.salvos.mu.Unlock()
+		if m.salvos.schedules[name] == sched {
+			m.armScheduleLocked(name, sched)
+		}
+	})
+}
+
+// Stops the schedule of a named salvo, the salvo itself is kept
+// Returns whether the salvo was scheduled
+func (m *MagnumRouter) CancelSchedule(name string) bool {
+	m.salvos.mu.Lock()
+	defer m.salvos.mu.Unlock()
+	sched, ok := m.salvos.schedules[name]
+	if !ok {
+		return false
+	}
+	sched.timer.Stop()
+	delete(m.salvos.schedules, name)
+	return true
+}
+
+// Returns every scheduled salvo in name order
+func (m *MagnumRouter) Schedules() []ScheduledSalvo {
+	m.salvos.mu.Lock()
+	defer m.salvos.mu.Unlock()
+	schedules := make([]ScheduledSalvo, 0, len(m.salvos.schedules))
+	for name, sched := range m.salvos.schedules {
+		schedules = append(schedules, ScheduledSalvo{Name: name, At: sched.at, Next: sched.next})
+	}
+	sort.Slice(schedules, func(i, j int) bool { return schedules[i].Name < schedules[j].Name })
+	return schedules
+}
@@ -0,0 +1,79 @@
+package magnumrouter
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestScheduledSalvoRecalled(t *testing.T) {
+	clock := newFakeClock()
+	m, conn := newScriptRouter(t, 4, 4, 1, WithClock(clock))
+	m.DefineSalvo("overnight", []RouteOp{{Levels: []uint{0}, Destination: 1, Source: 2}})
+	if err := m.ScheduleSalvo("overnight", DailyAt(2, 0)); err != nil {
+		t.Fatalf("ScheduleSalvo() = %v", err)
+	}
+	due := time.Date(2024, 1, 1, 2, 0, 0, 0, time.UTC)
+	if got := m.Schedules(); len(got) != 1 || got[0].Name != "overnight" || !got[0].Next.Equal(due) {
+		t.Fatalf("Schedules() = %+v, want overnight next due at %v", got, due)
+	}
+
+	clock.Advance(time.Hour + 59*time.Minute)
+	if got := countCalls(conn, "route [V] 1 2"); got != 0 {
+		t.Fatalf("salvo recalled %d times before it was due", got)
+	}
+	clock.Advance(time.Minute)
+	if got := countCalls(conn, "route [V] 1 2"); got != 1 {
+		t.Fatalf("salvo recalled %d times when due, want 1", got)
+	}
+	if got := m.Schedules()[0].Next; !got.Equal(due.AddDate(0, 0, 1)) {
+		t.Errorf("next due %v, want the same time the next day", got)
+	}
+	clock.Advance(24 * time.Hour)
+	if got := countCalls(conn, "route [V] 1 2"); got != 2 {
+		t.Errorf("salvo recalled %d times after two days, want 2", got)
+	}
+
+	if !m.CancelSchedule("overnight") {
+		t.Error("CancelSchedule() = false for a scheduled salvo")
+	}
+	clock.Advance(24 * time.Hour)
+	if got := countCalls(conn, "route [V] 1 2"); got != 2 {
+		t.Errorf("salvo recalled %d times, want no recall after cancelling", got)
+	}
+	if got := m.Schedules(); len(got) != 0 {
+		t.Errorf("Schedules() = %+v after cancelling, want none", got)
+	}
+	if m.CancelSchedule("overnight") {
+		t.Error("CancelSchedule() = true for an unscheduled salvo")
+	}
+}
+
+func TestScheduleInLocation(t *testing.T) {
+	clock := newFakeClock()
+	m, _ := newScriptRouter(t, 4, 4, 1, WithClock(clock))
+	m.DefineSalvo("morning", []RouteOp{{Levels: []uint{0}, Destination: 1, Source: 2}})
+	zone := time.FixedZone("UTC+3", 3*60*60)
+	if err := m.ScheduleSalvo("morning", Schedule{Hour: 6, Minute: 30, Location: zone}); err != nil {
+		t.Fatal(err)
+	}
+	want := time.Date(2024, 1, 1, 3, 30, 0, 0, time.UTC)
+	if got := m.Schedules()[0].Next; !got.Equal(want) {
+		t.Errorf("next due %v, want %v", got, want)
+	}
+}
+
+func TestScheduleSalvoRejected(t *testing.T) {
+	m, _ := newScriptRouter(t, 4, 4, 1, WithClock(newFakeClock()))
+	if err := m.ScheduleSalvo("missing", DailyAt(2, 0)); !errors.Is(err, ErrSalvoNotFound) {
+		t.Errorf("ScheduleSalvo() of an undefined salvo = %v, want ErrSalvoNotFound", err)
+	}
+	m.DefineSalvo("overnight", nil)
+	if err := m.ScheduleSalvo("overnight", DailyAt(24, 0)); err == nil {
+		t.Error("ScheduleSalvo() accepted hour 24")
+	}
+	if err := m.RecallSalvo(context.Background(), "missing"); !errors.Is(err, ErrSalvoNotFound) {
+		t.Errorf("RecallSalvo() of an undefined salvo = %v, want ErrSalvoNotFound", err)
+	}
+}
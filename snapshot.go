@@ -0,0 +1,250 @@
+package magnumrouter
+
+import (
+	"encoding/json"
+	"fmt"
+)
+
+// Version of the RouterSnapshot layout written by this library
+// Version 1 had no version field and no tags
+const SnapshotSchemaVersion = 2
+
+// A copy of the cached router state
+// Tables are indexed the same as the MagnumRouter.Get*Table() methods
+// Snapshots saved as JSON by earlier versions of the library are upgraded as they are unmarshalled
+type RouterSnapshot struct {
+	// Layout version, set to SnapshotSchemaVersion by ExportState()
+	SchemaVersion    int      `json:"schema_version"`
+	SourceNames      []string `json:"source_names"`
+	DestinationNames []string `json:"destination_names"`
+	DestinationLocks []bool   `json:"destination_locks"`
+	// Indexed by destination ID then level ID
+	Routes [][]uint `json:"routes"`
+	// Level names as per GetLevelName(), so including those set by WithLevelNames()
+	LevelNames []string `json:"level_names"`
+	// Tags set with SetSourceTags() and SetDestinationTags(), keyed by ID
+	SourceTags      map[uint]map[string]string `json:"source_tags,omitempty"`
+	DestinationTags map[uint]map[string]string `json:"destination_tags,omitempty"`
+}
+
+// Returns the name of every level as per GetLevelName(), indexed by level ID
+func (m *MagnumRouter) effectiveLevelNamesLocked() []string {
+	names := make([]string, m.levelCount)
+	for lvl := range names {
+		names[lvl] = m.levelNameLocked(uint(lvl))
+	}
+	return names
+}
+
+// Returns a copy of the current cached state
+func (m *MagnumRouter) ExportState() RouterSnapshot {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	return m.snapshotLocked()
+}
+
+func (m *MagnumRouter) snapshotLocked() RouterSnapshot {
+	routes := m.routes.table()
+	routesCopy := make([][]uint, len(routes))
+	for i := range routes {
+		routesCopy[i] = append([]uint{}, routes[i]...)
+	}
+	return RouterSnapshot{
+		SchemaVersion:    SnapshotSchemaVersion,
+		SourceNames:      append([]string{}, m.sourceNames...),
+		DestinationNames: append([]string{}, m.destinationNames...),
+		DestinationLocks: append([]bool{}, m.destinationLocks...),
+		Routes:           routesCopy,
+		LevelNames:       m.effectiveLevelNamesLocked(),
+		SourceTags:       copyAllTags(m.sourceTags),
+		DestinationTags:  copyAllTags(m.destinationTags),
+	}
+}
+
+// Replaces the cached state with a previously exported snapshot, without touching the device
+// Lets a restarted service come up with warm state instead of waiting for a sync
+// The snapshot may be stale, use Verify() to bring the cache back in line with the device
+// The snapshot must have the same counts as the router, change events are sent for entries that differ
+// Tags are replaced only if the snapshot has any, so snapshots taken without tags keep the current tags
+func (m *MagnumRouter) ImportState(s RouterSnapshot) error {
+	var err error
+	m.update(func() []Event {
+		if err = m.checkSnapshotLocked(s); err != nil {
+			return nil
+		}
+		return m.importStateLocked(s)
+	})
+	return err
+}
+
+func (m *MagnumRouter) importStateLocked(s RouterSnapshot) []Event {
+	events := diffEvents(DiffSnapshots(m.snapshotLocked(), s))
+	copy(m.sourceNames, s.SourceNames)
+	copy(m.destinationNames, s.DestinationNames)
+	copy(m.destinationLocks, s.DestinationLocks)
+	// Names matching the fallback are left unset so they keep following it, as the device did not report them
+	for lvl, name := range s.LevelNames {
+		if lvl < len(m.levelNames) {
+			if name == m.levelFallbackLocked(uint(lvl)) {
+				name = ""
+			}
+			m.levelNames[lvl] = name
+		}
+	}
+	if s.SourceTags != nil || s.DestinationTags != nil {
+		m.sourceTags = copyAllTags(s.SourceTags)
+		m.destinationTags = copyAllTags(s.DestinationTags)
+	}
+	for dest := range s.Routes {
+		for lvl, src := range s.Routes[dest] {
+			m.routes.set(uint(dest), uint(lvl), src)
+		}
+	}
+	m.generation++
+	return events
+}
+
+// Unmarshals a snapshot, upgrading layouts written by earlier versions to the current one
+// Returns an error for a snapshot written by a newer version of the library
+func (s *RouterSnapshot) UnmarshalJSON(data []byte) error {
+	// The alias has no methods, so unmarshalling it does not recurse
+	type snapshot RouterSnapshot
+	var raw snapshot
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return err
+	}
+	if raw.SchemaVersion > SnapshotSchemaVersion {
+		return fmt.Errorf("snapshot schema version %d is newer than supported version %d", raw.SchemaVersion, SnapshotSchemaVersion)
+	}
+	// Upgrade one version at a time, version 1 predates the version field
+	if raw.SchemaVersion < 1 {
+		raw.SchemaVersion = 1
+	}
+	if raw.SchemaVersion == 1 {
+		// Version 2 added tags, which version 1 snapshots have none of
+		raw.SchemaVersion = 2
+	}
+	*s = RouterSnapshot(raw)
+	return nil
+}
+
+// Checks a snapshot has the same shape as the router
+func (m *MagnumRouter) checkSnapshotLocked(s RouterSnapshot) error {
+	if s.SchemaVersion > SnapshotSchemaVersion {
+		return fmt.Errorf("snapshot schema version %d is newer than supported version %d", s.SchemaVersion, SnapshotSchemaVersion)
+	}
+	if len(s.SourceNames) != len(m.sourceNames) {
+		return fmt.Errorf("snapshot has %d source entries, router has %d", len(s.SourceNames), len(m.sourceNames))
+	}
+	if len(s.DestinationNames) != len(m.destinationNames) || len(s.DestinationLocks) != len(m.destinationNames) || len(s.Routes) != len(m.destinationNames) {
+		return fmt.Errorf("snapshot destination tables do not match router with %d destination entries", len(m.destinationNames))
+	}
+	for dest := range s.Routes {
+		if len(s.Routes[dest]) != int(m.levelCount) {
+			return fmt.Errorf("snapshot destination %d has %d levels, router has %d", dest, len(s.Routes[dest]), m.levelCount)
+		}
+	}
+	if len(s.LevelNames) != 0 && len(s.LevelNames) != int(m.levelCount) {
+		return fmt.Errorf("snapshot has %d level names, router has %d levels", len(s.LevelNames), m.levelCount)
+	}
+	for src := range s.SourceTags {
+		if src >= uint(len(m.sourceNames)) {
+			return fmt.Errorf("snapshot tags source %d: %w", src, ErrSourceOutOfRange)
+		}
+	}
+	for dest := range s.DestinationTags {
+		if dest >= uint(len(m.destinationNames)) {
+			return fmt.Errorf("snapshot tags destination %d: %w", dest, ErrDestinationOutOfRange)
+		}
+	}
+	return nil
+}
+
+// Kind of difference described by a RouteDiff
+type DiffKind int
+
+const (
+	// A crosspoint changed source, Destination, Level, Before and After are set
+	DiffRoute DiffKind = iota
+	// A destination lock changed, Destination, BeforeLocked and AfterLocked are set
+	DiffLock
+	// A source name changed, Source, BeforeName and AfterName are set
+	DiffSourceName
+	// A destination name changed, Destination, BeforeName and AfterName are set
+	DiffDestinationName
+)
+
+// A single difference between two snapshots
+type RouteDiff struct {
+	Kind         DiffKind
+	Destination  uint
+	Level        uint
+	Source       uint
+	Before       uint
+	After        uint
+	BeforeLocked bool
+	AfterLocked  bool
+	BeforeName   string
+	AfterName    string
+}
+
+// Returns every difference going from snapshot a to snapshot b
+// Entries present in only one of the snapshots are compared against zero values
+func DiffSnapshots(a RouterSnapshot, b RouterSnapshot) []RouteDiff {
+	diffs := []RouteDiff{}
+	for i := 0; i < max(len(a.SourceNames), len(b.SourceNames)); i++ {
+		before, after := at(a.SourceNames, i), at(b.SourceNames, i)
+		if before != after {
+			diffs = append(diffs, RouteDiff{Kind: DiffSourceName, Source: uint(i), BeforeName: before, AfterName: after})
+		}
+	}
+	for i := 0; i < max(len(a.DestinationNames), len(b.DestinationNames)); i++ {
+		before, after := at(a.DestinationNames, i), at(b.DestinationNames, i)
+		if before != after {
+			diffs = append(diffs, RouteDiff{Kind: DiffDestinationName, Destination: uint(i), BeforeName: before, AfterName: after})
+		}
+	}
+	for i := 0; i < max(len(a.DestinationLocks), len(b.DestinationLocks)); i++ {
+		before, after := at(a.DestinationLocks, i), at(b.DestinationLocks, i)
+		if before != after {
+			diffs = append(diffs, RouteDiff{Kind: DiffLock, Destination: uint(i), BeforeLocked: before, AfterLocked: after})
+		}
+	}
+	for dest := 0; dest < max(len(a.Routes), len(b.Routes)); dest++ {
+		levelsA, levelsB := at(a.Routes, dest), at(b.Routes, dest)
+		for lvl := 0; lvl < max(len(levelsA), len(levelsB)); lvl++ {
+			before, after := at(levelsA, lvl), at(levelsB, lvl)
+			if before != after {
+				diffs = append(diffs, RouteDiff{Kind: DiffRoute, Destination: uint(dest), Level: uint(lvl), Before: before, After: after})
+			}
+		}
+	}
+	return diffs
+}
+
+// Converts diffs to the change events they represent
+func diffEvents(diffs []RouteDiff) []Event {
+	events := make([]Event, 0, len(diffs))
+	for _, d := range diffs {
+		switch d.Kind {
+		case DiffRoute:
+			events = append(events, Event{Type: EventRouteChange, Destination: d.Destination, Level: d.Level, Source: d.After})
+		case DiffLock:
+			events = append(events, Event{Type: EventLockChange, Destination: d.Destination, Locked: d.AfterLocked})
+		case DiffSourceName:
+			events = append(events, Event{Type: EventSourceNameChange, Source: d.Source, Name: d.AfterName})
+		case DiffDestinationName:
+			events = append(events, Event{Type: EventDestinationNameChange, Destination: d.Destination, Name: d.AfterName})
+		}
+	}
+	return events
+}
+
+// Returns s[i], or the zero value if i is out of range
+func at[T any](s []T, i int) T {
+	var zero T
+	if i < len(s) {
+		return s[i]
+	}
+	return zero
+}
@@ -0,0 +1,127 @@
+package magnumrouter
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestImportStateThenVerify(t *testing.T) {
+	fake := NewFakeConn(3, 3)
+	fake.routes[crosspoint{destination: 1, level: 0}] = 1
+	fake.routes[crosspoint{destination: 2, level: 0}] = 2
+	first := NewMagnumRouterWithConn(fake, 3, 3, 1)
+	if err := first.ConnectContext(context.Background()); err != nil {
+		t.Fatalf("connect: %v", err)
+	}
+	if _, err := first.Verify(context.Background()); err != nil {
+		t.Fatalf("verify: %v", err)
+	}
+	saved := first.ExportState()
+	first.Close()
+
+	// The device changes while the service is down
+	fake.mu.Lock()
+	fake.routes[crosspoint{destination: 1, level: 0}] = 3
+	fake.destNames[2] = "RECORDER"
+	fake.mu.Unlock()
+
+	restarted := NewMagnumRouterWithConn(fake, 3, 3, 1, WithNoInitialSync())
+	defer restarted.Close()
+	if err := restarted.ImportState(saved); err != nil {
+		t.Fatalf("ImportState() = %v", err)
+	}
+	if got := restarted.ExportState(); !reflect.DeepEqual(got, saved) {
+		t.Fatalf("imported state %+v, want %+v", got, saved)
+	}
+	if err := restarted.Connect(); err != nil {
+		t.Fatalf("connect: %v", err)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	diffs, err := restarted.Verify(ctx)
+	if err != nil {
+		t.Fatalf("Verify() = %v", err)
+	}
+	want := []RouteDiff{
+		{Kind: DiffDestinationName, Destination: 2, BeforeName: "DST 2", AfterName: "RECORDER"},
+		{Kind: DiffRoute, Destination: 1, Level: 0, Before: 1, After: 3},
+	}
+	if !reflect.DeepEqual(diffs, want) {
+		t.Errorf("Verify() = %+v, want %+v", diffs, want)
+	}
+}
+
+func TestImportStateRejectsOtherShape(t *testing.T) {
+	small := NewMagnumRouterWithConn(NewFakeConn(2, 2), 2, 2, 1)
+	large := NewMagnumRouterWithConn(NewFakeConn(3, 3), 3, 3, 1)
+	if err := large.ImportState(small.ExportState()); err == nil {
+		t.Error("ImportState() accepted a snapshot of another size")
+	}
+}
+
+func TestSnapshotV1Upgraded(t *testing.T) {
+	// As saved before the schema version and tags were added
+	v1 := `{"source_names":["","CAM 1","CAM 2"],"destination_names":["","MON 1","MON 2"],` +
+		`"destination_locks":[false,true,false],"routes":[[0],[2],[1]],"level_names":["V"]}`
+	var s RouterSnapshot
+	if err := json.Unmarshal([]byte(v1), &s); err != nil {
+		t.Fatalf("Unmarshal() = %v", err)
+	}
+	if s.SchemaVersion != SnapshotSchemaVersion {
+		t.Errorf("SchemaVersion = %d, want %d", s.SchemaVersion, SnapshotSchemaVersion)
+	}
+	if s.SourceTags != nil || s.DestinationTags != nil {
+		t.Errorf("tags %v %v, want none", s.SourceTags, s.DestinationTags)
+	}
+
+	m := NewMagnumRouterWithConn(NewFakeConn(2, 2), 2, 2, 1)
+	if err := m.ImportState(s); err != nil {
+		t.Fatalf("ImportState() = %v", err)
+	}
+	if got := m.GetRoute(0, 1); got != 2 {
+		t.Errorf("route of destination 1 = %d, want 2", got)
+	}
+	if got := m.GetDestinationName(1); got != "MON 1" {
+		t.Errorf("name of destination 1 = %q, want MON 1", got)
+	}
+	if !m.GetDestinationLocked(1) {
+		t.Error("destination 1 not locked")
+	}
+}
+
+func TestSnapshotRoundTrip(t *testing.T) {
+	m, _ := newFakeRouter(t, 2, 2, 1)
+	if err := m.SetSourceTags(1, map[string]string{"room": "A"}); err != nil {
+		t.Fatal(err)
+	}
+	saved := m.ExportState()
+	data, err := json.Marshal(saved)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var loaded RouterSnapshot
+	if err := json.Unmarshal(data, &loaded); err != nil {
+		t.Fatalf("Unmarshal() = %v", err)
+	}
+	if !reflect.DeepEqual(loaded, saved) {
+		t.Errorf("loaded %+v, want %+v", loaded, saved)
+	}
+}
+
+func TestSnapshotNewerVersionRejected(t *testing.T) {
+	newer := fmt.Sprintf(`{"schema_version":%d,"source_names":[""]}`, SnapshotSchemaVersion+1)
+	var s RouterSnapshot
+	if err := json.Unmarshal([]byte(newer), &s); err == nil {
+		t.Error("Unmarshal() accepted a newer schema version")
+	}
+	m := NewMagnumRouterWithConn(NewFakeConn(2, 2), 2, 2, 1)
+	s = m.ExportState()
+	s.SchemaVersion = SnapshotSchemaVersion + 1
+	if err := m.ImportState(s); err == nil {
+		t.Error("ImportState() accepted a newer schema version")
+	}
+}
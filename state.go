@@ -0,0 +1,167 @@
+package magnumrouter
+
+// Connection state of the router to the magnum server
+type ConnectionState int
+
+const (
+	StateDisconnected ConnectionState = iota
+	StateConnecting
+	StateConnected
+)
+
+func (s ConnectionState) String() string {
+	switch s {
+	case StateDisconnected:
+		return "disconnected"
+	case StateConnecting:
+		return "connecting"
+	case StateConnected:
+		return "connected"
+	}
+	return "unknown"
+}
+
+// Returns the current connection state
+// This is always the actual state, regardless of any debounce applied to published states
+func (m *MagnumRouter) State() ConnectionState {
+	m.stateMu.Lock()
+	defer m.stateMu.Unlock()
+	return m.state
+}
+
+// Moves the router to a new connection state and publishes it to the state handler
+// With debouncing enabled, publishing is deferred until the state has held for the debounce window
+func (m *MagnumRouter) setState(state ConnectionState) {
+	m.transitionState(func(ConnectionState) bool { return true }, state)
+}
+
+// Moves the router to a new connection state only if it is currently in the from state
+// Returns whether the router is now in the new state because of this call
+func (m *MagnumRouter) changeState(from ConnectionState, to ConnectionState) bool {
+	return m.transitionState(func(current ConnectionState) bool { return current == from }, to)
+}
+
+func (m *MagnumRouter) transitionState(allowed func(current ConnectionState) bool, state ConnectionState) bool {
+	m.stateMu.Lock()
+	if m.state == state || !allowed(m.state) {
+		m.stateMu.Unlock()
+		return false
+	}
+	m.recordStateStats(m.state, state)
+	m.state = state
+	if state == StateDisconnected {
+		m.linked = false
+	}
+	m.signalReadyLocked()
+	if m.stateTimer != nil {
+		m.stateTimer.Stop()
+		m.stateTimer = nil
+	}
+	if m.opts.stateDebounce <= 0 {
+		m.publishedState = state
+		m.stateMu.Unlock()
+		m.publishState()
+		return true
+	}
+	m.stateTimer = m.opts.clock.AfterFunc(m.opts.stateDebounce, func() {
+		m.stateMu.Lock()
+		// Only publish if the state held and differs from what subscribers last saw
+		if m.state != state || m.publishedState == state {
+			m.stateMu.Unlock()
+			return
+		}
+		m.publishedState = state
+		m.stateTimer = nil
+		m.stateMu.Unlock()
+		m.publishState()
+	})
+	m.stateMu.Unlock()
+	return true
+}
+
+// Delivers the published state to the state handler and subscribers
+// Only one caller delivers at a time, looping until the latest published state is delivered,
+// so concurrent transitions are never seen out of order, and a handler changing the state does not deadlock
+// Intermediate states published while the handler runs are skipped in favour of the latest
+func (m *MagnumRouter) publishState() {
+	m.stateMu.Lock()
+	if m.publishing {
+		m.stateMu.Unlock()
+		return
+	}
+	m.publishing = true
+	for m.deliveredState != m.publishedState {
+		state := m.publishedState
+		m.deliveredState = state
+		m.stateMu.Unlock()
+		if m.opts.stateHandler != nil {
+			m.opts.stateHandler(state)
+		}
+		m.subMu.Lock()
+		for _, sub := range m.stateSubscribers {
+			sub.send(state)
+		}
+		m.subMu.Unlock()
+		m.stateMu.Lock()
+	}
+	m.publishing = false
+	m.stateMu.Unlock()
+}
+
+// A SubscribeState() subscriber, holding the last state sent so repeats are skipped
+type stateSubscriber struct {
+	ch   chan ConnectionState
+	last ConnectionState
+}
+
+// Sends a state, replacing any state the receiver has not taken yet so it always sees the latest, subMu must be held
+func (s *stateSubscriber) send(state ConnectionState) {
+	if s.last == state {
+		return
+	}
+	s.last = state
+	select {
+	case s.ch <- state:
+	default:
+		select {
+		case <-s.ch:
+		default:
+		}
+		s.ch <- state
+	}
+}
+
+// Returns a channel receiving only connection state changes, and a function to unsubscribe
+// The current state is sent immediately, then each published state as per WithStateHandler(), following any debounce
+// A receiver that falls behind misses intermediate states but always receives the latest
+// Unsubscribing closes the channel, as does Close(), and after Close() the channel is returned already closed
+func (m *MagnumRouter) SubscribeState() (<-chan ConnectionState, func()) {
+	ch := make(chan ConnectionState, 1)
+	// Holding stateMu while registering means no publish can fall between reading the state and subscribing
+	m.stateMu.Lock()
+	m.subMu.Lock()
+	if m.subsClosed {
+		m.subMu.Unlock()
+		m.stateMu.Unlock()
+		close(ch)
+		return ch, func() {}
+	}
+	// The delivered state, so a publish in progress cannot send an older state after this one
+	sub := &stateSubscriber{ch: ch, last: m.deliveredState}
+	ch <- m.deliveredState
+	id := m.nextSubID
+	m.nextSubID++
+	m.stateSubscribers[id] = sub
+	m.subMu.Unlock()
+	m.stateMu.Unlock()
+
+	unsubscribe := func() {
+		m.subMu.Lock()
+		defer m.subMu.Unlock()
+		if _, ok := m.stateSubscribers[id]; ok {
+			delete(m.stateSubscribers, id)
+			close(ch)
+		}
+	}
+	return ch, unsubscribe
+}
@@ -0,0 +1,171 @@
+package magnumrouter
+
+import (
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestStatePublishedInOrder(t *testing.T) {
+	var mu sync.Mutex
+	seen := []ConnectionState{}
+	m := NewMagnumRouterWithConn(NewFakeConn(1, 1), 1, 1, 1, WithStateHandler(func(state ConnectionState) {
+		mu.Lock()
+		seen = append(seen, state)
+		mu.Unlock()
+	}))
+	states, unsubscribe := m.SubscribeState()
+	defer unsubscribe()
+
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			for j := 0; j < 200; j++ {
+				m.setState(ConnectionState((i + j) % 3))
+			}
+		}(i)
+	}
+	wg.Wait()
+
+	mu.Lock()
+	defer mu.Unlock()
+	final := m.State()
+	if len(seen) > 0 && seen[len(seen)-1] != final {
+		t.Errorf("handler last saw %v, want %v", seen[len(seen)-1], final)
+	}
+	for i := 1; i < len(seen); i++ {
+		if seen[i] == seen[i-1] {
+			t.Fatalf("handler saw %v twice in a row", seen[i])
+		}
+	}
+	if got := <-states; got != final {
+		t.Errorf("subscriber last saw %v, want %v", got, final)
+	}
+}
+
+func TestStateHandlerMayChangeState(t *testing.T) {
+	var m *MagnumRouter
+	seen := []ConnectionState{}
+	m = NewMagnumRouterWithConn(NewFakeConn(1, 1), 1, 1, 1, WithStateHandler(func(state ConnectionState) {
+		seen = append(seen, state)
+		if state == StateConnecting {
+			m.setState(StateConnected)
+		}
+	}))
+	m.setState(StateConnecting)
+	want := []ConnectionState{StateConnecting, StateConnected}
+	if len(seen) != len(want) || seen[0] != want[0] || seen[1] != want[1] {
+		t.Errorf("handler saw %v, want %v", seen, want)
+	}
+}
+
+func TestStateDebounceSmoothsFlaps(t *testing.T) {
+	clock := newFakeClock()
+	seen := []ConnectionState{}
+	m := NewMagnumRouterWithConn(NewFakeConn(1, 1), 1, 1, 1, WithClock(clock), WithStateDebounce(time.Second),
+		WithStateHandler(func(state ConnectionState) { seen = append(seen, state) }))
+
+	// Flapping faster than the window publishes nothing
+	for i := 0; i < 10; i++ {
+		m.setState(StateConnected)
+		clock.Advance(100 * time.Millisecond)
+		m.setState(StateConnecting)
+		clock.Advance(100 * time.Millisecond)
+	}
+	if len(seen) != 0 {
+		t.Fatalf("published %v during flaps, want nothing", seen)
+	}
+	if got := m.State(); got != StateConnecting {
+		t.Errorf("State() = %v, want connecting regardless of debounce", got)
+	}
+
+	// The final stable state is published once it holds for the window
+	m.setState(StateConnected)
+	clock.Advance(999 * time.Millisecond)
+	if len(seen) != 0 {
+		t.Fatalf("published %v before the window elapsed", seen)
+	}
+	clock.Advance(time.Millisecond)
+	if len(seen) != 1 || seen[0] != StateConnected {
+		t.Fatalf("published %v, want [connected]", seen)
+	}
+
+	// A blip away and back within the window publishes nothing more
+	m.setState(StateDisconnected)
+	clock.Advance(500 * time.Millisecond)
+	m.setState(StateConnected)
+	clock.Advance(2 * time.Second)
+	if len(seen) != 1 {
+		t.Errorf("published %v after a blip, want only [connected]", seen)
+	}
+}
+
+// Receives the next state from a SubscribeState() channel
+func nextState(t *testing.T, states <-chan ConnectionState) ConnectionState {
+	t.Helper()
+	select {
+	case state := <-states:
+		return state
+	case <-time.After(time.Second):
+		t.Fatal("no state received")
+		return 0
+	}
+}
+
+func TestSubscribeState(t *testing.T) {
+	m, conn := newScriptRouter(t, 2, 2, 1)
+	states, unsubscribe := m.SubscribeState()
+	if got := nextState(t, states); got != StateConnected {
+		t.Fatalf("initial state %v, want connected", got)
+	}
+
+	// Route events are not sent as states
+	conn.inject(update(1, 2))
+	eventually(t, func() bool { return m.GetRoute(0, 1) == 2 })
+	select {
+	case state := <-states:
+		t.Fatalf("received %v for a route change", state)
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	if err := m.Disconnect(); err != nil {
+		t.Fatal(err)
+	}
+	if got := nextState(t, states); got != StateDisconnected {
+		t.Errorf("state after Disconnect() %v, want disconnected", got)
+	}
+	unsubscribe()
+	if _, ok := <-states; ok {
+		t.Error("channel open after unsubscribing")
+	}
+	unsubscribe()
+}
+
+func TestSubscribeStateKeepsLatest(t *testing.T) {
+	m := NewMagnumRouterWithConn(newScriptConn(), 2, 2, 1, WithNoInitialSync())
+	defer m.Close()
+	states, unsubscribe := m.SubscribeState()
+	defer unsubscribe()
+	// Nothing is received while connecting and disconnecting twice
+	for i := 0; i < 2; i++ {
+		if err := m.Connect(); err != nil {
+			t.Fatal(err)
+		}
+		if err := m.Disconnect(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := m.Connect(); err != nil {
+		t.Fatal(err)
+	}
+	if got := nextState(t, states); got != StateConnected {
+		t.Errorf("state %v, want the latest, connected", got)
+	}
+	select {
+	case state := <-states:
+		t.Errorf("received %v after the latest state", state)
+	default:
+	}
+}
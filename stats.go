@@ -0,0 +1,61 @@
+package magnumrouter
+
+import "time"
+
+// Cumulative connection statistics, maintained across reconnects
+// Byte counts are not available as the quartz layer does not expose them
+type Stats struct {
+	// Time the current connection was established, zero if not connected
+	ConnectedSince time.Time
+	// Total time spent connected, including the current connection
+	TotalUptime time.Duration
+	// Number of successful connections after the first
+	ReconnectCount int
+	// Time the last connection was lost or closed, zero if never disconnected
+	LastDisconnect time.Time
+}
+
+type connStats struct {
+	Stats
+	connectedOnce bool
+}
+
+// Returns the cumulative connection statistics
+// Statistics live for the lifetime of the router unless cleared with ResetStats()
+func (m *MagnumRouter) Stats() Stats {
+	m.stateMu.Lock()
+	defer m.stateMu.Unlock()
+	stats := m.stats.Stats
+	if !stats.ConnectedSince.IsZero() {
+		stats.TotalUptime += m.opts.clock.Now().Sub(stats.ConnectedSince)
+	}
+	return stats
+}
+
+// Clears all connection statistics
+// If currently connected, the current connection is counted from now and is not treated as a reconnect
+func (m *MagnumRouter) ResetStats() {
+	m.stateMu.Lock()
+	defer m.stateMu.Unlock()
+	m.stats = connStats{}
+	if m.state == StateConnected {
+		m.stats.ConnectedSince = m.opts.clock.Now()
+		m.stats.connectedOnce = true
+	}
+}
+
+// Updates the statistics for a state transition, must be called with stateMu held
+func (m *MagnumRouter) recordStateStats(from ConnectionState, to ConnectionState) {
+	now := m.opts.clock.Now()
+	if to == StateConnected {
+		if m.stats.connectedOnce {
+			m.stats.ReconnectCount++
+		}
+		m.stats.connectedOnce = true
+		m.stats.ConnectedSince = now
+	} else if from == StateConnected {
+		m.stats.TotalUptime += now.Sub(m.stats.ConnectedSince)
+		m.stats.ConnectedSince = time.Time{}
+		m.stats.LastDisconnect = now
+	}
+}
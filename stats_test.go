@@ -0,0 +1,46 @@
+package magnumrouter
+
+import (
+	"testing"
+	"time"
+)
+
+func TestStatsAcrossReconnects(t *testing.T) {
+	clock := newFakeClock()
+	m, _ := newScriptRouter(t, 1, 1, 1, WithClock(clock))
+	start := clock.Now()
+	if got := m.Stats(); got.ConnectedSince != start || got.ReconnectCount != 0 {
+		t.Fatalf("Stats() = %+v after first connect", got)
+	}
+
+	clock.Advance(10 * time.Second)
+	if err := m.Disconnect(); err != nil {
+		t.Fatalf("disconnect: %v", err)
+	}
+	disconnected := clock.Now()
+	clock.Advance(5 * time.Second)
+	if err := m.Connect(); err != nil {
+		t.Fatalf("reconnect: %v", err)
+	}
+	clock.Advance(20 * time.Second)
+
+	got := m.Stats()
+	if got.ReconnectCount != 1 {
+		t.Errorf("ReconnectCount = %d, want 1", got.ReconnectCount)
+	}
+	if got.TotalUptime != 30*time.Second {
+		t.Errorf("TotalUptime = %v, want 30s excluding the time disconnected", got.TotalUptime)
+	}
+	if got.LastDisconnect != disconnected {
+		t.Errorf("LastDisconnect = %v, want %v", got.LastDisconnect, disconnected)
+	}
+	if got.ConnectedSince != disconnected.Add(5*time.Second) {
+		t.Errorf("ConnectedSince = %v, want the reconnect time", got.ConnectedSince)
+	}
+
+	m.ResetStats()
+	clock.Advance(time.Second)
+	if got := m.Stats(); got.ReconnectCount != 0 || got.TotalUptime != time.Second || !got.LastDisconnect.IsZero() {
+		t.Errorf("Stats() = %+v after ResetStats", got)
+	}
+}
@@ -0,0 +1,512 @@
+package magnumrouter
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Source ID cached for a crosspoint whose route is not known
+// Index 0 is reserved by magnum so it never refers to a real source, see WithIndexBase() for 0 based devices
+const SourceUnknown uint = 0
+
+// Controls how Connect reacts to a query failing during the initial sync
+type SyncErrorPolicy int
+
+const (
+	// Any failed query aborts Connect and closes the connection (default)
+	SyncStrict SyncErrorPolicy = iota
+	// Failed queries are logged and recorded, and their cache entries marked unknown
+	// Connect succeeds as long as the link itself is up
+	SyncBestEffort
+)
+
+// Returns the query errors recorded during the last sync in best-effort mode
+// Each error identifies the entry that failed to sync
+func (m *MagnumRouter) SyncErrors() []error {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	return append([]error{}, m.syncErrors...)
+}
+
+// Returns whether the initial sync of the current connection has finished
+// In best-effort mode the sync may have finished with errors, see SyncErrors()
+// With WithNoInitialSync() there is nothing to wait for, so this is true as soon as the link is up
+func (m *MagnumRouter) SyncComplete() bool {
+	m.stateMu.Lock()
+	defer m.stateMu.Unlock()
+	return m.syncComplete
+}
+
+func (m *MagnumRouter) setSyncComplete(complete bool) {
+	m.stateMu.Lock()
+	defer m.stateMu.Unlock()
+	m.syncComplete = complete
+	m.signalReadyLocked()
+}
+
+// Returns whether a sync is currently rewriting the cache
+// The cache may be transiently inconsistent with the device until it finishes
+func (m *MagnumRouter) IsSyncing() bool {
+	m.stateMu.Lock()
+	defer m.stateMu.Unlock()
+	return m.syncing > 0
+}
+
+// Marks a sync as started, syncs may overlap and the router is syncing until all have ended
+func (m *MagnumRouter) beginSync() {
+	m.stateMu.Lock()
+	defer m.stateMu.Unlock()
+	if m.syncing == 0 {
+		m.syncIdle = make(chan struct{})
+	}
+	m.syncing++
+	m.signalReadyLocked()
+}
+
+func (m *MagnumRouter) endSync() {
+	m.stateMu.Lock()
+	defer m.stateMu.Unlock()
+	m.syncing--
+	if m.syncing == 0 {
+		close(m.syncIdle)
+	}
+	m.signalReadyLocked()
+}
+
+// Guards operations that make decisions from the cache against a sync in progress
+// Returns ErrResyncInProgress, or with WithResyncWait() waits for the sync to finish or the context to be done
+func (m *MagnumRouter) awaitSync(ctx context.Context) error {
+	for {
+		m.stateMu.Lock()
+		if m.syncing == 0 {
+			m.stateMu.Unlock()
+			return nil
+		}
+		idle := m.syncIdle
+		m.stateMu.Unlock()
+		if !m.opts.resyncWait {
+			return ErrResyncInProgress
+		}
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-idle:
+		}
+	}
+}
+
+// Decides whether a failed query should abort a sweep
+type syncErrorHandler func(err error) error
+
+// Aborts the sweep on the first failed query
+func strictSync(err error) error {
+	return err
+}
+
+// Records and logs the failed query then lets the sweep continue
+// The query is kept for WithSyncRetry() to resend
+func (m *MagnumRouter) bestEffortSync(err error) error {
+	m.opts.logger.Warn("magnum sync query failed", "err", err)
+	m.mu.Lock()
+	m.syncErrors = append(m.syncErrors, err)
+	var queryErr *syncQueryError
+	if errors.As(err, &queryErr) {
+		m.failedQueries = append(m.failedQueries, queryErr.query)
+	}
+	m.mu.Unlock()
+	return nil
+}
+
+// Requests all names, locks, and routes from the server following the configured sync error policy
+func (m *MagnumRouter) requestAll(ctx context.Context) error {
+	m.beginSync()
+	defer m.endSync()
+	handle := strictSync
+	if m.opts.syncErrorPolicy == SyncBestEffort {
+		handle = m.bestEffortSync
+	}
+	m.mu.Lock()
+	m.syncErrors = nil
+	m.failedQueries = nil
+	m.mu.Unlock()
+
+	if err := m.requestAllSourceNames(ctx, handle); err != nil {
+		return err
+	}
+	if err := m.requestAllDestinationNames(ctx, handle); err != nil {
+		return err
+	}
+	if err := m.requestAllDestinationLocks(ctx, handle); err != nil {
+		return err
+	}
+	if m.opts.levelNameQuery {
+		// Devices may not support level names, in which case the static letters are kept
+		if err := m.RequestAllLevelNames(); err != nil {
+			m.opts.logger.Warn("magnum level name query failed", "err", err)
+		}
+	}
+	return m.requestAllRoutes(ctx, handle)
+}
+
+// A single query sent during a sync
+type syncQuery struct {
+	// Describes the queried entry for errors
+	desc string
+	send func() error
+	// Marks the queried cache entry unknown, called with mu held
+	unknown func()
+}
+
+// A failed sync query, passed to the sync error handler so the query can be retried
+type syncQueryError struct {
+	query syncQuery
+	err   error
+}
+
+func (e *syncQueryError) Error() string {
+	return e.err.Error()
+}
+
+func (e *syncQueryError) Unwrap() error {
+	return e.err
+}
+
+// Time without any response after which a query held back by WithSyncMaxInflight() is sent anyway
+const inflightStall = time.Second
+
+// Sends count queries built by query, with up to the configured sync concurrency outstanding at once
+// With WithSyncMaxInflight(), also holds each query until fewer than the cap are awaiting a response,
+// and waits for the last responses before returning
+// Stops issuing queries once the handler returns an error or the context is done
+// Errors from queries already in flight are joined into the result
+func (m *MagnumRouter) runSync(ctx context.Context, count int, query func(i int) syncQuery, handle syncErrorHandler) error {
+	concurrency := m.opts.syncConcurrency
+	if concurrency < 1 {
+		concurrency = 1
+	}
+	sem := make(chan struct{}, concurrency)
+	wg := sync.WaitGroup{}
+	errMu := sync.Mutex{}
+	errs := []error{}
+	// Responses to queries from before the sync are counted too, which only loosens the cap
+	startResponses := m.responseCount()
+	// Queries that will never be answered, as their send failed or their response went missing
+	var unanswered atomic.Int64
+	sent := 0
+	inflight := func() int {
+		return sent - int(unanswered.Load()) - int(m.responseCount()-startResponses)
+	}
+	lost := func() { unanswered.Add(1) }
+
+	for i := 0; i < count; i++ {
+		if m.opts.syncMaxInflight > 0 {
+			if err := m.awaitInflight(ctx, m.opts.syncMaxInflight, inflight, lost); err != nil {
+				errMu.Lock()
+				errs = append(errs, err)
+				errMu.Unlock()
+				break
+			}
+		}
+		if err := ctx.Err(); err != nil {
+			errMu.Lock()
+			errs = append(errs, err)
+			errMu.Unlock()
+			break
+		}
+		errMu.Lock()
+		failed := len(errs) > 0
+		errMu.Unlock()
+		if failed {
+			break
+		}
+
+		q := query(i)
+		sem <- struct{}{}
+		sent++
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			defer func() { <-sem }()
+			err := q.send()
+			if err == nil {
+				return
+			}
+			unanswered.Add(1)
+			m.mu.Lock()
+			q.unknown()
+			m.mu.Unlock()
+			if err = handle(&syncQueryError{query: q, err: fmt.Errorf("%s: %w", q.desc, err)}); err != nil {
+				errMu.Lock()
+				errs = append(errs, err)
+				errMu.Unlock()
+			}
+		}()
+	}
+	wg.Wait()
+	// The next sweep only counts its own queries, so it would otherwise start over the cap
+	if m.opts.syncMaxInflight > 0 && len(errs) == 0 {
+		if err := m.awaitInflight(ctx, 1, inflight, lost); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// Blocks while inflight reports limit or more queries awaiting a response
+// Each time no response arrives for inflightStall, one query is marked lost so its slot is released
+func (m *MagnumRouter) awaitInflight(ctx context.Context, limit int, inflight func() int, lost func()) error {
+	for {
+		// Take the signal before checking so a response arriving in between is not missed
+		m.respMu.Lock()
+		signal := m.respSignal
+		m.respMu.Unlock()
+		if inflight() < limit {
+			return nil
+		}
+		stalled := make(chan struct{})
+		timer := m.opts.clock.AfterFunc(inflightStall, func() {
+			close(stalled)
+		})
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return ctx.Err()
+		case <-signal:
+			timer.Stop()
+		case <-stalled:
+			lost()
+		}
+	}
+}
+
+// Request all source names from Magnum
+// Results are cached and can be accessed via MagnumRouter.GetSourceNameTable() or MagnumRouter.GetSourceName(source)
+func (m *MagnumRouter) RequestAllSourceNames() error {
+	return m.requestAllSourceNames(context.Background(), strictSync)
+}
+
+func (m *MagnumRouter) requestAllSourceNames(ctx context.Context, handle syncErrorHandler) error {
+	sources, _, _ := m.counts()
+	if sources == 0 {
+		return nil
+	}
+	return m.requestSourceNames(ctx, m.base(), m.base()+sources-1, handle)
+}
+
+// Request the names of sources start to end inclusive from Magnum
+// Uses a single range query when the connection implements NameRangeQuerier, otherwise one query per source
+// Returns ErrSourceOutOfRange without sending anything if the range is empty or not configured
+func (m *MagnumRouter) RequestSourceNamesRange(start uint, end uint) error {
+	sources, _, _ := m.counts()
+	if start < m.base() || start > end || end >= m.base()+sources {
+		return fmt.Errorf("%w: range %d to %d", ErrSourceOutOfRange, start, end)
+	}
+	return m.requestSourceNames(context.Background(), start, end, strictSync)
+}
+
+func (m *MagnumRouter) requestSourceNames(ctx context.Context, start uint, end uint, handle syncErrorHandler) error {
+	if querier, ok := m.conn.(NameRangeQuerier); ok {
+		return m.runSync(ctx, 1, func(int) syncQuery {
+			return syncQuery{
+				desc: fmt.Sprintf("source %d to %d names", start, end),
+				send: func() error { return m.sendQuery(func() error { return querier.GetSourceNameRange(start, end) }) },
+				unknown: func() {
+					for src := start; src <= end; src++ {
+						m.sourceNames[src] = ""
+					}
+				},
+			}
+		}, handle)
+	}
+	return m.runSync(ctx, int(end-start+1), func(i int) syncQuery {
+		src := start + uint(i)
+		return syncQuery{
+			desc:    fmt.Sprintf("source %d name", src),
+			send:    func() error { return m.sendQuery(func() error { return m.conn.GetSourceName(src) }) },
+			unknown: func() { m.sourceNames[src] = "" },
+		}
+	}, handle)
+}
+
+// Request all destination names from Magnum
+// Results are cached and can be accessed via MagnumRouter.GetDestinationNameTable() or MagnumRouter.GetDestinationName(destination)
+func (m *MagnumRouter) RequestAllDestinationNames() error {
+	return m.requestAllDestinationNames(context.Background(), strictSync)
+}
+
+func (m *MagnumRouter) requestAllDestinationNames(ctx context.Context, handle syncErrorHandler) error {
+	_, destinations, _ := m.counts()
+	if destinations == 0 {
+		return nil
+	}
+	return m.requestDestinationNames(ctx, m.base(), m.base()+destinations-1, handle)
+}
+
+// Request the names of destinations start to end inclusive from Magnum
+// Uses a single range query when the connection implements NameRangeQuerier, otherwise one query per destination
+// Returns ErrDestinationOutOfRange without sending anything if the range is empty or not configured
+func (m *MagnumRouter) RequestDestinationNamesRange(start uint, end uint) error {
+	_, destinations, _ := m.counts()
+	if start < m.base() || start > end || end >= m.base()+destinations {
+		return fmt.Errorf("%w: range %d to %d", ErrDestinationOutOfRange, start, end)
+	}
+	return m.requestDestinationNames(context.Background(), start, end, strictSync)
+}
+
+func (m *MagnumRouter) requestDestinationNames(ctx context.Context, start uint, end uint, handle syncErrorHandler) error {
+	if querier, ok := m.conn.(NameRangeQuerier); ok {
+		return m.runSync(ctx, 1, func(int) syncQuery {
+			return syncQuery{
+				desc: fmt.Sprintf("destination %d to %d names", start, end),
+				send: func() error { return m.sendQuery(func() error { return querier.GetDestinationNameRange(start, end) }) },
+				unknown: func() {
+					for dest := start; dest <= end; dest++ {
+						m.destinationNames[dest] = ""
+					}
+				},
+			}
+		}, handle)
+	}
+	return m.runSync(ctx, int(end-start+1), func(i int) syncQuery {
+		dest := start + uint(i)
+		return syncQuery{
+			desc:    fmt.Sprintf("destination %d name", dest),
+			send:    func() error { return m.sendQuery(func() error { return m.conn.GetDestinationName(dest) }) },
+			unknown: func() { m.destinationNames[dest] = "" },
+		}
+	}, handle)
+}
+
+// Re-queries the names of the given sources, such as after an external system reports them renamed
+// Queries are sent with the configured sync concurrency, and name change events fire as responses arrive
+// All IDs are validated before anything is sent, and every query is attempted with failures returned together
+func (m *MagnumRouter) RefreshSourceNames(ctx context.Context, ids []uint) error {
+	errs := []error{}
+	for _, id := range ids {
+		if err := m.checkSource(id); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	if len(errs) > 0 {
+		return errors.Join(errs...)
+	}
+	collect, collected := collectSync()
+	err := m.runSync(ctx, len(ids), func(i int) syncQuery {
+		src := ids[i]
+		return syncQuery{
+			desc:    fmt.Sprintf("source %d name", src),
+			send:    func() error { return m.sendQuery(func() error { return m.conn.GetSourceName(src) }) },
+			unknown: func() { m.sourceNames[src] = "" },
+		}
+	}, collect)
+	return errors.Join(err, collected())
+}
+
+// Re-queries the names of the given destinations, as per RefreshSourceNames()
+func (m *MagnumRouter) RefreshDestinationNames(ctx context.Context, ids []uint) error {
+	errs := []error{}
+	for _, id := range ids {
+		if err := m.checkDestination(id); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	if len(errs) > 0 {
+		return errors.Join(errs...)
+	}
+	collect, collected := collectSync()
+	err := m.runSync(ctx, len(ids), func(i int) syncQuery {
+		dest := ids[i]
+		return syncQuery{
+			desc:    fmt.Sprintf("destination %d name", dest),
+			send:    func() error { return m.sendQuery(func() error { return m.conn.GetDestinationName(dest) }) },
+			unknown: func() { m.destinationNames[dest] = "" },
+		}
+	}, collect)
+	return errors.Join(err, collected())
+}
+
+// Returns a handler that lets a sweep continue past failed queries, and a function returning them joined
+func collectSync() (syncErrorHandler, func() error) {
+	mu := sync.Mutex{}
+	errs := []error{}
+	handle := func(err error) error {
+		mu.Lock()
+		defer mu.Unlock()
+		errs = append(errs, err)
+		return nil
+	}
+	collected := func() error {
+		mu.Lock()
+		defer mu.Unlock()
+		return errors.Join(errs...)
+	}
+	return handle, collected
+}
+
+// Request all destination locks from Magnum
+// Results are cached and can be accessed via MagnumRouter.GetDestinationLockTable() or MagnumRouter.GetDestinationLock(destination)
+func (m *MagnumRouter) RequestAllDestinationLocks() error {
+	return m.requestAllDestinationLocks(context.Background(), strictSync)
+}
+
+func (m *MagnumRouter) requestAllDestinationLocks(ctx context.Context, handle syncErrorHandler) error {
+	_, destinations, _ := m.counts()
+	return m.runSync(ctx, int(destinations), func(i int) syncQuery {
+		dest := m.base() + uint(i)
+		return syncQuery{
+			desc:    fmt.Sprintf("destination %d lock", dest),
+			send:    func() error { return m.sendQuery(func() error { return m.conn.GetDestinationLock(dest) }) },
+			unknown: func() { m.destinationLocks[dest] = false },
+		}
+	}, handle)
+}
+
+// Request all routes from Magnum
+// Results are cached and can be accessed via MagnumRouter.GetRouteTable() or MagnumRouter.GetRoute(levels, destination)
+func (m *MagnumRouter) RequestAllRoutes() error {
+	return m.requestAllRoutes(context.Background(), strictSync)
+}
+
+func (m *MagnumRouter) requestAllRoutes(ctx context.Context, handle syncErrorHandler) error {
+	_, _, levelCount := m.counts()
+	levels := make([]uint, levelCount)
+	for i := range levels {
+		levels[i] = uint(i)
+	}
+	return m.requestRoutes(ctx, levels, handle)
+}
+
+// Request routes of every destination on only the given levels from Magnum
+// Reduces traffic when auditing a subset of levels, such as audio only
+// Returns ErrLevelOutOfRange without sending anything if any level is not configured
+func (m *MagnumRouter) RequestRoutesForLevels(levels []uint) error {
+	for _, lvl := range levels {
+		if err := m.checkLevel(lvl); err != nil {
+			return err
+		}
+	}
+	return m.requestRoutes(context.Background(), levels, strictSync)
+}
+
+func (m *MagnumRouter) requestRoutes(ctx context.Context, levels []uint, handle syncErrorHandler) error {
+	_, destinations, _ := m.counts()
+	return m.runSync(ctx, int(destinations)*len(levels), func(i int) syncQuery {
+		dest := m.base() + uint(i/len(levels))
+		lvl := levels[i%len(levels)]
+		return syncQuery{
+			desc: fmt.Sprintf("destination %d level %d route", dest, lvl),
+			send: func() error {
+				quartzLevel, ok := idToQuartzLevel(lvl)
+				if !ok {
+					return fmt.Errorf("%w: %d", ErrLevelOutOfRange, lvl)
+				}
+				return m.sendQuery(func() error { return m.conn.GetRoute(quartzLevel, dest) })
+			},
+			unknown: func() { m.routes.set(dest, lvl, SourceUnknown) },
+		}
+	}, handle)
+}
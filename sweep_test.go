@@ -0,0 +1,470 @@
+package magnumrouter
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/cassaram/quartz"
+)
+
+// A FakeConn failing to send route queries for some destinations
+type failRouteConn struct {
+	*FakeConn
+	fail uint
+	// Further destinations to fail
+	more []uint
+}
+
+func (c *failRouteConn) GetRoute(level quartz.QuartzLevel, dest uint) error {
+	if dest == c.fail {
+		return errors.New("write failed")
+	}
+	for _, fail := range c.more {
+		if dest == fail {
+			return errors.New("write failed")
+		}
+	}
+	return c.FakeConn.GetRoute(level, dest)
+}
+
+// A FakeConn taking delay to send each route query, tracking the most queries sent at once
+type slowRouteConn struct {
+	*FakeConn
+	delay   time.Duration
+	mu      sync.Mutex
+	current int
+	peak    int
+}
+
+func (c *slowRouteConn) GetRoute(level quartz.QuartzLevel, dest uint) error {
+	c.mu.Lock()
+	c.current++
+	if c.current > c.peak {
+		c.peak = c.current
+	}
+	c.mu.Unlock()
+	time.Sleep(c.delay)
+	c.mu.Lock()
+	c.current--
+	c.mu.Unlock()
+	return c.FakeConn.GetRoute(level, dest)
+}
+
+func TestSyncStrictFailsConnect(t *testing.T) {
+	m := NewMagnumRouterWithConn(&failRouteConn{FakeConn: NewFakeConn(3, 3), fail: 2}, 3, 3, 1)
+	defer m.Close()
+	if err := m.Connect(); err == nil {
+		t.Fatal("Connect() succeeded despite a failed query")
+	}
+	if got := m.State(); got != StateDisconnected {
+		t.Errorf("State() = %v, want disconnected", got)
+	}
+}
+
+func TestSyncBestEffortRecordsErrors(t *testing.T) {
+	fake := NewFakeConn(3, 3)
+	for dest := uint(1); dest <= 3; dest++ {
+		fake.routes[crosspoint{destination: dest, level: 0}] = 1
+	}
+	m := NewMagnumRouterWithConn(&failRouteConn{FakeConn: fake, fail: 2}, 3, 3, 1, WithSyncErrorPolicy(SyncBestEffort))
+	defer m.Close()
+	if err := m.Connect(); err != nil {
+		t.Fatalf("Connect() = %v, want nil in best-effort mode", err)
+	}
+	if got := m.State(); got != StateConnected {
+		t.Errorf("State() = %v, want connected", got)
+	}
+	if errs := m.SyncErrors(); len(errs) != 1 {
+		t.Errorf("SyncErrors() = %v, want one error", errs)
+	}
+	eventually(t, func() bool { return m.GetRoute(0, 3) == 1 })
+	if got := m.GetRoute(0, 1); got != 1 {
+		t.Errorf("GetRoute(0, 1) = %d, want 1", got)
+	}
+	if got := m.GetRoute(0, 2); got != SourceUnknown {
+		t.Errorf("GetRoute(0, 2) = %d, want SourceUnknown", got)
+	}
+}
+
+func TestSyncConcurrencyAggregatesErrors(t *testing.T) {
+	conn := &failRouteConn{FakeConn: NewFakeConn(2, 40), fail: 7, more: []uint{19, 33}}
+	m := NewMagnumRouterWithConn(conn, 2, 40, 2, WithSyncConcurrency(8), WithSyncErrorPolicy(SyncBestEffort))
+	defer m.Close()
+	if err := m.Connect(); err != nil {
+		t.Fatalf("Connect() = %v", err)
+	}
+	// Each failing destination fails on both levels
+	if errs := m.SyncErrors(); len(errs) != 6 {
+		t.Errorf("SyncErrors() = %v, want 6 errors", errs)
+	}
+}
+
+func TestSyncConcurrencyBounded(t *testing.T) {
+	conn := &slowRouteConn{FakeConn: NewFakeConn(1, 30), delay: 2 * time.Millisecond}
+	m := NewMagnumRouterWithConn(conn, 1, 30, 1, WithSyncConcurrency(4))
+	defer m.Close()
+	if err := m.Connect(); err != nil {
+		t.Fatalf("Connect() = %v", err)
+	}
+	conn.mu.Lock()
+	defer conn.mu.Unlock()
+	if conn.peak > 4 || conn.peak < 2 {
+		t.Errorf("peak of %d queries at once, want between 2 and the limit of 4", conn.peak)
+	}
+}
+
+// A FakeConn answering one query every delay, tracking the most queries awaiting a response at once
+type laggingConn struct {
+	*FakeConn
+	delay       time.Duration
+	rx          chan quartz.QuartzResponse
+	mu          sync.Mutex
+	outstanding int
+	peak        int
+}
+
+func newLaggingConn(sources uint, destinations uint, delay time.Duration) *laggingConn {
+	c := &laggingConn{FakeConn: NewFakeConn(sources, destinations), delay: delay, rx: make(chan quartz.QuartzResponse, 1024)}
+	go func() {
+		for msg := range c.FakeConn.RxMessages() {
+			time.Sleep(c.delay)
+			c.mu.Lock()
+			c.outstanding--
+			c.mu.Unlock()
+			c.rx <- msg
+		}
+	}()
+	return c
+}
+
+func (c *laggingConn) query(send func() error) error {
+	c.mu.Lock()
+	c.outstanding++
+	c.peak = max(c.peak, c.outstanding)
+	c.mu.Unlock()
+	return send()
+}
+
+func (c *laggingConn) GetSourceName(src uint) error {
+	return c.query(func() error { return c.FakeConn.GetSourceName(src) })
+}
+
+func (c *laggingConn) GetDestinationName(dest uint) error {
+	return c.query(func() error { return c.FakeConn.GetDestinationName(dest) })
+}
+
+func (c *laggingConn) GetDestinationLock(dest uint) error {
+	return c.query(func() error { return c.FakeConn.GetDestinationLock(dest) })
+}
+
+func (c *laggingConn) GetRoute(level quartz.QuartzLevel, dest uint) error {
+	return c.query(func() error { return c.FakeConn.GetRoute(level, dest) })
+}
+
+func (c *laggingConn) RxMessages() <-chan quartz.QuartzResponse {
+	return c.rx
+}
+
+func (c *laggingConn) maxOutstanding() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.peak
+}
+
+func TestSyncMaxInflight(t *testing.T) {
+	for _, limit := range []int{0, 3} {
+		t.Run(fmt.Sprint("limit ", limit), func(t *testing.T) {
+			conn := newLaggingConn(4, 8, time.Millisecond)
+			m := NewMagnumRouterWithConn(conn, 4, 8, 2, WithSyncMaxInflight(limit))
+			defer m.Close()
+			if err := m.Connect(); err != nil {
+				t.Fatalf("Connect() = %v", err)
+			}
+			eventually(t, func() bool { return m.GetDestinationName(8) != "" })
+			peak := conn.maxOutstanding()
+			if limit > 0 && peak > limit {
+				t.Errorf("peak of %d queries awaiting a response, want at most %d", peak, limit)
+			}
+			// Without a cap the sync runs well ahead of the device
+			if limit == 0 && peak <= 3 {
+				t.Errorf("peak of %d queries awaiting a response without a cap, want more than 3", peak)
+			}
+		})
+	}
+}
+
+func TestSyncRespectsContext(t *testing.T) {
+	conn := &slowRouteConn{FakeConn: NewFakeConn(1, 100), delay: 5 * time.Millisecond}
+	m := NewMagnumRouterWithConn(conn, 1, 100, 1, WithSyncConcurrency(2))
+	defer m.Close()
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	if err := m.ConnectContext(ctx); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("ConnectContext() = %v, want the deadline", err)
+	}
+}
+
+// Sync of a frame over a link taking 100µs to send each query
+func BenchmarkSyncConcurrency(b *testing.B) {
+	for _, n := range []int{1, 4, 16} {
+		b.Run(fmt.Sprintf("concurrency=%d", n), func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				conn := &slowRouteConn{FakeConn: NewFakeConn(4, 64), delay: 100 * time.Microsecond}
+				m := NewMagnumRouterWithConn(conn, 4, 64, 4, WithSyncConcurrency(n))
+				if err := m.Connect(); err != nil {
+					b.Fatal(err)
+				}
+				m.Close()
+			}
+		})
+	}
+}
+
+func TestRequestRoutesForLevels(t *testing.T) {
+	m, conn := newScriptRouter(t, 2, 3, 3)
+	if err := m.RequestRoutesForLevels([]uint{2, 0}); err != nil {
+		t.Fatalf("RequestRoutesForLevels(): %v", err)
+	}
+	want := []string{
+		"connect",
+		"get route B 1", "get route V 1",
+		"get route B 2", "get route V 2",
+		"get route B 3", "get route V 3",
+	}
+	if got := conn.recorded(); !reflect.DeepEqual(got, want) {
+		t.Errorf("sent %v, want %v", got, want)
+	}
+}
+
+func TestRequestRoutesForLevelsValidates(t *testing.T) {
+	m, conn := newScriptRouter(t, 2, 3, 2)
+	if err := m.RequestRoutesForLevels([]uint{0, 2}); !errors.Is(err, ErrLevelOutOfRange) {
+		t.Errorf("RequestRoutesForLevels() = %v, want ErrLevelOutOfRange", err)
+	}
+	if err := m.RequestRoutesForLevels(nil); err != nil {
+		t.Errorf("RequestRoutesForLevels(nil) = %v, want nil", err)
+	}
+	if got := conn.recorded(); len(got) != 1 {
+		t.Errorf("sent %v, want nothing after connecting", got)
+	}
+}
+
+// A scriptConn able to query names by range
+type rangeConn struct {
+	*scriptConn
+}
+
+func (c rangeConn) GetSourceNameRange(start uint, end uint) error {
+	return c.record("get sources %d-%d", start, end)
+}
+
+func (c rangeConn) GetDestinationNameRange(start uint, end uint) error {
+	return c.record("get destinations %d-%d", start, end)
+}
+
+func TestNameRangeBatched(t *testing.T) {
+	conn := rangeConn{newScriptConn()}
+	m := NewMagnumRouterWithConn(conn, 5, 4, 1, WithNoInitialSync())
+	if err := m.Connect(); err != nil {
+		t.Fatalf("connect: %v", err)
+	}
+	defer m.Close()
+	if err := m.RequestSourceNamesRange(2, 4); err != nil {
+		t.Fatalf("RequestSourceNamesRange(): %v", err)
+	}
+	if err := m.RequestAllDestinationNames(); err != nil {
+		t.Fatalf("RequestAllDestinationNames(): %v", err)
+	}
+	want := []string{"connect", "get sources 2-4", "get destinations 1-4"}
+	if got := conn.recorded(); !reflect.DeepEqual(got, want) {
+		t.Errorf("sent %v, want %v", got, want)
+	}
+}
+
+func TestNameRangeFallback(t *testing.T) {
+	m, conn := newScriptRouter(t, 5, 4, 1)
+	if err := m.RequestSourceNamesRange(2, 4); err != nil {
+		t.Fatalf("RequestSourceNamesRange(): %v", err)
+	}
+	if err := m.RequestDestinationNamesRange(3, 3); err != nil {
+		t.Fatalf("RequestDestinationNamesRange(): %v", err)
+	}
+	want := []string{"connect", "get source 2", "get source 3", "get source 4", "get destination 3"}
+	if got := conn.recorded(); !reflect.DeepEqual(got, want) {
+		t.Errorf("sent %v, want %v", got, want)
+	}
+}
+
+func TestNameRangeValidated(t *testing.T) {
+	m, conn := newScriptRouter(t, 5, 4, 1)
+	ranges := [][2]uint{{0, 2}, {3, 2}, {4, 6}}
+	for _, r := range ranges {
+		if err := m.RequestSourceNamesRange(r[0], r[1]); !errors.Is(err, ErrSourceOutOfRange) {
+			t.Errorf("RequestSourceNamesRange(%d, %d) = %v, want ErrSourceOutOfRange", r[0], r[1], err)
+		}
+	}
+	if err := m.RequestDestinationNamesRange(1, 5); !errors.Is(err, ErrDestinationOutOfRange) {
+		t.Errorf("RequestDestinationNamesRange(1, 5) = %v, want ErrDestinationOutOfRange", err)
+	}
+	if got := conn.recorded(); len(got) != 1 {
+		t.Errorf("sent %v, want nothing after connecting", got)
+	}
+}
+
+func TestSweepsFollowIndexBase(t *testing.T) {
+	tests := []struct {
+		base uint
+		want []string
+	}{
+		{0, []string{
+			"get source 0", "get source 1",
+			"get destination 0", "get destination 1",
+			"get lock 0", "get lock 1",
+			"get route V 0", "get route V 1",
+		}},
+		{1, []string{
+			"get source 1", "get source 2",
+			"get destination 1", "get destination 2",
+			"get lock 1", "get lock 2",
+			"get route V 1", "get route V 2",
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(fmt.Sprint("base ", tt.base), func(t *testing.T) {
+			m, conn := newScriptRouter(t, 2, 2, 1, WithIndexBase(tt.base))
+			sweeps := []func() error{m.RequestAllSourceNames, m.RequestAllDestinationNames, m.RequestAllDestinationLocks, m.RequestAllRoutes}
+			for _, sweep := range sweeps {
+				if err := sweep(); err != nil {
+					t.Fatalf("sweep: %v", err)
+				}
+			}
+			if got := conn.recorded()[1:]; !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("sent %v, want %v", got, tt.want)
+			}
+			if got := len(m.GetSourceNameTable()); got != int(tt.base)+2 {
+				t.Errorf("source name table has %d entries, want %d", got, tt.base+2)
+			}
+			if got := len(m.GetRouteTable()); got != int(tt.base)+2 {
+				t.Errorf("route table has %d entries, want %d", got, tt.base+2)
+			}
+		})
+	}
+}
+
+func TestReserveZeroDisabled(t *testing.T) {
+	m, conn := newScriptRouter(t, 2, 2, 1, WithReserveZero(false))
+	m.processMessage(&quartz.ResponseReadSource{Source: 0, Name: "BARS"})
+	m.processMessage(&quartz.ResponseReadDestination{Destination: 0, Name: "PGM"})
+	m.processMessage(&quartz.ResponseLockStatus{Destination: 0, Locked: true})
+	m.processMessage(update(0, 1))
+	if got := m.GetSourceName(0); got != "BARS" {
+		t.Errorf("GetSourceName(0) = %q, want BARS", got)
+	}
+	if got := m.GetDestinationName(0); got != "PGM" {
+		t.Errorf("GetDestinationName(0) = %q, want PGM", got)
+	}
+	if !m.GetDestinationLocked(0) {
+		t.Error("destination 0 not locked")
+	}
+	if got := m.GetRoute(0, 0); got != 1 {
+		t.Errorf("GetRoute(0, 0) = %d, want 1", got)
+	}
+	if got := len(m.GetDestinationNameTable()); got != 2 {
+		t.Errorf("destination name table has %d entries, want 2", got)
+	}
+
+	m.processMessage(&quartz.ResponseLockStatus{Destination: 0, Locked: false})
+	if err := m.SetRoute([]uint{0}, 1, 0); err != nil {
+		t.Errorf("SetRoute() to destination 1 = %v", err)
+	}
+	if err := m.SetRoute([]uint{0}, 2, 0); !errors.Is(err, ErrDestinationOutOfRange) {
+		t.Errorf("SetRoute() to destination 2 = %v, want ErrDestinationOutOfRange", err)
+	}
+	if got, want := conn.recorded()[1:], []string{"route [V] 1 0"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("sent %q, want %q", got, want)
+	}
+}
+
+func TestReserveZeroDefault(t *testing.T) {
+	m, _ := newScriptRouter(t, 2, 2, 1, WithReserveZero(true))
+	if err := m.SetRoute([]uint{0}, 2, 1); err != nil {
+		t.Errorf("SetRoute() to destination 2 = %v", err)
+	}
+	if got := len(m.GetDestinationNameTable()); got != 3 {
+		t.Errorf("destination name table has %d entries, want 3", got)
+	}
+}
+
+// A FakeConn failing to send name queries for one source
+type failNameConn struct {
+	*FakeConn
+	fail uint
+}
+
+func (c *failNameConn) GetSourceName(src uint) error {
+	if src == c.fail {
+		return errors.New("write failed")
+	}
+	return c.FakeConn.GetSourceName(src)
+}
+
+func TestRefreshSourceNamesOneFailing(t *testing.T) {
+	fake := NewFakeConn(4, 2)
+	conn := &failNameConn{FakeConn: fake}
+	m := NewMagnumRouterWithConn(conn, 4, 2, 1, WithSyncConcurrency(2))
+	if err := m.Connect(); err != nil {
+		t.Fatalf("connect: %v", err)
+	}
+	defer m.Close()
+	eventually(t, func() bool { return m.GetSourceName(4) == "SRC 4" })
+	events, unsubscribe := m.Subscribe()
+	defer unsubscribe()
+
+	// Renamed on the device, as by an external system
+	for _, src := range []uint{1, 2, 3} {
+		fake.WriteSourceName(src, fmt.Sprintf("CAM %d", src))
+	}
+	conn.fail = 2
+	err := m.RefreshSourceNames(context.Background(), []uint{1, 2, 3})
+	if err == nil || !strings.Contains(err.Error(), "source 2 name") {
+		t.Fatalf("RefreshSourceNames() = %v, want the failure of source 2", err)
+	}
+	eventually(t, func() bool { return m.GetSourceName(1) == "CAM 1" && m.GetSourceName(3) == "CAM 3" })
+	if got := m.GetSourceName(2); got != "" {
+		t.Errorf("GetSourceName(2) after a failed refresh = %q, want unknown", got)
+	}
+	renamed := map[uint]string{}
+	for len(renamed) < 2 {
+		select {
+		case ev := <-events:
+			if ev.Type == EventSourceNameChange {
+				renamed[ev.Source] = ev.Name
+			}
+		case <-time.After(time.Second):
+			t.Fatalf("name change events %v, want sources 1 and 3", renamed)
+		}
+	}
+	if want := map[uint]string{1: "CAM 1", 3: "CAM 3"}; !reflect.DeepEqual(renamed, want) {
+		t.Errorf("name change events %v, want %v", renamed, want)
+	}
+}
+
+func TestRefreshNamesValidatesIDs(t *testing.T) {
+	m, conn := newScriptRouter(t, 4, 2, 1)
+	err := m.RefreshSourceNames(context.Background(), []uint{1, 5, 6})
+	if !errors.Is(err, ErrSourceOutOfRange) || !strings.Contains(err.Error(), "5") || !strings.Contains(err.Error(), "6") {
+		t.Errorf("RefreshSourceNames() = %v, want both IDs out of range", err)
+	}
+	if err := m.RefreshDestinationNames(context.Background(), []uint{3}); !errors.Is(err, ErrDestinationOutOfRange) {
+		t.Errorf("RefreshDestinationNames() = %v, want ErrDestinationOutOfRange", err)
+	}
+	if got := conn.recorded(); len(got) != 1 {
+		t.Errorf("sent %v, want nothing after connecting", got)
+	}
+}
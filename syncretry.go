@@ -0,0 +1,68 @@
+package magnumrouter
+
+import "context"
+
+// Returns the number of queries that failed during the last best-effort sync and have not yet been resent
+// WithSyncRetry() resends them in the background, this reaching 0 once all have been sent
+func (m *MagnumRouter) UnsyncedCount() int {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	return len(m.failedQueries)
+}
+
+// Starts resending failed sync queries in the background when WithSyncRetry() is set and there are any
+func (m *MagnumRouter) startSyncRetry() {
+	if m.opts.syncRetryInterval <= 0 || m.UnsyncedCount() == 0 {
+		return
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	m.stateMu.Lock()
+	if m.syncRetryCancel != nil {
+		m.syncRetryCancel()
+	}
+	m.syncRetryCancel = cancel
+	m.stateMu.Unlock()
+	go m.retryFailedQueries(ctx)
+}
+
+// Stops resending failed sync queries, leaving those not yet sent counted by UnsyncedCount()
+func (m *MagnumRouter) stopSyncRetry() {
+	m.stateMu.Lock()
+	defer m.stateMu.Unlock()
+	if m.syncRetryCancel != nil {
+		m.syncRetryCancel()
+		m.syncRetryCancel = nil
+	}
+}
+
+func (m *MagnumRouter) retryFailedQueries(ctx context.Context) {
+	for attempt := 1; m.opts.syncRetryMax == 0 || attempt <= m.opts.syncRetryMax; attempt++ {
+		if sleep(ctx, m.opts.clock, m.opts.syncRetryInterval) != nil {
+			return
+		}
+		m.mu.Lock()
+		pending := m.failedQueries
+		m.failedQueries = nil
+		m.mu.Unlock()
+
+		failed := []syncQuery{}
+		for _, q := range pending {
+			if ctx.Err() != nil {
+				failed = append(failed, q)
+				continue
+			}
+			if err := q.send(); err != nil {
+				failed = append(failed, q)
+			}
+		}
+		m.mu.Lock()
+		// A resync may have recorded new failures meanwhile, keep those too
+		m.failedQueries = append(failed, m.failedQueries...)
+		remaining := len(m.failedQueries)
+		m.mu.Unlock()
+		m.opts.logger.Info("magnum sync retry", "attempt", attempt, "sent", len(pending)-len(failed), "remaining", remaining)
+		if remaining == 0 {
+			return
+		}
+	}
+}
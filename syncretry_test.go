@@ -0,0 +1,111 @@
+package magnumrouter
+
+import (
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/cassaram/quartz"
+)
+
+// A FakeConn failing to send route queries for one destination until healed
+type healingConn struct {
+	*FakeConn
+	mu     sync.Mutex
+	fail   uint
+	healed bool
+}
+
+func (c *healingConn) GetRoute(level quartz.QuartzLevel, dest uint) error {
+	c.mu.Lock()
+	failing := dest == c.fail && !c.healed
+	c.mu.Unlock()
+	if failing {
+		return errors.New("write failed")
+	}
+	return c.FakeConn.GetRoute(level, dest)
+}
+
+func (c *healingConn) heal() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.healed = true
+}
+
+// Returns a best-effort router whose sync failed the route query of destination 2, retried on a fake clock
+func newSyncRetryRouter(t *testing.T, max int) (*MagnumRouter, *healingConn, *fakeClock) {
+	t.Helper()
+	fake := NewFakeConn(3, 3)
+	fake.routes[crosspoint{destination: 2, level: 0}] = 3
+	conn := &healingConn{FakeConn: fake, fail: 2}
+	clock := newFakeClock()
+	m := NewMagnumRouterWithConn(conn, 3, 3, 1, WithSyncErrorPolicy(SyncBestEffort), WithSyncRetry(time.Second, max), WithClock(clock))
+	if err := m.Connect(); err != nil {
+		t.Fatalf("connect: %v", err)
+	}
+	t.Cleanup(func() { m.Close() })
+	if got := m.UnsyncedCount(); got != 1 {
+		t.Fatalf("UnsyncedCount() = %d after the sync, want 1", got)
+	}
+	return m, conn, clock
+}
+
+// Advances the clock past the next retry once it is waiting
+func nextRetry(t *testing.T, clock *fakeClock) {
+	t.Helper()
+	eventually(t, func() bool { return clock.pending() > 0 })
+	clock.Advance(time.Second)
+}
+
+func TestSyncRetryHeals(t *testing.T) {
+	m, conn, clock := newSyncRetryRouter(t, 0)
+	events, unsubscribe := m.Subscribe()
+	defer unsubscribe()
+
+	// Still failing, so kept for the next retry
+	nextRetry(t, clock)
+	eventually(t, func() bool { return clock.pending() > 0 })
+	if got := m.UnsyncedCount(); got != 1 {
+		t.Fatalf("UnsyncedCount() = %d after a failed retry, want 1", got)
+	}
+
+	conn.heal()
+	nextRetry(t, clock)
+	eventually(t, func() bool { return m.UnsyncedCount() == 0 })
+	eventually(t, func() bool { return m.GetRoute(0, 2) == 3 })
+	// Responses to the initial sync may still be arriving, so their events are skipped
+	deadline := time.After(time.Second)
+	for healed := false; !healed; {
+		select {
+		case ev := <-events:
+			if ev.Type != EventRouteChange || ev.Destination != 2 {
+				continue
+			}
+			if ev.Source != 3 {
+				t.Errorf("event %+v, want the healed route to source 3", ev)
+			}
+			healed = true
+		case <-deadline:
+			t.Fatal("no event for the healed route")
+		}
+	}
+	// Nothing left to retry
+	time.Sleep(20 * time.Millisecond)
+	if got := clock.pending(); got != 0 {
+		t.Errorf("%d timers pending once healed, want none", got)
+	}
+}
+
+func TestSyncRetryCapped(t *testing.T) {
+	m, _, clock := newSyncRetryRouter(t, 2)
+	nextRetry(t, clock)
+	nextRetry(t, clock)
+	time.Sleep(20 * time.Millisecond)
+	if got := clock.pending(); got != 0 {
+		t.Errorf("%d timers pending after the last retry, want none", got)
+	}
+	if got := m.UnsyncedCount(); got != 1 {
+		t.Errorf("UnsyncedCount() = %d, want the query still unsynced", got)
+	}
+}
@@ -0,0 +1,104 @@
+package magnumrouter
+
+import "sort"
+
+// Replaces the metadata tags of a source, such as category or location
+// Tags are held by the library only and never sent to the device, empty tags remove all tags
+// Returns ErrSourceOutOfRange if the source is not configured
+func (m *MagnumRouter) SetSourceTags(source uint, tags map[string]string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if err := m.checkSourceLocked(source); err != nil {
+		return err
+	}
+	m.sourceTags = setTags(m.sourceTags, source, tags)
+	m.generation++
+	return nil
+}
+
+// Replaces the metadata tags of a destination, as per SetSourceTags()
+// Returns ErrDestinationOutOfRange if the destination is not configured
+func (m *MagnumRouter) SetDestinationTags(destination uint, tags map[string]string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if err := m.checkDestinationLocked(destination); err != nil {
+		return err
+	}
+	m.destinationTags = setTags(m.destinationTags, destination, tags)
+	m.generation++
+	return nil
+}
+
+// Returns a copy of the tags of a source, nil if it has none
+func (m *MagnumRouter) GetSourceTags(source uint) map[string]string {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	return copyTags(m.sourceTags[source])
+}
+
+// Returns a copy of the tags of a destination, nil if it has none
+func (m *MagnumRouter) GetDestinationTags(destination uint) map[string]string {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	return copyTags(m.destinationTags[destination])
+}
+
+// Returns the sources with a tag set to value, in ID order
+func (m *MagnumRouter) SourcesByTag(key string, value string) []uint {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	return idsByTag(m.sourceTags, key, value)
+}
+
+// Returns the destinations with a tag set to value, in ID order
+func (m *MagnumRouter) DestinationsByTag(key string, value string) []uint {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	return idsByTag(m.destinationTags, key, value)
+}
+
+func setTags(all map[uint]map[string]string, id uint, tags map[string]string) map[uint]map[string]string {
+	if len(tags) == 0 {
+		delete(all, id)
+		return all
+	}
+	if all == nil {
+		all = map[uint]map[string]string{}
+	}
+	all[id] = copyTags(tags)
+	return all
+}
+
+func copyTags(tags map[string]string) map[string]string {
+	if len(tags) == 0 {
+		return nil
+	}
+	copied := make(map[string]string, len(tags))
+	for k, v := range tags {
+		copied[k] = v
+	}
+	return copied
+}
+
+// Returns a deep copy of a set of tags by ID, nil if there are none
+func copyAllTags(all map[uint]map[string]string) map[uint]map[string]string {
+	if len(all) == 0 {
+		return nil
+	}
+	copied := make(map[uint]map[string]string, len(all))
+	for id, tags := range all {
+		copied[id] = copyTags(tags)
+	}
+	return copied
+}
+
+func idsByTag(all map[uint]map[string]string, key string, value string) []uint {
+	ids := []uint{}
+	for id, tags := range all {
+		if v, ok := tags[key]; ok && v == value {
+			ids = append(ids, id)
+		}
+	}
+	sort.Slice(ids, func(i, j int) bool { return ids[i] < ids[j] })
+	return ids
+}
@@ -0,0 +1,68 @@
+package magnumrouter
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+)
+
+func TestTags(t *testing.T) {
+	m := NewMagnumRouterWithConn(NewFakeConn(4, 4), 4, 4, 1)
+	tags := map[string]string{"category": "camera", "location": "studio A"}
+	if err := m.SetSourceTags(1, tags); err != nil {
+		t.Fatalf("SetSourceTags(): %v", err)
+	}
+	m.SetSourceTags(3, map[string]string{"category": "camera"})
+	m.SetSourceTags(2, map[string]string{"category": "graphics"})
+	m.SetDestinationTags(4, map[string]string{"color": "red"})
+
+	// Stored as a copy
+	tags["category"] = "changed"
+	if got := m.GetSourceTags(1); !reflect.DeepEqual(got, map[string]string{"category": "camera", "location": "studio A"}) {
+		t.Errorf("GetSourceTags(1) = %v", got)
+	}
+	if got := m.SourcesByTag("category", "camera"); !reflect.DeepEqual(got, []uint{1, 3}) {
+		t.Errorf("SourcesByTag() = %v, want [1 3]", got)
+	}
+	if got := m.DestinationsByTag("color", "red"); !reflect.DeepEqual(got, []uint{4}) {
+		t.Errorf("DestinationsByTag() = %v, want [4]", got)
+	}
+	if got := m.SourcesByTag("category", "audio"); len(got) != 0 {
+		t.Errorf("SourcesByTag() of an unused value = %v, want empty", got)
+	}
+
+	// Empty tags remove all tags
+	m.SetSourceTags(3, nil)
+	if got := m.GetSourceTags(3); got != nil {
+		t.Errorf("GetSourceTags(3) after clearing = %v, want nil", got)
+	}
+	if got := m.SourcesByTag("category", "camera"); !reflect.DeepEqual(got, []uint{1}) {
+		t.Errorf("SourcesByTag() after clearing = %v, want [1]", got)
+	}
+}
+
+func TestTagsOutOfRange(t *testing.T) {
+	m := NewMagnumRouterWithConn(NewFakeConn(4, 4), 4, 4, 1)
+	if err := m.SetSourceTags(5, map[string]string{"a": "b"}); !errors.Is(err, ErrSourceOutOfRange) {
+		t.Errorf("SetSourceTags(5) = %v, want ErrSourceOutOfRange", err)
+	}
+	if err := m.SetDestinationTags(5, map[string]string{"a": "b"}); !errors.Is(err, ErrDestinationOutOfRange) {
+		t.Errorf("SetDestinationTags(5) = %v, want ErrDestinationOutOfRange", err)
+	}
+}
+
+func TestTagsInSnapshot(t *testing.T) {
+	m := NewMagnumRouterWithConn(NewFakeConn(4, 4), 4, 4, 1)
+	m.SetSourceTags(2, map[string]string{"category": "camera"})
+	m.SetDestinationTags(1, map[string]string{"color": "red"})
+	restored := NewMagnumRouterWithConn(NewFakeConn(4, 4), 4, 4, 1)
+	if err := restored.ImportState(m.ExportState()); err != nil {
+		t.Fatalf("ImportState(): %v", err)
+	}
+	if got := restored.SourcesByTag("category", "camera"); !reflect.DeepEqual(got, []uint{2}) {
+		t.Errorf("restored SourcesByTag() = %v, want [2]", got)
+	}
+	if got := restored.GetDestinationTags(1); !reflect.DeepEqual(got, map[string]string{"color": "red"}) {
+		t.Errorf("restored GetDestinationTags(1) = %v", got)
+	}
+}
@@ -0,0 +1,232 @@
+package magnumrouter
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"text/tabwriter"
+)
+
+// Selects how endpoints are labelled in text output
+type TextLabel int
+
+const (
+	// Label endpoints by name, falling back to the ID when unnamed (default)
+	TextLabelNames TextLabel = iota
+	// Label endpoints by ID only
+	TextLabelIDs
+	// Label endpoints by ID followed by name
+	TextLabelBoth
+)
+
+// Options for MagnumRouter.WriteRouteTableText()
+type TextOpts struct {
+	// How sources and destinations are labelled
+	Label TextLabel
+	// Destinations to include as rows, all destinations if empty
+	Destinations []uint
+	// Levels to include as columns, all levels if empty
+	Levels []uint
+}
+
+// Writes the cached route table as an aligned text table for terminal viewing
+// Rows are destinations and columns are levels, with cells showing the routed source
+// Locked destinations are marked with an L in the LOCK column
+func (m *MagnumRouter) WriteRouteTableText(w io.Writer, opts TextOpts) error {
+	m.mu.RLock()
+	destinations := opts.Destinations
+	if len(destinations) == 0 {
+		for i := int(m.base()); i < len(m.destinationNames); i++ {
+			destinations = append(destinations, uint(i))
+		}
+	}
+	levels := opts.Levels
+	if len(levels) == 0 {
+		for i := uint(0); i < m.levelCount; i++ {
+			levels = append(levels, i)
+		}
+	}
+	for _, dest := range destinations {
+		if err := m.checkDestinationLocked(dest); err != nil {
+			m.mu.RUnlock()
+			return err
+		}
+	}
+	for _, lvl := range levels {
+		if err := m.checkLevelLocked(lvl); err != nil {
+			m.mu.RUnlock()
+			return err
+		}
+	}
+
+	rows := [][]string{}
+	header := []string{"DEST", "LOCK"}
+	for _, lvl := range levels {
+		quartzLevel, ok := idToQuartzLevel(lvl)
+		if !ok {
+			header = append(header, fmt.Sprint(lvl))
+			continue
+		}
+		header = append(header, string(quartzLevel))
+	}
+	rows = append(rows, header)
+	cells := [][]textCell{}
+	for _, dest := range destinations {
+		lock := "-"
+		if m.destinationLocks[dest] {
+			lock = "L"
+		}
+		row := []textCell{{kind: NameDestination, id: dest, name: m.destinationNames[dest]}, {text: lock}}
+		for _, lvl := range levels {
+			src := m.routes.get(dest, lvl)
+			if src == SourceUnknown {
+				row = append(row, textCell{text: "-"})
+				continue
+			}
+			name := ""
+			if src < uint(len(m.sourceNames)) {
+				name = m.sourceNames[src]
+			}
+			row = append(row, textCell{kind: NameSource, id: src, name: name})
+		}
+		cells = append(cells, row)
+	}
+	m.mu.RUnlock()
+
+	// Labels are resolved after unlocking as the name resolver is user code
+	for _, row := range cells {
+		labels := make([]string, len(row))
+		for i, cell := range row {
+			labels[i] = cell.text
+			if cell.text == "" {
+				labels[i] = m.textLabel(opts.Label, cell)
+			}
+		}
+		rows = append(rows, labels)
+	}
+
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	for _, row := range rows {
+		if _, err := fmt.Fprintln(tw, strings.Join(row, "\t")); err != nil {
+			return err
+		}
+	}
+	return tw.Flush()
+}
+
+// A cell of text output, either literal text or an endpoint to be labelled
+type textCell struct {
+	text string
+	kind NameKind
+	id   uint
+	name string
+}
+
+func (m *MagnumRouter) textLabel(label TextLabel, cell textCell) string {
+	switch label {
+	case TextLabelIDs:
+		return fmt.Sprint(cell.id)
+	case TextLabelBoth:
+		name, ok := cell.name, cell.name != ""
+		if !ok {
+			name, ok = m.resolveName(cell.kind, cell.id)
+		}
+		if !ok {
+			return fmt.Sprint(cell.id)
+		}
+		return fmt.Sprintf("%d %s", cell.id, name)
+	}
+	return m.displayName(cell.kind, cell.id, cell.name)
+}
+
+// Returns an operator readable summary of diffs, such as from DiffSnapshots(), with counts followed by one line per change
+// Endpoints and levels are labelled with names from view, which may be nil to label by ID only
+// Route changes are listed by destination then level, followed by lock changes and renames
+func SummarizeDiff(diffs []RouteDiff, view RouterView) string {
+	sorted := append([]RouteDiff{}, diffs...)
+	sort.SliceStable(sorted, func(i, j int) bool {
+		if sorted[i].Kind != sorted[j].Kind {
+			return sorted[i].Kind < sorted[j].Kind
+		}
+		if sorted[i].Destination != sorted[j].Destination {
+			return sorted[i].Destination < sorted[j].Destination
+		}
+		if sorted[i].Level != sorted[j].Level {
+			return sorted[i].Level < sorted[j].Level
+		}
+		return sorted[i].Source < sorted[j].Source
+	})
+
+	counts := map[DiffKind]int{}
+	lines := []string{}
+	for _, d := range sorted {
+		counts[d.Kind]++
+		switch d.Kind {
+		case DiffRoute:
+			lines = append(lines, fmt.Sprintf("Dest %s %s: %s → %s", diffDestination(view, d.Destination), diffLevel(view, d.Level), diffSource(view, d.Before), diffSource(view, d.After)))
+		case DiffLock:
+			state := "unlocked"
+			if d.AfterLocked {
+				state = "locked"
+			}
+			lines = append(lines, fmt.Sprintf("Dest %s %s", diffDestination(view, d.Destination), state))
+		case DiffSourceName:
+			lines = append(lines, fmt.Sprintf("Source %d renamed '%s' → '%s'", d.Source, d.BeforeName, d.AfterName))
+		case DiffDestinationName:
+			lines = append(lines, fmt.Sprintf("Dest %d renamed '%s' → '%s'", d.Destination, d.BeforeName, d.AfterName))
+		}
+	}
+
+	parts := []string{}
+	for _, c := range []struct {
+		kind     DiffKind
+		singular string
+		plural   string
+	}{
+		{DiffRoute, "crosspoint changed", "crosspoints changed"},
+		{DiffLock, "lock toggled", "locks toggled"},
+		{DiffSourceName, "source renamed", "sources renamed"},
+		{DiffDestinationName, "destination renamed", "destinations renamed"},
+	} {
+		switch n := counts[c.kind]; n {
+		case 0:
+		case 1:
+			parts = append(parts, "1 "+c.singular)
+		default:
+			parts = append(parts, fmt.Sprintf("%d %s", n, c.plural))
+		}
+	}
+	if len(parts) == 0 {
+		return "No changes"
+	}
+	return strings.Join(parts, ", ") + "\n" + strings.Join(lines, "\n")
+}
+
+func diffDestination(view RouterView, destination uint) string {
+	if view != nil {
+		if name := view.GetDestinationName(destination); name != "" {
+			return "'" + name + "'"
+		}
+	}
+	return fmt.Sprint(destination)
+}
+
+func diffSource(view RouterView, source uint) string {
+	if source == SourceUnknown {
+		return "unknown"
+	}
+	if view != nil {
+		if name := view.GetSourceName(source); name != "" {
+			return "'" + name + "'"
+		}
+	}
+	return fmt.Sprint(source)
+}
+
+func diffLevel(view RouterView, level uint) string {
+	if view != nil {
+		return view.GetLevelName(level)
+	}
+	return fmt.Sprintf("level %d", level)
+}
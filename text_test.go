@@ -0,0 +1,98 @@
+package magnumrouter
+
+import (
+	"bytes"
+	"flag"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/cassaram/quartz"
+)
+
+var updateGolden = flag.Bool("update", false, "rewrite golden files in testdata")
+
+// Compares got with the golden file testdata/name, rewriting it instead with -update
+func checkGolden(t *testing.T, name string, got []byte) {
+	t.Helper()
+	path := filepath.Join("testdata", name)
+	if *updateGolden {
+		if err := os.WriteFile(path, got, 0o644); err != nil {
+			t.Fatal(err)
+		}
+		return
+	}
+	want, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(got, want) {
+		t.Errorf("%s mismatch\ngot:\n%s\nwant:\n%s", name, got, want)
+	}
+}
+
+func TestWriteRouteTableTextGolden(t *testing.T) {
+	m := NewMagnumRouterWithConn(NewFakeConn(3, 3), 3, 3, 2)
+	m.processMessage(&quartz.ResponseReadSource{Source: 1, Name: "CAM 1"})
+	m.processMessage(&quartz.ResponseReadSource{Source: 2, Name: "CAMERA 2"})
+	m.processMessage(&quartz.ResponseReadDestination{Destination: 1, Name: "MON 1"})
+	m.processMessage(&quartz.ResponseReadDestination{Destination: 2, Name: "RECORDER"})
+	m.processMessage(update(1, 1, quartz.QUARTZ_LVL_V, quartz.QUARTZ_LVL_A))
+	m.processMessage(update(2, 2, quartz.QUARTZ_LVL_V))
+	m.processMessage(update(3, 3, quartz.QUARTZ_LVL_A))
+	m.processMessage(&quartz.ResponseLockStatus{Destination: 2, Locked: true})
+
+	tests := []struct {
+		golden string
+		opts   TextOpts
+	}{
+		{"route_table_names.golden", TextOpts{}},
+		{"route_table_ids.golden", TextOpts{Label: TextLabelIDs}},
+		{"route_table_both.golden", TextOpts{Label: TextLabelBoth}},
+		{"route_table_filtered.golden", TextOpts{Destinations: []uint{2, 3}, Levels: []uint{1}}},
+	}
+	for _, tt := range tests {
+		var buf bytes.Buffer
+		if err := m.WriteRouteTableText(&buf, tt.opts); err != nil {
+			t.Fatalf("%s: %v", tt.golden, err)
+		}
+		checkGolden(t, tt.golden, buf.Bytes())
+	}
+}
+
+func TestWriteRouteTableTextOutOfRange(t *testing.T) {
+	m := NewMagnumRouterWithConn(NewFakeConn(3, 3), 3, 3, 2)
+	var buf bytes.Buffer
+	if err := m.WriteRouteTableText(&buf, TextOpts{Destinations: []uint{4}}); err == nil {
+		t.Error("WriteRouteTableText() accepted an out of range destination")
+	}
+	if err := m.WriteRouteTableText(&buf, TextOpts{Levels: []uint{2}}); err == nil {
+		t.Error("WriteRouteTableText() accepted an out of range level")
+	}
+	if buf.Len() != 0 {
+		t.Errorf("wrote %q before failing", buf.String())
+	}
+}
+
+func TestSummarizeDiffGolden(t *testing.T) {
+	m := NewMagnumRouterWithConn(NewFakeConn(9, 3), 9, 3, 2)
+	m.processMessage(&quartz.ResponseReadSource{Source: 5, Name: "SRC-5"})
+	m.processMessage(&quartz.ResponseReadSource{Source: 9, Name: "SRC-9"})
+	m.processMessage(&quartz.ResponseReadDestination{Destination: 1, Name: "MON-A"})
+	m.processMessage(update(1, 5, quartz.QUARTZ_LVL_V, quartz.QUARTZ_LVL_A))
+	m.processMessage(update(2, 5, quartz.QUARTZ_LVL_V))
+	before := m.ExportState()
+
+	m.processMessage(update(1, 9, quartz.QUARTZ_LVL_V))
+	m.processMessage(update(2, 3, quartz.QUARTZ_LVL_V))
+	m.processMessage(update(3, 9, quartz.QUARTZ_LVL_A))
+	m.processMessage(&quartz.ResponseLockStatus{Destination: 1, Locked: true})
+	m.processMessage(&quartz.ResponseReadDestination{Destination: 3, Name: "REC"})
+	diffs := DiffSnapshots(before, m.ExportState())
+
+	checkGolden(t, "diff_summary_names.golden", []byte(SummarizeDiff(diffs, m)))
+	checkGolden(t, "diff_summary_ids.golden", []byte(SummarizeDiff(diffs, nil)))
+	if got := SummarizeDiff(nil, m); got != "No changes" {
+		t.Errorf("SummarizeDiff(nil) = %q, want No changes", got)
+	}
+}
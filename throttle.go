@@ -0,0 +1,128 @@
+package magnumrouter
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// Identifies the state an event reports on, so later events for the same state replace earlier ones
+type throttleKey struct {
+	kind        EventType
+	destination uint
+	level       uint
+	source      uint
+}
+
+func throttleKeyOf(ev Event) throttleKey {
+	switch ev.Type {
+	case EventRouteChange:
+		return throttleKey{kind: ev.Type, destination: ev.Destination, level: ev.Level}
+	case EventLevelNameChange:
+		return throttleKey{kind: ev.Type, level: ev.Level}
+	case EventLockChange, EventDestinationNameChange, EventSignalChange:
+		return throttleKey{kind: ev.Type, destination: ev.Destination}
+	case EventSourceNameChange:
+		return throttleKey{kind: ev.Type, source: ev.Source}
+	}
+	return throttleKey{kind: ev.Type}
+}
+
+// Events waiting to be emitted to a SubscribeThrottled() subscriber, oldest first with only the latest per key
+type throttledSubscriber struct {
+	mu      sync.Mutex
+	pending map[throttleKey]Event
+	order   []throttleKey
+	signal  chan struct{}
+	stop    context.CancelFunc
+}
+
+// Queues an event, replacing a pending one for the same state in place, without blocking
+func (s *throttledSubscriber) add(ev Event) {
+	key := throttleKeyOf(ev)
+	s.mu.Lock()
+	if _, ok := s.pending[key]; !ok {
+		s.order = append(s.order, key)
+	}
+	s.pending[key] = ev
+	s.mu.Unlock()
+	select {
+	case s.signal <- struct{}{}:
+	default:
+	}
+}
+
+// Removes and returns the oldest pending event, or false if there is none
+func (s *throttledSubscriber) next() (Event, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if len(s.order) == 0 {
+		return Event{}, false
+	}
+	key := s.order[0]
+	s.order = s.order[1:]
+	ev := s.pending[key]
+	delete(s.pending, key)
+	return ev, true
+}
+
+// Returns a channel receiving events as per Subscribe(), at most maxRate a second, and a function to unsubscribe
+// Instead of dropping events while the receiver is behind, pending events are coalesced so only the latest
+// for each crosspoint, name and lock is kept, so the final state seen always matches the cache
+// Errors and bulk changes coalesce to the latest of their type, and Seq has gaps where events were coalesced
+// Pacing uses the router's clock, and a maxRate below 1 is treated as 1
+// Unsubscribing closes the channel, as does Close(), and after Close() the channel is returned already closed
+func (m *MagnumRouter) SubscribeThrottled(maxRate int) (<-chan Event, func()) {
+	if maxRate < 1 {
+		maxRate = 1
+	}
+	out := make(chan Event)
+	ctx, stop := context.WithCancel(context.Background())
+	sub := &throttledSubscriber{pending: map[throttleKey]Event{}, signal: make(chan struct{}, 1), stop: stop}
+	m.subMu.Lock()
+	if m.subsClosed {
+		m.subMu.Unlock()
+		stop()
+		close(out)
+		return out, func() {}
+	}
+	id := m.nextSubID
+	m.nextSubID++
+	if m.throttled == nil {
+		m.throttled = map[uint64]*throttledSubscriber{}
+	}
+	m.throttled[id] = sub
+	m.subMu.Unlock()
+
+	go func() {
+		defer close(out)
+		interval := time.Second / time.Duration(maxRate)
+		for {
+			ev, ok := sub.next()
+			if !ok {
+				select {
+				case <-sub.signal:
+					continue
+				case <-ctx.Done():
+					return
+				}
+			}
+			select {
+			case out <- ev:
+			case <-ctx.Done():
+				return
+			}
+			if err := sleep(ctx, m.opts.clock, interval); err != nil {
+				return
+			}
+		}
+	}()
+
+	unsubscribe := func() {
+		m.subMu.Lock()
+		delete(m.throttled, id)
+		m.subMu.Unlock()
+		stop()
+	}
+	return out, unsubscribe
+}
@@ -0,0 +1,64 @@
+package magnumrouter
+
+import (
+	"testing"
+	"time"
+
+	"github.com/cassaram/quartz"
+)
+
+func TestSubscribeThrottledFinalState(t *testing.T) {
+	clock := newFakeClock()
+	m := NewMagnumRouterWithConn(newScriptConn(), 4, 4, 1, WithClock(clock))
+	defer m.Close()
+	events, unsubscribe := m.SubscribeThrottled(10)
+	defer unsubscribe()
+
+	produced := 0
+	for i := 0; i < 100; i++ {
+		for dest := uint(1); dest <= 4; dest++ {
+			m.processMessage(update(dest, uint(i)%4+1))
+			produced++
+		}
+	}
+	m.processMessage(&quartz.ResponseLockStatus{Destination: 3, Locked: true})
+
+	routes := map[uint]uint{}
+	locked := map[uint]bool{}
+	received := 0
+	for {
+		select {
+		case ev := <-events:
+			received++
+			switch ev.Type {
+			case EventRouteChange:
+				routes[ev.Destination] = ev.Source
+			case EventLockChange:
+				locked[ev.Destination] = ev.Locked
+			}
+			// Nothing more is emitted until the interval has passed on the router's clock
+			select {
+			case ev := <-events:
+				t.Fatalf("event %+v before the interval passed", ev)
+			case <-time.After(5 * time.Millisecond):
+			}
+			eventually(t, func() bool { return clock.pending() > 0 })
+			clock.Advance(100 * time.Millisecond)
+			continue
+		case <-time.After(50 * time.Millisecond):
+		}
+		break
+	}
+
+	if received >= produced {
+		t.Errorf("received %d events of %d produced, want them coalesced", received, produced)
+	}
+	for dest := uint(1); dest <= 4; dest++ {
+		if got, want := routes[dest], m.GetRoute(0, dest); got != want {
+			t.Errorf("last event for destination %d routed %d, cache has %d", dest, got, want)
+		}
+	}
+	if !locked[3] {
+		t.Error("lock of destination 3 not received")
+	}
+}
@@ -0,0 +1,83 @@
+package magnumrouter
+
+import "fmt"
+
+// A destination or source of a frame in a RouterGroup, one end of a tie line
+type tieEnd struct {
+	frame string
+	id    uint
+}
+
+// One step of a signal traced through a RouterGroup by TraceSource()
+type Hop struct {
+	Frame       string
+	Destination uint
+	// Source the destination is routed to in the cache, SourceUnknown if the route is not known
+	Source uint
+}
+
+// Records that destination srcDest of frame srcFrame is cabled to source dstSource of frame dstFrame
+// Tie lines are held by the group only and never sent to the devices, and replace any tie line feeding the same source
+// Returns ErrFrameNotFound for an unknown frame, or an out of range error if either ID is not configured
+func (g *RouterGroup) DefineTieLine(srcFrame string, srcDest uint, dstFrame string, dstSource uint) error {
+	from, ok := g.members[srcFrame]
+	if !ok {
+		return fmt.Errorf("%w: %q", ErrFrameNotFound, srcFrame)
+	}
+	to, ok := g.members[dstFrame]
+	if !ok {
+		return fmt.Errorf("%w: %q", ErrFrameNotFound, dstFrame)
+	}
+	if err := from.checkDestination(srcDest); err != nil {
+		return err
+	}
+	if err := to.checkSource(dstSource); err != nil {
+		return err
+	}
+	g.tieMu.Lock()
+	defer g.tieMu.Unlock()
+	if g.tieLines == nil {
+		g.tieLines = map[tieEnd]tieEnd{}
+	}
+	g.tieLines[tieEnd{frame: dstFrame, id: dstSource}] = tieEnd{frame: srcFrame, id: srcDest}
+	return nil
+}
+
+// Follows the signal on a destination back through tie lines at a level, using the cache of each frame
+// Returns one hop per destination passed through, starting with the given one, so the last hop's source is the origin
+// The trace stops at a source with no tie line feeding it or a route that is not known
+// Returns the hops so far with ErrTieLineCycle if the trace reaches a destination twice
+// Each frame is assumed to number its levels the same way
+func (g *RouterGroup) TraceSource(frame string, level uint, destination uint) ([]Hop, error) {
+	hops := []Hop{}
+	visited := map[tieEnd]bool{}
+	at := tieEnd{frame: frame, id: destination}
+	for {
+		r, ok := g.members[at.frame]
+		if !ok {
+			return hops, fmt.Errorf("%w: %q", ErrFrameNotFound, at.frame)
+		}
+		if visited[at] {
+			return hops, fmt.Errorf("%w: frame %q destination %d", ErrTieLineCycle, at.frame, at.id)
+		}
+		visited[at] = true
+		if err := r.checkLevel(level); err != nil {
+			return hops, err
+		}
+		if err := r.checkDestination(at.id); err != nil {
+			return hops, err
+		}
+		src := r.GetRoute(level, at.id)
+		hops = append(hops, Hop{Frame: at.frame, Destination: at.id, Source: src})
+		if src == SourceUnknown {
+			return hops, nil
+		}
+		g.tieMu.Lock()
+		next, ok := g.tieLines[tieEnd{frame: at.frame, id: src}]
+		g.tieMu.Unlock()
+		if !ok {
+			return hops, nil
+		}
+		at = next
+	}
+}
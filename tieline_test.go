@@ -0,0 +1,72 @@
+package magnumrouter
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+)
+
+// Returns a group of three unconnected frames named a, b and c
+func newTieLineGroup(t *testing.T) (*RouterGroup, map[string]*MagnumRouter) {
+	t.Helper()
+	frames := map[string]*MagnumRouter{}
+	for _, name := range []string{"a", "b", "c"} {
+		m := NewMagnumRouterWithConn(newScriptConn(), 4, 4, 1)
+		t.Cleanup(func() { m.Close() })
+		frames[name] = m
+	}
+	return NewRouterGroup(frames), frames
+}
+
+func TestTraceSourceTwoHops(t *testing.T) {
+	g, frames := newTieLineGroup(t)
+	// Camera on source 3 of frame c reaches destination 1 of frame a through frame b
+	frames["a"].processMessage(update(1, 2))
+	frames["b"].processMessage(update(4, 1))
+	frames["c"].processMessage(update(2, 3))
+	if err := g.DefineTieLine("b", 4, "a", 2); err != nil {
+		t.Fatalf("DefineTieLine() = %v", err)
+	}
+	if err := g.DefineTieLine("c", 2, "b", 1); err != nil {
+		t.Fatalf("DefineTieLine() = %v", err)
+	}
+
+	hops, err := g.TraceSource("a", 0, 1)
+	if err != nil {
+		t.Fatalf("TraceSource() = %v", err)
+	}
+	want := []Hop{
+		{Frame: "a", Destination: 1, Source: 2},
+		{Frame: "b", Destination: 4, Source: 1},
+		{Frame: "c", Destination: 2, Source: 3},
+	}
+	if !reflect.DeepEqual(hops, want) {
+		t.Errorf("TraceSource() = %v, want %v", hops, want)
+	}
+}
+
+func TestTraceSourceCycle(t *testing.T) {
+	g, frames := newTieLineGroup(t)
+	frames["a"].processMessage(update(1, 2))
+	frames["b"].processMessage(update(3, 4))
+	g.DefineTieLine("b", 3, "a", 2)
+	g.DefineTieLine("a", 1, "b", 4)
+
+	hops, err := g.TraceSource("a", 0, 1)
+	if !errors.Is(err, ErrTieLineCycle) {
+		t.Fatalf("TraceSource() = %v, want ErrTieLineCycle", err)
+	}
+	if len(hops) != 2 {
+		t.Errorf("TraceSource() = %v, want the two hops before the cycle", hops)
+	}
+}
+
+func TestDefineTieLineValidates(t *testing.T) {
+	g, _ := newTieLineGroup(t)
+	if err := g.DefineTieLine("x", 1, "a", 1); !errors.Is(err, ErrFrameNotFound) {
+		t.Errorf("DefineTieLine() from frame x = %v, want ErrFrameNotFound", err)
+	}
+	if err := g.DefineTieLine("a", 9, "b", 1); !errors.Is(err, ErrDestinationOutOfRange) {
+		t.Errorf("DefineTieLine() from destination 9 = %v, want ErrDestinationOutOfRange", err)
+	}
+}
@@ -1,17 +1,70 @@
 package magnumrouter
 
 import (
+	"fmt"
 	"strings"
+	"unicode"
 
 	"github.com/cassaram/quartz"
 )
 
+// Quartz level letters in level ID order, video first then audio
+const levelIds = "VABCDEFGHIJKLMNOPQRSTUWXYZ"
+
+// Number of levels that can be addressed over quartz
+const maxLevels = uint(len(levelIds))
+
+// Fails loudly if an edit to levelIds breaks the mapping, as that would silently misroute levels
+func init() {
+	if err := checkLevelMap(levelIds, maxLevels); err != nil {
+		panic(err)
+	}
+}
+
+// Checks a level string maps count level IDs one to one onto distinct quartz level letters
+func checkLevelMap(levels string, count uint) error {
+	if uint(len(levels)) < count {
+		return fmt.Errorf("level map %q has %d levels, need %d", levels, len(levels), count)
+	}
+	seen := map[rune]int{}
+	for i, r := range levels {
+		if r < 'A' || r > 'Z' {
+			return fmt.Errorf("level map %q has invalid level %q at %d", levels, r, i)
+		}
+		if j, ok := seen[r]; ok {
+			return fmt.Errorf("level map %q maps levels %d and %d to %q", levels, j, i, r)
+		}
+		seen[r] = i
+	}
+	return nil
+}
+
 func quartzLevelToID(level quartz.QuartzLevel) uint {
-	levelIds := "VABCDEFGHIJKLMNOPQRSTUWXYZ"
 	return uint(strings.Index(levelIds, string(level)))
 }
 
-func idToQuartzLevel(id uint) quartz.QuartzLevel {
-	levelIds := "VABCDEFGHIJKLMNOPQRSTUWXYZ"
-	return quartz.QuartzLevel(levelIds[id])
+// Returns the quartz level for a level ID, or false if the ID has no quartz level
+func idToQuartzLevel(id uint) (quartz.QuartzLevel, bool) {
+	if id >= maxLevels {
+		return "", false
+	}
+	return quartz.QuartzLevel(levelIds[id]), true
+}
+
+// Trims surrounding whitespace from a name and collapses runs of control characters to a single space
+func normalizeName(name string) string {
+	var b strings.Builder
+	control := false
+	for _, r := range name {
+		if unicode.IsControl(r) {
+			control = true
+			continue
+		}
+		if control {
+			b.WriteByte(' ')
+			control = false
+		}
+		b.WriteRune(r)
+	}
+	return strings.TrimSpace(b.String())
 }
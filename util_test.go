@@ -0,0 +1,80 @@
+package magnumrouter
+
+import (
+	"testing"
+
+	"github.com/cassaram/quartz"
+)
+
+func TestIDToQuartzLevel(t *testing.T) {
+	tests := []struct {
+		id   uint
+		want quartz.QuartzLevel
+		ok   bool
+	}{
+		{0, quartz.QUARTZ_LVL_V, true},
+		{1, quartz.QuartzLevel("A"), true},
+		{maxLevels - 1, quartz.QuartzLevel(levelIds[maxLevels-1:]), true},
+		{maxLevels, "", false},
+		{maxLevels + 1, "", false},
+		{^uint(0), "", false},
+	}
+	for _, tt := range tests {
+		got, ok := idToQuartzLevel(tt.id)
+		if got != tt.want || ok != tt.ok {
+			t.Errorf("idToQuartzLevel(%d) = %q, %v, want %q, %v", tt.id, got, ok, tt.want, tt.ok)
+		}
+	}
+}
+
+func TestQuartzLevelRoundTrip(t *testing.T) {
+	for id := uint(0); id < maxLevels; id++ {
+		level, ok := idToQuartzLevel(id)
+		if !ok {
+			t.Fatalf("idToQuartzLevel(%d) not ok", id)
+		}
+		if got := quartzLevelToID(level); got != id {
+			t.Errorf("quartzLevelToID(%q) = %d, want %d", level, got, id)
+		}
+	}
+}
+
+func TestNormalizeName(t *testing.T) {
+	tests := map[string]string{
+		"CAM 1":             "CAM 1",
+		"CAM 1        ":     "CAM 1",
+		"   CAM 1\r":        "CAM 1",
+		"CAM\x00\x01\x02 1": "CAM  1",
+		"CAM\t1":            "CAM 1",
+		"\x00\x00":          "",
+		"      ":            "",
+	}
+	for name, want := range tests {
+		if got := normalizeName(name); got != want {
+			t.Errorf("normalizeName(%q) = %q, want %q", name, got, want)
+		}
+	}
+}
+
+func TestCheckLevelMap(t *testing.T) {
+	if err := checkLevelMap(levelIds, maxLevels); err != nil {
+		t.Errorf("checkLevelMap(levelIds) = %v", err)
+	}
+	broken := []struct {
+		name   string
+		levels string
+		count  uint
+	}{
+		{"duplicate", "VABCA", 5},
+		{"too short", "VAB", 4},
+		{"lower case", "VaB", 3},
+		{"digit", "VA1", 3},
+	}
+	for _, tt := range broken {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := checkLevelMap(tt.levels, tt.count); err == nil {
+				t.Errorf("checkLevelMap(%q, %d) accepted a broken map", tt.levels, tt.count)
+			}
+		})
+	}
+}
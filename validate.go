@@ -0,0 +1,50 @@
+package magnumrouter
+
+import (
+	"errors"
+	"fmt"
+)
+
+// Checks that the router's configuration is consistent with its level count
+// The level count must be addressable over quartz, names set by WithLevelNames() must not exceed it,
+// and every cached table must match the configured dimensions
+// All problems found are returned together
+func (m *MagnumRouter) Validate() error {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	errs := []error{}
+	if m.levelCount == 0 || m.levelCount > maxLevels {
+		errs = append(errs, fmt.Errorf("level count must be between 1 and %d, got %d", maxLevels, m.levelCount))
+	}
+	if len(m.opts.levelNames) > int(m.levelCount) {
+		errs = append(errs, fmt.Errorf("%d level names set but level count is %d", len(m.opts.levelNames), m.levelCount))
+	}
+	if len(m.levelNames) != int(m.levelCount) {
+		errs = append(errs, fmt.Errorf("level name cache has %d levels but level count is %d", len(m.levelNames), m.levelCount))
+	}
+	destinations, levelsOf := m.routes.dimensions()
+	if destinations != len(m.destinationNames) {
+		errs = append(errs, fmt.Errorf("route table has %d destination entries but the name table has %d", destinations, len(m.destinationNames)))
+	}
+	for dest := 0; dest < destinations; dest++ {
+		if levels := levelsOf(dest); levels != int(m.levelCount) {
+			errs = append(errs, fmt.Errorf("route table destination %d has %d levels but level count is %d", dest, levels, m.levelCount))
+			break
+		}
+	}
+	// Sorted so the same problems are always reported in the same order
+	for _, dest := range sortedKeys(m.whitelists) {
+		if dest >= uint(len(m.destinationNames)) {
+			errs = append(errs, fmt.Errorf("whitelist for destination %d: %w", dest, ErrDestinationOutOfRange))
+		}
+		for _, src := range sortedKeys(m.whitelists[dest]) {
+			if src >= uint(len(m.sourceNames)) {
+				errs = append(errs, fmt.Errorf("whitelist for destination %d source %d: %w", dest, src, ErrSourceOutOfRange))
+			}
+		}
+	}
+	if len(errs) > 0 {
+		return fmt.Errorf("invalid router: %w", errors.Join(errs...))
+	}
+	return nil
+}
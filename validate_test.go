@@ -0,0 +1,122 @@
+package magnumrouter
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestValidateConsistentRouter(t *testing.T) {
+	m := NewMagnumRouterWithConn(NewFakeConn(4, 4), 4, 4, 2, WithLevelNames([]string{"VIDEO", "AUDIO"}))
+	if err := m.Validate(); err != nil {
+		t.Errorf("Validate() = %v, want nil", err)
+	}
+	if err := m.Resize(8, 2, 3, true); err != nil {
+		t.Fatalf("Resize(): %v", err)
+	}
+	if err := m.Validate(); err != nil {
+		t.Errorf("Validate() after a resize = %v, want nil", err)
+	}
+}
+
+func TestValidateMismatches(t *testing.T) {
+	tests := map[string]struct {
+		levels uint
+		opts   []Option
+		// Breaks the router after construction, as only a bug could
+		corrupt func(m *MagnumRouter)
+		want    string
+		wantErr error
+	}{
+		"no levels": {
+			levels: 0,
+			want:   "level count must be between 1 and 26, got 0",
+		},
+		"too many levels": {
+			levels: maxLevels + 1,
+			want:   "level count must be between 1 and 26, got 27",
+		},
+		"too many level names": {
+			levels: 2,
+			opts:   []Option{WithLevelNames([]string{"VIDEO", "AUDIO", "DATA"})},
+			want:   "3 level names set but level count is 2",
+		},
+		"level name cache": {
+			levels:  2,
+			corrupt: func(m *MagnumRouter) { m.levelNames = m.levelNames[:1] },
+			want:    "level name cache has 1 levels but level count is 2",
+		},
+		"route table destinations": {
+			levels:  2,
+			corrupt: func(m *MagnumRouter) { m.routes = newDenseRoutes(3, 2) },
+			want:    "route table has 3 destination entries but the name table has 5",
+		},
+		"route table levels": {
+			levels:  2,
+			corrupt: func(m *MagnumRouter) { m.routes = newDenseRoutes(5, 1) },
+			want:    "route table destination 0 has 1 levels but level count is 2",
+		},
+		"whitelisted destination": {
+			levels:  2,
+			corrupt: func(m *MagnumRouter) { m.whitelists[9] = map[uint]bool{1: true} },
+			wantErr: ErrDestinationOutOfRange,
+		},
+		"whitelisted source": {
+			levels:  2,
+			corrupt: func(m *MagnumRouter) { m.whitelists[1] = map[uint]bool{9: true} },
+			wantErr: ErrSourceOutOfRange,
+		},
+	}
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			m := NewMagnumRouterWithConn(NewFakeConn(4, 4), 4, 4, tt.levels, tt.opts...)
+			if tt.corrupt != nil {
+				tt.corrupt(m)
+			}
+			err := m.Validate()
+			if err == nil {
+				t.Fatal("Validate() = nil, want an error")
+			}
+			if tt.want != "" && !strings.Contains(err.Error(), tt.want) {
+				t.Errorf("Validate() = %v, want it to contain %q", err, tt.want)
+			}
+			if tt.wantErr != nil && !errors.Is(err, tt.wantErr) {
+				t.Errorf("Validate() = %v, want %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestValidateReportsAllProblems(t *testing.T) {
+	m := NewMagnumRouterWithConn(NewFakeConn(4, 4), 4, 4, 1, WithLevelNames([]string{"VIDEO", "AUDIO"}))
+	m.whitelists[1] = map[uint]bool{9: true}
+	err := m.Validate()
+	if !errors.Is(err, ErrSourceOutOfRange) || !strings.Contains(err.Error(), "2 level names set") {
+		t.Errorf("Validate() = %v, want both the level names and the whitelist reported", err)
+	}
+}
+
+func TestValidateReportsInOrder(t *testing.T) {
+	m := NewMagnumRouterWithConn(NewFakeConn(4, 4), 4, 4, 1)
+	for _, dest := range []uint{12, 9, 3, 10} {
+		m.whitelists[dest] = map[uint]bool{7: true, 1: true, 5: true, 8: true}
+	}
+	first := m.Validate()
+	if first == nil {
+		t.Fatal("Validate() = nil, want an error")
+	}
+	for i := 0; i < 20; i++ {
+		if err := m.Validate(); err.Error() != first.Error() {
+			t.Fatalf("Validate() = %q, then %q", first, err)
+		}
+	}
+	dests := []string{"destination 3 ", "destination 9:", "destination 10:", "destination 12:"}
+	at := 0
+	for _, d := range dests {
+		i := strings.Index(first.Error()[at:], d)
+		if i < 0 {
+			t.Fatalf("Validate() = %q, want whitelists reported in destination order", first)
+		}
+		at += i
+	}
+}
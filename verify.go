@@ -0,0 +1,154 @@
+package magnumrouter
+
+import (
+	"context"
+	"encoding/binary"
+	"fmt"
+	"hash/fnv"
+	"strings"
+
+	"github.com/cassaram/quartz"
+)
+
+// Returns a hash of the cached route table and lock statuses, for cheap change detection and comparing routers
+// Routers of the same size in the same state produce the same checksum, and any route or lock change alters it
+// Names are not included
+func (m *MagnumRouter) RouteTableChecksum() uint64 {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	h := fnv.New64a()
+	var buf [8]byte
+	write := func(v uint64) {
+		binary.LittleEndian.PutUint64(buf[:], v)
+		h.Write(buf[:])
+	}
+	write(uint64(len(m.destinationNames)))
+	write(uint64(m.levelCount))
+	for dest := m.base(); dest < uint(len(m.destinationNames)); dest++ {
+		locked := uint64(0)
+		if m.destinationLocks[dest] {
+			locked = 1
+		}
+		write(locked)
+		for lvl := uint(0); lvl < m.levelCount; lvl++ {
+			write(uint64(m.routes.get(dest, lvl)))
+		}
+	}
+	return h.Sum64()
+}
+
+// Re-queries the whole device and returns how the cache differed from it
+// Useful after ImportState() to find entries that went stale while the service was down
+// Waits until a response has been received for every query or the context is done
+// As unsolicited updates also count as responses, a few late responses may still be applied after returning
+// Returns ErrResyncInProgress if another sync is in progress, unless WithResyncWait() is set
+func (m *MagnumRouter) Verify(ctx context.Context) ([]RouteDiff, error) {
+	if err := m.awaitSync(ctx); err != nil {
+		return nil, err
+	}
+	m.beginSync()
+	defer m.endSync()
+	before := m.ExportState()
+	if err := m.requestAllAndWait(ctx); err != nil {
+		return nil, err
+	}
+	return DiffSnapshots(before, m.ExportState()), nil
+}
+
+// Runs a full sync then waits until a response has been received for every query or the context is done
+func (m *MagnumRouter) requestAllAndWait(ctx context.Context) error {
+	sources, destinations, levels := m.counts()
+	expected := uint64(sources + destinations*2 + destinations*levels)
+	start := m.responseCount()
+
+	if err := m.requestAll(ctx); err != nil {
+		return err
+	}
+	// Queries that failed to send in best-effort mode will never be answered
+	expected -= uint64(len(m.SyncErrors()))
+	return m.waitResponses(ctx, start+expected)
+}
+
+// Returns ErrIncompleteSync listing crosspoints whose source is still unknown
+// Every crosspoint of a magnum frame has a source, so any left unknown after a sync point to dropped
+// responses or a level mapping problem
+func (m *MagnumRouter) ValidateFullySynced() error {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	unknown := []string{}
+	for dest := m.base(); dest < uint(len(m.destinationNames)); dest++ {
+		for lvl := uint(0); lvl < m.levelCount; lvl++ {
+			if m.routes.get(dest, lvl) == SourceUnknown {
+				unknown = append(unknown, fmt.Sprintf("destination %d level %d", dest, lvl))
+			}
+		}
+	}
+	if len(unknown) == 0 {
+		return nil
+	}
+	// Keep the error readable when a whole frame is missing
+	const listed = 10
+	if len(unknown) > listed {
+		return fmt.Errorf("%w: %d crosspoints unknown, including %s", ErrIncompleteSync, len(unknown), strings.Join(unknown[:listed], ", "))
+	}
+	return fmt.Errorf("%w: %d crosspoints unknown: %s", ErrIncompleteSync, len(unknown), strings.Join(unknown, ", "))
+}
+
+// Whether a message is a response to a sync query
+func isQueryResponse(msg quartz.QuartzResponse) bool {
+	switch msg.GetType() {
+	case quartz.QUARTZ_RESP_TYPE_UPDATE, quartz.QUARTZ_RESP_TYPE_READ_SRC, quartz.QUARTZ_RESP_TYPE_READ_DST, quartz.QUARTZ_RESP_TYPE_LOCK_STS:
+		return true
+	}
+	return false
+}
+
+// Counts a processed query response and wakes anything waiting on responses
+func (m *MagnumRouter) countResponse() {
+	m.respMu.Lock()
+	defer m.respMu.Unlock()
+	m.respCount++
+	close(m.respSignal)
+	m.respSignal = make(chan struct{})
+}
+
+// Counts a processed error response and wakes anything waiting on responses
+func (m *MagnumRouter) countRejection() {
+	m.respMu.Lock()
+	defer m.respMu.Unlock()
+	m.rejectCount++
+	close(m.respSignal)
+	m.respSignal = make(chan struct{})
+}
+
+// Returns the number of error responses processed so far
+func (m *MagnumRouter) rejectionCount() uint64 {
+	m.respMu.Lock()
+	defer m.respMu.Unlock()
+	return m.rejectCount
+}
+
+// Returns the number of query responses processed so far
+func (m *MagnumRouter) responseCount() uint64 {
+	m.respMu.Lock()
+	defer m.respMu.Unlock()
+	return m.respCount
+}
+
+// Blocks until the number of query responses processed reaches target or the context is done
+func (m *MagnumRouter) waitResponses(ctx context.Context, target uint64) error {
+	for {
+		m.respMu.Lock()
+		if m.respCount >= target {
+			m.respMu.Unlock()
+			return nil
+		}
+		signal := m.respSignal
+		m.respMu.Unlock()
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-signal:
+		}
+	}
+}
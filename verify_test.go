@@ -0,0 +1,124 @@
+package magnumrouter
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/cassaram/quartz"
+)
+
+// Returns a fake device with every crosspoint routed except those listed
+func routedFakeConn(sources uint, destinations uint, levels uint, unrouted ...crosspoint) *FakeConn {
+	f := NewFakeConn(sources, destinations)
+	for dest := uint(1); dest <= destinations; dest++ {
+		for lvl := uint(0); lvl < levels; lvl++ {
+			f.routes[crosspoint{destination: dest, level: lvl}] = dest%sources + 1
+		}
+	}
+	for _, xp := range unrouted {
+		delete(f.routes, xp)
+	}
+	return f
+}
+
+func TestPostSyncValidationComplete(t *testing.T) {
+	m := NewMagnumRouterWithConn(routedFakeConn(3, 4, 2), 3, 4, 2, WithPostSyncValidation((*MagnumRouter).ValidateFullySynced))
+	defer m.Close()
+	if err := m.Connect(); err != nil {
+		t.Fatalf("Connect() = %v, want a complete sync", err)
+	}
+	if err := m.ValidateFullySynced(); err != nil {
+		t.Errorf("ValidateFullySynced() = %v, want nil", err)
+	}
+}
+
+func TestPostSyncValidationIncomplete(t *testing.T) {
+	conn := routedFakeConn(3, 4, 2, crosspoint{destination: 2, level: 1}, crosspoint{destination: 4, level: 0})
+	m := NewMagnumRouterWithConn(conn, 3, 4, 2, WithPostSyncValidation((*MagnumRouter).ValidateFullySynced))
+	defer m.Close()
+	err := m.Connect()
+	if !errors.Is(err, ErrIncompleteSync) {
+		t.Fatalf("Connect() = %v, want ErrIncompleteSync", err)
+	}
+	for _, want := range []string{"2 crosspoints unknown", "destination 2 level 1", "destination 4 level 0"} {
+		if !strings.Contains(err.Error(), want) {
+			t.Errorf("Connect() = %v, want it to mention %q", err, want)
+		}
+	}
+	if got := m.State(); got != StateDisconnected {
+		t.Errorf("State() = %v, want disconnected", got)
+	}
+}
+
+func TestPostSyncValidationHook(t *testing.T) {
+	calls := 0
+	failed := errors.New("not what we expected")
+	m := NewMagnumRouterWithConn(routedFakeConn(3, 4, 1), 3, 4, 1, WithPostSyncValidation(func(m *MagnumRouter) error {
+		calls++
+		// Runs after every response has been applied
+		if got := m.GetDestinationName(4); got != "DST 4" {
+			t.Errorf("destination 4 name during validation = %q, want DST 4", got)
+		}
+		return failed
+	}))
+	defer m.Close()
+	if err := m.Connect(); !errors.Is(err, failed) {
+		t.Errorf("Connect() = %v, want the hook error", err)
+	}
+	if calls != 1 {
+		t.Errorf("hook called %d times, want 1", calls)
+	}
+}
+
+func TestValidateFullySyncedTruncates(t *testing.T) {
+	m := NewMagnumRouterWithConn(NewFakeConn(3, 20), 3, 20, 1)
+	err := m.ValidateFullySynced()
+	if !errors.Is(err, ErrIncompleteSync) || !strings.Contains(err.Error(), "20 crosspoints unknown, including") {
+		t.Errorf("ValidateFullySynced() = %v, want a truncated list of 20", err)
+	}
+}
+
+func TestRouteTableChecksum(t *testing.T) {
+	newRouter := func(opts ...Option) *MagnumRouter {
+		m := NewMagnumRouterWithConn(NewFakeConn(3, 3), 3, 3, 2, opts...)
+		m.processMessage(update(1, 2, quartz.QUARTZ_LVL_V, quartz.QuartzLevel("A")))
+		m.processMessage(update(2, 3, quartz.QUARTZ_LVL_V))
+		return m
+	}
+	first, second := newRouter(), newRouter(WithSparseRouteTable(true))
+	sum := first.RouteTableChecksum()
+	if got := second.RouteTableChecksum(); got != sum {
+		t.Errorf("checksums %x and %x for routers in the same state", sum, got)
+	}
+	// Names are not covered
+	first.processMessage(&quartz.ResponseReadSource{Source: 1, Name: "CAM 1"})
+	if got := first.RouteTableChecksum(); got != sum {
+		t.Errorf("checksum changed to %x on a name change", got)
+	}
+
+	changes := []quartz.QuartzResponse{
+		update(3, 1, quartz.QuartzLevel("A")),
+		&quartz.ResponseLockStatus{Destination: 3, Locked: true},
+	}
+	seen := map[uint64]bool{sum: true}
+	for _, msg := range changes {
+		first.processMessage(msg)
+		got := first.RouteTableChecksum()
+		if seen[got] {
+			t.Errorf("checksum %x unchanged after %+v", got, msg)
+		}
+		seen[got] = true
+	}
+
+	// Swapping the sources of two crosspoints is a change
+	swapped := NewMagnumRouterWithConn(NewFakeConn(3, 3), 3, 3, 2)
+	swapped.processMessage(update(1, 3, quartz.QUARTZ_LVL_V))
+	swapped.processMessage(update(2, 2, quartz.QUARTZ_LVL_V))
+	plain := NewMagnumRouterWithConn(NewFakeConn(3, 3), 3, 3, 2)
+	plain.processMessage(update(1, 2, quartz.QUARTZ_LVL_V))
+	plain.processMessage(update(2, 3, quartz.QUARTZ_LVL_V))
+	if swapped.RouteTableChecksum() == plain.RouteTableChecksum() {
+		t.Error("same checksum for swapped routes")
+	}
+}
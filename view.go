@@ -0,0 +1,80 @@
+package magnumrouter
+
+import "fmt"
+
+// The read only surface of a router, for embedding router state in a larger model without exposing control
+// Implemented by *MagnumRouter for live state, and by NewStaticView() for a frozen snapshot
+type RouterView interface {
+	GetSourceNameTable() []string
+	GetDestinationNameTable() []string
+	GetDestinationLockTable() []bool
+	GetRouteTable() [][]uint
+	GetRoute(level uint, destination uint) uint
+	GetSourceName(source uint) string
+	GetDestinationName(destination uint) string
+	GetDestinationLocked(destination uint) bool
+	GetLevelName(level uint) string
+	ExportState() RouterSnapshot
+}
+
+var _ RouterView = (*MagnumRouter)(nil)
+
+// A RouterView of a snapshot, which never changes
+type staticView struct {
+	snapshot RouterSnapshot
+}
+
+// Returns a RouterView of a snapshot, such as one from MagnumRouter.ExportState()
+// The snapshot is copied, so later changes to it are not seen by the view
+// Out of range IDs read as empty rather than panicking
+func NewStaticView(snapshot RouterSnapshot) RouterView {
+	return staticView{snapshot: copySnapshot(snapshot)}
+}
+
+func (v staticView) GetSourceNameTable() []string {
+	return append([]string{}, v.snapshot.SourceNames...)
+}
+
+func (v staticView) GetDestinationNameTable() []string {
+	return append([]string{}, v.snapshot.DestinationNames...)
+}
+
+func (v staticView) GetDestinationLockTable() []bool {
+	return append([]bool{}, v.snapshot.DestinationLocks...)
+}
+
+func (v staticView) GetRouteTable() [][]uint {
+	return copySnapshot(v.snapshot).Routes
+}
+
+func (v staticView) GetRoute(level uint, destination uint) uint {
+	return at(at(v.snapshot.Routes, int(destination)), int(level))
+}
+
+func (v staticView) GetSourceName(source uint) string {
+	return at(v.snapshot.SourceNames, int(source))
+}
+
+func (v staticView) GetDestinationName(destination uint) string {
+	return at(v.snapshot.DestinationNames, int(destination))
+}
+
+func (v staticView) GetDestinationLocked(destination uint) bool {
+	return at(v.snapshot.DestinationLocks, int(destination))
+}
+
+// Returns the level name in the snapshot, falling back to the quartz level letter then the level ID
+func (v staticView) GetLevelName(level uint) string {
+	if name := at(v.snapshot.LevelNames, int(level)); name != "" {
+		return name
+	}
+	lvl, ok := idToQuartzLevel(level)
+	if !ok {
+		return fmt.Sprint(level)
+	}
+	return string(lvl)
+}
+
+func (v staticView) ExportState() RouterSnapshot {
+	return copySnapshot(v.snapshot)
+}
@@ -0,0 +1,84 @@
+package magnumrouter
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/cassaram/quartz"
+)
+
+func TestViewsConsistent(t *testing.T) {
+	m := NewMagnumRouterWithConn(NewFakeConn(3, 3), 3, 3, 2)
+	m.processMessage(update(1, 2, quartz.QUARTZ_LVL_V, quartz.QUARTZ_LVL_A))
+	m.processMessage(update(3, 3, quartz.QUARTZ_LVL_A))
+	m.processMessage(&quartz.ResponseReadSource{Source: 2, Name: "CAM 2"})
+	m.processMessage(&quartz.ResponseReadDestination{Destination: 1, Name: "MON 1"})
+	m.processMessage(&quartz.ResponseLockStatus{Destination: 3, Locked: true})
+	snapshot := m.ExportState()
+	var live, static RouterView = m, NewStaticView(snapshot)
+
+	if !reflect.DeepEqual(static.GetRouteTable(), live.GetRouteTable()) {
+		t.Errorf("route tables differ: %v and %v", static.GetRouteTable(), live.GetRouteTable())
+	}
+	if !reflect.DeepEqual(static.GetSourceNameTable(), live.GetSourceNameTable()) ||
+		!reflect.DeepEqual(static.GetDestinationNameTable(), live.GetDestinationNameTable()) ||
+		!reflect.DeepEqual(static.GetDestinationLockTable(), live.GetDestinationLockTable()) {
+		t.Error("name or lock tables differ")
+	}
+	for id := uint(1); id <= 3; id++ {
+		for lvl := uint(0); lvl < 2; lvl++ {
+			if got, want := static.GetRoute(lvl, id), live.GetRoute(lvl, id); got != want {
+				t.Errorf("GetRoute(%d, %d) = %d, want %d", lvl, id, got, want)
+			}
+		}
+		if got, want := static.GetSourceName(id), live.GetSourceName(id); got != want {
+			t.Errorf("GetSourceName(%d) = %q, want %q", id, got, want)
+		}
+		if got, want := static.GetDestinationName(id), live.GetDestinationName(id); got != want {
+			t.Errorf("GetDestinationName(%d) = %q, want %q", id, got, want)
+		}
+		if got, want := static.GetDestinationLocked(id), live.GetDestinationLocked(id); got != want {
+			t.Errorf("GetDestinationLocked(%d) = %v, want %v", id, got, want)
+		}
+	}
+	if !reflect.DeepEqual(static.ExportState(), live.ExportState()) {
+		t.Error("exported states differ")
+	}
+
+	// Frozen, so later changes to the router or the snapshot are not seen
+	m.processMessage(update(1, 3))
+	snapshot.Routes[1][1] = 1
+	if got := static.GetRoute(0, 1); got != 2 {
+		t.Errorf("static GetRoute(0, 1) after changes = %d, want 2", got)
+	}
+	if got := static.GetRoute(1, 1); got != 2 {
+		t.Errorf("static GetRoute(1, 1) after changing the snapshot = %d, want 2", got)
+	}
+	if got := static.GetRoute(5, 9); got != SourceUnknown {
+		t.Errorf("static GetRoute() out of range = %d, want SourceUnknown", got)
+	}
+	if got := static.GetSourceName(9); got != "" {
+		t.Errorf("static GetSourceName() out of range = %q, want empty", got)
+	}
+}
+
+func TestStaticViewKeepsOptionLevelNames(t *testing.T) {
+	m := NewMagnumRouterWithConn(NewFakeConn(2, 2), 2, 2, 3, WithLevelNames([]string{"VIDEO", "AUDIO"}))
+	view := NewStaticView(m.ExportState())
+	for lvl := uint(0); lvl < 3; lvl++ {
+		if got, want := view.GetLevelName(lvl), m.GetLevelName(lvl); got != want {
+			t.Errorf("GetLevelName(%d) = %q, want %q", lvl, got, want)
+		}
+	}
+
+	// Names imported from the snapshot keep following the options of the importing router
+	imported := NewMagnumRouterWithConn(NewFakeConn(2, 2), 2, 2, 3, WithLevelNames([]string{"PGM"}))
+	if err := imported.ImportState(m.ExportState()); err != nil {
+		t.Fatalf("import: %v", err)
+	}
+	for lvl, want := range []string{"VIDEO", "AUDIO", "B"} {
+		if got := imported.GetLevelName(uint(lvl)); got != want {
+			t.Errorf("imported GetLevelName(%d) = %q, want %q", lvl, got, want)
+		}
+	}
+}
@@ -0,0 +1,165 @@
+package magnumrouter
+
+import (
+	"context"
+	"fmt"
+	"sort"
+)
+
+// Blocks until the cached source of a crosspoint is the given source, or the context is done
+// Returns immediately if the crosspoint is already routed to the source
+// Returns ErrClosed if the router is closed while waiting
+// Failures are returned as an *OpError
+func (m *MagnumRouter) WaitForRoute(ctx context.Context, level uint, destination uint, source uint) error {
+	ctx = m.correlate(ctx)
+	return opError(ctx, "WaitForRoute", destination, m.waitForRoute(ctx, level, destination, source))
+}
+
+func (m *MagnumRouter) waitForRoute(ctx context.Context, level uint, destination uint, source uint) error {
+	if err := m.checkDestination(destination); err != nil {
+		return err
+	}
+	if err := m.checkLevel(level); err != nil {
+		return err
+	}
+	events, unsubscribe := m.Subscribe()
+	defer unsubscribe()
+	if m.GetRoute(level, destination) == source {
+		return nil
+	}
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case ev, ok := <-events:
+			if !ok {
+				return ErrClosed
+			}
+			if (ev.Type == EventBulkChange || ev.Type == EventRouteChange && ev.Destination == destination) && m.GetRoute(level, destination) == source {
+				return nil
+			}
+		}
+	}
+}
+
+// Sets a route and waits for the server to confirm every requested level reached the source
+// Returns ErrRouteMismatch if a level is reported routed to a different source
+// Returns ErrRouteNotConfirmed, listing the unconfirmed levels, if the context is done before all levels confirm
+// With WithAckWait(), returns ErrCommandRejected as soon as the server rejects the route, such as for a locked destination
+// Returns ErrClosed if the router is closed while waiting
+// Failures are returned as an *OpError
+func (m *MagnumRouter) SetRouteConfirmed(ctx context.Context, levels []uint, destination uint, source uint) error {
+	ctx = m.correlate(ctx)
+	return opError(ctx, "SetRouteConfirmed", destination, m.setRouteConfirmed(ctx, levels, destination, source))
+}
+
+func (m *MagnumRouter) setRouteConfirmed(ctx context.Context, levels []uint, destination uint, source uint) error {
+	// Subscribe before sending so no confirmation can be missed
+	events, unsubscribe := m.Subscribe()
+	defer unsubscribe()
+	if _, err := m.setRoute(ctx, "SetRouteConfirmed", levels, destination, source, nil); err != nil {
+		return err
+	}
+
+	pending := map[uint]bool{}
+	for _, lvl := range levels {
+		if m.GetRoute(lvl, destination) != source {
+			pending[lvl] = true
+		}
+	}
+	for len(pending) > 0 {
+		select {
+		case <-ctx.Done():
+			return fmt.Errorf("%w: destination %d levels %v: %w", ErrRouteNotConfirmed, destination, sortedLevels(pending), ctx.Err())
+		case ev, ok := <-events:
+			if !ok {
+				return ErrClosed
+			}
+			if ev.Type == EventBulkChange {
+				// Individual updates were suppressed, so check the cache directly
+				for lvl := range pending {
+					if m.GetRoute(lvl, destination) == source {
+						delete(pending, lvl)
+					}
+				}
+				continue
+			}
+			if ev.Type != EventRouteChange || ev.Destination != destination || !pending[ev.Level] {
+				continue
+			}
+			if ev.Source != source {
+				return fmt.Errorf("%w: destination %d level %d routed to source %d, expected %d", ErrRouteMismatch, destination, ev.Level, ev.Source, source)
+			}
+			delete(pending, ev.Level)
+		}
+	}
+	return nil
+}
+
+// Sets a lock status for a destination and waits for the server to report the new status
+// Returns immediately once the cached lock status matches
+// Returns ErrClosed if the router is closed while waiting
+// Failures are returned as an *OpError
+func (m *MagnumRouter) SetLockAndWait(ctx context.Context, destination uint, lock bool) error {
+	ctx = m.correlate(ctx)
+	return opError(ctx, "SetLockAndWait", destination, m.setLockAndWait(ctx, destination, lock))
+}
+
+func (m *MagnumRouter) setLockAndWait(ctx context.Context, destination uint, lock bool) error {
+	events, unsubscribe := m.Subscribe()
+	defer unsubscribe()
+	if err := m.setLock(ctx, "SetLockAndWait", destination, lock); err != nil {
+		return err
+	}
+	return m.awaitLock(ctx, events, destination, lock)
+}
+
+// Blocks until the cached lock status of a destination matches, or the context is done
+// Returns immediately if the destination is already in the given state
+// Returns ErrClosed if the router is closed while waiting
+// Failures are returned as an *OpError
+func (m *MagnumRouter) WaitForLock(ctx context.Context, destination uint, locked bool) error {
+	ctx = m.correlate(ctx)
+	return opError(ctx, "WaitForLock", destination, m.waitForLock(ctx, destination, locked))
+}
+
+func (m *MagnumRouter) waitForLock(ctx context.Context, destination uint, locked bool) error {
+	if err := m.checkDestination(destination); err != nil {
+		return err
+	}
+	events, unsubscribe := m.Subscribe()
+	defer unsubscribe()
+	return m.awaitLock(ctx, events, destination, locked)
+}
+
+// Waits on a subscription until the lock status of a destination matches
+// The subscription must be taken before checking the cache so no change can be missed
+func (m *MagnumRouter) awaitLock(ctx context.Context, events <-chan Event, destination uint, locked bool) error {
+	if m.GetDestinationLocked(destination) == locked {
+		return nil
+	}
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case ev, ok := <-events:
+			if !ok {
+				return ErrClosed
+			}
+			if ev.Type == EventLockChange && ev.Destination == destination && ev.Locked == locked {
+				return nil
+			}
+		}
+	}
+}
+
+func sortedLevels(levels map[uint]bool) []uint {
+	sorted := make([]uint, 0, len(levels))
+	for lvl := range levels {
+		sorted = append(sorted, lvl)
+	}
+	sort.Slice(sorted, func(i, j int) bool {
+		return sorted[i] < sorted[j]
+	})
+	return sorted
+}
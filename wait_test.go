@@ -0,0 +1,155 @@
+package magnumrouter
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/cassaram/quartz"
+)
+
+func TestWaitersReturnErrClosedOnClose(t *testing.T) {
+	waits := map[string]func(m *MagnumRouter) error{
+		"WaitForRoute": func(m *MagnumRouter) error {
+			return m.WaitForRoute(context.Background(), 0, 1, 2)
+		},
+		"WaitForLock": func(m *MagnumRouter) error {
+			return m.WaitForLock(context.Background(), 1, true)
+		},
+		"SetRouteConfirmed": func(m *MagnumRouter) error {
+			return m.SetRouteConfirmed(context.Background(), []uint{0}, 1, 2)
+		},
+		"SetLockAndWait": func(m *MagnumRouter) error {
+			return m.SetLockAndWait(context.Background(), 1, true)
+		},
+	}
+	for name, wait := range waits {
+		t.Run(name, func(t *testing.T) {
+			m, _ := newScriptRouter(t, 4, 4, 1)
+			errs := make(chan error, 1)
+			go func() { errs <- wait(m) }()
+			eventually(t, func() bool {
+				m.subMu.Lock()
+				defer m.subMu.Unlock()
+				return len(m.subscribers) > 0
+			})
+			m.Close()
+			if err := receiveErr(t, errs); !errors.Is(err, ErrClosed) {
+				t.Fatalf("got %v, want ErrClosed", err)
+			}
+		})
+	}
+}
+
+// Waits for a command starting with prefix to be sent on conn
+func awaitSent(t *testing.T, conn *scriptConn, prefix string) {
+	t.Helper()
+	eventually(t, func() bool {
+		for _, call := range conn.recorded() {
+			if strings.HasPrefix(call, prefix) {
+				return true
+			}
+		}
+		return false
+	})
+}
+
+func TestSetRouteConfirmedAllLevels(t *testing.T) {
+	m, _ := newFakeRouter(t, 4, 4, 2)
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	if err := m.SetRouteConfirmed(ctx, []uint{0, 1}, 1, 3); err != nil {
+		t.Fatalf("SetRouteConfirmed() = %v", err)
+	}
+	if m.GetRoute(0, 1) != 3 || m.GetRoute(1, 1) != 3 {
+		t.Errorf("routes %d and %d after confirmation, want 3", m.GetRoute(0, 1), m.GetRoute(1, 1))
+	}
+}
+
+func TestSetRouteConfirmedPartialTimeout(t *testing.T) {
+	m, conn := newScriptRouter(t, 4, 4, 2)
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	errs := make(chan error, 1)
+	go func() { errs <- m.SetRouteConfirmed(ctx, []uint{0, 1}, 1, 3) }()
+	awaitSent(t, conn, "route")
+	conn.inject(update(1, 3, quartz.QUARTZ_LVL_V))
+
+	err := receiveErr(t, errs)
+	if !errors.Is(err, ErrRouteNotConfirmed) || !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("SetRouteConfirmed() = %v, want ErrRouteNotConfirmed on the deadline", err)
+	}
+	if !strings.Contains(err.Error(), "levels [1]") {
+		t.Errorf("error %q does not list only the unconfirmed level 1", err)
+	}
+	var opErr *OpError
+	if !errors.As(err, &opErr) || opErr.Op != "SetRouteConfirmed" || opErr.Destination != 1 {
+		t.Errorf("error %v is not an OpError for the operation", err)
+	}
+}
+
+func TestSetRouteConfirmedMismatch(t *testing.T) {
+	m, conn := newScriptRouter(t, 4, 4, 2)
+	errs := make(chan error, 1)
+	go func() { errs <- m.SetRouteConfirmed(context.Background(), []uint{0, 1}, 1, 3) }()
+	awaitSent(t, conn, "route")
+	conn.inject(update(1, 3, quartz.QUARTZ_LVL_V), update(1, 2, quartz.QUARTZ_LVL_A))
+
+	if err := receiveErr(t, errs); !errors.Is(err, ErrRouteMismatch) {
+		t.Fatalf("SetRouteConfirmed() = %v, want ErrRouteMismatch", err)
+	}
+}
+
+func TestWaitForLockAlreadySatisfied(t *testing.T) {
+	m := NewMagnumRouterWithConn(NewFakeConn(2, 2), 2, 2, 1)
+	m.processMessage(&quartz.ResponseLockStatus{Destination: 1, Locked: true})
+	// Satisfied from the cache, so a done context is not consulted
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if err := m.WaitForLock(ctx, 1, true); err != nil {
+		t.Errorf("WaitForLock() of a locked destination = %v, want nil", err)
+	}
+	if err := m.WaitForLock(ctx, 2, false); err != nil {
+		t.Errorf("WaitForLock() of an unlocked destination = %v, want nil", err)
+	}
+}
+
+func TestWaitForLockEvent(t *testing.T) {
+	m := NewMagnumRouterWithConn(NewFakeConn(2, 2), 2, 2, 1)
+	errs := make(chan error, 1)
+	go func() { errs <- m.WaitForLock(context.Background(), 2, true) }()
+	eventually(t, func() bool {
+		m.subMu.Lock()
+		defer m.subMu.Unlock()
+		return len(m.subscribers) == 1
+	})
+	m.processMessage(&quartz.ResponseLockStatus{Destination: 1, Locked: true})
+	select {
+	case err := <-errs:
+		t.Fatalf("WaitForLock() returned %v on another destination locking", err)
+	case <-time.After(20 * time.Millisecond):
+	}
+	m.processMessage(&quartz.ResponseLockStatus{Destination: 2, Locked: true})
+	if err := receiveErr(t, errs); err != nil {
+		t.Errorf("WaitForLock() = %v, want nil", err)
+	}
+}
+
+func TestWaitForLockTimeout(t *testing.T) {
+	m := NewMagnumRouterWithConn(NewFakeConn(2, 2), 2, 2, 1)
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	err := m.WaitForLock(ctx, 1, true)
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("WaitForLock() = %v, want DeadlineExceeded", err)
+	}
+	var opErr *OpError
+	if !errors.As(err, &opErr) || opErr.Op != "WaitForLock" || opErr.Destination != 1 {
+		t.Errorf("WaitForLock() = %#v, want an *OpError for destination 1", err)
+	}
+	if err := m.WaitForLock(context.Background(), 3, true); !errors.Is(err, ErrDestinationOutOfRange) {
+		t.Errorf("WaitForLock() of destination 3 = %v, want ErrDestinationOutOfRange", err)
+	}
+}
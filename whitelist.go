@@ -0,0 +1,57 @@
+package magnumrouter
+
+import "fmt"
+
+// Restricts which sources may be routed to a destination by this client
+// This is client-side policy, the device itself is not restricted
+// An empty list removes the whitelist, leaving the destination unrestricted
+func (m *MagnumRouter) SetSourceWhitelist(destination uint, allowedSources []uint) error {
+	if err := m.checkDestination(destination); err != nil {
+		return err
+	}
+	for _, src := range allowedSources {
+		if err := m.checkSource(src); err != nil {
+			return err
+		}
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if len(allowedSources) == 0 {
+		delete(m.whitelists, destination)
+		return nil
+	}
+	allowed := map[uint]bool{}
+	for _, src := range allowedSources {
+		allowed[src] = true
+	}
+	m.whitelists[destination] = allowed
+	return nil
+}
+
+// Returns the sources whitelisted for a destination, or nil if unrestricted
+func (m *MagnumRouter) GetSourceWhitelist(destination uint) []uint {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	allowed, ok := m.whitelists[destination]
+	if !ok {
+		return nil
+	}
+	sources := []uint{}
+	for src := uint(0); src < uint(len(m.sourceNames)); src++ {
+		if allowed[src] {
+			sources = append(sources, src)
+		}
+	}
+	return sources
+}
+
+// Checks a source is allowed on a destination by its whitelist
+func (m *MagnumRouter) checkWhitelist(destination uint, source uint) error {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	allowed, ok := m.whitelists[destination]
+	if ok && !allowed[source] {
+		return fmt.Errorf("%w: source %d on destination %d", ErrSourceNotAllowed, source, destination)
+	}
+	return nil
+}
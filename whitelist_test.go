@@ -0,0 +1,57 @@
+package magnumrouter
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestSourceWhitelist(t *testing.T) {
+	m, conn := newScriptRouter(t, 4, 3, 1)
+	if err := m.SetSourceWhitelist(1, []uint{2, 3}); err != nil {
+		t.Fatalf("SetSourceWhitelist() = %v", err)
+	}
+	if got := m.GetSourceWhitelist(1); !reflect.DeepEqual(got, []uint{2, 3}) {
+		t.Errorf("GetSourceWhitelist() = %v, want [2 3]", got)
+	}
+
+	tests := []struct {
+		name string
+		dest uint
+		src  uint
+		want error
+	}{
+		{"allowed", 1, 2, nil},
+		{"disallowed", 1, 4, ErrSourceNotAllowed},
+		{"unrestricted", 2, 4, nil},
+	}
+	for _, tt := range tests {
+		if err := m.SetRoute([]uint{0}, tt.dest, tt.src); !errors.Is(err, tt.want) {
+			t.Errorf("%s: SetRoute() = %v, want %v", tt.name, err, tt.want)
+		}
+	}
+	if err := m.EnsureRoute(context.Background(), []uint{0}, 1, 1); !errors.Is(err, ErrSourceNotAllowed) {
+		t.Errorf("EnsureRoute() = %v, want ErrSourceNotAllowed", err)
+	}
+	for _, call := range conn.recorded() {
+		if strings.HasPrefix(call, "route") && (strings.HasSuffix(call, " 1 4") || strings.HasSuffix(call, " 1 1")) {
+			t.Errorf("sent disallowed %q", call)
+		}
+	}
+
+	// Clearing the whitelist leaves the destination unrestricted
+	if err := m.SetSourceWhitelist(1, nil); err != nil {
+		t.Fatal(err)
+	}
+	if err := m.SetRoute([]uint{0}, 1, 4); err != nil {
+		t.Errorf("SetRoute() after clearing = %v", err)
+	}
+	if got := m.GetSourceWhitelist(1); got != nil {
+		t.Errorf("GetSourceWhitelist() = %v, want nil", got)
+	}
+	if err := m.SetSourceWhitelist(1, []uint{5}); !errors.Is(err, ErrSourceOutOfRange) {
+		t.Errorf("SetSourceWhitelist() = %v, want ErrSourceOutOfRange", err)
+	}
+}